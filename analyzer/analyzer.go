@@ -4,10 +4,19 @@ import (
 	"fmt"
 	"mars/ast"
 	"mars/errors"
+	"mars/lexer"
 	"os"
+	"strings"
 )
 
+// debugEnabled turns on debugLog; set MARS_ANALYZER_DEBUG to trace scope
+// resolution into analyzer_debug.log in the working directory
+var debugEnabled = os.Getenv("MARS_ANALYZER_DEBUG") != ""
+
 func debugLog(msg string) {
+	if !debugEnabled {
+		return
+	}
 	f, err := os.OpenFile("analyzer_debug.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err == nil {
 		defer f.Close()
@@ -21,6 +30,8 @@ type Analyzer struct {
 	symbols         *SymbolTable
 	types           *TypeChecker
 	immutable       *ImmutabilityChecker
+	info            *TypeInfo
+	imports         map[string]bool // names of the imported modules
 	sourceCode      string
 	filename        string
 	currentFunction *ast.FuncDecl
@@ -35,6 +46,8 @@ func New(sourceCode, filename string) *Analyzer {
 		symbols:         NewSymbolTable(),
 		types:           NewTypeChecker(),
 		immutable:       NewImmutabilityChecker(),
+		info:            NewTypeInfo(),
+		imports:         make(map[string]bool),
 		sourceCode:      sourceCode,
 		filename:        filename,
 		currentFunction: nil,
@@ -45,6 +58,38 @@ func New(sourceCode, filename string) *Analyzer {
 
 // Analyze performs semantic analysis on the given AST
 func (a *Analyzer) Analyze(node ast.Node) error {
+	// Infer the types of x := [] declarations from their uses first, so
+	// the passes below see them
+	if program, ok := node.(*ast.Program); ok {
+		if err := a.InferTypes(program); err != nil {
+			return err
+		}
+	}
+
+	if err := a.TypeCheck(node); err != nil {
+		return err
+	}
+
+	if err := a.CheckImmutability(node); err != nil {
+		return err
+	}
+
+	if program, ok := node.(*ast.Program); ok {
+		if err := a.CheckControlFlow(program); err != nil {
+			return err
+		}
+		if err := a.CheckDataflow(program); err != nil {
+			return err
+		}
+		return a.CheckUnused(program)
+	}
+	return nil
+}
+
+// TypeCheck collects the declarations in node, then checks that every name
+// it uses is defined and that the types of its declarations, operands,
+// conditions, calls and struct literals match
+func (a *Analyzer) TypeCheck(node ast.Node) error {
 	// First pass: collect all declarations
 	if err := a.collectDeclarations(node); err != nil {
 		return err
@@ -55,16 +100,29 @@ func (a *Analyzer) Analyze(node ast.Node) error {
 		return fmt.Errorf("%s", a.errors.String())
 	}
 
-	// Second pass: type checking and immutability analysis
+	// Second pass: type checking
 	if err := a.CheckTypes(node); err != nil {
 		return err
 	}
+	if a.errors.HasErrors() {
+		return fmt.Errorf("%s", a.errors.String())
+	}
+	return nil
+}
 
-	if err := a.checkImmutability(node); err != nil {
-		return err
+// Warnings returns the warnings the checks that ran reported, formatted for
+// printing, or "" if there are none
+func (a *Analyzer) Warnings() string {
+	if !a.errors.HasWarnings() {
+		return ""
 	}
+	return a.errors.String()
+}
 
-	return nil
+// Diagnostics returns the errors and warnings the checks that ran
+// reported, in the order they were found
+func (a *Analyzer) Diagnostics() []errors.Diagnostic {
+	return a.errors.Diagnostics()
 }
 
 // Error represents a semantic analysis error
@@ -92,12 +150,21 @@ func (a *Analyzer) collectDeclarations(node ast.Node) error {
 	case *ast.VarDecl:
 		//collect variable declarations
 		return a.collectVariableDeclaration(n)
+	case *ast.ConstDecl:
+		//collect constant declarations
+		return a.collectConstDeclaration(n)
+	case *ast.ImportDecl:
+		//CheckImports checks the references into imported modules
+		a.imports[n.Name] = true
 	case *ast.FuncDecl:
 		//collect function declarations
 		return a.collectFunctionDeclaration(n)
 	case *ast.StructDecl:
 		//collect struct declarations
 		return a.collectStructDeclaration(n)
+	case *ast.TypeDecl:
+		//collect type declarations
+		return a.collectTypeDeclaration(n)
 	case *ast.UnsafeBlock:
 		//collect unsafe blocks
 		return a.collectUnsafeBlock(n)
@@ -147,15 +214,16 @@ func (a *Analyzer) collectDeclarations(node ast.Node) error {
 func (a *Analyzer) CheckVarDecl(decl *ast.VarDecl) error {
 	// DEBUG: Log variable being resolved and current scope pointer
 	debugLog(fmt.Sprintf("[DEBUG] Resolving variable '%s' in scope %p", decl.Name.Name, a.symbols.CurrentScope))
-	// Attempt to use an existing symbol if it was defined in pass 1.
-	// If not found (e.g., local variables inside function bodies), define it now in the current scope.
+	// Attempt to use the symbol pass 1 defined for this declaration.
+	// If not found (e.g., local variables inside function bodies, which may
+	// shadow an outer name), define it now in the current scope.
 	var declared ast.Type
-	if sym, err := a.symbols.Resolve(decl.Name.Name); err == nil {
+	if sym, err := a.symbols.Resolve(decl.Name.Name); err == nil && sym.DeclaredAt == ast.Node(decl) {
 		declared = sym.Type
 	} else {
 		// Determine declared type
-		if decl.Type != nil {
-			declared = *decl.Type
+		if t := writtenType(decl); t != nil {
+			declared = *t
 		} else if decl.Value != nil {
 			inferred := a.inferExpressionType(decl.Value)
 			if inferred != nil {
@@ -177,7 +245,7 @@ func (a *Analyzer) CheckVarDecl(decl *ast.VarDecl) error {
 			// Continue to allow more diagnostics
 		}
 	}
-	hasAnnot := decl.Type != nil
+	hasAnnot := writtenType(decl) != nil
 	hasInit := decl.Value != nil
 
 	// Check the initializer expression for errors (e.g., struct literal errors)
@@ -188,34 +256,38 @@ func (a *Analyzer) CheckVarDecl(decl *ast.VarDecl) error {
 	switch {
 	// 1) explicit type + initializer → check compatibility
 	case hasAnnot && hasInit:
-		actual := a.inferExpressionType(decl.Value)
-		if !a.types.typesCompatible(&declared, actual) {
-			help := fmt.Sprintf("cast the value to %s or change the variable's type", declared.BaseType)
+		actual := a.inferAs(decl.Value, &declared)
+		if !a.types.typesCompatible(&declared, actual) && !a.intLiteralFor(decl.Value, &declared) &&
+			!a.types.promotesToBig(&declared, actual) {
+			help := fmt.Sprintf("cast the value to %s or change the variable's type", typeName(&declared))
+			if a.types.isDistinct(&declared) || a.types.isDistinct(actual) {
+				help = fmt.Sprintf("convert the value explicitly, as in %s(value)", typeName(&declared))
+			}
 			a.errors.AddErrorWithHelp(
 				decl.Name.Position,
 				errors.ErrCodeTypeError,
-				fmt.Sprintf("mismatched types: expected %s, found %s", declared.BaseType, actual.BaseType),
+				fmt.Sprintf("mismatched types: expected %s, found %s", typeName(&declared), typeName(actual)),
 				help,
 			)
 		}
+		// A fixed-size array must be initialized with exactly its size
+		if lit, ok := decl.Value.(*ast.ArrayLiteral); ok {
+			if size := a.types.resolve(&declared).ArraySize; size != nil && len(lit.Elements) != *size {
+				a.errors.AddErrorWithHelp(
+					lit.Position,
+					errors.ErrCodeTypeError,
+					fmt.Sprintf("array length mismatch: %s holds %d elements, found %d", typeName(&declared), *size, len(lit.Elements)),
+					fmt.Sprintf("give the literal %d elements, or declare the variable without a value to start with zeros", *size),
+				)
+			}
+		}
 
-	// 2) explicit type only → nothing more to check
-	case hasAnnot:
+	// 2) explicit type only, or x := e, whose type InferTypes checks can
+	// be inferred → nothing more to check
+	case hasAnnot, hasInit:
 		// ok
 
-	// 3) initializer only (x := e) → infer
-	case hasInit:
-		actual := a.inferExpressionType(decl.Value)
-		if actual.BaseType == "unknown" {
-			a.errors.AddErrorWithHelp(
-				decl.Name.Position,
-				errors.ErrCodeTypeError,
-				fmt.Sprintf("cannot infer type for variable %q", decl.Name.Name),
-				fmt.Sprintf("variable may not exist, declare %s before using", decl.Name.Name),
-			)
-		}
-
-	// 4) neither → error
+	// 3) neither → error
 	default:
 		a.errors.AddErrorWithHelp(
 			decl.Name.Position,
@@ -231,8 +303,8 @@ func (a *Analyzer) collectVariableDeclaration(decl *ast.VarDecl) error {
 	// DEBUG: Log variable being defined and current scope pointer
 	debugLog(fmt.Sprintf("[DEBUG] Defining variable '%s' in scope %p", decl.Name.Name, a.symbols.CurrentScope))
 	var varType ast.Type
-	if decl.Type != nil {
-		varType = *decl.Type
+	if t := writtenType(decl); t != nil {
+		varType = *t
 	} else if decl.Value != nil {
 		inferredType := a.inferExpressionType(decl.Value)
 		if inferredType != nil {
@@ -265,9 +337,27 @@ func (a *Analyzer) collectVariableDeclaration(decl *ast.VarDecl) error {
 	return nil
 }
 
+// collectConstDeclaration defines a constant as an immutable symbol, typed
+// by its annotation or its value
+func (a *Analyzer) collectConstDeclaration(decl *ast.ConstDecl) error {
+	constType := decl.Type
+	if constType == nil {
+		constType = a.inferExpressionType(decl.Value)
+	}
+	if err := a.symbols.Define(decl.Name.Name, *constType, false, false, decl); err != nil {
+		a.errors.AddErrorWithHelp(
+			decl.Name.Position,
+			errors.ErrCodeDuplicateDecl,
+			fmt.Sprintf("constant '%s' is already defined in this scope", decl.Name.Name),
+			"give this constant a different name",
+		)
+	}
+	return nil
+}
+
 func (a *Analyzer) CheckLiteral(lit *ast.Literal) error {
 	// inferType accepts an Expression, so pass the nod e itself
-	inferred := a.types.inferType(lit)
+	inferred := a.types.literalType(lit)
 	if inferred.BaseType == "unknown" {
 		a.errors.AddError(
 			lit.Position,
@@ -388,6 +478,41 @@ func (a *Analyzer) collectStructDeclaration(decl *ast.StructDecl) error {
 	return nil
 }
 
+func (a *Analyzer) collectTypeDeclaration(decl *ast.TypeDecl) error {
+	if !a.types.declareType(decl) {
+		a.errors.AddErrorWithHelp(
+			decl.Name.Position,
+			errors.ErrCodeDuplicateDecl,
+			fmt.Sprintf("type '%s' is already defined", decl.Name.Name),
+			"give this type a different name",
+		)
+	}
+	return nil
+}
+
+// checkTypeDeclaration reports aliases that lead back to themselves, which
+// name no type at all
+func (a *Analyzer) checkTypeDeclaration(decl *ast.TypeDecl) error {
+	seen := map[*ast.TypeDecl]bool{decl: true}
+	for t := decl.Type; ; {
+		next := a.types.lookupType(t)
+		if next == nil {
+			return nil
+		}
+		if seen[next] {
+			a.errors.AddErrorWithHelp(
+				decl.Name.Position,
+				errors.ErrCodeInvalidType,
+				fmt.Sprintf("type '%s' is defined in terms of itself", decl.Name.Name),
+				"declare it with an existing type, such as type "+decl.Name.Name+" int;",
+			)
+			return nil
+		}
+		seen[next] = true
+		t = next.Type
+	}
+}
+
 func (a *Analyzer) collectUnsafeBlock(block *ast.UnsafeBlock) error {
 	if block.Body == nil {
 		return fmt.Errorf("unsafe block must have a body")
@@ -414,6 +539,14 @@ func (a *Analyzer) CheckTypes(node ast.Node) error {
 		return a.checkFunctionBody(n)
 	case *ast.VarDecl:
 		return a.CheckVarDecl(n)
+	case *ast.TypeDecl:
+		return a.checkTypeDeclaration(n)
+	case *ast.ConstDecl:
+		// Constants in function bodies weren't collected in the first pass
+		if _, err := a.symbols.Resolve(n.Name.Name); err != nil {
+			a.collectConstDeclaration(n)
+		}
+		return a.CheckTypes(n.Value)
 	case *ast.Literal:
 		return a.CheckLiteral(n)
 	case *ast.Identifier:
@@ -503,8 +636,9 @@ func (a *Analyzer) CheckTypes(node ast.Node) error {
 					"function has no return type but returns a value",
 				)
 			} else {
-				returnType := a.inferExpressionType(n.Value)
-				if !a.types.typesCompatible(sig.ReturnType, returnType) {
+				returnType := a.inferAs(n.Value, sig.ReturnType)
+				if !a.types.typesCompatible(sig.ReturnType, returnType) && !a.intLiteralFor(n.Value, sig.ReturnType) &&
+					!a.types.promotesToBig(sig.ReturnType, returnType) {
 					a.errors.AddError(
 						n.Position,
 						errors.ErrCodeTypeError,
@@ -521,6 +655,10 @@ func (a *Analyzer) CheckTypes(node ast.Node) error {
 		return a.CheckAssignment(n)
 
 	case *ast.ForStatement:
+		// The loop's own variables are scoped to it
+		a.symbols.EnterScope()
+		defer a.symbols.ExitScope()
+
 		// Enter loop context
 		prevLoopContext := a.inLoopContext
 		a.inLoopContext = true
@@ -560,6 +698,35 @@ func (a *Analyzer) CheckTypes(node ast.Node) error {
 			return a.CheckTypes(n.Expression)
 		}
 
+	case *ast.SpawnStatement:
+		return a.CheckTypes(n.Call)
+
+	case *ast.SelectStatement:
+		for _, c := range n.Cases {
+			if err := a.CheckTypes(c.Channel); err != nil {
+				return err
+			}
+			if c.Value != nil {
+				if err := a.CheckTypes(c.Value); err != nil {
+					return err
+				}
+			}
+			// A received value is bound in a scope around the case's body
+			a.symbols.EnterScope()
+			if c.Name != nil {
+				a.symbols.Define(c.Name.Name, *ast.NewBaseType("unknown"), false, false, c)
+			}
+			err := a.CheckTypes(c.Body)
+			a.symbols.ExitScope()
+			if err != nil {
+				return err
+			}
+		}
+		if n.Default != nil {
+			return a.CheckTypes(n.Default)
+		}
+		return nil
+
 	case *ast.BreakStatement:
 		if !a.inLoopContext {
 			a.errors.AddErrorWithHelp(
@@ -629,11 +796,20 @@ func (a *Analyzer) CheckTypes(node ast.Node) error {
 
 	case *ast.MemberExpression:
 		// Check struct field access
+		if a.isModule(n.Object) {
+			return nil
+		}
 		if err := a.CheckTypes(n.Object); err != nil {
 			return err
 		}
 		objectType := a.inferExpressionType(n.Object)
 
+		// Members of imported modules, and fields of structs declared in
+		// them, are checked by CheckImports; values of unknown type can't be
+		if a.isModule(n.Object) || isUnknown(objectType) || strings.Contains(objectType.StructName, ".") {
+			return nil
+		}
+
 		// Check if the object's type is a struct.
 		if objectType.StructName == "" { // If StructName is empty, it's not a struct type
 			a.errors.AddErrorWithHelp(
@@ -667,13 +843,17 @@ func (a *Analyzer) CheckTypes(node ast.Node) error {
 		}
 		// If the field was not found, report an error.
 		if foundField == nil { // The check is now safe and clear.
+			help := errors.DidYouMean(n.Property.Name, fieldNames(structSym.Type.StructFields))
+			if help == "" {
+				help = fmt.Sprintf("check the spelling or define '%s' in struct '%s'",
+					n.Property.Name, objectType.StructName)
+			}
 			a.errors.AddErrorWithHelp(
 				n.Property.Pos(),             // Point the error at the field name itself.
 				errors.ErrCodeUndefinedField, // Use a more specific error code.
 				fmt.Sprintf("field '%s' does not exist on type '%s'",
 					n.Property.Name, objectType.String()),
-				fmt.Sprintf("check the spelling or define '%s' in struct '%s'",
-					n.Property.Name, objectType.StructName),
+				help,
 			)
 			return nil
 		}
@@ -709,14 +889,46 @@ func (a *Analyzer) CheckTypes(node ast.Node) error {
 func (a *Analyzer) checkIdentifier(ident *ast.Identifier) error {
 	_, err := a.symbols.Resolve(ident.Name)
 	if err != nil {
-		a.errors.AddErrorWithHelp(ident.Position, errors.ErrCodeUndefinedVar, fmt.Sprintf("undefined  %q", ident.Name), "variable must be defined before use")
+		help := errors.DidYouMean(ident.Name, a.visibleNames())
+		if help == "" {
+			help = "variable must be defined before use"
+		}
+		a.errors.AddErrorWithHelp(ident.Position, errors.ErrCodeUndefinedVar, fmt.Sprintf("undefined %q", ident.Name), help)
 	}
 	return nil
 }
 
-// checkImmutability verifies immutability rules
-func (a *Analyzer) checkImmutability(node ast.Node) error {
-	// TODO: Implement immutability checking
+// visibleNames returns the names an identifier here could have meant: the
+// symbols in scope, the builtin functions and the keywords that are values
+func (a *Analyzer) visibleNames() []string {
+	names := a.symbols.Visible()
+	for name := range builtinResults {
+		names = append(names, name)
+	}
+	return append(names, lexer.ValueKeywords()...)
+}
+
+// fieldNames returns the names of a struct's fields
+func fieldNames(fields []*ast.FieldDecl) []string {
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, field.Name.Name)
+	}
+	return names
+}
+
+// CheckImmutability reports assignments to variables, parameters and
+// constants not declared mut, and writes to their elements and fields
+// (E0010)
+func (a *Analyzer) CheckImmutability(node ast.Node) error {
+	program, ok := node.(*ast.Program)
+	if !ok {
+		return nil
+	}
+	a.immutable.Check(program, a.errors)
+	if a.errors.HasErrors() {
+		return fmt.Errorf("%s", a.errors.String())
+	}
 	return nil
 }
 
@@ -728,20 +940,10 @@ func (a *Analyzer) CheckAssignment(stmt *ast.AssignmentStatement) error {
 		return err
 	}
 
-	// 2) if the symbol was declared immutable, error with fix-it
-	if !sym.IsMutable {
-		a.errors.AddErrorWithHelp(
-			stmt.Name.Position,
-			errors.ErrCodeImmutable,
-			fmt.Sprintf("cannot assign to immutable variable %q", stmt.Name.Name),
-			"add 'mut' to the declaration: e.g., 'mut "+stmt.Name.Name+" : <type> = ...' or 'mut "+stmt.Name.Name+" := ...'",
-		)
-		// still continue so we can report other errors
-	}
-
-	// 3) type‐check the right‐hand side
-	actual := a.inferExpressionType(stmt.Value)
-	if !a.types.typesCompatible(&sym.Type, actual) {
+	// 2) type‐check the right‐hand side
+	actual := a.inferAs(stmt.Value, &sym.Type)
+	if !a.types.typesCompatible(&sym.Type, actual) && !a.intLiteralFor(stmt.Value, &sym.Type) &&
+		!a.types.promotesToBig(&sym.Type, actual) {
 		a.errors.AddError(
 			stmt.Name.Position,
 			errors.ErrCodeTypeError,
@@ -759,11 +961,72 @@ func (a *Analyzer) checkBinaryExpression(expr *ast.BinaryExpression) error {
 		return err
 	}
 
+	// An optional may be compared with nil; CheckDataflow narrows it
+	if (expr.Operator == "==" || expr.Operator == "!=") &&
+		((isNilLiteral(expr.Right) && a.mayBeNil(expr.Left)) || (isNilLiteral(expr.Left) && a.mayBeNil(expr.Right))) {
+		return nil
+	}
+
 	leftType := a.inferExpressionType(expr.Left)
 	rightType := a.inferExpressionType(expr.Right)
+	// An operand whose type can't be seen, such as a module member, or
+	// an undefined name already reported, matches any operator
+	if isUnknown(leftType) || isUnknown(rightType) {
+		return nil
+	}
+	if a.types.isDistinct(leftType) || a.types.isDistinct(rightType) {
+		if !a.distinctOperandsMatch(expr, leftType, rightType) {
+			a.errors.AddErrorWithHelp(
+				expr.Position,
+				errors.ErrCodeTypeError,
+				fmt.Sprintf("invalid operation: %s %s %s (mismatched types)",
+					typeName(leftType), expr.Operator, typeName(rightType)),
+				"convert one of the operands explicitly, as in "+typeName(leftType)+"(value)",
+			)
+			return nil
+		}
+		// Operators apply to distinct types as to their representation
+		leftType, rightType = a.types.underlying(leftType), a.types.underlying(rightType)
+	}
+	if (isSizedInt(leftType) || isSizedInt(rightType)) && !a.sizedOperandsMatch(expr, leftType, rightType) {
+		a.errors.AddErrorWithHelp(
+			expr.Position,
+			errors.ErrCodeTypeError,
+			fmt.Sprintf("invalid operation: %s %s %s (mismatched types)",
+				typeName(leftType), expr.Operator, typeName(rightType)),
+			"convert one of the operands explicitly, as in "+typeName(leftType)+"(value)",
+		)
+		return nil
+	}
+	if isBigInt(leftType) || isBigInt(rightType) {
+		// An int operand is promoted; other types need a conversion
+		if !bigOperand(leftType) || !bigOperand(rightType) {
+			a.errors.AddErrorWithHelp(
+				expr.Position,
+				errors.ErrCodeTypeError,
+				fmt.Sprintf("invalid operation: %s %s %s (mismatched types)",
+					typeName(leftType), expr.Operator, typeName(rightType)),
+				"convert the other operand explicitly, as in bigint(value)",
+			)
+			return nil
+		}
+		leftType, rightType = &ast.Type{BaseType: "bigint"}, &ast.Type{BaseType: "bigint"}
+	}
 	switch expr.Operator {
+	case "&", "|", "^", "<<", ">>":
+		if !isIntegerType(leftType) || !isIntegerType(rightType) {
+			a.errors.AddError(
+				expr.Position,
+				errors.ErrCodeTypeError,
+				fmt.Sprintf("invalid operation: %s %s %s (operator %s not defined on %s)",
+					typeName(leftType), expr.Operator, typeName(rightType),
+					expr.Operator, typeName(leftType)),
+			)
+		}
 	case "+", "-", "*", "/", "%":
-		if !isNumericType(leftType) || !isNumericType(rightType) {
+		// + also concatenates strings
+		concat := expr.Operator == "+" && leftType.BaseType == "string" && rightType.BaseType == "string"
+		if !concat && (!isNumericType(leftType) || !isNumericType(rightType)) {
 			a.errors.AddError(
 				expr.Position,
 				errors.ErrCodeTypeError,
@@ -816,10 +1079,169 @@ func (a *Analyzer) checkBinaryExpression(expr *ast.BinaryExpression) error {
 	return nil
 }
 
-func (a *Analyzer) checkFunctionCall(call *ast.FunctionCall) error {
-	if err := a.CheckTypes(call.Function); err != nil {
+// mayBeNil reports whether expr is a variable of an optional type or a
+// call to a function returning one
+func (a *Analyzer) mayBeNil(expr ast.Expression) bool {
+	if a.isRecv(expr) {
+		return true
+	}
+	var name string
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		name = e.Name
+	case *ast.FunctionCall:
+		if ident, ok := e.Function.(*ast.Identifier); ok {
+			name = ident.Name
+		}
+	}
+	symbol, err := a.symbols.Resolve(name)
+	if err != nil {
+		return false
+	}
+	// x := f() may be nil when f returns ?T, or is recv, which returns nil
+	// once its channel is closed and drained
+	if decl, ok := symbol.DeclaredAt.(*ast.VarDecl); ok && writtenType(decl) == nil {
+		if call, ok := decl.Value.(*ast.FunctionCall); ok {
+			return a.mayBeNil(call)
+		}
+	}
+	if symbol.IsFunction {
+		sig := symbol.Type.GetFunctionSignature()
+		return sig != nil && a.types.isOptional(sig.ReturnType)
+	}
+	return a.types.isOptional(&symbol.Type)
+}
+
+// bigOperand reports whether a value of type t can be an operand of a
+// bigint operator: a bigint, or an int that is promoted
+// isRecv reports whether expr calls the recv builtin
+func (a *Analyzer) isRecv(expr ast.Expression) bool {
+	call, ok := expr.(*ast.FunctionCall)
+	if !ok {
+		return false
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Name == "recv" && a.isBuiltin("recv")
+}
+
+func bigOperand(t *ast.Type) bool {
+	return t.BaseType == "bigint" || t.BaseType == "int"
+}
+
+// distinctOperandsMatch reports whether the operands of expr, one of which
+// has a distinct type, can be combined: both have the same type, or one is
+// a literal, which takes the other's type
+func (a *Analyzer) distinctOperandsMatch(expr *ast.BinaryExpression, leftType, rightType *ast.Type) bool {
+	if a.types.typesCompatible(leftType, rightType) {
+		return true
+	}
+	_, leftLiteral := expr.Left.(*ast.Literal)
+	_, rightLiteral := expr.Right.(*ast.Literal)
+	if leftLiteral {
+		underlying := a.types.underlying(rightType)
+		return a.types.typesCompatible(underlying, leftType) || a.intLiteralFor(expr.Left, underlying)
+	}
+	if rightLiteral {
+		underlying := a.types.underlying(leftType)
+		return a.types.typesCompatible(underlying, rightType) || a.intLiteralFor(expr.Right, underlying)
+	}
+	return false
+}
+
+// sizedOperandsMatch reports whether the operands of expr, one of which
+// has a sized integer type, can be combined: both have the same type, or
+// one is an int literal the other's type can hold. A shift count may have
+// any integer type.
+func (a *Analyzer) sizedOperandsMatch(expr *ast.BinaryExpression, leftType, rightType *ast.Type) bool {
+	if expr.Operator == "<<" || expr.Operator == ">>" {
+		return isIntegerType(leftType) && isIntegerType(rightType)
+	}
+	if leftType.BaseType == rightType.BaseType {
+		return true
+	}
+	return a.intLiteralFor(expr.Left, rightType) || a.intLiteralFor(expr.Right, leftType)
+}
+
+// intLiteralFor reports whether expr is an int literal, possibly negated,
+// used where the sized integer type target is expected. Like a constant in
+// Go it takes that type, and is reported if the type can't hold it.
+func (a *Analyzer) intLiteralFor(expr ast.Expression, target *ast.Type) bool {
+	target = a.types.resolve(target)
+	typ, sized := ast.LookupIntType(target.BaseType)
+	if !sized {
+		return false
+	}
+	negated := false
+	if unary, ok := expr.(*ast.UnaryExpression); ok && unary.Operator == "-" {
+		expr, negated = unary.Right, true
+	}
+	lit, ok := expr.(*ast.Literal)
+	if !ok {
+		return false
+	}
+	value, ok := lit.Value.(int)
+	if !ok {
+		return false
+	}
+	if negated {
+		value = -value
+	}
+	if !typ.Fits(int64(value)) {
+		a.errors.AddErrorWithHelp(
+			lit.Position,
+			errors.ErrCodeTypeError,
+			fmt.Sprintf("constant %d overflows %s", value, typ.Name),
+			fmt.Sprintf("%s holds values that fit in %d bits", typ.Name, typ.Bits),
+		)
+	}
+	return true
+}
+
+// checkConversion verifies a conversion T(x): x's representation must be
+// T's, or both must be numeric. Integers also convert to strings, and
+// strings to bigints.
+func (a *Analyzer) checkConversion(call *ast.FunctionCall, target *ast.Type) error {
+	if len(call.Arguments) != 1 {
+		a.errors.AddErrorWithHelp(
+			call.Position,
+			errors.ErrCodeFunctionCallError,
+			fmt.Sprintf("conversion to %s takes one value, got %d", typeName(target), len(call.Arguments)),
+			fmt.Sprintf("write %s(value)", typeName(target)),
+		)
+		return nil
+	}
+	if err := a.CheckTypes(call.Arguments[0]); err != nil {
 		return err
 	}
+	from := a.types.underlying(a.inferExpressionType(call.Arguments[0]))
+	to := a.types.underlying(target)
+	if from.BaseType == "unknown" || a.types.typesCompatible(from, to) || (isNumericType(from) && isNumericType(to)) {
+		return nil
+	}
+	if (isIntegerType(from) && to.BaseType == "string") || (from.BaseType == "string" && isBigInt(to)) {
+		return nil
+	}
+	a.errors.AddError(
+		call.Position,
+		errors.ErrCodeTypeError,
+		fmt.Sprintf("cannot convert %s to %s", typeName(a.inferExpressionType(call.Arguments[0])), typeName(target)),
+	)
+	return nil
+}
+
+func (a *Analyzer) checkFunctionCall(call *ast.FunctionCall) error {
+	if target := a.types.conversionTarget(call); target != nil {
+		return a.checkConversion(call, target)
+	}
+
+	ident, ok := call.Function.(*ast.Identifier)
+	// Builtins take values of several types; inference gives their results
+	builtin := ok && a.isBuiltin(ident.Name)
+	if !builtin {
+		if err := a.CheckTypes(call.Function); err != nil {
+			return err
+		}
+	}
 
 	for _, arg := range call.Arguments {
 		if err := a.CheckTypes(arg); err != nil {
@@ -827,18 +1249,23 @@ func (a *Analyzer) checkFunctionCall(call *ast.FunctionCall) error {
 		}
 	}
 
-	ident, ok := call.Function.(*ast.Identifier)
-	if !ok {
+	if !ok || builtin {
 		// TODO: Handle method calls, function expressions
 		return nil
 	}
 
 	sym, err := a.symbols.Resolve(ident.Name)
 	if err != nil {
-		return err
+		// checkIdentifier has reported it, with a suggestion
+		return nil
 	}
 
-	if !sym.IsFunction {
+	// A variable may hold a function, as in f := add; one whose type can't
+	// be seen may too
+	if !sym.IsFunction && !sym.Type.IsFunctionType() {
+		if isUnknown(&sym.Type) {
+			return nil
+		}
 		a.errors.AddError(
 			call.Position,
 			errors.ErrCodeTypeError,
@@ -866,25 +1293,55 @@ func (a *Analyzer) checkFunctionCall(call *ast.FunctionCall) error {
 
 	//chack argument types
 	for i, arg := range call.Arguments {
-		argType := a.inferExpressionType(arg)
 		paramType := funcSig.Parameters[i].Type
+		argType := a.inferAs(arg, paramType)
 
-		if !a.types.typesCompatible(paramType, argType) {
+		if !a.types.typesCompatible(paramType, argType) && !a.intLiteralFor(arg, paramType) &&
+			!a.types.promotesToBig(paramType, argType) {
 			paramName := funcSig.Parameters[i].Name.Name
 			a.errors.AddErrorWithHelp(
 				arg.Pos(),
 				errors.ErrCodeTypeError,
 				fmt.Sprintf("cannot use '%s' as type '%s' in argument to '%s'",
-					argType.String(), paramType.String(), ident.Name),
+					typeName(argType), typeName(paramType), ident.Name),
 				fmt.Sprintf("parameter '%s' expects type '%s'",
-					paramName, paramType.String()),
+					paramName, typeName(paramType)),
 			)
 		}
 	}
 	return nil
 }
 
+// isBuiltin reports whether name calls a builtin function: it is one, and
+// no declaration of the program shadows it
+// isModule reports whether expr names an imported module that no local
+// declaration shadows
+func (a *Analyzer) isModule(expr ast.Expression) bool {
+	ident, ok := expr.(*ast.Identifier)
+	if !ok || !a.imports[ident.Name] {
+		return false
+	}
+	_, err := a.symbols.Resolve(ident.Name)
+	return err != nil
+}
+
+func (a *Analyzer) isBuiltin(name string) bool {
+	_, builtin := builtinResults[name]
+	_, err := a.symbols.Resolve(name)
+	return builtin && err != nil
+}
+
 func (a *Analyzer) checkStructLiteral(lit *ast.StructLiteral) error {
+	// CheckImports checks the fields of another module's struct
+	if lit.Module != nil {
+		for _, init := range lit.Fields {
+			if err := a.CheckTypes(init.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	// 1) Resolve the struct's type symbol.
 	sym, err := a.symbols.Resolve(lit.Type.Name)
 	if err != nil {
@@ -925,15 +1382,16 @@ func (a *Analyzer) checkStructLiteral(lit *ast.StructLiteral) error {
 
 		expected, ok := declared[name]
 		if !ok {
-			a.errors.AddError(init.Position,
+			a.errors.AddErrorWithHelp(init.Position,
 				errors.ErrCodeUndefinedField,
 				fmt.Sprintf("field %q does not exist on %s", name, lit.Type.Name),
+				errors.DidYouMean(name, fieldNames(sym.Type.StructFields)),
 			)
 			continue
 		}
 
 		// 3) Type-check the initializer expression.
-		actual := a.inferExpressionType(init.Value)
+		actual := a.inferAs(init.Value, expected)
 		if !a.types.typesCompatible(expected, actual) {
 			a.errors.AddErrorWithHelp(
 				init.Value.Pos(),
@@ -950,94 +1408,17 @@ func (a *Analyzer) checkStructLiteral(lit *ast.StructLiteral) error {
 	return nil
 }
 
+// inferExpressionType returns the type of expr in the current scope,
+// recording it in the analyzer's TypeInfo
 func (a *Analyzer) inferExpressionType(expr ast.Expression) *ast.Type {
-	if expr == nil {
-		return &ast.Type{BaseType: "unknown"}
-	}
-
-	switch e := expr.(type) {
-	case *ast.Literal:
-		return a.types.inferType(expr)
-
-	case *ast.Identifier:
-		symbol, err := a.symbols.Resolve(e.Name)
-		if err != nil {
-			return &ast.Type{BaseType: "unknown"}
-		}
-		return &symbol.Type
-
-	case *ast.FunctionCall:
-		// Get return type of the function
-		if ident, ok := e.Function.(*ast.Identifier); ok {
-			symbol, err := a.symbols.Resolve(ident.Name)
-			if err == nil && symbol.IsFunction {
-				sig := symbol.Type.GetFunctionSignature()
-				if sig != nil && sig.ReturnType != nil {
-					return sig.ReturnType
-				}
-			}
-		}
-		return &ast.Type{BaseType: "void"} // No return type
-
-	case *ast.BinaryExpression:
-		leftType := a.inferExpressionType(e.Left)
-		rightType := a.inferExpressionType(e.Right)
-
-		switch e.Operator {
-		case "+", "-", "*", "/", "%":
-			// Arithmetic operators
-			if leftType.BaseType == "float" || rightType.BaseType == "float" {
-				return &ast.Type{BaseType: "float"}
-			}
-			// Both operands are integers
-			if leftType.BaseType == "int" && rightType.BaseType == "int" {
-				return &ast.Type{BaseType: "int"}
-			}
-			// If we get here, one or both operands are not numeric
-			return &ast.Type{BaseType: "unknown"}
-
-		case "==", "!=", "<", ">", "<=", ">=":
-			// Comparison operators
-			return &ast.Type{BaseType: "bool"}
-
-		case "&&", "||":
-			// Logical operators
-			return &ast.Type{BaseType: "bool"}
-
-		default:
-			return &ast.Type{BaseType: "unknown"}
-		}
-
-	case *ast.UnaryExpression:
-		switch e.Operator {
-		case "!":
-			return &ast.Type{BaseType: "bool"}
-		case "-":
-			return a.inferExpressionType(e.Right)
-		default:
-			return &ast.Type{BaseType: "unknown"}
-		}
-
-	case *ast.ArrayLiteral:
-		// Infer array type from first element
-		if len(e.Elements) > 0 {
-			elemType := a.inferExpressionType(e.Elements[0])
-			return &ast.Type{
-				ArrayType: elemType,
-				// ArraySize could be set to len(e.Elements) for fixed arrays
-			}
-		}
-		return &ast.Type{BaseType: "unknown"}
-
-	case *ast.StructLiteral:
-		// For struct literals, return the struct type
-		return &ast.Type{
-			StructName: e.Type.Name,
-		}
+	return a.inferAs(expr, nil)
+}
 
-	default:
-		return &ast.Type{BaseType: "unknown"}
-	}
+// inferAs is inferExpressionType for expr used where a value of type
+// expected is wanted, which gives an empty array literal its type
+func (a *Analyzer) inferAs(expr ast.Expression, expected *ast.Type) *ast.Type {
+	in := &inferrer{symbols: a.symbols, types: a.types, info: a.info}
+	return in.inferAs(expr, expected)
 }
 
 func isBool(t *ast.Type) bool {
@@ -1046,7 +1427,7 @@ func isBool(t *ast.Type) bool {
 
 // Helper functions
 func isNumericType(t *ast.Type) bool {
-	return t.BaseType == "int" || t.BaseType == "float"
+	return isIntegerType(t) || t.BaseType == "float"
 }
 
 func isOrderedType(t *ast.Type) bool {
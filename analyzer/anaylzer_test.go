@@ -3,6 +3,7 @@ package analyzer
 import (
 	"fmt"
 	"mars/ast"
+	"mars/errors"
 	"mars/lexer"
 	"mars/parser"
 	"strings"
@@ -232,6 +233,108 @@ func TestVariableDeclarations(t *testing.T) {
 		{"redeclaration in same scope", "var x: int; var x: string;", "variable 'x' is already defined"},
 		{"declaration without type or initializer", "mut x;", "expected ':' or ':=' in variable declaration"},
 		{"inference failure from undeclared var", "x := y;", "undefined"},
+		{"sized array of the right length", "xs: [3]int = [1, 2, 3];", ""},
+		{"sized array length mismatch", "xs: [21]int = [0];", "array length mismatch: [21]int holds 21 elements, found 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errStr := testAnalyze(tt.code)
+			if tt.errorMsg != "" {
+				assertErrorContains(t, errStr, tt.errorMsg)
+			} else {
+				assertNoError(t, errStr)
+			}
+		})
+	}
+}
+
+func TestNamedTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		errorMsg string
+	}{
+		{"alias is interchangeable", "type UserId = int; id: UserId = 7; n: int = id + 1;", ""},
+		{"alias of alias", "type A = int; type B = A; b: B = 1; n: int = b;", ""},
+		{"distinct type needs conversion", "type Meters int; d: Meters = 5;", "mismatched types: expected Meters, found int"},
+		{"conversion to distinct type", "type Meters int; d: Meters = Meters(5); n: int = int(d);", ""},
+		{"distinct to its representation", "type Meters int; d: Meters = Meters(5); n: int = d;", "convert the value explicitly, as in int(value)"},
+		{"arithmetic keeps the type", "type Meters int; d: Meters = Meters(5) + Meters(1); e: Meters = d * 2;", ""},
+		{"mixing distinct types", "type Meters int; type Feet int; d := Meters(1) + Feet(2);", "invalid operation: Meters + Feet (mismatched types)"},
+		{"mixing with a variable", "type Meters int; n := 3; d := Meters(1) + n;", "invalid operation: Meters + int (mismatched types)"},
+		{"numeric conversion", "type Celsius float; c: Celsius = Celsius(20); f: float = float(c) * 1.8;", ""},
+		{"invalid conversion", "type Meters int; d := Meters(\"far\");", "cannot convert string to Meters"},
+		{"conversion arity", "type Meters int; d := Meters(1, 2);", "conversion to Meters takes one value, got 2"},
+		{"duplicate type", "type Meters int; type Meters float;", "type 'Meters' is already defined"},
+		{"alias cycle", "type A = B; type B = A;", "type 'A' is defined in terms of itself"},
+		{"distinct parameter", "type Meters int; func f(d: Meters) -> Meters { return d; } x := f(3);", "cannot use 'int' as type 'Meters'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errStr := testAnalyze(tt.code)
+			if tt.errorMsg != "" {
+				assertErrorContains(t, errStr, tt.errorMsg)
+			} else {
+				assertNoError(t, errStr)
+			}
+		})
+	}
+}
+
+func TestSizedIntegers(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		errorMsg string
+	}{
+		{"literal takes the sized type", "x: u8 = 255; y: i8 = -128; z: u8 = x + 1;", ""},
+		{"literal overflows", "x: u8 = 256;", "constant 256 overflows u8"},
+		{"negative unsigned", "x: u32 = -1;", "constant -1 overflows u32"},
+		{"byte is u8", "b: byte = 7; u: u8 = b;", ""},
+		{"mixing sized types", "a: u8 = 1; b: u16 = 2; c := a + b;", "invalid operation: u8 + u16 (mismatched types)"},
+		{"mixing with int variable", "a: u8 = 1; n := 2; c := a + n;", "invalid operation: u8 + int (mismatched types)"},
+		{"sized to int needs conversion", "a: u8 = 1; n: int = a;", "mismatched types: expected int, found u8"},
+		{"conversions", "a: u8 = u8(300); n: int = int(a) + 1; f: float = float(a);", ""},
+		{"bitwise on ints", "n := 6; m: int = n & 3 | 1 ^ n << 2 >> 1; k: int = ^n;", ""},
+		{"bitwise on floats", "f := 1.5; g := f & 1;", "operator & not defined on float"},
+		{"shift keeps the shifted type", "a: u32 = 1; n := 3; b: u32 = a << n;", ""},
+		{"sized argument", "func f(x: u16) -> u16 { return x; } y: u16 = f(65535);", ""},
+		{"sized argument overflow", "func f(x: u16) -> u16 { return x; } y: u16 = f(65536);", "constant 65536 overflows u16"},
+		{"distinct sized type", "type Flags u8; f: Flags = Flags(1); g: Flags = f | 4;", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errStr := testAnalyze(tt.code)
+			if tt.errorMsg != "" {
+				assertErrorContains(t, errStr, tt.errorMsg)
+			} else {
+				assertNoError(t, errStr)
+			}
+		})
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		errorMsg string
+	}{
+		{"large literal", "x: bigint = 100000000000000000000; y: bigint = x * x;", ""},
+		{"int promotes", "n := 3; x: bigint = n; mut y: bigint = 1; y = y * n + 1;", ""},
+		{"int argument", "func f(x: bigint) -> bigint { return x + 1; } y: bigint = f(41);", ""},
+		{"int result", "func f() -> bigint { return 1; }", ""},
+		{"bigint to int needs conversion", "x: bigint = 1; n: int = x;", "mismatched types: expected int, found bigint"},
+		{"comparison", "x: bigint = 1; b: bool = x < 2 && x == 1;", ""},
+		{"bitwise", "x: bigint = 6; y: bigint = x & 3 | x << 70;", ""},
+		{"mixing with float", "x: bigint = 1; y := x + 0.5;", "invalid operation: bigint + float (mismatched types)"},
+		{"mixing with sized int", "x: bigint = 1; a: u8 = 1; y := x + a;", "mismatched types"},
+		{"conversions", "x: bigint = bigint(\"12345678901234567890123\"); n: int = int(x); s: string = string(x); f: float = float(x);", ""},
+		{"int to string", "s: string = string(42);", ""},
+		{"bool to bigint", "x := bigint(true);", "cannot convert bool to bigint"},
 	}
 
 	for _, tt := range tests {
@@ -311,7 +414,7 @@ func TestFunctionCalls(t *testing.T) {
 		{"wrong number of arguments (too many)", "func foo() {} foo(1);", "wrong number of arguments"},
 		{"wrong argument type", "func foo(a: int) {} foo(\"hello\");", "cannot use 'string' as type 'int'"},
 		{"calling a non-function", "x := 10; x();", "'x' is not a function"},
-		{"calling an undefined function", "foo();", "undefined symbol 'foo'"},
+		{"calling an undefined function", "foo();", `undefined "foo"`},
 		{"valid mutual recursion", "func a() { b(); } func b() { a(); } a();", ""},
 	}
 
@@ -354,6 +457,101 @@ func TestStructLiterals(t *testing.T) {
 	}
 }
 
+func TestInferredTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		errorMsg string
+	}{
+		{"call result", "func f() -> int { return 1; } x := f(); y: int = x;", ""},
+		{"index and slice", "xs := [[1, 2], [3]]; n: int = xs[0][1]; ys: []int = xs[1][0:1]; s: string = \"ab\"[0];", ""},
+		{"field", "struct P { xs: []int; } p := P{xs: [1]}; n: int = p.xs[0];", ""},
+		{"builtins", "mut xs := [1.5]; n: int = len(xs); f: float = pop(xs); b: bool = isInt(n);", ""},
+		{"empty array from its type", "xs: []int = []; func f(ys: []string) -> []string { return []; }", ""},
+		{"empty array from a later use", "mut xs := []; push(xs, 1); n: int = xs[0];", ""},
+		{"index mismatch", "xs := [1]; s: string = xs[0];", "mismatched types: expected string, found int"},
+		{"element mismatch", "xs: []string = [1];", "mismatched types: expected []string, found []int"},
+		{"empty array without a use", "xs := [];", "cannot infer the type of 'xs' from an empty array"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errStr := testAnalyze(tt.code)
+			if tt.errorMsg != "" {
+				assertErrorContains(t, errStr, tt.errorMsg)
+			} else {
+				assertNoError(t, errStr)
+			}
+		})
+	}
+}
+
+func TestInferTypes(t *testing.T) {
+	code := `struct P { pos: []float; name: string; }
+type Id = int;
+func first(xs: []Id) -> Id { return xs[0]; }
+func main() {
+    p := P{pos: [1.0, 2.0], name: "p"};
+    mut ids := [];
+    push(ids, 7);
+    grid := [[], [1, 2]];
+    ch := chan[string](1);
+    log(p.pos[1:]);
+    log(first(ids));
+    log(len(p.name) + 1);
+    log(recv(ch));
+    log(grid[0]);
+    log(ids);
+    log(mod.f());
+}`
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"p", "P"},
+		{"p.pos", "[]float"},
+		{"p.pos[1:]", "[]float"},
+		{"first(ids)", "int"},
+		{"len(p.name)", "int"},
+		{"recv(ch)", "string"},
+		{"grid[0]", "[]int"},
+		{"ids", "[]int"},
+		{"mod.f()", "unknown"},
+	}
+
+	p := parser.NewParser(lexer.New(code))
+	program := p.ParseProgram()
+	if len(p.GetErrors().Errors()) > 0 {
+		t.Fatalf("parser error: %s", p.GetErrors().Error())
+	}
+	a := New(code, "test.mars")
+	if err := a.InferTypes(program); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The last use of each expression, as the log calls come last
+	found := map[string]ast.Expression{}
+	ast.Inspect(program, func(n ast.Node) bool {
+		if expr, ok := n.(ast.Expression); ok {
+			found[expr.String()] = expr
+			if a.TypeInfo().TypeOf(expr) == nil {
+				t.Errorf("no type recorded for %s", expr)
+			}
+		}
+		return true
+	})
+	for _, tt := range tests {
+		expr, ok := found[tt.expr]
+		if !ok {
+			t.Errorf("expression %s not found", tt.expr)
+			continue
+		}
+		if got := typeName(a.TypeInfo().TypeOf(expr)); got != tt.want {
+			t.Errorf("type of %s: expected %s, got %s", tt.expr, tt.want, got)
+		}
+	}
+}
+
 func TestBreakContinueValidation(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -422,3 +620,582 @@ func TestBreakContinueValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestControlFlow(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		errorMsg string // error expected from Analyze
+		warning  string // warning expected, if no error is
+	}{
+		{"returns at end", "func f() -> int { return 1; }", "", ""},
+		{"missing return", "func f(x: int) -> int { if x > 0 { return 1; } }", "missing return at end of function 'f'", ""},
+		{"if and else return", "func f(x: int) -> int { if x > 0 { return 1; } else { return 2; } }", "", ""},
+		{"else if without else", "func f(x: int) -> int { if x > 0 { return 1; } else { if x < 0 { return -1; } } }", "missing return", ""},
+		{"no return type", "func f(x: int) { if x > 0 { return; } }", "", ""},
+		{"loop may not run", "func f(n: int) -> int { for mut i := 0; i < n; i = i + 1 { return i; } }", "missing return", ""},
+		{"infinite loop", "func f() -> int { for { } }", "", ""},
+		{"while true returns", "func f() -> int { mut i := 0; while true { i = i + 1; if i > 3 { return i; } } }", "", ""},
+		{"break leaves infinite loop", "func f() -> int { while true { break; } }", "missing return", ""},
+		{"select returns in every case", "func f(c: chan[int]) -> int { select { case recv(c) { return 1; } default { return 0; } } }", "", ""},
+		{"code after return", "func f() -> int { return 1; log(2); }", "", "unreachable code"},
+		{"code after break", "func f() { for { break; log(1); } }", "", "unreachable code"},
+		{"code after continue", "func f(n: int) { mut i := 0; while i < n { i = i + 1; continue; log(i); } }", "", "unreachable code"},
+		{"code after infinite loop", "func f() { for { } log(1); }", "", "unreachable code"},
+		{"code after returning if", "func f(x: int) -> int { if x > 0 { return 1; } else { return 2; } log(x); }", "", "unreachable code"},
+		{"code after loop with break", "func f() { for { break; } log(1); }", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.NewParser(lexer.New(tt.code))
+			program := p.ParseProgram()
+			if len(p.GetErrors().Errors()) > 0 {
+				t.Fatalf("parser error: %s", p.GetErrors().Error())
+			}
+			a := New(tt.code, "test.mars")
+			errStr := ""
+			if err := a.Analyze(program); err != nil {
+				errStr = err.Error()
+			}
+			if tt.errorMsg != "" {
+				assertErrorContains(t, errStr, tt.errorMsg)
+				return
+			}
+			assertNoError(t, errStr)
+			warnings := a.Warnings()
+			if tt.warning == "" && strings.Contains(warnings, errors.WarnCodeUnreachable) {
+				t.Errorf("unexpected warning: %s", warnings)
+			}
+			if tt.warning != "" && !strings.Contains(warnings, tt.warning) {
+				t.Errorf("expected warning containing %q, got %q", tt.warning, warnings)
+			}
+		})
+	}
+}
+
+func TestUnused(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		warnings []string // expected warnings, in order
+	}{
+		{"all used", "func add(a: int, b: int) -> int { return a + b; } func main() { x := add(1, 2); log(x); }", nil},
+		{"unused local", "func main() { x := 1; y := 2; log(y); }", []string{"unused variable 'x'"}},
+		{"assigned but never read", "func main() { mut x := 1; x = 2; }", []string{"unused variable 'x'"}},
+		{"unused parameter", "func f(a: int, b: int) -> int { return a; } func main() { log(f(1, 2)); }", []string{"unused parameter 'b'"}},
+		{"discards", "func f(_: int, _: int) -> int { return 1; } func main() { _ := f(1, 2); }", nil},
+		{"unused function", "func helper() {} func main() {}", []string{"unused function 'helper'"}},
+		{"recursion alone isn't a use", "func loop(n: int) -> int { return loop(n - 1); } func main() {}", []string{"unused function 'loop'"}},
+		{"pub and test functions", "pub func helper() {} func test_helper() {} func main() {}", nil},
+		{"unused struct", "struct P { x: int; } func main() {}", []string{"unused struct 'P'"}},
+		{"struct used in annotation", "struct P { x: int; } func f(p: P) -> int { return p.x; } func main() { log(f(P{x: 1})); }", nil},
+		{"field name isn't a use", "struct P { x: int; } func main() { x := 1; p := P{x: 2}; log(p.x); }", []string{"unused variable 'x'"}},
+		{"shadowed in a block", "func main() { x := 1; if true { x := 2; log(x); } }", []string{"unused variable 'x'"}},
+		{"loop variable", "func main() { for mut i := 0; i < 3; i = i + 1 { y := i; } }", []string{"unused variable 'y'"}},
+		{"select binding", "func main() { c := chan[int](1); send(c, 1); select { case v := recv(c) { log(1); } } }", []string{"unused variable 'v'"}},
+		{"top-level variables", "x := 1; func main() {}", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.NewParser(lexer.New(tt.code))
+			program := p.ParseProgram()
+			if len(p.GetErrors().Errors()) > 0 {
+				t.Fatalf("parser error: %s", p.GetErrors().Error())
+			}
+			a := New(tt.code, "test.mars")
+			if err := a.CheckUnused(program); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			warnings := a.Warnings()
+			if len(tt.warnings) == 0 && warnings != "" {
+				t.Errorf("unexpected warnings: %s", warnings)
+			}
+			rest := warnings
+			for _, want := range tt.warnings {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Errorf("expected warning %q in order, got %q", want, warnings)
+					break
+				}
+				rest = rest[i+len(want):]
+			}
+			if got := strings.Count(warnings, "W0001"); got != len(tt.warnings) {
+				t.Errorf("expected %d warnings, got %d: %s", len(tt.warnings), got, warnings)
+			}
+		})
+	}
+}
+
+func TestDataflow(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		errors []string // expected errors, in order
+	}{
+		{"assigned on every path", "func main() { mut x: int; if true { x = 1; } else { x = 2; } log(x); }", nil},
+		{"assigned on one path", "func main() { mut x: int; if true { x = 1; } log(x); }", []string{"'x' is used before it is assigned"}},
+		{"never assigned", "func main() { x: int; log(x + 1); }", []string{"'x' is used before it is assigned"}},
+		{"sized array starts with zeros", "const N = 4; func main() { mut dp: [N]int; dp[0] = 1; log(dp[1]); }", nil},
+		{"slice is not assigned", "func main() { xs: []int; log(xs); }", []string{"'xs' is used before it is assigned"}},
+		{"assigned in a loop body", "func main() { mut x: int; mut i := 0; while i < 3 { x = i; i = i + 1; } log(x); }", []string{"'x' is used before it is assigned"}},
+		{"assigned before break", "func main() { mut x: int; for { x = 1; break; } log(x); }", nil},
+		{"branch that returns", "func f(b: bool) -> int { mut x: int; if b { return 0; } else { x = 1; } return x; }", nil},
+		{"nil into int", "func main() { x: int = nil; log(x); }", []string{"cannot use nil as int"}},
+		{"nil argument", "func f(a: int) -> int { return a; } func main() { log(f(nil)); }", []string{"cannot use nil as int"}},
+		{"nil return", "func f() -> string { return nil; }", []string{"cannot use nil as string"}},
+		{"nil field", "struct P { x: int; y: ?int; } func main() { p := P{x: nil, y: nil}; log(p.x); }", []string{"cannot use nil as int"}},
+		{"nil without a type", "func main() { x := nil; log(x); }", []string{"cannot infer a type from nil"}},
+		{"nil into optional", "func f(a: ?int) -> ?int { return a; } func main() { x: ?int = nil; log(f(x)); log(f(nil)); }", nil},
+		{"unchecked optional", "func f(a: ?int) -> int { return a + 1; }", []string{"'a' may be nil"}},
+		{"checked optional", "func f(a: ?int) -> int { if a != nil { return a + 1; } return 0; }", nil},
+		{"early return narrows", "func f(a: ?int) -> int { if a == nil { return 0; } return a; }", nil},
+		{"else of == nil", "func f(a: ?int) -> int { if a == nil { return 0; } else { return a * 2; } }", nil},
+		{"&& narrows the right operand", "func f(a: ?int) -> bool { return a != nil && a > 0; }", nil},
+		{"|| narrows the right operand", "func f(a: ?int) -> bool { return a == nil || a > 0; }", nil},
+		{"narrowed by assignment", "func f(a: ?int) -> int { mut b: ?int = a; b = 1; return b; }", nil},
+		{"reassigned nil in a loop", "func f() -> int { mut a: ?int = 1; mut t := 0; while t < 3 { t = t + a; a = nil; } return t; }", []string{"'a' may be nil"}},
+		{"optional call result", "func find() -> ?int { return nil; } func main() { x := find(); log(x + 1); }", []string{"'x' may be nil"}},
+		{"optional alias", "type MaybeInt = ?int; func f(a: MaybeInt) -> int { return a; }", []string{"'a' may be nil"}},
+		{"comparing and logging", "func f(a: ?int) -> bool { log(a); return a == nil; }", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.NewParser(lexer.New(tt.code))
+			program := p.ParseProgram()
+			if len(p.GetErrors().Errors()) > 0 {
+				t.Fatalf("parser error: %s", p.GetErrors().Error())
+			}
+			a := New(tt.code, "test.mars")
+			err := a.CheckDataflow(program)
+			if len(tt.errors) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q, got none", tt.errors)
+			}
+			rest := err.Error()
+			for _, want := range tt.errors {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Errorf("expected error %q in order, got %q", want, err.Error())
+					break
+				}
+				rest = rest[i+len(want):]
+			}
+			if got := strings.Count(err.Error(), "error["); got != len(tt.errors) {
+				t.Errorf("expected %d errors, got %d: %s", len(tt.errors), got, err.Error())
+			}
+		})
+	}
+}
+
+func TestOptionalTypeChecks(t *testing.T) {
+	code := `func find(n: int) -> ?int { if n > 0 { return n; } return nil; }
+func f(a: ?int) -> int { if a != nil { return a + 1; } return 0; }
+func main() { x: ?int = nil; y: ?int = find(2); if y == nil { return; } log(f(x) + y); mut z: ?int = 3; z = nil; log(z); }`
+	p := parser.NewParser(lexer.New(code))
+	program := p.ParseProgram()
+	if err := New(code, "test.mars").Analyze(program); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	code = "func main() { w: int = 1; log(w == nil); }"
+	p = parser.NewParser(lexer.New(code))
+	program = p.ParseProgram()
+	err := New(code, "test.mars").Analyze(program)
+	if err == nil || !strings.Contains(err.Error(), "int == nil (mismatched types)") {
+		t.Errorf("expected comparing an int with nil to fail, got %v", err)
+	}
+}
+
+func TestImmutability(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		errors []string // expected errors, in order
+	}{
+		{"mut variables", "struct P { x: int; xs: []int; } func main() { mut a := [1]; a[0] = 2; push(a, 3); mut p := P{x: 1, xs: [1]}; p.x = 2; p.xs[0] = 3; }", nil},
+		{"assignment", "func main() { x := 1; x = 2; }", []string{"cannot assign to immutable variable 'x'", "mut x := ..."}},
+		{"typed declaration", "func main() { x: int = 1; x = 2; }", []string{"mut x: int"}},
+		{"element", "func main() { a := [1, 2]; a[0] = 3; }", []string{"cannot assign to an element of immutable variable 'a'"}},
+		{"field", "struct P { x: int; } func main() { p := P{x: 1}; p.x = 2; }", []string{"cannot assign to a field of immutable variable 'p'"}},
+		{"nested element", "struct P { xs: []int; } func main() { p := P{xs: [1]}; p.xs[0] = 2; }", []string{"cannot assign to an element of immutable variable 'p'"}},
+		{"parameter", "func f(n: int) { n = 1; }", []string{"cannot assign to immutable parameter 'n'", "mut n: int"}},
+		{"mut parameter", "struct P { x: int; } func f(mut p: P, mut n: int) { p.x = n; n = 2; }", nil},
+		{"parameter element", "func f(xs: []int) { xs[0] = 1; }", []string{"cannot assign to an element of immutable parameter 'xs'"}},
+		{"builtin that modifies", "func main() { a := [1]; push(a, 2); log(pop(a)); }", []string{"cannot modify immutable variable 'a' with push", "cannot modify immutable variable 'a' with pop"}},
+		{"shadowed builtin", "func push(a: []int, b: int) {} func main() { a := [1]; push(a, 2); }", nil},
+		{"constant", "const N = 1; func main() { N = 2; }", []string{"cannot assign to constant 'N'"}},
+		{"function", "func f() {} func main() { f = 1; }", []string{"cannot assign to function 'f'"}},
+		{"shadowed in a block", "func main() { x := 1; if true { mut x := 2; x = 3; } }", nil},
+		{"for init", "func main() { for i := 0; i < 2; i = i + 1 { } }", []string{"cannot assign to immutable variable 'i'"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.NewParser(lexer.New(tt.code))
+			program := p.ParseProgram()
+			if len(p.GetErrors().Errors()) > 0 {
+				t.Fatalf("parser error: %s", p.GetErrors().Error())
+			}
+			err := New(tt.code, "test.mars").CheckImmutability(program)
+			if len(tt.errors) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q, got none", tt.errors)
+			}
+			rest := err.Error()
+			for _, want := range tt.errors {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Errorf("expected %q in order, got %q", want, err.Error())
+					break
+				}
+				rest = rest[i+len(want):]
+			}
+		})
+	}
+}
+
+func TestImmutabilityDiagnostics(t *testing.T) {
+	code := "func main() {\n    x := 1;\n    x = 2;\n}"
+	program := parser.NewParser(lexer.New(code)).ParseProgram()
+	a := New(code, "test.mars")
+	if err := a.CheckImmutability(program); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	diagnostics := a.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %+v", diagnostics)
+	}
+	d := diagnostics[0]
+	if d.File != "test.mars" || d.Start.Line != 3 || d.Code != errors.ErrCodeImmutable {
+		t.Errorf("unexpected diagnostic %+v", d)
+	}
+	if len(d.Related) != 1 || d.Related[0].Start.Line != 2 || d.Related[0].Message != "'x' is declared here" {
+		t.Errorf("expected the declaration as a related location, got %+v", d.Related)
+	}
+}
+
+func TestCheckImports(t *testing.T) {
+	parse := func(code string) *ast.Program {
+		p := parser.NewParser(lexer.New(code))
+		program := p.ParseProgram()
+		if len(p.GetErrors().Errors()) > 0 {
+			t.Fatalf("parser error: %s", p.GetErrors().Error())
+		}
+		return program
+	}
+	modules := map[string]*ast.Program{
+		"geometry/vec": parse(`pub struct Vec { pub x: int; y: int; }
+pub struct Line { pub from: Vec; to: Vec; }
+struct secret { pub n: int; }
+pub origin := 0;
+pub unit := Vec{x: 1, y: 1};
+scale := 2;
+pub func length(a: int, b: int) -> int { return a + b; }
+pub func make(x: int) -> Vec { return Vec{x: x, y: x}; }
+func helper() -> int { return 0; }
+pub const LIMIT = 10;
+const hidden = 1;`),
+		"other/vec": parse("pub func length() -> int { return 0; }"),
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		errorMsg string
+	}{
+		{"valid references", `import "geometry/vec"; n := vec.length(vec.origin, 2);`, ""},
+		{"missing member", `import "geometry/vec"; n := vec.width;`, `module "geometry/vec" has no member "width"`},
+		{"missing member in call argument", `import "geometry/vec"; log(vec.length(vec.nope, 1));`, `has no member "nope"`},
+		{"wrong argument count", `import "geometry/vec"; n := vec.length(1);`, "wrong number of arguments in call to 'vec.length'"},
+		{"module not loaded", `import "geometry/mat";`, `module "geometry/mat" is not loaded`},
+		{"duplicate module name", `import "geometry/vec"; import "other/vec";`, `"vec" imported twice`},
+		{"declaration conflicts with import", `import "geometry/vec"; func vec() {}`, `"vec" is already declared by the import of "geometry/vec"`},
+		{"parameter shadows module", `import "geometry/vec"; func f(vec: int) -> int { return vec.x; }`, ""},
+		{"local shadows module after declaration", `import "geometry/vec"; func f() { a := vec.nope; vec := 1; log(vec.x); }`, `has no member "nope"`},
+		// Visibility: only 'pub' declarations and fields are reachable from other modules
+		{"private function", `import "geometry/vec"; n := vec.helper();`, `"helper" is not public in module "geometry/vec"`},
+		{"private variable", `import "geometry/vec"; n := vec.scale;`, `"scale" is not public in module "geometry/vec"`},
+		{"public constant", `import "geometry/vec"; n := vec.LIMIT;`, ""},
+		{"private constant", `import "geometry/vec"; n := vec.hidden;`, `"hidden" is not public in module "geometry/vec"`},
+		{"private struct literal", `import "geometry/vec"; s := vec.secret{n: 1};`, `"secret" is not public in module "geometry/vec"`},
+		{"private field in literal", `import "geometry/vec"; v := vec.Vec{x: 1, y: 2};`, `field "y" of "Vec" is not public in module "geometry/vec"`},
+		{"public fields in literal", `import "geometry/vec"; v := vec.Vec{x: 1}; n := v.x;`, ""},
+		{"private field of literal", `import "geometry/vec"; n := vec.Vec{x: 1}.y;`, `field "y" of "Vec" is not public`},
+		{"private field of returned struct", `import "geometry/vec"; v := vec.make(1); n := v.y;`, `field "y" of "Vec" is not public`},
+		{"private field of module variable", `import "geometry/vec"; n := vec.unit.y;`, `field "y" of "Vec" is not public`},
+		{"private field of typed parameter", `import "geometry/vec"; func f(v: vec.Vec) -> int { return v.y; }`, `field "y" of "Vec" is not public`},
+		{"private field through field", `import "geometry/vec"; func f(l: vec.Line) -> int { return l.from.y; }`, `field "y" of "Vec" is not public`},
+		{"private field of field", `import "geometry/vec"; func f(l: vec.Line) -> int { return l.to.x; }`, `field "to" of "Line" is not public`},
+		{"assign public field", `import "geometry/vec"; func f() { mut v := vec.make(1); v.x = 5; }`, ""},
+		{"assign private field", `import "geometry/vec"; func f() { mut v := vec.make(1); v.y = 5; }`, `field "y" of "Vec" is not public`},
+		{"assign private field of field", `import "geometry/vec"; func f(mut l: vec.Line) { l.from.y = 5; }`, `field "y" of "Vec" is not public`},
+		{"assign field of private field", `import "geometry/vec"; func f(mut l: vec.Line) { l.to.x = 5; }`, `field "to" of "Line" is not public`},
+		{"shadowed variable is not tracked", `import "geometry/vec"; func f() -> int { v := vec.make(1); v := 2; return v.y; }`, ""},
+		{"literal of unimported module", `s := geo.Vec{x: 1};`, `"geo" is not an imported module`},
+		{"public type annotations", `import "geometry/vec"; func f(v: vec.Vec, l: []vec.Line) -> ?vec.Vec { return v; }`, ""},
+		{"private variable type", `import "geometry/vec"; h: vec.secret = vec.make(1);`, `"secret" is not public in module "geometry/vec"`},
+		{"private parameter type", `import "geometry/vec"; func f(s: vec.secret) {}`, `"secret" is not public in module "geometry/vec"`},
+		{"private return type", `import "geometry/vec"; func f() -> vec.secret { return nil; }`, `"secret" is not public in module "geometry/vec"`},
+		{"private field type", `import "geometry/vec"; struct Box { s: vec.secret; }`, `"secret" is not public in module "geometry/vec"`},
+		{"private array element type", `import "geometry/vec"; func f(xs: [4]vec.secret) {}`, `"secret" is not public in module "geometry/vec"`},
+		{"private optional type", `import "geometry/vec"; mut s: ?vec.secret = nil;`, `"secret" is not public in module "geometry/vec"`},
+		{"private channel element type", `import "geometry/vec"; func f(c: chan[vec.secret]) {}`, `"secret" is not public in module "geometry/vec"`},
+		{"private channel literal type", `import "geometry/vec"; c := chan[vec.secret]();`, `"secret" is not public in module "geometry/vec"`},
+		{"private type alias target", `import "geometry/vec"; type S = vec.secret;`, `"secret" is not public in module "geometry/vec"`},
+		{"missing type", `import "geometry/vec"; func f(s: vec.Nope) {}`, `module "geometry/vec" has no member "Nope"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errStr := ""
+			if err := New(tt.code, "main.mars").CheckImports(parse(tt.code), modules); err != nil {
+				errStr = err.Error()
+			}
+			if tt.errorMsg != "" {
+				assertErrorContains(t, errStr, tt.errorMsg)
+			} else {
+				assertNoError(t, errStr)
+			}
+		})
+	}
+}
+
+func TestCheckConstants(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		value    interface{} // folded value of the constant X, when errorMsg is empty
+		errorMsg string
+	}{
+		{"int arithmetic", `const X = (1 + 2) * 10 / 4 % 5;`, 2, ""},
+		{"float promotion", `const X = 1 + 0.5;`, 1.5, ""},
+		{"string concatenation", `const X = "mars" + "!";`, "mars!", ""},
+		{"comparison", `const X = 2 * 3 >= 6 && !("a" == "b");`, true, ""},
+		{"negation", `const X = -(-4);`, 4, ""},
+		{"bool operands", `const X = N * N; const N = 1 == 1;`, nil, "invalid constant operation: bool * bool"},
+		{"constants declared later", `const X = N * N; const N = 8;`, 64, ""},
+		{"declared float", `const X: float = 3;`, 3.0, ""},
+		{"declared type mismatch", `const X: int = "three";`, nil, `constant "X" is declared int, but its value is string`},
+		{"variable", `n := 3; const X = n + 1;`, nil, `"n" is not a constant`},
+		{"function call", `const X = len("abc");`, nil, `len("abc") is not a constant expression`},
+		{"undefined", `const X = Y;`, nil, `undefined constant "Y"`},
+		{"division by zero", `const X = 10 / (5 - 5);`, nil, "division by zero in constant"},
+		{"operand types", `const X = "a" - 1;`, nil, "invalid constant operation: string - int"},
+		{"cycle", `const X = Y + 1; const Y = X;`, nil, "is defined in terms of itself"},
+		{"local constant", `func f() -> int { const L = 2; const M = L * X; return M; } const X = 3;`, 3, ""},
+		{"parameter shadows constant", `const X = 1; func f(X: int) { const Y = X; }`, nil, `"X" is not a constant`},
+		{"local used before declaration", `func f() { const A = B; const B = 1; }`, nil, `undefined constant "B"`},
+		{"array size not a constant", `size := 4; func f(a: [size]int) {}`, nil, `"size" is not a constant`},
+		{"array size not an int", `const S = "four"; func f(a: [S]int) {}`, nil, `array size "S" must be an int, found string`},
+		{"negative array size", `const S = -1; x: [S]int;`, nil, `array size "S" must not be negative`},
+		{"bitwise operators", `const X = (0xF0 | 0b0101) & ^0x04 ^ 1 << 8 >> 4;`, (0xF5 & ^0x04) ^ (1 << 8 >> 4), ""},
+		{"sized constant", `const X: u8 = 0xFF;`, 255, ""},
+		{"sized constant overflow", `const X: i8 = 128;`, nil, `constant "X" overflows i8: 128`},
+		{"negative shift", `const X = 1 << -1;`, nil, "negative shift count in constant"},
+		{"int overflow", `const X = 9223372036854775807 + 1;`, nil, "constant (9223372036854775807 + 1) overflows int"},
+		{"division overflow", `const M = -9223372036854775807 - 1; const X = M / -1;`, nil, "constant (M / (-1)) overflows int"},
+		{"negation overflow", `const M = -9223372036854775807 - 1; const X = -M;`, nil, "constant (-M) overflows int"},
+		{"shift past the width", `const X = 1 << 64;`, nil, "constant (1 << 64) overflows int"},
+		{"shift out of the sign bit", `const X = 1 << 63;`, nil, "constant (1 << 63) overflows int"},
+		{"shift into the sign bit", `const X = -1 << 63;`, -9223372036854775808, ""},
+		{"bigint division by zero", `const X = 100000000000000000000 / 0;`, nil, "division by zero in constant"},
+		{"bigint operand types", `const X = 100000000000000000000 + "1";`, nil, "invalid constant operation: bigint + string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.NewParser(lexer.New(tt.code))
+			program := p.ParseProgram()
+			if len(p.GetErrors().Errors()) > 0 {
+				t.Fatalf("parser error: %s", p.GetErrors().Error())
+			}
+			errStr := ""
+			if err := New(tt.code, "main.mars").CheckConstants(program); err != nil {
+				errStr = err.Error()
+			}
+			if tt.errorMsg != "" {
+				assertErrorContains(t, errStr, tt.errorMsg)
+				return
+			}
+			assertNoError(t, errStr)
+			for _, decl := range program.Declarations {
+				if c, ok := decl.(*ast.ConstDecl); ok && c.Name.Name == "X" {
+					if c.Folded == nil || c.Folded.Value != tt.value {
+						t.Errorf("X folded to %v, want %v", c.Folded, tt.value)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCheckConstantsArraySizes(t *testing.T) {
+	code := `const N = 4;
+func f(a: [N]int) -> [N][N]int {
+    const N = 2;
+    b: [N]string;
+    return a;
+}`
+	p := parser.NewParser(lexer.New(code))
+	program := p.ParseProgram()
+	if len(p.GetErrors().Errors()) > 0 {
+		t.Fatalf("parser error: %s", p.GetErrors().Error())
+	}
+	if err := New(code, "main.mars").CheckConstants(program); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fn := program.Declarations[1].(*ast.FuncDecl)
+	if size := fn.Signature.Parameters[0].Type.ArraySize; size == nil || *size != 4 {
+		t.Errorf("parameter size = %v, want 4", size)
+	}
+	ret := fn.Signature.ReturnType
+	if ret.ArraySize == nil || *ret.ArraySize != 4 || ret.ArrayType.ArraySize == nil || *ret.ArrayType.ArraySize != 4 {
+		t.Errorf("expected return type [4][4]int, got sizes %v", ret)
+	}
+	local := fn.Body.Statements[1].(*ast.VarDecl)
+	if size := local.Type.ArraySize; size == nil || *size != 2 {
+		t.Errorf("local size = %v, want 2 from the shadowing constant", size)
+	}
+}
+
+// exampleCodes parses, analyzes and checks a program as mars check does,
+// with geometry/vector as the only module to import, and returns the codes
+// of everything reported
+func exampleCodes(code string) []string {
+	var codes []string
+	p := parser.NewParserWithSource(lexer.New(code), strings.Split(code, "\n"))
+	program := p.ParseProgram()
+	if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+		for _, err := range errs.Errors() {
+			codes = append(codes, err.Code)
+		}
+		return codes
+	}
+
+	vector := "pub func length(x: int, y: int) -> int { return x * x + y * y; }"
+	modules := map[string]*ast.Program{
+		"geometry/vector": parser.NewParser(lexer.New(vector)).ParseProgram(),
+	}
+	a := New(code, "example.mars")
+	checks := []func(*ast.Program) error{
+		func(program *ast.Program) error { return a.CheckImports(program, modules) },
+		a.CheckConstants,
+		a.InferTypes,
+		func(program *ast.Program) error { return a.TypeCheck(program) },
+		func(program *ast.Program) error { return a.CheckImmutability(program) },
+		a.CheckControlFlow,
+		a.CheckDataflow,
+		a.CheckUnused,
+	}
+	for _, check := range checks {
+		if err := check(program); err != nil {
+			break
+		}
+	}
+	for _, d := range a.Diagnostics() {
+		codes = append(codes, d.Code)
+	}
+	return codes
+}
+
+// TestCatalogExamples checks that the erroneous example of each analysis
+// code mars explain documents reports that code, and that the fixed one
+// reports nothing. The examples of runtime codes must get past the checks
+// to run at all.
+func TestCatalogExamples(t *testing.T) {
+	for _, info := range errors.Codes() {
+		// Private access needs a second module
+		if info.Reserved() || info.Code == errors.ErrCodePrivateAccess {
+			continue
+		}
+		// E1007's example is reported as E0010 first, as its explanation
+		// says; only the REPL, which doesn't check, reaches it
+		if strings.HasPrefix(info.Code, "E1") && info.Code != errors.RuntimeCodeImmutable {
+			t.Run(info.Code, func(t *testing.T) {
+				if codes := exampleCodes(info.Erroneous); len(codes) > 0 {
+					t.Errorf("erroneous example reported %v before running", codes)
+				}
+			})
+			continue
+		} else if strings.HasPrefix(info.Code, "E1") {
+			continue
+		}
+		t.Run(info.Code, func(t *testing.T) {
+			codes := exampleCodes(info.Erroneous)
+			found := false
+			for _, code := range codes {
+				found = found || code == info.Code
+			}
+			if !found {
+				t.Errorf("erroneous example reported %v, want %s", codes, info.Code)
+			}
+			if codes := exampleCodes(info.Fixed); len(codes) > 0 {
+				t.Errorf("fixed example reported %v", codes)
+			}
+		})
+	}
+}
+
+func TestTypeCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  string
+		codes string // codes reported, space separated
+	}{
+		{"type mismatch", `x: int = "hello"; log(x);`, "E0002"},
+		{"undefined name", `count := 1; log(countr);`, "E0003"},
+		{"local shadows function", `func total() -> int { mut total := 0; total = 2; return total; } log(total());`, ""},
+		{"sibling loops", `func f() { for mut i := 0; i < 2; i = i + 1 { log(i); } for mut i := 0; i < 2; i = i + 1 { log(i); } } f();`, ""},
+		{"string concatenation", `name := "x"; log("hi " + name);`, ""},
+		{"recv result compared with nil", `c := chan[int](1); close(c); j := recv(c); if j == nil { log("closed"); }`, ""},
+		{"optional result compared with nil", `func find() -> ?int { return nil; } o := find(); if o != nil { log(o); }`, ""},
+		{"function value", `func add(a: int, b: int) -> int { return a + b; } f := add; log(f(1, 2));`, ""},
+		{"function value with wrong arguments", `func add(a: int, b: int) -> int { return a + b; } f := add; log(f(1));`, "E0002"},
+		{"int literal returned as sized int", `func f() -> u64 { return 0; } log(f());`, ""},
+		{"module members", `import "geometry/vector"; n := vector.length(1, 2) + 1; log(n);`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(exampleCodes(tt.code), " "); got != tt.codes {
+				t.Errorf("reported %q, want %q", got, tt.codes)
+			}
+		})
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		help  string
+	}{
+		{"builtin", "xs := [1, 2];\nprintln(lenght(xs));", "did you mean 'len'?"},
+		{"variable in an enclosing scope", "func f() -> int {\n    total := 1;\n    if total > 0 {\n        return totl;\n    }\n    return 0;\n}", "did you mean 'total'?"},
+		{"keyword", "ok := ture;", "did you mean 'true'?"},
+		{"function", "func square(n: int) -> int { return n * n; }\nprintln(sqare(2));", "did you mean 'square'?"},
+		{"field", "struct Point { x: int; y: int; }\np := Point{x: 1, y: 2};\nprintln(p.yy);", "did you mean 'y'?"},
+		{"field in a literal", "struct Point { x: int; y: int; }\np := Point{x: 1, yy: 2};", "did you mean 'y'?"},
+		{"nothing close", "println(zzz);", "variable must be defined before use"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertErrorContains(t, testAnalyze(tt.input), tt.help)
+		})
+	}
+}
@@ -0,0 +1,609 @@
+package analyzer
+
+import (
+	"fmt"
+	"mars/ast"
+	"mars/errors"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// CheckConstants computes the value of every constant declaration in a
+// module and stores it in the declaration's Folded literal. Constant values
+// may only use literals, other constants and operators; anything else is
+// reported, as is an array size [N] that doesn't name a constant int.
+// Top-level constants can be used before their declaration, constants in
+// functions only after it.
+func (a *Analyzer) CheckConstants(program *ast.Program) error {
+	c := &constChecker{a: a, folding: map[*ast.ConstDecl]bool{}, failed: map[*ast.ConstDecl]bool{}, aliases: map[string]*ast.Type{}}
+	globals := &constScope{names: map[string]*ast.ConstDecl{}}
+	for _, decl := range program.Declarations {
+		if d, ok := decl.(*ast.ConstDecl); ok {
+			globals.names[d.Name.Name] = d
+		} else if d, ok := decl.(*ast.TypeDecl); ok && d.Alias {
+			c.aliases[d.Name.Name] = d.Type
+		} else if name := declarationName(decl); name != "" {
+			globals.names[name] = nil
+		}
+	}
+	c.globals = globals
+
+	for _, decl := range program.Declarations {
+		if d, ok := decl.(*ast.ConstDecl); ok {
+			c.foldDecl(d, globals)
+			continue
+		}
+		c.walk(decl, globals)
+	}
+
+	if a.errors.HasErrors() {
+		return fmt.Errorf("%s", a.errors.String())
+	}
+	return nil
+}
+
+// constScope maps the names declared in a scope to their constant
+// declarations. Variables and parameters map to nil: they shadow any
+// constant of the same name.
+type constScope struct {
+	outer *constScope
+	names map[string]*ast.ConstDecl
+}
+
+func (s *constScope) enter() *constScope {
+	return &constScope{outer: s, names: map[string]*ast.ConstDecl{}}
+}
+
+func (s *constScope) lookup(name string) (*ast.ConstDecl, bool) {
+	for ; s != nil; s = s.outer {
+		if decl, ok := s.names[name]; ok {
+			return decl, true
+		}
+	}
+	return nil, false
+}
+
+type constChecker struct {
+	a       *Analyzer
+	globals *constScope
+	folding map[*ast.ConstDecl]bool // constants whose values are being computed, to catch cycles
+	failed  map[*ast.ConstDecl]bool // constants already reported, so uses aren't reported again
+	aliases map[string]*ast.Type    // types the module's aliases stand for
+}
+
+// walk folds the constants declared within node and resolves the array
+// sizes of the types it mentions, tracking which names are in scope
+func (c *constChecker) walk(node ast.Node, scope *constScope) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			inner := scope.enter()
+			if n.Signature != nil {
+				for _, param := range n.Signature.Parameters {
+					c.resolveType(param.Type, scope)
+					inner.names[param.Name.Name] = nil
+				}
+				c.resolveType(n.Signature.ReturnType, scope)
+			}
+			if n.Body != nil {
+				c.walk(n.Body, inner)
+			}
+			return false
+		case *ast.BlockStatement:
+			inner := scope.enter()
+			for _, stmt := range n.Statements {
+				if stmt != nil {
+					c.walk(stmt, inner)
+				}
+			}
+			return false
+		case *ast.ForStatement:
+			inner := scope.enter()
+			if n.Init != nil {
+				c.walk(n.Init, inner)
+			}
+			c.walkExpression(n.Condition, inner)
+			if n.Post != nil {
+				c.walk(n.Post, inner)
+			}
+			if n.Body != nil {
+				c.walk(n.Body, inner)
+			}
+			return false
+		case *ast.SelectCase:
+			c.walkExpression(n.Channel, scope)
+			c.walkExpression(n.Value, scope)
+			inner := scope.enter()
+			if n.Name != nil {
+				inner.names[n.Name.Name] = nil
+			}
+			if n.Body != nil {
+				c.walk(n.Body, inner)
+			}
+			return false
+		case *ast.ConstDecl:
+			c.foldDecl(n, scope)
+			scope.names[n.Name.Name] = n
+			return false
+		case *ast.VarDecl:
+			c.resolveType(n.Type, scope)
+			c.walkExpression(n.Value, scope)
+			scope.names[n.Name.Name] = nil
+			return false
+		case *ast.StructDecl:
+			for _, field := range n.Fields {
+				c.resolveType(field.Type, scope)
+			}
+			return false
+		case *ast.ChanLiteral:
+			c.resolveType(n.ElemType, scope)
+		case *ast.MapLiteral:
+			c.resolveType(n.KeyType, scope)
+			c.resolveType(n.ValueType, scope)
+		}
+		return true
+	})
+}
+
+func (c *constChecker) walkExpression(expr ast.Expression, scope *constScope) {
+	if expr != nil {
+		c.walk(expr, scope)
+	}
+}
+
+// resolveType sets the size of every [N]T within t from the constant N
+func (c *constChecker) resolveType(t *ast.Type, scope *constScope) {
+	if t == nil {
+		return
+	}
+	if t.ArrayLen != nil && t.ArraySize == nil {
+		c.resolveArrayLen(t, scope)
+	}
+	c.resolveType(t.ArrayType, scope)
+	c.resolveType(t.PointerType, scope)
+	c.resolveType(t.MapType, scope)
+	c.resolveType(t.ChanType, scope)
+	c.resolveType(t.OptionalType, scope)
+	if t.FunctionSignature != nil {
+		for _, param := range t.FunctionSignature.Parameters {
+			c.resolveType(param.Type, scope)
+		}
+		c.resolveType(t.FunctionSignature.ReturnType, scope)
+	}
+}
+
+func (c *constChecker) resolveArrayLen(t *ast.Type, scope *constScope) {
+	name := t.ArrayLen
+	lit, ok := c.foldIdentifier(name, scope)
+	if !ok {
+		return
+	}
+	size, ok := lit.Value.(int)
+	if !ok {
+		c.a.errors.AddErrorWithHelp(name.Position, errors.ErrCodeTypeError,
+			fmt.Sprintf("array size %q must be an int, found %s", name.Name, constType(lit)),
+			"declare the size as an int constant, such as const N = 16;")
+		return
+	}
+	if size < 0 {
+		c.a.errors.AddError(name.Position, errors.ErrCodeTypeError,
+			fmt.Sprintf("array size %q must not be negative, found %d", name.Name, size))
+		return
+	}
+	t.ArraySize = &size
+}
+
+// foldDecl computes the value of a constant declared in scope, once
+func (c *constChecker) foldDecl(decl *ast.ConstDecl, scope *constScope) (*ast.Literal, bool) {
+	if decl.Folded != nil {
+		return decl.Folded, true
+	}
+	if c.failed[decl] {
+		return nil, false
+	}
+	if c.folding[decl] {
+		c.failed[decl] = true
+		c.a.errors.AddErrorWithHelp(decl.Name.Position, errors.ErrCodeNotConstant,
+			fmt.Sprintf("constant %q is defined in terms of itself", decl.Name.Name),
+			"break the cycle by giving one of the constants a literal value")
+		return nil, false
+	}
+
+	c.folding[decl] = true
+	lit, ok := c.fold(decl.Value, scope)
+	delete(c.folding, decl)
+	if ok && decl.Type != nil {
+		lit, ok = c.convert(decl, lit)
+	}
+	if !ok {
+		c.failed[decl] = true
+		return nil, false
+	}
+	decl.Folded = lit
+	return lit, true
+}
+
+// convert checks a constant's value against its declared type. An int
+// value declared float becomes a float; one declared with a sized integer
+// type must fit it.
+func (c *constChecker) convert(decl *ast.ConstDecl, lit *ast.Literal) (*ast.Literal, bool) {
+	want := typeName(c.resolveAlias(decl.Type))
+	if i, ok := lit.Value.(int); ok && want == "float" {
+		return constLiteral(float64(i), lit.Position), true
+	}
+	if i, ok := lit.Value.(int); ok && want == "bigint" {
+		return constLiteral(big.NewInt(int64(i)), lit.Position), true
+	}
+	if typ, sized := ast.LookupIntType(want); sized {
+		if i, ok := lit.Value.(int); ok {
+			if !typ.Fits(int64(i)) {
+				c.a.errors.AddErrorWithHelp(decl.Name.Position, errors.ErrCodeTypeError,
+					fmt.Sprintf("constant %q overflows %s: %d", decl.Name.Name, want, i),
+					"use a wider type or a smaller value")
+				return nil, false
+			}
+			return lit, true
+		}
+	}
+	if got := constType(lit); got != want {
+		c.a.errors.AddErrorWithHelp(decl.Name.Position, errors.ErrCodeTypeError,
+			fmt.Sprintf("mismatched types: constant %q is declared %s, but its value is %s", decl.Name.Name, want, got),
+			"change the constant's type or its value")
+		return nil, false
+	}
+	return lit, true
+}
+
+// resolveAlias follows the module's aliases from t to the type they name
+func (c *constChecker) resolveAlias(t *ast.Type) *ast.Type {
+	for seen := 0; seen <= len(c.aliases) && t.StructName != ""; seen++ {
+		aliased, ok := c.aliases[t.StructName]
+		if !ok {
+			break
+		}
+		t = aliased
+	}
+	return t
+}
+
+// fold computes the value of a constant expression, reporting why it
+// can't if it isn't one
+func (c *constChecker) fold(expr ast.Expression, scope *constScope) (*ast.Literal, bool) {
+	switch e := expr.(type) {
+	case *ast.Literal:
+		switch e.Value.(type) {
+		case int, float64, string, bool, *big.Int:
+			return e, true
+		}
+	case *ast.Identifier:
+		return c.foldIdentifier(e, scope)
+	case *ast.UnaryExpression:
+		right, ok := c.fold(e.Right, scope)
+		if !ok {
+			return nil, false
+		}
+		return c.foldUnary(e, right)
+	case *ast.BinaryExpression:
+		left, ok := c.fold(e.Left, scope)
+		if !ok {
+			return nil, false
+		}
+		right, ok := c.fold(e.Right, scope)
+		if !ok {
+			return nil, false
+		}
+		return c.foldBinary(e, left, right)
+	}
+	c.a.errors.AddErrorWithHelp(expr.Pos(), errors.ErrCodeNotConstant,
+		fmt.Sprintf("%s is not a constant expression", expr.String()),
+		"constant values can only use literals, other constants and operators")
+	return nil, false
+}
+
+func (c *constChecker) foldIdentifier(ident *ast.Identifier, scope *constScope) (*ast.Literal, bool) {
+	decl, found := scope.lookup(ident.Name)
+	if !found {
+		c.a.errors.AddError(ident.Position, errors.ErrCodeUndefinedVar,
+			fmt.Sprintf("undefined constant %q", ident.Name))
+		return nil, false
+	}
+	if decl == nil {
+		c.a.errors.AddErrorWithHelp(ident.Position, errors.ErrCodeNotConstant,
+			fmt.Sprintf("%q is not a constant", ident.Name),
+			fmt.Sprintf("declare it with 'const %s = value;' to use it here", ident.Name))
+		return nil, false
+	}
+	// Top-level constants are folded in the module's scope, wherever
+	// they are used from
+	if c.globals.names[ident.Name] == decl {
+		return c.foldDecl(decl, c.globals)
+	}
+	return c.foldDecl(decl, scope)
+}
+
+func (c *constChecker) foldUnary(e *ast.UnaryExpression, right *ast.Literal) (*ast.Literal, bool) {
+	switch v := right.Value.(type) {
+	case int:
+		if e.Operator == "-" && v == math.MinInt {
+			c.a.errors.AddError(e.Position, errors.ErrCodeTypeError,
+				fmt.Sprintf("constant %s overflows int", e.String()))
+			return nil, false
+		}
+		if e.Operator == "-" {
+			return constLiteral(-v, e.Position), true
+		}
+		if e.Operator == "^" {
+			return constLiteral(^v, e.Position), true
+		}
+	case float64:
+		if e.Operator == "-" {
+			return constLiteral(-v, e.Position), true
+		}
+	case *big.Int:
+		if e.Operator == "-" {
+			return constLiteral(new(big.Int).Neg(v), e.Position), true
+		}
+		if e.Operator == "^" {
+			return constLiteral(new(big.Int).Not(v), e.Position), true
+		}
+	case bool:
+		if e.Operator == "!" {
+			return constLiteral(!v, e.Position), true
+		}
+	}
+	c.a.errors.AddError(e.Position, errors.ErrCodeTypeError,
+		fmt.Sprintf("invalid constant operation: %s%s", e.Operator, constType(right)))
+	return nil, false
+}
+
+func (c *constChecker) foldBinary(e *ast.BinaryExpression, left, right *ast.Literal) (*ast.Literal, bool) {
+	var result interface{}
+	switch l := left.Value.(type) {
+	case int:
+		switch r := right.Value.(type) {
+		case int:
+			result = foldInts(e.Operator, l, r)
+		case float64:
+			result = foldFloats(e.Operator, float64(l), r)
+		case *big.Int:
+			result = foldBigInts(e.Operator, big.NewInt(int64(l)), r)
+		}
+	case *big.Int:
+		switch r := right.Value.(type) {
+		case int:
+			result = foldBigInts(e.Operator, l, big.NewInt(int64(r)))
+		case *big.Int:
+			result = foldBigInts(e.Operator, l, r)
+		}
+	case float64:
+		switch r := right.Value.(type) {
+		case int:
+			result = foldFloats(e.Operator, l, float64(r))
+		case float64:
+			result = foldFloats(e.Operator, l, r)
+		}
+	case string:
+		if r, ok := right.Value.(string); ok {
+			result = foldStrings(e.Operator, l, r)
+		}
+	case bool:
+		if r, ok := right.Value.(bool); ok {
+			result = foldBools(e.Operator, l, r)
+		}
+	}
+
+	switch result := result.(type) {
+	case nil:
+		c.a.errors.AddError(e.Position, errors.ErrCodeTypeError,
+			fmt.Sprintf("invalid constant operation: %s %s %s", constType(left), e.Operator, constType(right)))
+		return nil, false
+	case divisionByZero:
+		c.a.errors.AddError(e.Position, errors.ErrCodeInvalidExpression,
+			fmt.Sprintf("division by zero in constant %s", e.String()))
+		return nil, false
+	case negativeShift:
+		c.a.errors.AddError(e.Position, errors.ErrCodeInvalidExpression,
+			fmt.Sprintf("negative shift count in constant %s", e.String()))
+		return nil, false
+	case intOverflow:
+		c.a.errors.AddError(e.Position, errors.ErrCodeTypeError,
+			fmt.Sprintf("constant %s overflows int", e.String()))
+		return nil, false
+	default:
+		return constLiteral(result, e.Position), true
+	}
+}
+
+// divisionByZero is the result of folding x / 0 or x % 0
+type divisionByZero struct{}
+
+// negativeShift is the result of folding x << n or x >> n for n < 0
+type negativeShift struct{}
+
+// intOverflow is the result of folding an int operation whose result int
+// can't hold, or a shift by int's width or more, which fail at runtime
+type intOverflow struct{}
+
+// The fold functions below return nil for operators their operands don't
+// support, matching the evaluator's operators
+
+func foldInts(op string, l, r int) interface{} {
+	switch op {
+	case "+":
+		if v := l + r; (r > 0 && v < l) || (r < 0 && v > l) {
+			return intOverflow{}
+		}
+		return l + r
+	case "-":
+		if v := l - r; (r < 0 && v < l) || (r > 0 && v > l) {
+			return intOverflow{}
+		}
+		return l - r
+	case "*":
+		if v := l * r; l != 0 && (v/l != r || (l == -1 && r == math.MinInt)) {
+			return intOverflow{}
+		}
+		return l * r
+	case "/", "%":
+		if r == 0 {
+			return divisionByZero{}
+		}
+		if op == "/" {
+			if l == math.MinInt && r == -1 {
+				return intOverflow{}
+			}
+			return l / r
+		}
+		return l % r
+	case "&":
+		return l & r
+	case "|":
+		return l | r
+	case "^":
+		return l ^ r
+	case "<<", ">>":
+		if r < 0 {
+			return negativeShift{}
+		}
+		if r >= strconv.IntSize || (op == "<<" && l<<r>>r != l) {
+			return intOverflow{}
+		}
+		if op == "<<" {
+			return l << r
+		}
+		return l >> r
+	}
+	return compare(op, l == r, l < r)
+}
+
+func foldBigInts(op string, l, r *big.Int) interface{} {
+	v := new(big.Int)
+	switch op {
+	case "+":
+		return v.Add(l, r)
+	case "-":
+		return v.Sub(l, r)
+	case "*":
+		return v.Mul(l, r)
+	case "/", "%":
+		if r.Sign() == 0 {
+			return divisionByZero{}
+		}
+		if op == "/" {
+			return v.Quo(l, r)
+		}
+		return v.Rem(l, r)
+	case "&":
+		return v.And(l, r)
+	case "|":
+		return v.Or(l, r)
+	case "^":
+		return v.Xor(l, r)
+	case "<<", ">>":
+		if r.Sign() < 0 {
+			return negativeShift{}
+		}
+		if !r.IsInt64() || r.Int64() > 1<<20 {
+			return nil
+		}
+		if op == "<<" {
+			return v.Lsh(l, uint(r.Int64()))
+		}
+		return v.Rsh(l, uint(r.Int64()))
+	}
+	c := l.Cmp(r)
+	return compare(op, c == 0, c < 0)
+}
+
+func foldFloats(op string, l, r float64) interface{} {
+	switch op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		if r == 0 {
+			return divisionByZero{}
+		}
+		return l / r
+	}
+	return compare(op, l == r, l < r)
+}
+
+func foldStrings(op string, l, r string) interface{} {
+	if op == "+" {
+		return l + r
+	}
+	return compare(op, l == r, l < r)
+}
+
+func foldBools(op string, l, r bool) interface{} {
+	switch op {
+	case "&&":
+		return l && r
+	case "||":
+		return l || r
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	}
+	return nil
+}
+
+// compare folds a comparison from whether its operands are equal and
+// whether the left one is less
+func compare(op string, eq, less bool) interface{} {
+	switch op {
+	case "==":
+		return eq
+	case "!=":
+		return !eq
+	case "<":
+		return less
+	case "<=":
+		return less || eq
+	case ">":
+		return !less && !eq
+	case ">=":
+		return !less
+	}
+	return nil
+}
+
+func constLiteral(value interface{}, pos ast.Position) *ast.Literal {
+	var token string
+	switch v := value.(type) {
+	case int:
+		token = strconv.Itoa(v)
+	case float64:
+		token = strconv.FormatFloat(v, 'g', -1, 64)
+	case *big.Int:
+		token = v.String()
+	case string:
+		token = v
+	case bool:
+		token = strconv.FormatBool(v)
+	}
+	return &ast.Literal{Token: token, Value: value, Position: pos}
+}
+
+// constType names the type of a folded constant
+func constType(lit *ast.Literal) string {
+	switch lit.Value.(type) {
+	case int:
+		return "int"
+	case float64:
+		return "float"
+	case *big.Int:
+		return "bigint"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	}
+	return "unknown"
+}
@@ -0,0 +1,644 @@
+package analyzer
+
+import (
+	"fmt"
+	"mars/ast"
+	"mars/errors"
+)
+
+// CheckDataflow follows the statements of each function, and the top-level
+// statements, along every path, and reports:
+//   - reads of local variables declared without a value that some path
+//     reaches before assigning them (E0021)
+//   - nil assigned, passed, returned or used as a field of a type that
+//     isn't optional (E0022)
+//   - values of an optional type ?T used as a T before a check such as
+//     `if x != nil` or `if x == nil { return; }` narrows them (E0022)
+//
+// Comparing an optional with nil, logging it and passing it on as another
+// optional don't need a check. Assigning a value that isn't nil narrows
+// the variable until the next assignment.
+func (a *Analyzer) CheckDataflow(program *ast.Program) error {
+	d := &dataflow{
+		a:       a,
+		symbols: NewSymbolTable(),
+		types:   NewTypeChecker(),
+		pending: make(map[*Symbol]bool),
+	}
+	for _, decl := range program.Declarations {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			d.symbols.Define(decl.Name.Name, ast.Type{}, false, true, decl)
+		case *ast.StructDecl:
+			d.symbols.Define(decl.Name.Name, ast.Type{}, false, false, decl)
+		case *ast.TypeDecl:
+			d.types.declareType(decl)
+		case *ast.VarDecl:
+			// A function can run before or after any top-level assignment,
+			// so globals count as assigned
+			d.symbols.Define(decl.Name.Name, d.declaredType(decl, newFlowState()), decl.Mutable, false, decl)
+		}
+	}
+
+	top := newFlowState()
+	for _, decl := range program.Declarations {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			d.function(decl)
+		case *ast.UnsafeBlock:
+			d.block(decl.Body, top)
+		case ast.Statement:
+			d.stmt(decl, top)
+		}
+	}
+
+	if a.errors.HasErrors() {
+		return fmt.Errorf("%s", a.errors.String())
+	}
+	return nil
+}
+
+// flowState is what holds at a point of a function on every path that
+// reaches it: which variables declared without a value are assigned, and
+// which optional variables aren't nil. No path reaches a dead state, so
+// it holds everything.
+type flowState struct {
+	dead     bool
+	assigned map[*Symbol]bool
+	narrowed map[*Symbol]bool
+}
+
+func newFlowState() *flowState {
+	return &flowState{assigned: make(map[*Symbol]bool), narrowed: make(map[*Symbol]bool)}
+}
+
+func (s *flowState) copy() *flowState {
+	c := newFlowState()
+	c.dead = s.dead
+	for sym := range s.assigned {
+		c.assigned[sym] = true
+	}
+	for sym := range s.narrowed {
+		c.narrowed[sym] = true
+	}
+	return c
+}
+
+// join keeps what holds in both s and other, as after two paths meet
+func (s *flowState) join(other *flowState) {
+	switch {
+	case other.dead:
+		return
+	case s.dead:
+		*s = *other.copy()
+		return
+	}
+	for sym := range s.assigned {
+		if !other.assigned[sym] {
+			delete(s.assigned, sym)
+		}
+	}
+	for sym := range s.narrowed {
+		if !other.narrowed[sym] {
+			delete(s.narrowed, sym)
+		}
+	}
+}
+
+// sameAs reports whether s and other hold the same facts
+func (s *flowState) sameAs(other *flowState) bool {
+	if s.dead || other.dead {
+		return s.dead == other.dead
+	}
+	return len(s.assigned) == len(other.assigned) && len(s.narrowed) == len(other.narrowed) &&
+		subset(s.assigned, other.assigned) && subset(s.narrowed, other.narrowed)
+}
+
+func subset(a, b map[*Symbol]bool) bool {
+	for sym := range a {
+		if !b[sym] {
+			return false
+		}
+	}
+	return true
+}
+
+// loopExits collects the states break and continue leave a loop body in
+type loopExits struct {
+	breaks    []*flowState
+	continues []*flowState
+}
+
+type dataflow struct {
+	a       *Analyzer
+	symbols *SymbolTable
+	types   *TypeChecker     // type declarations, to see through ?T aliases
+	pending map[*Symbol]bool // variables declared without a value
+	current *ast.FuncDecl
+	loops   []*loopExits
+	quiet   int // while above 0, loop bodies are walked to find their entry state, not to report
+}
+
+func (d *dataflow) function(fn *ast.FuncDecl) {
+	d.current = fn
+	defer func() { d.current = nil }()
+
+	d.symbols.EnterScope()
+	defer d.symbols.ExitScope()
+	if fn.Signature != nil {
+		for _, param := range fn.Signature.Parameters {
+			if param.Type != nil {
+				d.symbols.Define(param.Name.Name, *param.Type, false, false, param.Name)
+			}
+		}
+	}
+	d.block(fn.Body, newFlowState())
+}
+
+// block walks a block in its own scope, updating st
+func (d *dataflow) block(block *ast.BlockStatement, st *flowState) {
+	if block == nil {
+		return
+	}
+	d.symbols.EnterScope()
+	for _, stmt := range block.Statements {
+		d.stmt(stmt, st)
+	}
+	d.symbols.ExitScope()
+}
+
+func (d *dataflow) stmt(stmt ast.Statement, st *flowState) {
+	switch s := stmt.(type) {
+	case *ast.VarDecl:
+		d.varDecl(s, st)
+	case *ast.ConstDecl:
+		d.expr(s.Value, st)
+		if !d.symbols.IsGlobal() {
+			d.symbols.Define(s.Name.Name, ast.Type{}, false, false, s)
+		}
+	case *ast.AssignmentStatement:
+		d.assign(s, st)
+	case *ast.IndexAssignmentStatement:
+		d.expr(s.Object, st)
+		d.expr(s.Index, st)
+		d.expr(s.Value, st)
+	case *ast.FieldAssignmentStatement:
+		d.expr(s.Object, st)
+		d.expr(s.Value, st)
+	case *ast.PrintStatement:
+		// log prints nil, so an optional needs no check
+		if sym := d.optionalVar(s.Expression); sym != nil {
+			d.read(s.Expression.(*ast.Identifier), st, false)
+		} else {
+			d.expr(s.Expression, st)
+		}
+	case *ast.ExpressionStatement:
+		d.expr(s.Expression, st)
+	case *ast.SpawnStatement:
+		if s.Call != nil {
+			d.expr(s.Call, st)
+		}
+	case *ast.ReturnStatement:
+		if d.current != nil && d.current.Signature != nil && d.current.Signature.ReturnType != nil {
+			d.flowInto(s.Value, d.current.Signature.ReturnType, st)
+		} else {
+			d.expr(s.Value, st)
+		}
+		st.dead = true
+	case *ast.BreakStatement:
+		if len(d.loops) > 0 {
+			loop := d.loops[len(d.loops)-1]
+			loop.breaks = append(loop.breaks, st.copy())
+		}
+		st.dead = true
+	case *ast.ContinueStatement:
+		if len(d.loops) > 0 {
+			loop := d.loops[len(d.loops)-1]
+			loop.continues = append(loop.continues, st.copy())
+		}
+		st.dead = true
+	case *ast.BlockStatement:
+		d.block(s, st)
+	case *ast.IfStatement:
+		d.expr(s.Condition, st)
+		whenTrue, whenFalse := d.narrowing(s.Condition)
+		consequence, alternative := st.copy(), st.copy()
+		narrow(consequence, whenTrue)
+		narrow(alternative, whenFalse)
+		d.block(s.Consequence, consequence)
+		d.block(s.Alternative, alternative)
+		consequence.join(alternative)
+		*st = *consequence
+	case *ast.ForStatement:
+		d.symbols.EnterScope()
+		if s.Init != nil {
+			d.stmt(s.Init, st)
+		}
+		d.loop(s.Condition, s.Body, s.Post, st)
+		d.symbols.ExitScope()
+	case *ast.WhileStatement:
+		d.loop(s.Condition, s.Body, nil, st)
+	case *ast.SelectStatement:
+		// select runs exactly one of its bodies
+		after := &flowState{dead: true}
+		for _, c := range s.Cases {
+			d.expr(c.Channel, st)
+			d.expr(c.Value, st)
+			branch := st.copy()
+			d.symbols.EnterScope()
+			if c.Name != nil {
+				d.symbols.Define(c.Name.Name, ast.Type{}, false, false, c)
+			}
+			d.block(c.Body, branch)
+			d.symbols.ExitScope()
+			after.join(branch)
+		}
+		if s.Default != nil {
+			branch := st.copy()
+			d.block(s.Default, branch)
+			after.join(branch)
+		}
+		*st = *after
+	}
+}
+
+// loop walks a loop that tests condition before each run of body, and
+// leaves st as it is after the loop. What holds at the test is what holds
+// before the loop and after every run of the body, so the body is walked
+// until that stops changing, then once more to report.
+func (d *dataflow) loop(condition ast.Expression, body *ast.BlockStatement, post ast.Statement, st *flowState) {
+	head := st.copy()
+	var exits *loopExits
+	for reporting := false; ; {
+		if !reporting {
+			d.quiet++
+		}
+		entry := head.copy()
+		d.expr(condition, entry)
+		whenTrue, whenFalse := d.narrowing(condition)
+		narrow(entry, whenTrue)
+
+		exits = &loopExits{}
+		d.loops = append(d.loops, exits)
+		d.block(body, entry)
+		d.loops = d.loops[:len(d.loops)-1]
+		for _, cont := range exits.continues {
+			entry.join(cont)
+		}
+		if post != nil {
+			d.stmt(post, entry)
+		}
+
+		if reporting {
+			after := &flowState{dead: true}
+			if !alwaysTrue(condition) {
+				after = head.copy()
+				narrow(after, whenFalse)
+			}
+			for _, brk := range exits.breaks {
+				after.join(brk)
+			}
+			*st = *after
+			return
+		}
+		d.quiet--
+
+		next := head.copy()
+		next.join(entry)
+		if next.sameAs(head) {
+			reporting = true
+		}
+		head = next
+	}
+}
+
+func narrow(st *flowState, syms []*Symbol) {
+	for _, sym := range syms {
+		st.narrowed[sym] = true
+	}
+}
+
+// narrowing returns the optional variables a condition shows aren't nil
+// when it's true, and when it's false
+func (d *dataflow) narrowing(condition ast.Expression) (whenTrue, whenFalse []*Symbol) {
+	switch c := condition.(type) {
+	case *ast.BinaryExpression:
+		switch c.Operator {
+		case "!=", "==":
+			sym := d.nilComparison(c)
+			if sym == nil {
+				return nil, nil
+			}
+			if c.Operator == "!=" {
+				return []*Symbol{sym}, nil
+			}
+			return nil, []*Symbol{sym}
+		case "&&":
+			leftTrue, _ := d.narrowing(c.Left)
+			rightTrue, _ := d.narrowing(c.Right)
+			return append(leftTrue, rightTrue...), nil
+		case "||":
+			_, leftFalse := d.narrowing(c.Left)
+			_, rightFalse := d.narrowing(c.Right)
+			return nil, append(leftFalse, rightFalse...)
+		}
+	case *ast.UnaryExpression:
+		if c.Operator == "!" {
+			whenTrue, whenFalse = d.narrowing(c.Right)
+			return whenFalse, whenTrue
+		}
+	}
+	return nil, nil
+}
+
+// nilComparison returns the optional variable x of `x == nil` or
+// `x != nil`, or nil if expr compares something else
+func (d *dataflow) nilComparison(expr *ast.BinaryExpression) *Symbol {
+	if isNilLiteral(expr.Right) {
+		return d.optionalVar(expr.Left)
+	}
+	if isNilLiteral(expr.Left) {
+		return d.optionalVar(expr.Right)
+	}
+	return nil
+}
+
+// isSizedArray reports whether t is [N]T, which starts with N zero values
+// when it is declared without one
+func isSizedArray(t *ast.Type) bool {
+	return t != nil && t.ArrayType != nil && (t.ArraySize != nil || t.ArrayLen != nil)
+}
+
+func isNilLiteral(expr ast.Expression) bool {
+	lit, ok := expr.(*ast.Literal)
+	return ok && lit.Value == nil && lit.Token == "nil"
+}
+
+// optionalVar returns the symbol of expr if it names a variable of an
+// optional type, or nil
+func (d *dataflow) optionalVar(expr ast.Expression) *Symbol {
+	ident, ok := expr.(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+	sym, err := d.symbols.Resolve(ident.Name)
+	if err != nil || !d.types.isOptional(&sym.Type) {
+		return nil
+	}
+	return sym
+}
+
+// declaredType is the type a variable declaration gives its variable. Like
+// the analyzer's inference, it is empty when not written, unless the
+// value is an optional, which makes the variable optional too.
+func (d *dataflow) declaredType(decl *ast.VarDecl, st *flowState) ast.Type {
+	if t := writtenType(decl); t != nil {
+		return *t
+	}
+	if t := d.optionalType(decl.Value); t != nil && !d.nonNil(decl.Value, st) {
+		return *t
+	}
+	return ast.Type{}
+}
+
+// optionalType returns the type of expr if it is an optional variable or
+// a call to a function returning an optional, or nil
+func (d *dataflow) optionalType(expr ast.Expression) *ast.Type {
+	if sym := d.optionalVar(expr); sym != nil {
+		return &sym.Type
+	}
+	if fn := d.calledFunction(expr); fn != nil && d.types.isOptional(fn.Signature.ReturnType) {
+		return fn.Signature.ReturnType
+	}
+	return nil
+}
+
+// nonNil reports whether expr is known not to be nil in st
+func (d *dataflow) nonNil(expr ast.Expression, st *flowState) bool {
+	if isNilLiteral(expr) {
+		return false
+	}
+	if sym := d.optionalVar(expr); sym != nil {
+		return st.narrowed[sym]
+	}
+	return d.optionalType(expr) == nil
+}
+
+// calledFunction returns the declaration of the function expr calls by
+// name, or nil
+func (d *dataflow) calledFunction(expr ast.Expression) *ast.FuncDecl {
+	call, ok := expr.(*ast.FunctionCall)
+	if !ok {
+		return nil
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+	sym, err := d.symbols.Resolve(ident.Name)
+	if err != nil {
+		return nil
+	}
+	fn, _ := sym.DeclaredAt.(*ast.FuncDecl)
+	if fn == nil || fn.Signature == nil {
+		return nil
+	}
+	return fn
+}
+
+// writtenType returns the type a variable declaration names, or nil for
+// x := value, whose type the parser fills in
+func writtenType(decl *ast.VarDecl) *ast.Type {
+	if decl.Inferred {
+		return nil
+	}
+	return decl.Type
+}
+
+func (d *dataflow) varDecl(decl *ast.VarDecl, st *flowState) {
+	switch {
+	case decl.Value != nil && writtenType(decl) != nil:
+		d.flowInto(decl.Value, decl.Type, st)
+	case isNilLiteral(decl.Value):
+		d.report(decl.Value.Pos(), errors.ErrCodeNilSafety, "cannot infer a type from nil",
+			fmt.Sprintf("give '%s' an optional type, as in %s: ?int = nil", decl.Name.Name, decl.Name.Name))
+	default:
+		d.expr(decl.Value, st)
+	}
+
+	sym, err := d.symbols.Resolve(decl.Name.Name)
+	if !d.symbols.IsGlobal() {
+		if err = d.symbols.Define(decl.Name.Name, d.declaredType(decl, st), decl.Mutable, false, decl); err != nil {
+			// Redeclarations are reported by the other checks
+			return
+		}
+		sym, err = d.symbols.Resolve(decl.Name.Name)
+	}
+	if err != nil {
+		return
+	}
+	switch {
+	case decl.Value == nil && !d.types.isOptional(&sym.Type) && !isSizedArray(decl.Type) && !d.symbols.IsGlobal():
+		d.pending[sym] = true
+	case decl.Value != nil && d.types.isOptional(&sym.Type) && d.nonNil(decl.Value, st):
+		st.narrowed[sym] = true
+	}
+}
+
+func (d *dataflow) assign(s *ast.AssignmentStatement, st *flowState) {
+	sym, err := d.symbols.Resolve(s.Name.Name)
+	if err != nil {
+		d.expr(s.Value, st)
+		return
+	}
+	switch {
+	case sym.Type.String() != "unknown":
+		d.flowInto(s.Value, &sym.Type, st)
+	case isNilLiteral(s.Value):
+		d.report(s.Value.Pos(), errors.ErrCodeNilSafety, fmt.Sprintf("cannot assign nil to '%s'", s.Name.Name),
+			fmt.Sprintf("declare '%s' with an optional type, as in %s: ?int, to let it hold nil", s.Name.Name, s.Name.Name))
+	default:
+		d.expr(s.Value, st)
+	}
+
+	st.assigned[sym] = true
+	if d.types.isOptional(&sym.Type) {
+		if d.nonNil(s.Value, st) {
+			st.narrowed[sym] = true
+		} else {
+			delete(st.narrowed, sym)
+		}
+	}
+}
+
+// flowInto checks a value used where a value of type target is expected:
+// nil and unchecked optionals only flow into optional types
+func (d *dataflow) flowInto(value ast.Expression, target *ast.Type, st *flowState) {
+	if value == nil {
+		return
+	}
+	optional := d.types.isOptional(target)
+	switch {
+	case isNilLiteral(value) && !optional:
+		d.report(value.Pos(), errors.ErrCodeNilSafety, fmt.Sprintf("cannot use nil as %s", typeName(target)),
+			fmt.Sprintf("only an optional type such as ?%s can hold nil", typeName(target)))
+	case optional && d.optionalVar(value) != nil:
+		d.read(value.(*ast.Identifier), st, false)
+	default:
+		d.expr(value, st)
+	}
+}
+
+// read checks a read of a variable: that every path to it assigns the
+// variable, and, if checkNil is set, that an optional isn't nil
+func (d *dataflow) read(ident *ast.Identifier, st *flowState, checkNil bool) {
+	sym, err := d.symbols.Resolve(ident.Name)
+	if err != nil || st.dead {
+		return
+	}
+	if d.pending[sym] && !st.assigned[sym] {
+		d.report(ident.Position, errors.ErrCodeUninitialized, fmt.Sprintf("'%s' is used before it is assigned", ident.Name),
+			fmt.Sprintf("assign '%s' on every path before this, or give it a value where it is declared", ident.Name))
+		// Report each variable once per path
+		st.assigned[sym] = true
+		return
+	}
+	if checkNil && d.types.isOptional(&sym.Type) && !st.narrowed[sym] {
+		d.report(ident.Position, errors.ErrCodeNilSafety, fmt.Sprintf("'%s' may be nil", ident.Name),
+			fmt.Sprintf("check it first, as in if %s != nil { ... }", ident.Name))
+		st.narrowed[sym] = true
+	}
+}
+
+// expr checks the reads an expression makes. The right operand of && and
+// || is checked with what the left one shows when it runs.
+func (d *dataflow) expr(node ast.Expression, st *flowState) {
+	if node == nil {
+		return
+	}
+	switch e := node.(type) {
+	case *ast.Identifier:
+		d.read(e, st, true)
+	case *ast.BinaryExpression:
+		if sym := d.nilComparison(e); sym != nil {
+			if ident, ok := e.Left.(*ast.Identifier); ok {
+				d.read(ident, st, false)
+			} else {
+				d.read(e.Right.(*ast.Identifier), st, false)
+			}
+			return
+		}
+		d.expr(e.Left, st)
+		right := st
+		if e.Operator == "&&" || e.Operator == "||" {
+			right = st.copy()
+			whenTrue, whenFalse := d.narrowing(e.Left)
+			if e.Operator == "&&" {
+				narrow(right, whenTrue)
+			} else {
+				narrow(right, whenFalse)
+			}
+		}
+		d.expr(e.Right, right)
+	case *ast.FunctionCall:
+		fn := d.calledFunction(e)
+		if fn == nil || len(fn.Signature.Parameters) != len(e.Arguments) {
+			d.expr(e.Function, st)
+			for _, arg := range e.Arguments {
+				d.expr(arg, st)
+			}
+			return
+		}
+		for i, arg := range e.Arguments {
+			d.flowInto(arg, fn.Signature.Parameters[i].Type, st)
+		}
+	case *ast.StructLiteral:
+		fields := d.structFields(e)
+		for _, field := range e.Fields {
+			if t, ok := fields[field.Name.Name]; ok {
+				d.flowInto(field.Value, t, st)
+			} else {
+				d.expr(field.Value, st)
+			}
+		}
+	case *ast.MemberExpression:
+		// The property is a field or module member, not a name in scope
+		d.expr(e.Object, st)
+	case *ast.Literal:
+	default:
+		ast.Inspect(node, func(n ast.Node) bool {
+			if n == node {
+				return true
+			}
+			if child, ok := n.(ast.Expression); ok {
+				d.expr(child, st)
+			}
+			return false
+		})
+	}
+}
+
+// structFields returns the field types of the struct a literal of this
+// module builds
+func (d *dataflow) structFields(lit *ast.StructLiteral) map[string]*ast.Type {
+	fields := make(map[string]*ast.Type)
+	if lit.Module != nil || lit.Type == nil {
+		return fields
+	}
+	sym, err := d.symbols.Resolve(lit.Type.Name)
+	if err != nil {
+		return fields
+	}
+	if decl, ok := sym.DeclaredAt.(*ast.StructDecl); ok {
+		for _, field := range decl.Fields {
+			fields[field.Name.Name] = field.Type
+		}
+	}
+	return fields
+}
+
+func (d *dataflow) report(pos ast.Position, code, message, help string) {
+	if d.quiet == 0 {
+		d.a.errors.AddErrorWithHelp(pos, code, message, help)
+	}
+}
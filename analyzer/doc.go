@@ -0,0 +1,55 @@
+// Package analyzer checks a parsed Mars module before it runs. Each pass is
+// a method on Analyzer that reports through its MarsReporter, and the mars
+// commands run the passes in order over every module of a program.
+//
+// CheckConstants folds const declarations: literals, other constants,
+// arithmetic, string +, comparisons and && and ||. A variable, parameter or
+// call in a constant, or a constant defined in terms of itself, is E0020.
+// An int constant that overflows is E0002, like the same expression would
+// fail at runtime. Top-level constants may be used before they are
+// declared, local ones only after, and [N]T takes its size from the int
+// constant N.
+//
+// TypeChecker.resolve resolves an alias wherever it is used, while a
+// distinct type (type Meters int) is only compatible with itself.
+//
+// One engine, the inferrer in infer.go, types expressions for both
+// InferTypes and the type checks, recording each result in the analyzer's
+// TypeInfo keyed by the ast.Expression. It resolves names in a SymbolTable
+// and types through the TypeChecker, so aliases and optionals come out
+// resolved; builtins get their result types from builtinResults, and names
+// it can't see, such as module members, are unknown, which typesCompatible
+// accepts anywhere. An empty array literal takes the type expected where it
+// is used; for xs := [] the variable stays pending until a use fixes its
+// type, then the program is walked again so earlier uses see it.
+//
+// CheckImmutability declares variables, parameters, constants and functions
+// scope by scope, and follows element and field writes, and the first
+// argument of push, pop and reverse, back to the variable they start from,
+// so p.xs[0] = 1 needs p to be mut.
+//
+// CheckControlFlow builds a graph of basic blocks per function: if and
+// select branch and rejoin, loops test their condition in a head block that
+// continue returns to, break jumps past the loop and return to the exit.
+// Conditions aren't evaluated, except that a loop without one or with the
+// literal true only ends with break. A function with a return type whose
+// fall-off-the-end block is reachable is E0017, and the first statement of
+// each unreachable run gets W0004.
+//
+// CheckDataflow carries a flowState through each function and the top
+// level: the variables declared without a value that are assigned on every
+// path, and the optionals known not to be nil. Branches rejoin by
+// intersection, return, break and continue make the state dead, and loop
+// bodies are walked quietly until the state at the loop test stops
+// changing, then once more to report. Conditions narrow through x != nil, x
+// == nil, !, && and ||.
+//
+// CheckUnused declares names scope by scope and marks a Symbol used when an
+// expression or type annotation reads it; assignments don't count, and
+// neither does a function calling itself. Unused variables, parameters and
+// private functions and structs are W0001. _ is never declared.
+//
+// Undefined names and fields are reported with the closest candidate that
+// errors.Suggest finds among the visible names, builtins and value
+// keywords, or the struct's fields.
+package analyzer
@@ -0,0 +1,249 @@
+package analyzer
+
+import (
+	"fmt"
+	"mars/ast"
+	"mars/errors"
+)
+
+// CheckControlFlow builds a control-flow graph for each function and
+// reports functions with a return type that can reach the end of their
+// body without returning (E0017). Statements no path reaches, such as code
+// after return, break or continue, or after a loop that never exits, are
+// reported as warnings.
+func (a *Analyzer) CheckControlFlow(program *ast.Program) error {
+	for _, decl := range program.Declarations {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+			a.checkFunctionFlow(fn)
+		}
+	}
+
+	if a.errors.HasErrors() {
+		return fmt.Errorf("%s", a.errors.String())
+	}
+	return nil
+}
+
+func (a *Analyzer) checkFunctionFlow(fn *ast.FuncDecl) {
+	graph := buildFlowGraph(fn.Body)
+	reachable := graph.reachable()
+
+	// Report the first statement of each unreachable run, not every
+	// statement in it
+	for _, placed := range graph.placed {
+		if !reachable[placed.block] && placed.prev != nil && reachable[placed.prev] {
+			a.errors.AddWarning(placed.stmt.Pos(), errors.WarnCodeUnreachable,
+				"unreachable code",
+				"no path reaches this statement; remove it or the jump before it")
+		}
+	}
+
+	if fn.Signature.ReturnType != nil && reachable[graph.end] {
+		a.errors.AddErrorWithHelp(fn.Name.Position, errors.ErrCodeControlFlowError,
+			fmt.Sprintf("missing return at end of function '%s'", fn.Name.Name),
+			fmt.Sprintf("every path through '%s' must return a value of type %s", fn.Name.Name, typeName(fn.Signature.ReturnType)))
+	}
+}
+
+// flowBlock is a node of a control-flow graph: statements that run in
+// order, then a jump to one of the successors
+type flowBlock struct {
+	stmts []ast.Statement
+	succs []*flowBlock
+}
+
+// flowGraph is the control-flow graph of a function body. Returns jump to
+// exit, and end is the block that falls off the end of the body.
+type flowGraph struct {
+	entry  *flowBlock
+	exit   *flowBlock
+	end    *flowBlock
+	blocks []*flowBlock
+	placed []placedStmt
+}
+
+// placedStmt is a statement with the block it starts in, and the block the
+// statement before it in the same list starts in; nil for the first one
+type placedStmt struct {
+	stmt  ast.Statement
+	block *flowBlock
+	prev  *flowBlock
+}
+
+// loopTargets are the blocks break and continue jump to in a loop
+type loopTargets struct {
+	breakTo    *flowBlock
+	continueTo *flowBlock
+}
+
+type flowBuilder struct {
+	graph   *flowGraph
+	current *flowBlock // nil right after a jump
+	loops   []loopTargets
+}
+
+func buildFlowGraph(body *ast.BlockStatement) *flowGraph {
+	b := &flowBuilder{graph: &flowGraph{}}
+	b.graph.entry = b.newBlock()
+	b.graph.exit = b.newBlock()
+	b.current = b.graph.entry
+	b.stmts(body.Statements)
+	b.graph.end = b.block()
+	return b.graph
+}
+
+// reachable returns the blocks some path from the entry reaches
+func (g *flowGraph) reachable() map[*flowBlock]bool {
+	seen := map[*flowBlock]bool{g.entry: true}
+	work := []*flowBlock{g.entry}
+	for len(work) > 0 {
+		block := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, succ := range block.succs {
+			if !seen[succ] {
+				seen[succ] = true
+				work = append(work, succ)
+			}
+		}
+	}
+	return seen
+}
+
+func (b *flowBuilder) newBlock() *flowBlock {
+	block := &flowBlock{}
+	b.graph.blocks = append(b.graph.blocks, block)
+	return block
+}
+
+// block returns the block the next statement runs in. Code after a jump
+// starts a block nothing jumps to.
+func (b *flowBuilder) block() *flowBlock {
+	if b.current == nil {
+		b.current = b.newBlock()
+	}
+	return b.current
+}
+
+// jump ends the current block with an edge to target
+func (b *flowBuilder) jump(target *flowBlock) {
+	if b.current != nil && target != nil {
+		b.current.succs = append(b.current.succs, target)
+	}
+	b.current = nil
+}
+
+// branch starts a block that from may continue to
+func (b *flowBuilder) branch(from *flowBlock) *flowBlock {
+	block := b.newBlock()
+	from.succs = append(from.succs, block)
+	return block
+}
+
+func (b *flowBuilder) stmts(list []ast.Statement) {
+	var prev *flowBlock
+	for _, stmt := range list {
+		block := b.block()
+		b.graph.placed = append(b.graph.placed, placedStmt{stmt: stmt, block: block, prev: prev})
+		b.stmt(stmt)
+		prev = block
+	}
+}
+
+func (b *flowBuilder) body(block *ast.BlockStatement) {
+	if block != nil {
+		b.stmts(block.Statements)
+	}
+}
+
+func (b *flowBuilder) stmt(stmt ast.Statement) {
+	current := b.block()
+	current.stmts = append(current.stmts, stmt)
+
+	switch s := stmt.(type) {
+	case *ast.ReturnStatement:
+		b.jump(b.graph.exit)
+	case *ast.BreakStatement:
+		// break and continue outside a loop are reported by CheckTypes
+		var target *flowBlock
+		if len(b.loops) > 0 {
+			target = b.loops[len(b.loops)-1].breakTo
+		}
+		b.jump(target)
+	case *ast.ContinueStatement:
+		var target *flowBlock
+		if len(b.loops) > 0 {
+			target = b.loops[len(b.loops)-1].continueTo
+		}
+		b.jump(target)
+	case *ast.BlockStatement:
+		b.stmts(s.Statements)
+	case *ast.IfStatement:
+		after := b.newBlock()
+		b.current = b.branch(current)
+		b.body(s.Consequence)
+		b.jump(after)
+		b.current = b.branch(current)
+		b.body(s.Alternative)
+		b.jump(after)
+		b.current = after
+	case *ast.ForStatement:
+		if s.Init != nil {
+			current.stmts = append(current.stmts, s.Init)
+		}
+		post := b.newBlock()
+		if s.Post != nil {
+			post.stmts = append(post.stmts, s.Post)
+		}
+		b.loop(s.Condition, s.Body, post)
+	case *ast.WhileStatement:
+		b.loop(s.Condition, s.Body, nil)
+	case *ast.SelectStatement:
+		// select runs exactly one of its bodies
+		after := b.newBlock()
+		for _, c := range s.Cases {
+			b.current = b.branch(current)
+			b.body(c.Body)
+			b.jump(after)
+		}
+		if s.Default != nil {
+			b.current = b.branch(current)
+			b.body(s.Default)
+			b.jump(after)
+		}
+		b.current = after
+	}
+}
+
+// loop adds a loop that tests condition before each run of body. continue
+// jumps to post, which runs the for statement's post statement, if any,
+// and goes back to the test. Without a condition, or with the condition
+// true, only break leaves the loop.
+func (b *flowBuilder) loop(condition ast.Expression, body *ast.BlockStatement, post *flowBlock) {
+	head := b.newBlock()
+	after := b.newBlock()
+	if post == nil {
+		post = head
+	} else {
+		post.succs = append(post.succs, head)
+	}
+	b.jump(head)
+	if !alwaysTrue(condition) {
+		head.succs = append(head.succs, after)
+	}
+
+	b.current = b.branch(head)
+	b.loops = append(b.loops, loopTargets{breakTo: after, continueTo: post})
+	b.body(body)
+	b.loops = b.loops[:len(b.loops)-1]
+	b.jump(post)
+	b.current = after
+}
+
+// alwaysTrue reports whether a loop condition is missing or the literal true
+func alwaysTrue(condition ast.Expression) bool {
+	if condition == nil {
+		return true
+	}
+	lit, ok := condition.(*ast.Literal)
+	return ok && lit.Value == true
+}
@@ -1,8 +1,19 @@
 package analyzer
 
-// ImmutabilityChecker verifies immutability rules
+import (
+	"fmt"
+	"mars/ast"
+	"mars/errors"
+)
+
+// ImmutabilityChecker verifies immutability rules: only variables and
+// parameters declared mut can be assigned, have their array elements or
+// struct fields written, or be passed to a builtin that changes an array in
+// place. A write through elements and fields, as in p.xs[0] = 1, needs the
+// variable it starts from to be mut.
 type ImmutabilityChecker struct {
-	errors []Error
+	errors  *errors.MarsReporter
+	symbols *SymbolTable
 }
 
 // NewImmutabilityChecker creates a new immutability checker instance
@@ -10,61 +21,215 @@ func NewImmutabilityChecker() *ImmutabilityChecker {
 	return &ImmutabilityChecker{}
 }
 
-//
-//// CheckAssignment verifies that an assignment is valid according to immutability rules
-//func (ic *ImmutabilityChecker) CheckAssignment(target ast.Expression, value ast.Expression) error {
-//	// TODO: Implement assignment checking
-//	// - Variables must be marked as mutable to be assigned
-//	// - Struct fields must be mutable to be assigned
-//	// - Array elements must be mutable to be assigned
-//	return nil
-//}
-//
-//// CheckMutation verifies that a mutation operation is valid
-//func (ic *ImmutabilityChecker) CheckMutation(expr ast.Expression) error {
-//	switch e := expr.(type) {
-//	case *ast.Identifier:
-//		return ic.checkIdentifierMutation(e)
-//	case *ast.MemberExpr:
-//		return ic.checkMemberMutation(e)
-//	case *ast.IndexExpr:
-//		return ic.checkIndexMutation(e)
-//	default:
-//		return fmt.Errorf("cannot mutate expression of type %T", expr)
-//	}
-//}
-//
-//// checkIdentifierMutation verifies that an identifier can be mutated
-//func (ic *ImmutabilityChecker) checkIdentifierMutation(id *ast.Identifier) error {
-//	// TODO: Look up identifier in symbol table and check if mutable
-//	return nil
-//}
-//
-//// checkMemberMutation verifies that a struct member can be mutated
-//func (ic *ImmutabilityChecker) checkMemberMutation(expr *ast.MemberExpr) error {
-//	// TODO: Check if struct field is mutable
-//	return nil
-//}
-//
-//// checkIndexMutation verifies that an array element can be mutated
-//func (ic *ImmutabilityChecker) checkIndexMutation(expr *ast.IndexExpr) error {
-//	// TODO: Check if array element type is mutable
-//	return nil
-//}
-//
-//// IsMutableType determines if a type is mutable
-//func (ic *ImmutabilityChecker) IsMutableType(typ ast.Type) bool {
-//	switch t := typ.(type) {
-//	case *ast.BasicType:
-//		return false // Basic types are always immutable
-//	case *ast.ArrayType:
-//		return ic.IsMutableType(t.ElementType)
-//	case *ast.StructType:
-//		// TODO: Check if any fields are mutable
-//		return false
-//	case *ast.PointerType:
-//		return true // Pointers are always mutable
-//	default:
-//		return false
-//	}
-//}
+// mutatingBuiltins change the array passed as their first argument
+var mutatingBuiltins = map[string]bool{"push": true, "pop": true, "reverse": true}
+
+// Check reports the writes program makes to immutable variables, constants,
+// parameters and functions
+func (ic *ImmutabilityChecker) Check(program *ast.Program, reporter *errors.MarsReporter) {
+	ic.errors = reporter
+	ic.symbols = NewSymbolTable()
+	for _, decl := range program.Declarations {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			ic.symbols.Define(d.Name.Name, ast.Type{}, false, true, d)
+		case *ast.VarDecl:
+			ic.symbols.Define(d.Name.Name, ast.Type{}, d.Mutable, false, d)
+		case *ast.ConstDecl:
+			ic.symbols.Define(d.Name.Name, ast.Type{}, false, false, d)
+		}
+	}
+
+	for _, decl := range program.Declarations {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			ic.function(d)
+		case *ast.UnsafeBlock:
+			ic.block(d.Body)
+		case ast.Statement:
+			ic.stmt(d)
+		}
+	}
+}
+
+func (ic *ImmutabilityChecker) function(fn *ast.FuncDecl) {
+	ic.symbols.EnterScope()
+	defer ic.symbols.ExitScope()
+	if fn.Signature != nil {
+		for _, param := range fn.Signature.Parameters {
+			var typ ast.Type
+			if param.Type != nil {
+				typ = *param.Type
+			}
+			// Parameters aren't nodes, so they are declared at their name
+			ic.symbols.Define(param.Name.Name, typ, param.Mutable, false, param.Name)
+		}
+	}
+	ic.block(fn.Body)
+}
+
+func (ic *ImmutabilityChecker) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	ic.symbols.EnterScope()
+	for _, stmt := range block.Statements {
+		ic.stmt(stmt)
+	}
+	ic.symbols.ExitScope()
+}
+
+func (ic *ImmutabilityChecker) stmt(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.VarDecl:
+		ic.expr(s.Value)
+		if !ic.symbols.IsGlobal() {
+			ic.symbols.Define(s.Name.Name, ast.Type{}, s.Mutable, false, s)
+		}
+	case *ast.ConstDecl:
+		if !ic.symbols.IsGlobal() {
+			ic.symbols.Define(s.Name.Name, ast.Type{}, false, false, s)
+		}
+	case *ast.AssignmentStatement:
+		ic.expr(s.Value)
+		ic.write(s.Name, s.Name.Position, "assign to", "")
+	case *ast.IndexAssignmentStatement:
+		ic.expr(s.Object)
+		ic.expr(s.Index)
+		ic.expr(s.Value)
+		if root := rootVariable(s.Object); root != nil {
+			ic.write(root, s.Position, "assign to an element of", "")
+		}
+	case *ast.FieldAssignmentStatement:
+		ic.expr(s.Object)
+		ic.expr(s.Value)
+		if root := rootVariable(s.Object); root != nil {
+			ic.write(root, s.Position, "assign to a field of", "")
+		}
+	case *ast.BlockStatement:
+		ic.block(s)
+	case *ast.IfStatement:
+		ic.expr(s.Condition)
+		ic.block(s.Consequence)
+		ic.block(s.Alternative)
+	case *ast.ForStatement:
+		ic.symbols.EnterScope()
+		if s.Init != nil {
+			ic.stmt(s.Init)
+		}
+		ic.expr(s.Condition)
+		if s.Post != nil {
+			ic.stmt(s.Post)
+		}
+		ic.block(s.Body)
+		ic.symbols.ExitScope()
+	case *ast.WhileStatement:
+		ic.expr(s.Condition)
+		ic.block(s.Body)
+	case *ast.SelectStatement:
+		for _, c := range s.Cases {
+			ic.expr(c.Channel)
+			ic.expr(c.Value)
+			ic.symbols.EnterScope()
+			if c.Name != nil {
+				ic.symbols.Define(c.Name.Name, ast.Type{}, false, false, c)
+			}
+			ic.block(c.Body)
+			ic.symbols.ExitScope()
+		}
+		ic.block(s.Default)
+	default:
+		// The other statements only hold expressions
+		ic.expr(stmt)
+	}
+}
+
+// expr reports the builtin calls in an expression that change an
+// immutable array
+func (ic *ImmutabilityChecker) expr(node ast.Node) {
+	if node == nil {
+		return
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		call, ok := n.(*ast.FunctionCall)
+		if !ok || len(call.Arguments) == 0 {
+			return true
+		}
+		ident, ok := call.Function.(*ast.Identifier)
+		if !ok || !mutatingBuiltins[ident.Name] {
+			return true
+		}
+		// A function of the program may shadow the builtin
+		if _, err := ic.symbols.Resolve(ident.Name); err == nil {
+			return true
+		}
+		if root := rootVariable(call.Arguments[0]); root != nil {
+			ic.write(root, call.Position, "modify", " with "+ident.Name)
+		}
+		return true
+	})
+}
+
+// rootVariable returns the variable an element or field expression such as
+// p.xs[0] starts from, or nil if it starts from another value, such as a
+// call's result
+func rootVariable(expr ast.Expression) *ast.Identifier {
+	for {
+		switch e := expr.(type) {
+		case *ast.Identifier:
+			return e
+		case *ast.IndexExpression:
+			expr = e.Object
+		case *ast.SliceExpression:
+			expr = e.Object
+		case *ast.MemberExpression:
+			expr = e.Object
+		default:
+			return nil
+		}
+	}
+}
+
+// write reports a write to the variable name if it wasn't declared mut,
+// as "cannot <verb> immutable variable 'x'<via>"
+func (ic *ImmutabilityChecker) write(name *ast.Identifier, pos ast.Position, verb, via string) {
+	symbol, err := ic.symbols.Resolve(name.Name)
+	if err != nil || symbol.IsMutable {
+		// Undefined names and modules are reported by the other checks
+		return
+	}
+
+	var kind, help string
+	var declared ast.Position
+	switch d := symbol.DeclaredAt.(type) {
+	case *ast.VarDecl:
+		kind = "immutable variable"
+		example := fmt.Sprintf("mut %s := ...", d.Name.Name)
+		if d.Type != nil && !d.Inferred {
+			example = fmt.Sprintf("mut %s: %s", d.Name.Name, typeName(d.Type))
+		}
+		help = fmt.Sprintf("add 'mut' to its declaration on line %d: %s", d.Name.Position.Line, example)
+		declared = d.Name.Position
+	case *ast.Identifier:
+		kind = "immutable parameter"
+		help = fmt.Sprintf("declare the parameter on line %d as mut: mut %s: %s", d.Position.Line, name.Name, typeName(&symbol.Type))
+		declared = d.Position
+	case *ast.ConstDecl:
+		kind = "constant"
+		help = fmt.Sprintf("declare a variable instead of the constant on line %d: mut %s := ...", d.Name.Position.Line, name.Name)
+		declared = d.Name.Position
+	case *ast.SelectCase:
+		kind = "immutable variable"
+		help = fmt.Sprintf("copy the received value into a mut variable first: mut v := %s;", name.Name)
+		declared = d.Position
+	case *ast.FuncDecl:
+		kind = "function"
+		help = "functions can't be reassigned; declare a mut variable holding the function instead"
+		declared = d.Name.Position
+	default:
+		return
+	}
+	ic.errors.AddErrorWithHelp(pos, errors.ErrCodeImmutable,
+		fmt.Sprintf("cannot %s %s '%s'%s", verb, kind, name.Name, via), help)
+	ic.errors.Relate(declared, fmt.Sprintf("'%s' is declared here", name.Name))
+}
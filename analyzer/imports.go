@@ -0,0 +1,211 @@
+package analyzer
+
+import (
+	"fmt"
+	"mars/ast"
+	"mars/errors"
+)
+
+// CheckImports verifies a module's references into the modules it imports:
+// that each import names a loaded module, that import names don't collide
+// with each other or with top-level declarations, and that every mod.name
+// refers to a public top-level declaration of the imported module. Fields
+// of structs declared in other modules must be public to be initialized or
+// read. modules maps import paths to the programs loaded for them.
+func (a *Analyzer) CheckImports(program *ast.Program, modules map[string]*ast.Program) error {
+	imports := make(map[string]*ast.ImportDecl)
+	members := make(map[string]map[string]ast.Node)
+
+	for _, decl := range program.Declarations {
+		imp, ok := decl.(*ast.ImportDecl)
+		if !ok {
+			continue
+		}
+
+		if prev, exists := imports[imp.Name]; exists {
+			a.errors.AddErrorWithHelp(imp.Position, errors.ErrCodeImportError,
+				fmt.Sprintf("%q imported twice, from %q and %q", imp.Name, prev.Path, imp.Path),
+				"two imported modules cannot share a name")
+			continue
+		}
+
+		imported, ok := modules[imp.Path]
+		if !ok {
+			a.errors.AddError(imp.Position, errors.ErrCodeImportError,
+				fmt.Sprintf("module %q is not loaded", imp.Path))
+			continue
+		}
+
+		imports[imp.Name] = imp
+		members[imp.Name] = topLevelDeclarations(imported)
+	}
+
+	for _, decl := range program.Declarations {
+		name := declarationName(decl)
+		if imp, ok := imports[name]; ok {
+			a.errors.AddErrorWithHelp(decl.Pos(), errors.ErrCodeDuplicateDecl,
+				fmt.Sprintf("%q is already declared by the import of %q", name, imp.Path),
+				"rename the declaration, or the module it conflicts with")
+		}
+	}
+
+	globals := &visibilityChecker{a: a, imports: imports, members: members, vars: map[string]*structRef{}}
+	for _, decl := range program.Declarations {
+		shadowed := map[string]ast.Position{}
+		checker := globals
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			shadowed = localNames(fn)
+			checker = globals.enter(fn, shadowed)
+		}
+		a.checkModuleReferences(decl, imports, members, shadowed)
+		checker.check(decl)
+	}
+
+	if a.errors.HasErrors() {
+		return fmt.Errorf("%s", a.errors.String())
+	}
+	return nil
+}
+
+// checkModuleReferences reports mod.name expressions within node whose
+// module doesn't declare name, and calls with the wrong number of arguments
+func (a *Analyzer) checkModuleReferences(node ast.Node, imports map[string]*ast.ImportDecl,
+	members map[string]map[string]ast.Node, shadowed map[string]ast.Position) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.MemberExpression:
+			a.resolveModuleMember(n, imports, members, shadowed)
+		case *ast.FunctionCall:
+			member, ok := n.Function.(*ast.MemberExpression)
+			if !ok || !isModuleReference(member, imports, shadowed) {
+				break
+			}
+			if fn, ok := a.resolveModuleMember(member, imports, members, shadowed).(*ast.FuncDecl); ok && fn.Signature != nil &&
+				len(n.Arguments) != len(fn.Signature.Parameters) {
+				a.errors.AddErrorWithHelp(n.Position, errors.ErrCodeFunctionCallError,
+					fmt.Sprintf("wrong number of arguments in call to '%s'", member.String()),
+					fmt.Sprintf("expected %d arguments, got %d", len(fn.Signature.Parameters), len(n.Arguments)))
+			}
+
+			// The callee is checked; only the arguments are left
+			for _, arg := range n.Arguments {
+				a.checkModuleReferences(arg, imports, members, shadowed)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+// isModuleReference reports whether expr is mod.name for an imported
+// module, rather than a member of a local variable declared earlier
+func isModuleReference(expr *ast.MemberExpression, imports map[string]*ast.ImportDecl, shadowed map[string]ast.Position) bool {
+	object, ok := expr.Object.(*ast.Identifier)
+	if !ok || imports[object.Name] == nil || expr.Property == nil {
+		return false
+	}
+	local, ok := shadowed[object.Name]
+	return !ok || positionBefore(object.Position, local)
+}
+
+func positionBefore(a, b ast.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// resolveModuleMember returns the declaration expr refers to when it is
+// mod.name for an imported module, reporting an error if the module has no
+// such member. It returns nil for any other expression.
+func (a *Analyzer) resolveModuleMember(expr *ast.MemberExpression, imports map[string]*ast.ImportDecl,
+	members map[string]map[string]ast.Node, shadowed map[string]ast.Position) ast.Node {
+	if !isModuleReference(expr, imports, shadowed) {
+		return nil
+	}
+	object := expr.Object.(*ast.Identifier)
+	imp := imports[object.Name]
+
+	decl, ok := members[object.Name][expr.Property.Name]
+	if !ok {
+		a.errors.AddErrorWithHelp(expr.Property.Position, errors.ErrCodeUndefinedVar,
+			fmt.Sprintf("module %q has no member %q", imp.Path, expr.Property.Name),
+			fmt.Sprintf("only top-level functions, structs, types, constants and variables of %q can be referenced", imp.Path))
+		return nil
+	}
+	if !isPublic(decl) {
+		a.errors.AddErrorWithHelp(expr.Property.Position, errors.ErrCodePrivateAccess,
+			fmt.Sprintf("%q is not public in module %q", expr.Property.Name, imp.Path),
+			fmt.Sprintf("mark the declaration 'pub' in %q to use it from other modules", imp.Path))
+		return nil
+	}
+	return decl
+}
+
+// isPublic reports whether a top-level declaration was marked 'pub'
+func isPublic(decl ast.Node) bool {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Public
+	case *ast.StructDecl:
+		return d.Public
+	case *ast.VarDecl:
+		return d.Public
+	case *ast.ConstDecl:
+		return d.Public
+	case *ast.TypeDecl:
+		return d.Public
+	}
+	return false
+}
+
+// topLevelDeclarations maps the names of a program's top-level functions,
+// structs, types, constants and variables to their declarations
+func topLevelDeclarations(program *ast.Program) map[string]ast.Node {
+	decls := make(map[string]ast.Node)
+	for _, decl := range program.Declarations {
+		if name := declarationName(decl); name != "" {
+			decls[name] = decl
+		}
+	}
+	return decls
+}
+
+// declarationName returns the name a top-level function, struct, type,
+// constant or variable declares, or "" for any other declaration
+func declarationName(decl ast.Declaration) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Name.Name
+	case *ast.StructDecl:
+		return d.Name.Name
+	case *ast.VarDecl:
+		return d.Name.Name
+	case *ast.ConstDecl:
+		return d.Name.Name
+	case *ast.TypeDecl:
+		return d.Name.Name
+	}
+	return ""
+}
+
+// localNames maps the parameters and variables declared within fn to
+// where they start shadowing imported module names
+func localNames(fn *ast.FuncDecl) map[string]ast.Position {
+	names := make(map[string]ast.Position)
+	if fn.Signature != nil {
+		for _, param := range fn.Signature.Parameters {
+			names[param.Name.Name] = fn.Position
+		}
+	}
+	if fn.Body != nil {
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			decl, ok := n.(*ast.VarDecl)
+			if !ok {
+				return true
+			}
+			if pos, seen := names[decl.Name.Name]; !seen || positionBefore(decl.Position, pos) {
+				names[decl.Name.Name] = decl.Position
+			}
+			return true
+		})
+	}
+	return names
+}
@@ -0,0 +1,808 @@
+package analyzer
+
+import (
+	"fmt"
+	"mars/ast"
+	"mars/errors"
+	"sort"
+)
+
+// TypeInfo records the type inferred for each expression of a program, so
+// the evaluator, the formatter and editor tooling can look types up rather
+// than infer them again. Aliases and optionals are recorded resolved, as
+// the checks compare them, and expressions whose type the analyzer can't
+// see, such as another module's members, are recorded as unknown.
+type TypeInfo struct {
+	types map[ast.Expression]*ast.Type
+}
+
+// NewTypeInfo creates an empty type table
+func NewTypeInfo() *TypeInfo {
+	return &TypeInfo{types: make(map[ast.Expression]*ast.Type)}
+}
+
+// TypeOf returns the type inferred for expr, or nil if expr wasn't inferred
+func (ti *TypeInfo) TypeOf(expr ast.Expression) *ast.Type {
+	return ti.types[expr]
+}
+
+func (ti *TypeInfo) record(expr ast.Expression, t *ast.Type) *ast.Type {
+	ti.types[expr] = t
+	return t
+}
+
+func unknownType() *ast.Type {
+	return &ast.Type{BaseType: "unknown"}
+}
+
+// isUnknown reports whether t, or the innermost element type of an array
+// t, is unknown
+func isUnknown(t *ast.Type) bool {
+	for t != nil && t.ArrayType != nil {
+		t = t.ArrayType
+	}
+	return t == nil || t.BaseType == "unknown"
+}
+
+// isEmptyArray reports whether expr is [], or an array literal holding only
+// empty array literals, such as [[]], which has no type of its own
+func isEmptyArray(expr ast.Expression) bool {
+	lit, ok := expr.(*ast.ArrayLiteral)
+	if !ok {
+		return false
+	}
+	for _, elem := range lit.Elements {
+		if !isEmptyArray(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// isIntLiteral reports whether expr is an int literal, possibly negated
+func isIntLiteral(expr ast.Expression) bool {
+	if unary, ok := expr.(*ast.UnaryExpression); ok && unary.Operator == "-" {
+		expr = unary.Right
+	}
+	lit, ok := expr.(*ast.Literal)
+	if !ok {
+		return false
+	}
+	_, ok = lit.Value.(int)
+	return ok
+}
+
+// firstElement returns the first element of lit if it is an array literal
+func firstElement(lit *ast.ArrayLiteral) (*ast.ArrayLiteral, bool) {
+	if len(lit.Elements) == 0 {
+		return nil, false
+	}
+	elem, ok := lit.Elements[0].(*ast.ArrayLiteral)
+	return elem, ok
+}
+
+// inferrer assigns types to expressions, looking names up in symbols, and
+// records the type of every expression it visits in info
+type inferrer struct {
+	symbols *SymbolTable
+	types   *TypeChecker
+	info    *TypeInfo
+}
+
+// infer returns the type of expr, recording it and the types of the
+// expressions inside it
+func (in *inferrer) infer(expr ast.Expression) *ast.Type {
+	return in.inferAs(expr, nil)
+}
+
+// inferAs is infer for expr used where a value of type expected is wanted,
+// or nil if nothing is expected. Only empty array literals, which have no
+// type of their own, take their type from expected.
+func (in *inferrer) inferAs(expr ast.Expression, expected *ast.Type) *ast.Type {
+	if expr == nil {
+		return unknownType()
+	}
+	return in.info.record(expr, in.typeOf(expr, expected))
+}
+
+func (in *inferrer) typeOf(expr ast.Expression, expected *ast.Type) *ast.Type {
+	switch e := expr.(type) {
+	case *ast.Literal:
+		return in.types.literalType(e)
+
+	case *ast.Identifier:
+		symbol, err := in.symbols.Resolve(e.Name)
+		if err != nil {
+			return unknownType()
+		}
+		return in.types.resolve(&symbol.Type)
+
+	case *ast.FunctionCall:
+		return in.call(e)
+
+	case *ast.BinaryExpression:
+		return in.binary(e)
+
+	case *ast.UnaryExpression:
+		right := in.infer(e.Right)
+		switch e.Operator {
+		case "!":
+			return &ast.Type{BaseType: "bool"}
+		case "-", "^":
+			return right
+		default:
+			return unknownType()
+		}
+
+	case *ast.ArrayLiteral:
+		return in.array(e, expected)
+
+	case *ast.StructLiteral:
+		structType := &ast.Type{StructName: e.Type.Name}
+		fields := in.structFields(e.Type.Name)
+		if e.Module != nil {
+			structType = &ast.Type{StructName: e.Module.Name + "." + e.Type.Name}
+			fields = make(map[string]*ast.Type)
+		}
+		in.info.record(e.Type, structType)
+		for _, field := range e.Fields {
+			fieldType := fields[field.Name.Name]
+			in.inferAs(field.Value, fieldType)
+			if fieldType == nil {
+				fieldType = unknownType()
+			}
+			in.info.record(field.Name, in.types.resolve(fieldType))
+		}
+		return structType
+
+	case *ast.MemberExpression:
+		// Module members and fields of values of unknown type are unknown
+		object := in.types.underlying(in.infer(e.Object))
+		field := unknownType()
+		if t := in.structFields(object.StructName)[e.Property.Name]; t != nil {
+			field = in.types.resolve(t)
+		}
+		return in.info.record(e.Property, field)
+
+	case *ast.IndexExpression:
+		object := in.types.underlying(in.infer(e.Object))
+		in.infer(e.Index)
+		switch {
+		case object.ArrayType != nil:
+			return in.types.resolve(object.ArrayType)
+		case object.BaseType == "string":
+			// Indexing a string gives a one-character string
+			return object
+		}
+		return unknownType()
+
+	case *ast.SliceExpression:
+		object := in.types.underlying(in.infer(e.Object))
+		if e.Start != nil {
+			in.infer(e.Start)
+		}
+		if e.End != nil {
+			in.infer(e.End)
+		}
+		switch {
+		case object.ArrayType != nil:
+			// Slicing a fixed array gives a slice
+			return &ast.Type{ArrayType: object.ArrayType}
+		case object.BaseType == "string":
+			return object
+		}
+		return unknownType()
+
+	case *ast.ChanLiteral:
+		if e.Capacity != nil {
+			in.infer(e.Capacity)
+		}
+		return &ast.Type{ChanType: e.ElemType}
+
+	default:
+		return unknownType()
+	}
+}
+
+// structFields returns the field types of the struct named name, which
+// are empty if name isn't a struct of this module
+func (in *inferrer) structFields(name string) map[string]*ast.Type {
+	fields := make(map[string]*ast.Type)
+	symbol, err := in.symbols.Resolve(name)
+	if err != nil || symbol.Type.StructName != name {
+		return fields
+	}
+	for _, field := range symbol.Type.StructFields {
+		if field.Name != nil {
+			fields[field.Name.Name] = field.Type
+		}
+	}
+	return fields
+}
+
+// array infers an array literal. Its element type is that of the first
+// element whose type is known; empty arrays among the elements take it, as
+// does an empty literal from expected.
+func (in *inferrer) array(lit *ast.ArrayLiteral, expected *ast.Type) *ast.Type {
+	var expectedElem *ast.Type
+	if expected != nil {
+		expectedElem = in.types.underlying(expected).ArrayType
+	}
+	if len(lit.Elements) == 0 {
+		switch {
+		case expectedElem != nil:
+			return &ast.Type{ArrayType: expectedElem}
+		case in.info.TypeOf(lit) != nil:
+			// An earlier pass fixed its type from the way it is used
+			return in.info.TypeOf(lit)
+		}
+		return &ast.Type{ArrayType: unknownType()}
+	}
+
+	types := make([]*ast.Type, len(lit.Elements))
+	for i, elem := range lit.Elements {
+		types[i] = in.inferAs(elem, expectedElem)
+		if isSizedInt(in.types.resolve(expectedElem)) && isIntLiteral(elem) {
+			// Like a constant, an int literal takes the sized type expected
+			types[i] = in.info.record(elem, expectedElem)
+		}
+	}
+	elemType := types[0]
+	for _, t := range types {
+		if !isUnknown(t) {
+			elemType = t
+			break
+		}
+	}
+	if isUnknown(elemType) && expectedElem != nil {
+		elemType = expectedElem
+	}
+	if !isUnknown(elemType) {
+		for i, elem := range lit.Elements {
+			if isEmptyArray(elem) && isUnknown(types[i]) {
+				in.inferAs(elem, elemType)
+			}
+		}
+	}
+	return &ast.Type{ArrayType: elemType}
+}
+
+// call infers a function call: a conversion, a call to a function of the
+// program, or a builtin
+func (in *inferrer) call(call *ast.FunctionCall) *ast.Type {
+	if target := in.types.conversionTarget(call); target != nil {
+		for _, arg := range call.Arguments {
+			in.infer(arg)
+		}
+		return target
+	}
+
+	ident, ok := call.Function.(*ast.Identifier)
+	if ok {
+		if symbol, err := in.symbols.Resolve(ident.Name); err == nil {
+			in.infer(ident)
+			sig := symbol.Type.GetFunctionSignature()
+			if !symbol.IsFunction || sig == nil {
+				for _, arg := range call.Arguments {
+					in.infer(arg)
+				}
+				return unknownType()
+			}
+			for i, arg := range call.Arguments {
+				var param *ast.Type
+				if i < len(sig.Parameters) {
+					param = sig.Parameters[i].Type
+				}
+				in.inferAs(arg, param)
+			}
+			if sig.ReturnType == nil {
+				return &ast.Type{BaseType: "void"}
+			}
+			return in.types.resolve(sig.ReturnType)
+		}
+		if result, isBuiltin := builtinResults[ident.Name]; isBuiltin {
+			in.info.record(ident, &ast.Type{BaseType: "function"})
+			args := make([]*ast.Type, len(call.Arguments))
+			for i, arg := range call.Arguments {
+				args[i] = in.infer(arg)
+			}
+			return result(args)
+		}
+	}
+
+	// Calls of module members and other values
+	in.infer(call.Function)
+	for _, arg := range call.Arguments {
+		in.infer(arg)
+	}
+	return unknownType()
+}
+
+// binary infers a binary expression from its operands
+func (in *inferrer) binary(expr *ast.BinaryExpression) *ast.Type {
+	leftType := in.infer(expr.Left)
+	rightType := in.infer(expr.Right)
+
+	switch expr.Operator {
+	case "+", "-", "*", "/", "%", "&", "|", "^", "<<", ">>":
+		if expr.Operator == "+" {
+			// + also concatenates strings, and arrays into a slice
+			if leftType.BaseType == "string" && rightType.BaseType == "string" {
+				return leftType
+			}
+			if leftType.ArrayType != nil && rightType.ArrayType != nil {
+				if isUnknown(leftType) {
+					return &ast.Type{ArrayType: rightType.ArrayType}
+				}
+				return &ast.Type{ArrayType: leftType.ArrayType}
+			}
+		}
+		// Arithmetic on a distinct or sized type keeps the type, and
+		// a shift has the type of the value shifted
+		if in.types.isDistinct(leftType) || isSizedInt(leftType) {
+			return in.types.resolve(leftType)
+		}
+		// An int combined with a bigint is promoted
+		if isBigInt(leftType) || isBigInt(rightType) {
+			return &ast.Type{BaseType: "bigint"}
+		}
+		if expr.Operator == "<<" || expr.Operator == ">>" {
+			if leftType.BaseType == "int" {
+				return leftType
+			}
+			return unknownType()
+		}
+		if in.types.isDistinct(rightType) || isSizedInt(rightType) {
+			return in.types.resolve(rightType)
+		}
+		// Arithmetic operators
+		if leftType.BaseType == "float" || rightType.BaseType == "float" {
+			return &ast.Type{BaseType: "float"}
+		}
+		// Both operands are integers
+		if leftType.BaseType == "int" && rightType.BaseType == "int" {
+			return &ast.Type{BaseType: "int"}
+		}
+		// If we get here, one or both operands are not numeric
+		return unknownType()
+
+	case "==", "!=", "<", ">", "<=", ">=", "&&", "||":
+		// Comparison and logical operators
+		return &ast.Type{BaseType: "bool"}
+
+	default:
+		return unknownType()
+	}
+}
+
+// builtinResults gives the type each builtin function returns from the
+// types of its arguments. Builtins that return nothing have type void.
+var builtinResults = map[string]func(args []*ast.Type) *ast.Type{
+	"len":       returns("int"),
+	"append":    argument(0),
+	"print":     returns("void"),
+	"println":   returns("void"),
+	"printf":    returns("void"),
+	"sin":       returns("float"),
+	"cos":       returns("float"),
+	"sqrt":      returns("float"),
+	"now":       returns("string"),
+	"toInt":     returns("int"),
+	"toFloat":   returns("float"),
+	"toString":  returns("string"),
+	"getType":   returns("string"),
+	"abs":       argument(0),
+	"min":       numeric,
+	"max":       numeric,
+	"isInt":     returns("bool"),
+	"isFloat":   returns("bool"),
+	"isString":  returns("bool"),
+	"isArray":   returns("bool"),
+	"isBool":    returns("bool"),
+	"pow":       numeric,
+	"floor":     returns("int"),
+	"ceil":      returns("int"),
+	"push":      argument(0),
+	"pop":       element,
+	"reverse":   argument(0),
+	"join":      returns("string"),
+	"send":      returns("void"),
+	"recv":      element,
+	"close":     returns("void"),
+	"assert":    returns("void"),
+	"assert_eq": returns("void"),
+	"assert_ne": returns("void"),
+}
+
+func returns(name string) func([]*ast.Type) *ast.Type {
+	return func([]*ast.Type) *ast.Type { return &ast.Type{BaseType: name} }
+}
+
+// argument returns the type of the builtin's i-th argument, for builtins
+// that return it, such as push
+func argument(i int) func([]*ast.Type) *ast.Type {
+	return func(args []*ast.Type) *ast.Type {
+		if i >= len(args) {
+			return unknownType()
+		}
+		return args[i]
+	}
+}
+
+// element is the element type of the array or channel passed first, as
+// pop and recv return
+func element(args []*ast.Type) *ast.Type {
+	switch {
+	case len(args) == 0:
+		return unknownType()
+	case args[0].ArrayType != nil:
+		return args[0].ArrayType
+	case args[0].ChanType != nil:
+		return args[0].ChanType
+	}
+	return unknownType()
+}
+
+// numeric is the type of min, max and pow: float if an argument is
+// a float, and otherwise that of the first argument
+func numeric(args []*ast.Type) *ast.Type {
+	for _, arg := range args {
+		if arg.BaseType == "float" {
+			return arg
+		}
+	}
+	return argument(0)(args)
+}
+
+// InferTypes assigns a type to every expression of program and records it
+// in the table TypeInfo returns. An empty array literal has no type of its
+// own: it takes the type expected where it is used, and a variable
+// declared as x := [] takes its type from the first later use that fixes
+// it: an assignment, an element assignment, push(x, v) or append(x, v), or
+// passing, returning or storing x where a type is expected. A variable no
+// use fixes is reported (E0023).
+func (a *Analyzer) InferTypes(program *ast.Program) error {
+	w := newTypeWalker(a, make(map[*ast.VarDecl]*ast.Type))
+	w.program(program)
+
+	var unfixed []*ast.VarDecl
+	for _, decl := range w.pending {
+		unfixed = append(unfixed, decl)
+	}
+	sort.Slice(unfixed, func(i, j int) bool {
+		pi, pj := unfixed[i].Name.Position, unfixed[j].Name.Position
+		return pi.Line < pj.Line || (pi.Line == pj.Line && pi.Column < pj.Column)
+	})
+	for _, decl := range unfixed {
+		example := "int"
+		for lit, ok := decl.Value.(*ast.ArrayLiteral); ok; lit, ok = firstElement(lit) {
+			example = "[]" + example
+		}
+		a.errors.AddErrorWithHelp(decl.Value.Pos(), errors.ErrCodeCannotInfer,
+			fmt.Sprintf("cannot infer the type of '%s' from an empty array", decl.Name.Name),
+			fmt.Sprintf("give it a type, as in %s: %s = %s;", decl.Name.Name, example, decl.Value))
+	}
+
+	// Uses before the one that fixed a variable's type saw an array of
+	// unknown elements, so walk again with the types fixed
+	if len(w.fixed) > 0 {
+		newTypeWalker(a, w.fixed).program(program)
+	}
+
+	if a.errors.HasErrors() {
+		return fmt.Errorf("%s", a.errors.String())
+	}
+	return nil
+}
+
+// TypeInfo returns the types InferTypes and CheckTypes have inferred
+func (a *Analyzer) TypeInfo() *TypeInfo {
+	return a.info
+}
+
+// typeWalker walks a program in scope order for InferTypes
+type typeWalker struct {
+	in      *inferrer
+	current *ast.FuncDecl
+	pending map[*Symbol]*ast.VarDecl   // variables declared as x := [] whose type no use has fixed yet
+	fixed   map[*ast.VarDecl]*ast.Type // the types uses fixed, by declaration
+}
+
+func newTypeWalker(a *Analyzer, fixed map[*ast.VarDecl]*ast.Type) *typeWalker {
+	return &typeWalker{
+		in:      &inferrer{symbols: NewSymbolTable(), types: NewTypeChecker(), info: a.info},
+		pending: make(map[*Symbol]*ast.VarDecl),
+		fixed:   fixed,
+	}
+}
+
+// program declares the functions, structs and types of program, walks its
+// top-level statements, which declare the globals, and then the functions
+func (w *typeWalker) program(program *ast.Program) {
+	for _, decl := range program.Declarations {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Signature != nil {
+				w.in.symbols.Define(decl.Name.Name, *ast.NewFunctionType(decl.Signature), false, true, decl)
+			}
+		case *ast.StructDecl:
+			w.in.symbols.Define(decl.Name.Name, *ast.NewStructType(decl.Name.Name, decl.Fields), false, false, decl)
+			w.in.info.record(decl.Name, &ast.Type{StructName: decl.Name.Name})
+			for _, field := range decl.Fields {
+				if field.Name != nil && field.Type != nil {
+					w.in.info.record(field.Name, field.Type)
+				}
+			}
+		case *ast.TypeDecl:
+			w.in.types.declareType(decl)
+			w.in.info.record(decl.Name, decl.Type)
+		}
+	}
+	for _, decl := range program.Declarations {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+		case *ast.UnsafeBlock:
+			w.block(decl.Body)
+		case ast.Statement:
+			w.stmt(decl)
+		}
+	}
+	for _, decl := range program.Declarations {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			w.function(fn)
+		}
+	}
+}
+
+func (w *typeWalker) function(fn *ast.FuncDecl) {
+	w.current = fn
+	defer func() { w.current = nil }()
+
+	w.in.infer(fn.Name)
+	w.in.symbols.EnterScope()
+	defer w.in.symbols.ExitScope()
+	if fn.Signature != nil {
+		for _, param := range fn.Signature.Parameters {
+			if param.Type != nil {
+				w.in.symbols.Define(param.Name.Name, *param.Type, param.Mutable, false, param.Name)
+				w.in.infer(param.Name)
+			}
+		}
+	}
+	w.block(fn.Body)
+}
+
+func (w *typeWalker) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	w.in.symbols.EnterScope()
+	for _, stmt := range block.Statements {
+		w.stmt(stmt)
+	}
+	w.in.symbols.ExitScope()
+}
+
+func (w *typeWalker) stmt(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.VarDecl:
+		w.varDecl(s)
+	case *ast.ConstDecl:
+		constType := w.value(s.Value, s.Type)
+		if s.Type != nil {
+			constType = s.Type
+		}
+		w.in.symbols.Define(s.Name.Name, *constType, false, false, s)
+		w.in.info.record(s.Name, constType)
+	case *ast.AssignmentStatement:
+		symbol, err := w.in.symbols.Resolve(s.Name.Name)
+		if err != nil {
+			w.value(s.Value, nil)
+			return
+		}
+		var expected *ast.Type
+		if _, pending := w.pending[symbol]; !pending {
+			expected = &symbol.Type
+		}
+		w.fix(symbol, w.value(s.Value, expected))
+		w.in.infer(s.Name)
+	case *ast.IndexAssignmentStatement:
+		object := w.in.types.underlying(w.value(s.Object, nil))
+		w.value(s.Index, nil)
+		var elem *ast.Type
+		if object.ArrayType != nil && !isUnknown(object.ArrayType) {
+			elem = object.ArrayType
+		}
+		value := w.value(s.Value, elem)
+		if symbol := w.pendingVar(s.Object); symbol != nil {
+			w.fix(symbol, &ast.Type{ArrayType: value})
+		}
+	case *ast.FieldAssignmentStatement:
+		object := w.in.types.underlying(w.value(s.Object, nil))
+		fieldType := w.in.structFields(object.StructName)[s.Field.Name]
+		w.value(s.Value, fieldType)
+		if fieldType == nil {
+			fieldType = unknownType()
+		}
+		w.in.info.record(s.Field, w.in.types.resolve(fieldType))
+	case *ast.PrintStatement:
+		w.value(s.Expression, nil)
+	case *ast.ExpressionStatement:
+		w.value(s.Expression, nil)
+	case *ast.SpawnStatement:
+		if s.Call != nil {
+			w.value(s.Call, nil)
+		}
+	case *ast.ReturnStatement:
+		var expected *ast.Type
+		if w.current != nil && w.current.Signature != nil {
+			expected = w.current.Signature.ReturnType
+		}
+		if s.Value != nil {
+			w.value(s.Value, expected)
+		}
+	case *ast.BlockStatement:
+		w.block(s)
+	case *ast.IfStatement:
+		w.value(s.Condition, nil)
+		w.block(s.Consequence)
+		w.block(s.Alternative)
+	case *ast.ForStatement:
+		w.in.symbols.EnterScope()
+		if s.Init != nil {
+			w.stmt(s.Init)
+		}
+		if s.Condition != nil {
+			w.value(s.Condition, nil)
+		}
+		if s.Post != nil {
+			w.stmt(s.Post)
+		}
+		w.block(s.Body)
+		w.in.symbols.ExitScope()
+	case *ast.WhileStatement:
+		w.value(s.Condition, nil)
+		w.block(s.Body)
+	case *ast.SelectStatement:
+		for _, c := range s.Cases {
+			elem := w.in.types.underlying(w.value(c.Channel, nil)).ChanType
+			if c.Value != nil {
+				w.value(c.Value, elem)
+			}
+			w.in.symbols.EnterScope()
+			if c.Name != nil {
+				if elem == nil {
+					elem = unknownType()
+				}
+				w.in.symbols.Define(c.Name.Name, *elem, false, false, c)
+				w.in.info.record(c.Name, elem)
+			}
+			w.block(c.Body)
+			w.in.symbols.ExitScope()
+		}
+		w.block(s.Default)
+	}
+}
+
+func (w *typeWalker) varDecl(decl *ast.VarDecl) {
+	var declared *ast.Type
+	switch {
+	case writtenType(decl) != nil:
+		declared = decl.Type
+		if decl.Value != nil {
+			w.value(decl.Value, declared)
+		}
+	case w.fixed[decl] != nil:
+		declared = w.value(decl.Value, w.fixed[decl])
+	case decl.Value != nil:
+		declared = w.value(decl.Value, nil)
+	default:
+		declared = unknownType()
+	}
+
+	if err := w.in.symbols.Define(decl.Name.Name, *declared, decl.Mutable, false, decl); err != nil {
+		// Redeclarations are reported by the other checks
+		return
+	}
+	w.in.infer(decl.Name)
+	if decl.Inferred && isEmptyArray(decl.Value) && w.fixed[decl] == nil {
+		symbol, _ := w.in.symbols.Resolve(decl.Name.Name)
+		w.pending[symbol] = decl
+	}
+}
+
+// value infers expr used where a value of type expected is wanted, and
+// fixes the types of the variables declared as x := [] that it uses where
+// a type is expected
+func (w *typeWalker) value(expr ast.Expression, expected *ast.Type) *ast.Type {
+	if expr == nil {
+		return unknownType()
+	}
+	t := w.in.inferAs(expr, expected)
+	if symbol := w.pendingVar(expr); symbol != nil && expected != nil {
+		w.fix(symbol, expected)
+	}
+	if len(w.pending) == 0 {
+		return t
+	}
+
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.FunctionCall:
+			w.fixArguments(e)
+		case *ast.StructLiteral:
+			if e.Module != nil {
+				return true
+			}
+			fields := w.in.structFields(e.Type.Name)
+			for _, field := range e.Fields {
+				if symbol := w.pendingVar(field.Value); symbol != nil {
+					w.fix(symbol, fields[field.Name.Name])
+				}
+			}
+		}
+		return true
+	})
+	return t
+}
+
+// fixArguments fixes the types of the variables declared as x := [] that
+// a call passes as a parameter of a known type, or to push or append
+func (w *typeWalker) fixArguments(call *ast.FunctionCall) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	symbol, err := w.in.symbols.Resolve(ident.Name)
+	if err != nil {
+		if (ident.Name == "push" || ident.Name == "append") && len(call.Arguments) == 2 {
+			if array := w.pendingVar(call.Arguments[0]); array != nil {
+				w.fix(array, &ast.Type{ArrayType: w.in.info.TypeOf(call.Arguments[1])})
+			}
+		}
+		return
+	}
+	sig := symbol.Type.GetFunctionSignature()
+	if !symbol.IsFunction || sig == nil {
+		return
+	}
+	for i, arg := range call.Arguments {
+		if i >= len(sig.Parameters) {
+			break
+		}
+		if array := w.pendingVar(arg); array != nil {
+			w.fix(array, sig.Parameters[i].Type)
+		}
+	}
+}
+
+// pendingVar returns the symbol of expr if it names a variable declared as
+// x := [] whose type is still to be fixed, or nil
+func (w *typeWalker) pendingVar(expr ast.Expression) *Symbol {
+	ident, ok := expr.(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+	symbol, err := w.in.symbols.Resolve(ident.Name)
+	if err != nil {
+		return nil
+	}
+	if _, pending := w.pending[symbol]; !pending {
+		return nil
+	}
+	return symbol
+}
+
+// fix gives a variable declared as x := [] the array type t of a use, if
+// t's elements are known
+func (w *typeWalker) fix(symbol *Symbol, t *ast.Type) {
+	decl, pending := w.pending[symbol]
+	if !pending || t == nil || isUnknown(t) || w.in.types.underlying(t).ArrayType == nil {
+		return
+	}
+	symbol.Type = *t
+	w.fixed[decl] = t
+	w.in.info.record(decl.Value, t)
+	w.in.info.record(decl.Name, t)
+	delete(w.pending, symbol)
+}
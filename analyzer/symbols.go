@@ -13,8 +13,12 @@ type Symbol struct {
 	IsFunction bool
 	DeclaredAt ast.Node
 	Scope      *Scope
+	Used       bool // read somewhere after its declaration
 }
 
+// Discard is the name that declares nothing: values bound to it are dropped
+const Discard = "_"
+
 // Scope represents a lexical scope in the program
 type Scope struct {
 	Parent  *Scope
@@ -53,8 +57,11 @@ func (st *SymbolTable) ExitScope() {
 	}
 }
 
-// Define adds a new symbol to the current scope
+// Define adds a new symbol to the current scope. Defining _ does nothing.
 func (st *SymbolTable) Define(name string, typ ast.Type, isMutable, isFunction bool, declaredAt ast.Node) error {
+	if name == Discard {
+		return nil
+	}
 	if _, exists := st.CurrentScope.Symbols[name]; exists {
 		return fmt.Errorf("symbol '%s' already defined in this scope", name)
 	}
@@ -82,6 +89,27 @@ func (st *SymbolTable) Resolve(name string) (*Symbol, error) {
 	return nil, fmt.Errorf("undefined symbol '%s'", name)
 }
 
+// Use resolves a symbol that is read and marks it used
+func (st *SymbolTable) Use(name string) (*Symbol, error) {
+	symbol, err := st.Resolve(name)
+	if err == nil {
+		symbol.Used = true
+	}
+	return symbol, err
+}
+
+// Visible returns the names of every symbol in the current scope and the
+// scopes enclosing it
+func (st *SymbolTable) Visible() []string {
+	var names []string
+	for scope := st.CurrentScope; scope != nil; scope = scope.Parent {
+		for name := range scope.Symbols {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 // IsGlobal returns true if the current scope is the global scope
 func (st *SymbolTable) IsGlobal() bool {
 	return st.CurrentScope == st.GlobalScope
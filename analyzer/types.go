@@ -1,59 +1,217 @@
 package analyzer
 
 import (
-	"fmt"
 	"mars/ast"
+	"math/big"
 )
 
 // TypeChecker performs type checking on the AST
 type TypeChecker struct {
 	errors []Error
+	named  map[string]*ast.TypeDecl // type declarations by name
 }
 
 // NewTypeChecker creates a new type checker instance
 func NewTypeChecker() *TypeChecker {
-	return &TypeChecker{}
+	return &TypeChecker{named: make(map[string]*ast.TypeDecl)}
 }
 
-// CheckType verifies that an expression's type matches the expected type
-func (tc *TypeChecker) CheckType(expr ast.Expression, expected ast.Type) error {
-	actual := tc.inferType(expr)
-	if !tc.typesCompatible(actual, &expected) {
-		return fmt.Errorf("type mismatch: expected %v, got %s", expected, actual)
+// declareType records a type declaration, returning false if the name is
+// already declared
+func (tc *TypeChecker) declareType(decl *ast.TypeDecl) bool {
+	if _, exists := tc.named[decl.Name.Name]; exists {
+		return false
 	}
-	return nil
+	tc.named[decl.Name.Name] = decl
+	return true
+}
+
+// lookupType returns the declaration of the named type t refers to, or nil
+func (tc *TypeChecker) lookupType(t *ast.Type) *ast.TypeDecl {
+	if t == nil || t.StructName == "" {
+		return nil
+	}
+	return tc.named[t.StructName]
 }
 
-// InferType determines the type of an expression
-func (tc *TypeChecker) inferType(expr interface{}) *ast.Type {
-	switch e := expr.(type) {
-	case *ast.Literal:
-		switch e.Value.(type) {
-		case int, int64:
-			return &ast.Type{BaseType: "int"}
-		case float64:
-			return &ast.Type{BaseType: "float"}
-		case string:
-			return &ast.Type{BaseType: "string"}
-		case bool:
-			return &ast.Type{BaseType: "bool"}
+// resolve follows aliases to the type they stand for, including byte,
+// which stands for u8. Distinct types are returned as they are. ?T
+// resolves like T: whether a value may be nil is checked by CheckDataflow.
+func (tc *TypeChecker) resolve(t *ast.Type) *ast.Type {
+	for t != nil && t.OptionalType != nil {
+		t = t.OptionalType
+	}
+	for seen := 0; seen <= len(tc.named); seen++ {
+		decl := tc.lookupType(t)
+		if decl == nil || !decl.Alias {
+			break
+		}
+		t = decl.Type
+	}
+	if t != nil && t.BaseType == "byte" {
+		return &ast.Type{BaseType: "u8", Position: t.Position}
+	}
+	return t
+}
+
+// underlying returns the representation of t: the type a distinct type
+// was declared with, after resolving aliases
+func (tc *TypeChecker) underlying(t *ast.Type) *ast.Type {
+	for seen := 0; seen <= len(tc.named); seen++ {
+		t = tc.resolve(t)
+		decl := tc.lookupType(t)
+		if decl == nil {
+			return t
+		}
+		t = decl.Type
+	}
+	return t
+}
+
+// isDistinct reports whether t is a distinct named type, after resolving
+// aliases
+func (tc *TypeChecker) isDistinct(t *ast.Type) bool {
+	return tc.lookupType(tc.resolve(t)) != nil
+}
+
+// isOptional reports whether t is ?T, or a type declared as one
+func (tc *TypeChecker) isOptional(t *ast.Type) bool {
+	for seen := 0; t != nil && seen <= len(tc.named); seen++ {
+		if t.OptionalType != nil {
+			return true
+		}
+		decl := tc.lookupType(t)
+		if decl == nil {
+			return false
 		}
+		t = decl.Type
+	}
+	return false
+}
+
+// isSizedInt reports whether t is a sized integer type such as u8
+func isSizedInt(t *ast.Type) bool {
+	return t != nil && ast.IsIntTypeName(t.BaseType)
+}
+
+// isIntegerType reports whether t is int, bigint or a sized integer type
+func isIntegerType(t *ast.Type) bool {
+	return t != nil && (t.BaseType == "int" || t.BaseType == "bigint" || isSizedInt(t))
+}
+
+// isBigInt reports whether t is bigint
+func isBigInt(t *ast.Type) bool {
+	return t != nil && t.BaseType == "bigint"
+}
+
+// promotesToBig reports whether a value of type from is used where a
+// bigint is expected and is an int, which is promoted
+func (tc *TypeChecker) promotesToBig(target, from *ast.Type) bool {
+	if target == nil || from == nil {
+		return false
+	}
+	return isBigInt(tc.resolve(target)) && tc.resolve(from).BaseType == "int"
+}
+
+// typeName names t in diagnostics
+func typeName(t *ast.Type) string {
+	if t == nil {
+		return "unknown"
+	}
+	if t.StructName != "" && len(t.StructFields) == 0 {
+		return t.StructName
+	}
+	return t.String()
+}
+
+// literalType returns the type of a literal; nil has type nil until it is
+// used where an optional is expected
+func (tc *TypeChecker) literalType(lit *ast.Literal) *ast.Type {
+	switch lit.Value.(type) {
+	case int, int64:
+		return &ast.Type{BaseType: "int"}
+	case float64:
+		return &ast.Type{BaseType: "float"}
+	case *big.Int:
+		return &ast.Type{BaseType: "bigint"}
+	case string:
+		return &ast.Type{BaseType: "string"}
+	case bool:
+		return &ast.Type{BaseType: "bool"}
+	case nil:
+		return &ast.Type{BaseType: "nil"}
 	}
-	// For now, default to unknown
 	return &ast.Type{BaseType: "unknown"}
 }
 
+// conversionTarget returns the type a call converts its argument to when
+// it calls a declared type or a base type by name, such as Meters(5) or
+// int(d), or nil for any other call
+func (tc *TypeChecker) conversionTarget(call *ast.FunctionCall) *ast.Type {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+	switch ident.Name {
+	case "int", "float", "string", "bool", "bigint":
+		return &ast.Type{BaseType: ident.Name}
+	}
+	if ast.IsIntTypeName(ident.Name) {
+		return tc.resolve(&ast.Type{BaseType: ident.Name})
+	}
+	if _, declared := tc.named[ident.Name]; declared {
+		return tc.resolve(&ast.Type{StructName: ident.Name})
+	}
+	return nil
+}
+
 // typesCompatible checks if two types are compatible
 func (tc *TypeChecker) typesCompatible(actual, expected *ast.Type) bool {
 	if expected == nil || actual == nil {
 		return false
 	}
+	// nil is a value of every optional type
+	if (tc.isOptional(expected) && actual.BaseType == "nil") || (tc.isOptional(actual) && expected.BaseType == "nil") {
+		return true
+	}
 
-	// For now, simple base type comparison
+	// Aliases are interchangeable with the types they name; a distinct
+	// type only matches itself
+	actual, expected = tc.resolve(actual), tc.resolve(expected)
+	if tc.isDistinct(actual) || tc.isDistinct(expected) {
+		if actual.BaseType == "unknown" || expected.BaseType == "unknown" {
+			return true
+		}
+		return actual.StructName == expected.StructName
+	}
+
+	// A value whose type can't be seen, such as another module's member,
+	// matches any type
+	if actual.BaseType == "unknown" || expected.BaseType == "unknown" {
+		return true
+	}
 	if expected.BaseType != actual.BaseType {
 		return false
 	}
 
+	// Arrays and channels match when their elements do; the elements of an
+	// empty array literal match any
+	switch {
+	case expected.ArrayType != nil || actual.ArrayType != nil:
+		if expected.ArrayType == nil || actual.ArrayType == nil {
+			return false
+		}
+		return isUnknown(actual.ArrayType) || isUnknown(expected.ArrayType) ||
+			tc.typesCompatible(actual.ArrayType, expected.ArrayType)
+	case expected.ChanType != nil || actual.ChanType != nil:
+		if expected.ChanType == nil || actual.ChanType == nil {
+			return false
+		}
+		return tc.typesCompatible(actual.ChanType, expected.ChanType)
+	case expected.StructName != "" || actual.StructName != "":
+		return expected.StructName == actual.StructName
+	}
+
 	// Special handling for function types
 	if expected.IsFunctionType() && actual.IsFunctionType() {
 		return tc.functionSignaturesCompatible(
@@ -93,47 +251,3 @@ func (tc *TypeChecker) functionSignaturesCompatible(expected, actual *ast.Functi
 
 	return tc.typesCompatible(expected.ReturnType, actual.ReturnType)
 }
-
-// inferIdentifierType determines the type of an identifier
-func (tc *TypeChecker) inferIdentifierType(id *ast.Identifier) *ast.Type {
-	// TODO: Look up identifier in symbol table
-	return &ast.Type{BaseType: "unknown"}
-}
-
-// inferBinaryExprType determines the type of a binary expression
-func (tc *TypeChecker) inferBinaryExprType(expr *ast.BinaryExpression) *ast.Type {
-	leftType := tc.inferType(expr.Left)
-	rightType := tc.inferType(expr.Right)
-
-	// Handle arithmetic operators
-	switch expr.Operator {
-	case "+", "-", "*", "/", "%":
-		// If either operand is float, result is float
-		if leftType.BaseType == "float" || rightType.BaseType == "float" {
-			return &ast.Type{BaseType: "float"}
-		}
-		// Both operands are integers
-		if leftType.BaseType == "int" && rightType.BaseType == "int" {
-			return &ast.Type{BaseType: "int"}
-		}
-		// If we get here, one or both operands are not numeric
-		return &ast.Type{BaseType: "unknown"}
-
-	case "==", "!=", "<", ">", "<=", ">=":
-		// Comparison operators return boolean
-		return &ast.Type{BaseType: "bool"}
-
-	case "&&", "||":
-		// Logical operators return boolean
-		return &ast.Type{BaseType: "bool"}
-
-	default:
-		return &ast.Type{BaseType: "unknown"}
-	}
-}
-
-// inferCallExprType determines the type of a function call
-func (tc *TypeChecker) inferCallExprType(expr *ast.FunctionCall) *ast.Type {
-	// TODO: Look up function in symbol table and return its return type
-	return &ast.Type{BaseType: "unknown"}
-}
@@ -0,0 +1,277 @@
+package analyzer
+
+import (
+	"fmt"
+	"mars/ast"
+	"mars/errors"
+	"sort"
+	"strings"
+)
+
+// CheckUnused reports, as warnings, local variables and parameters that are
+// never read, and private functions and structs nothing refers to. main and
+// test_ functions are called by the runtime, and names declared as _ are
+// discards. Assigning to a variable doesn't use it.
+func (a *Analyzer) CheckUnused(program *ast.Program) error {
+	u := &unusedChecker{a: a, symbols: NewSymbolTable()}
+	for _, decl := range program.Declarations {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			u.define(d.Name, d)
+		case *ast.StructDecl:
+			u.define(d.Name, d)
+		case *ast.VarDecl:
+			u.define(d.Name, d)
+		case *ast.ConstDecl:
+			u.define(d.Name, d)
+		case *ast.TypeDecl:
+			u.define(d.Name, d)
+		}
+	}
+
+	for _, decl := range program.Declarations {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			u.function(d)
+		case *ast.StructDecl:
+			for _, field := range d.Fields {
+				u.typ(field.Type)
+			}
+		case *ast.VarDecl:
+			u.typ(d.Type)
+			u.expr(d.Value)
+		case *ast.ConstDecl:
+			u.typ(d.Type)
+			u.expr(d.Value)
+		case *ast.TypeDecl:
+			u.typ(d.Type)
+		case *ast.UnsafeBlock:
+			u.block(d.Body)
+		case ast.Statement:
+			u.stmt(d)
+		}
+	}
+	u.report(u.symbols.GlobalScope)
+
+	if a.errors.HasErrors() {
+		return fmt.Errorf("%s", a.errors.String())
+	}
+	return nil
+}
+
+type unusedChecker struct {
+	a       *Analyzer
+	symbols *SymbolTable
+	current *ast.FuncDecl // the function being walked; calls to itself don't use it
+}
+
+func (u *unusedChecker) define(name *ast.Identifier, declaredAt ast.Node) {
+	if name != nil {
+		// Redeclarations are reported by the other checks
+		u.symbols.Define(name.Name, ast.Type{}, false, false, declaredAt)
+	}
+}
+
+func (u *unusedChecker) use(name string) {
+	symbol, err := u.symbols.Resolve(name)
+	if err != nil || (u.current != nil && symbol.DeclaredAt == u.current) {
+		return
+	}
+	symbol.Used = true
+}
+
+// exit reports the unused symbols of the current scope and leaves it
+func (u *unusedChecker) exit() {
+	u.report(u.symbols.CurrentScope)
+	u.symbols.ExitScope()
+}
+
+func (u *unusedChecker) function(fn *ast.FuncDecl) {
+	u.current = fn
+	defer func() { u.current = nil }()
+
+	u.symbols.EnterScope()
+	if fn.Signature != nil {
+		for _, param := range fn.Signature.Parameters {
+			// Parameters aren't nodes, so they are declared at their name
+			u.typ(param.Type)
+			u.define(param.Name, param.Name)
+		}
+		u.typ(fn.Signature.ReturnType)
+	}
+	u.block(fn.Body)
+	u.exit()
+}
+
+func (u *unusedChecker) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	u.symbols.EnterScope()
+	for _, stmt := range block.Statements {
+		u.stmt(stmt)
+	}
+	u.exit()
+}
+
+func (u *unusedChecker) stmt(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.VarDecl:
+		u.typ(s.Type)
+		u.expr(s.Value)
+		if !u.symbols.IsGlobal() {
+			u.define(s.Name, s)
+		}
+	case *ast.ConstDecl:
+		u.typ(s.Type)
+		u.expr(s.Value)
+		if !u.symbols.IsGlobal() {
+			u.define(s.Name, s)
+		}
+	case *ast.AssignmentStatement:
+		// Assigning to a variable doesn't read it
+		u.expr(s.Value)
+	case *ast.FieldAssignmentStatement:
+		u.expr(s.Object)
+		u.expr(s.Value)
+	case *ast.BlockStatement:
+		u.block(s)
+	case *ast.IfStatement:
+		u.expr(s.Condition)
+		u.block(s.Consequence)
+		u.block(s.Alternative)
+	case *ast.ForStatement:
+		u.symbols.EnterScope()
+		if s.Init != nil {
+			u.stmt(s.Init)
+		}
+		u.expr(s.Condition)
+		if s.Post != nil {
+			u.stmt(s.Post)
+		}
+		u.block(s.Body)
+		u.exit()
+	case *ast.WhileStatement:
+		u.expr(s.Condition)
+		u.block(s.Body)
+	case *ast.SelectStatement:
+		for _, c := range s.Cases {
+			u.expr(c.Channel)
+			u.expr(c.Value)
+			u.symbols.EnterScope()
+			u.define(c.Name, c)
+			u.block(c.Body)
+			u.exit()
+		}
+		u.block(s.Default)
+	default:
+		// The other statements only hold expressions
+		u.expr(stmt)
+	}
+}
+
+// expr marks the names an expression reads as used
+func (u *unusedChecker) expr(node ast.Node) {
+	if node == nil {
+		return
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			u.use(n.Name)
+		case *ast.MemberExpression:
+			// The property is a field or module member, not a name in scope
+			u.expr(n.Object)
+			return false
+		case *ast.StructLiteral:
+			if n.Module != nil {
+				u.use(n.Module.Name)
+			} else if n.Type != nil {
+				u.use(n.Type.Name)
+			}
+			for _, field := range n.Fields {
+				u.expr(field.Value)
+			}
+			return false
+		case *ast.ChanLiteral:
+			u.typ(n.ElemType)
+		case *ast.MapLiteral:
+			u.typ(n.KeyType)
+			u.typ(n.ValueType)
+		}
+		return true
+	})
+}
+
+// typ marks the structs, types and constants a type annotation names as used
+func (u *unusedChecker) typ(t *ast.Type) {
+	if t == nil {
+		return
+	}
+	if t.StructName != "" && !strings.Contains(t.StructName, ".") {
+		u.use(t.StructName)
+	}
+	if t.ArrayLen != nil {
+		u.use(t.ArrayLen.Name)
+	}
+	u.typ(t.ArrayType)
+	u.typ(t.PointerType)
+	u.typ(t.MapType)
+	u.typ(t.ChanType)
+	u.typ(t.OptionalType)
+	for _, field := range t.StructFields {
+		u.typ(field.Type)
+	}
+	if sig := t.FunctionSignature; sig != nil {
+		for _, param := range sig.Parameters {
+			u.typ(param.Type)
+		}
+		u.typ(sig.ReturnType)
+	}
+}
+
+// report warns about the unused symbols of a scope, in source order
+func (u *unusedChecker) report(scope *Scope) {
+	var unused []*Symbol
+	for _, symbol := range scope.Symbols {
+		if !symbol.Used {
+			unused = append(unused, symbol)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		pi, pj := unused[i].DeclaredAt.Pos(), unused[j].DeclaredAt.Pos()
+		return pi.Line < pj.Line || (pi.Line == pj.Line && pi.Column < pj.Column)
+	})
+
+	for _, symbol := range unused {
+		switch d := symbol.DeclaredAt.(type) {
+		case *ast.VarDecl:
+			if scope != u.symbols.GlobalScope {
+				u.a.errors.AddWarning(d.Name.Position, errors.WarnCodeUnusedVar,
+					fmt.Sprintf("unused variable '%s'", symbol.Name),
+					"remove it, or declare it as _ to discard the value")
+			}
+		case *ast.SelectCase:
+			u.a.errors.AddWarning(d.Name.Position, errors.WarnCodeUnusedVar,
+				fmt.Sprintf("unused variable '%s'", symbol.Name),
+				"receive without a name, as in case recv(ch)")
+		case *ast.Identifier:
+			u.a.errors.AddWarning(d.Position, errors.WarnCodeUnusedVar,
+				fmt.Sprintf("unused parameter '%s'", symbol.Name),
+				"name it _ if the function must take it")
+		case *ast.FuncDecl:
+			name := symbol.Name
+			if !d.Public && name != "main" && !strings.HasPrefix(name, "test_") {
+				u.a.errors.AddWarning(d.Name.Position, errors.WarnCodeUnusedVar,
+					fmt.Sprintf("unused function '%s'", name),
+					"remove it, or make it pub to use it from other modules")
+			}
+		case *ast.StructDecl:
+			if !d.Public {
+				u.a.errors.AddWarning(d.Name.Position, errors.WarnCodeUnusedVar,
+					fmt.Sprintf("unused struct '%s'", symbol.Name),
+					"remove it, or make it pub to use it from other modules")
+			}
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package analyzer
+
+import (
+	"fmt"
+	"mars/ast"
+	"mars/errors"
+	"strings"
+)
+
+// structRef is a struct type declared in an imported module
+type structRef struct {
+	module string              // import path of the declaring module
+	decl   *ast.StructDecl     // the struct's declaration
+	decls  map[string]ast.Node // top-level declarations of the declaring module
+}
+
+// field returns the declaration of the struct's field name, or nil
+func (s *structRef) field(name string) *ast.FieldDecl {
+	for _, field := range s.decl.Fields {
+		if field != nil && field.Name != nil && field.Name.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// visibilityChecker reports uses of non-public struct types and fields
+// outside the module that declares them. It follows struct values from
+// imported modules through literals, calls, module variables, fields and
+// the local variables they are stored in.
+type visibilityChecker struct {
+	a        *Analyzer
+	imports  map[string]*ast.ImportDecl
+	members  map[string]map[string]ast.Node
+	shadowed map[string]ast.Position
+	vars     map[string]*structRef // variables known to hold a struct from another module
+}
+
+// enter returns a checker for the body of fn, which starts with the
+// variables known at the top level and fn's parameters
+func (v *visibilityChecker) enter(fn *ast.FuncDecl, shadowed map[string]ast.Position) *visibilityChecker {
+	inner := &visibilityChecker{a: v.a, imports: v.imports, members: v.members, shadowed: shadowed,
+		vars: make(map[string]*structRef, len(v.vars))}
+	for name, ref := range v.vars {
+		inner.vars[name] = ref
+	}
+	if fn.Signature != nil {
+		for _, param := range fn.Signature.Parameters {
+			if param != nil && param.Name != nil {
+				inner.bind(param.Name.Name, inner.qualifiedStruct(param.Type))
+			}
+		}
+	}
+	return inner
+}
+
+func (v *visibilityChecker) bind(name string, ref *structRef) {
+	if ref == nil {
+		delete(v.vars, name)
+		return
+	}
+	v.vars[name] = ref
+}
+
+func (v *visibilityChecker) check(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.VarDecl:
+			ref := v.structOf(n.Value)
+			if !n.Inferred && n.Type != nil {
+				v.checkType(n.Type)
+				ref = v.qualifiedStruct(n.Type)
+			}
+			// The name is bound after its initializer is checked
+			if n.Value != nil {
+				v.check(n.Value)
+			}
+			v.bind(n.Name.Name, ref)
+			return false
+		case *ast.ConstDecl:
+			v.checkType(n.Type)
+		case *ast.FuncDecl:
+			v.checkSignature(n.Signature)
+		case *ast.FieldDecl:
+			v.checkType(n.Type)
+		case *ast.TypeDecl:
+			v.checkType(n.Type)
+		case *ast.ChanLiteral:
+			v.checkType(n.ElemType)
+		case *ast.StructLiteral:
+			v.checkStructLiteral(n)
+		case *ast.MemberExpression:
+			if isModuleReference(n, v.imports, v.shadowed) {
+				break
+			}
+			v.checkField(v.structOf(n.Object), n.Property)
+		case *ast.FieldAssignmentStatement:
+			v.checkField(v.structOf(n.Object), n.Field)
+		}
+		return true
+	})
+}
+
+// checkField reports a read or write of the field name of a struct from
+// another module that isn't public
+func (v *visibilityChecker) checkField(ref *structRef, name *ast.Identifier) {
+	if ref == nil || name == nil {
+		return
+	}
+	if field := ref.field(name.Name); field != nil && !field.Public {
+		v.a.errors.AddErrorWithHelp(name.Position, errors.ErrCodePrivateAccess,
+			fmt.Sprintf("field %q of %q is not public in module %q", name.Name, ref.decl.Name.Name, ref.module),
+			fmt.Sprintf("mark the field 'pub' in %q to use it from other modules", ref.module))
+	}
+}
+
+// checkType reports mod.T annotations within t, including element,
+// optional and function types, whose T isn't public in mod
+func (v *visibilityChecker) checkType(t *ast.Type) {
+	if t == nil {
+		return
+	}
+	if module, name, ok := strings.Cut(t.StructName, "."); ok && v.imports[module] != nil {
+		path := v.imports[module].Path
+		decl, ok := v.members[module][name]
+		if !ok {
+			v.a.errors.AddErrorWithHelp(t.Position, errors.ErrCodeUndefinedVar,
+				fmt.Sprintf("module %q has no member %q", path, name),
+				fmt.Sprintf("only top-level functions, structs, types, constants and variables of %q can be referenced", path))
+		} else if !isPublic(decl) {
+			v.a.errors.AddErrorWithHelp(t.Position, errors.ErrCodePrivateAccess,
+				fmt.Sprintf("%q is not public in module %q", name, path),
+				fmt.Sprintf("mark the declaration 'pub' in %q to use it from other modules", path))
+		}
+	}
+	v.checkType(t.ArrayType)
+	v.checkType(t.PointerType)
+	v.checkType(t.MapType)
+	v.checkType(t.ChanType)
+	v.checkType(t.OptionalType)
+	v.checkSignature(t.FunctionSignature)
+}
+
+// checkSignature checks the parameter and return types of sig
+func (v *visibilityChecker) checkSignature(sig *ast.FunctionSignature) {
+	if sig == nil {
+		return
+	}
+	for _, param := range sig.Parameters {
+		if param != nil {
+			v.checkType(param.Type)
+		}
+	}
+	v.checkType(sig.ReturnType)
+}
+
+// checkStructLiteral reports a mod.Type{...} literal whose type isn't a
+// public struct of mod, or which initializes fields that aren't public
+func (v *visibilityChecker) checkStructLiteral(lit *ast.StructLiteral) {
+	if lit.Module == nil || lit.Type == nil {
+		return
+	}
+	imp := v.moduleNamed(lit.Module)
+	if imp == nil {
+		v.a.errors.AddErrorWithHelp(lit.Module.Position, errors.ErrCodeUndefinedVar,
+			fmt.Sprintf("%q is not an imported module", lit.Module.Name),
+			fmt.Sprintf("add an import declaration for the module that declares %q", lit.Type.Name))
+		return
+	}
+
+	decl, ok := v.members[lit.Module.Name][lit.Type.Name]
+	if !ok {
+		v.a.errors.AddErrorWithHelp(lit.Type.Position, errors.ErrCodeUndefinedVar,
+			fmt.Sprintf("module %q has no member %q", imp.Path, lit.Type.Name),
+			fmt.Sprintf("only top-level functions, structs, types, constants and variables of %q can be referenced", imp.Path))
+		return
+	}
+	structDecl, ok := decl.(*ast.StructDecl)
+	if !ok {
+		v.a.errors.AddError(lit.Type.Position, errors.ErrCodeTypeError,
+			fmt.Sprintf("%q in module %q is not a struct", lit.Type.Name, imp.Path))
+		return
+	}
+	if !structDecl.Public {
+		v.a.errors.AddErrorWithHelp(lit.Type.Position, errors.ErrCodePrivateAccess,
+			fmt.Sprintf("%q is not public in module %q", lit.Type.Name, imp.Path),
+			fmt.Sprintf("mark the declaration 'pub' in %q to use it from other modules", imp.Path))
+		return
+	}
+
+	ref := &structRef{module: imp.Path, decl: structDecl, decls: v.members[lit.Module.Name]}
+	for _, init := range lit.Fields {
+		if init == nil || init.Name == nil {
+			continue
+		}
+		if field := ref.field(init.Name.Name); field != nil && !field.Public {
+			v.a.errors.AddErrorWithHelp(init.Name.Position, errors.ErrCodePrivateAccess,
+				fmt.Sprintf("field %q of %q is not public in module %q", init.Name.Name, lit.Type.Name, imp.Path),
+				fmt.Sprintf("mark the field 'pub' in %q, or construct the struct with a function of the module", imp.Path))
+		}
+	}
+}
+
+// moduleNamed returns the import that ident names, unless a local
+// variable declared earlier shadows it
+func (v *visibilityChecker) moduleNamed(ident *ast.Identifier) *ast.ImportDecl {
+	imp := v.imports[ident.Name]
+	if imp == nil {
+		return nil
+	}
+	if local, ok := v.shadowed[ident.Name]; ok && !positionBefore(ident.Position, local) {
+		return nil
+	}
+	return imp
+}
+
+// structOf returns the imported struct type expr evaluates to, or nil if
+// it isn't known to be one
+func (v *visibilityChecker) structOf(expr ast.Expression) *structRef {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		return v.vars[e.Name]
+	case *ast.StructLiteral:
+		if e.Module == nil || e.Type == nil || v.moduleNamed(e.Module) == nil {
+			return nil
+		}
+		return v.memberStruct(e.Module.Name, e.Type.Name)
+	case *ast.FunctionCall:
+		member, ok := e.Function.(*ast.MemberExpression)
+		if !ok || !isModuleReference(member, v.imports, v.shadowed) {
+			return nil
+		}
+		module := member.Object.(*ast.Identifier).Name
+		fn, ok := v.members[module][member.Property.Name].(*ast.FuncDecl)
+		if !ok || fn.Signature == nil {
+			return nil
+		}
+		return v.declaredStruct(v.imports[module].Path, v.members[module], fn.Signature.ReturnType)
+	case *ast.MemberExpression:
+		if isModuleReference(e, v.imports, v.shadowed) {
+			module := e.Object.(*ast.Identifier).Name
+			global, ok := v.members[module][e.Property.Name].(*ast.VarDecl)
+			if !ok {
+				return nil
+			}
+			path, decls := v.imports[module].Path, v.members[module]
+			if !global.Inferred && global.Type != nil {
+				return v.declaredStruct(path, decls, global.Type)
+			}
+			if lit, ok := global.Value.(*ast.StructLiteral); ok && lit.Module == nil && lit.Type != nil {
+				return v.declaredStruct(path, decls, &ast.Type{StructName: lit.Type.Name})
+			}
+			return nil
+		}
+		ref := v.structOf(e.Object)
+		if ref == nil || e.Property == nil {
+			return nil
+		}
+		if field := ref.field(e.Property.Name); field != nil {
+			return v.declaredStruct(ref.module, ref.decls, field.Type)
+		}
+	}
+	return nil
+}
+
+// qualifiedStruct returns the struct a mod.Type annotation names
+func (v *visibilityChecker) qualifiedStruct(t *ast.Type) *structRef {
+	if t == nil {
+		return nil
+	}
+	module, name, ok := strings.Cut(t.StructName, ".")
+	if !ok || v.imports[module] == nil {
+		return nil
+	}
+	return v.memberStruct(module, name)
+}
+
+// memberStruct returns the struct name declared by the module imported as module
+func (v *visibilityChecker) memberStruct(module, name string) *structRef {
+	decl, ok := v.members[module][name].(*ast.StructDecl)
+	if !ok {
+		return nil
+	}
+	return &structRef{module: v.imports[module].Path, decl: decl, decls: v.members[module]}
+}
+
+// declaredStruct returns the struct an unqualified type annotation within
+// the module at path names
+func (v *visibilityChecker) declaredStruct(path string, decls map[string]ast.Node, t *ast.Type) *structRef {
+	if t == nil || t.StructName == "" || strings.Contains(t.StructName, ".") {
+		return nil
+	}
+	decl, ok := decls[t.StructName].(*ast.StructDecl)
+	if !ok {
+		return nil
+	}
+	return &structRef{module: path, decl: decl, decls: decls}
+}
@@ -3,6 +3,7 @@ package ast
 
 import (
 	"fmt"
+	"strings"
 )
 
 // Position represents a position in the source code
@@ -13,9 +14,12 @@ type Position struct {
 
 // Node represents a node in the AST
 // Pos returns line and column for error reporting (optional)
+// EndPos returns the position just past the node's last character, as
+// recorded by the parser; it is zero for nodes built by hand
 type Node interface {
 	TokenLiteral() string
 	Pos() Position
+	EndPos() Position
 }
 
 // Declaration represents a declaration or top-level statement
@@ -49,71 +53,178 @@ type Expression interface {
 type Program struct {
 	Declarations []Declaration
 	Position     Position
+	EndPosition  Position
+	// Comments maps declarations and statements to the comments the
+	// parser attached to them. It is nil for programs built by hand.
+	Comments CommentMap
+}
+
+// Comment represents a line (// ...) or block (/* ... */) comment
+type Comment struct {
+	Text     string
+	Position Position
+	// BlankBefore is true when a blank line separates the comment from
+	// the source that precedes it
+	BlankBefore bool
+}
+
+// NodeComments holds the comments and layout hints attached to a node
+type NodeComments struct {
+	Leading     []*Comment // comments on the lines directly above the node
+	Trailing    *Comment   // comment on the same line, after the node
+	Dangling    []*Comment // comments before the closing brace of a block, struct or program
+	BlankBefore bool       // a blank line separates the node from what precedes it
+}
+
+// CommentMap associates nodes with their attached comments
+type CommentMap map[Node]*NodeComments
+
+// Get returns the comments attached to node, or nil if there are none
+func (cm CommentMap) Get(node Node) *NodeComments {
+	if cm == nil {
+		return nil
+	}
+	return cm[node]
+}
+
+// ImportDecl represents an import of another module by path,
+// e.g. import "geometry/vec"; binds the module to the name "vec"
+type ImportDecl struct {
+	Path        string // slash-separated path relative to the project root, without .mars
+	Name        string // the last path segment, used to qualify the module's members
+	Position    Position
+	EndPosition Position
+}
+
+// ModuleName returns the name an import path binds, its last segment,
+// or "" if the path does not end in a valid identifier
+func ModuleName(path string) string {
+	name := path[strings.LastIndex(path, "/")+1:]
+	if name == "" {
+		return ""
+	}
+	for i, r := range name {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9') {
+			continue
+		}
+		return ""
+	}
+	return name
 }
 
 // VarDecl represents a variable declaration
 type VarDecl struct {
-	Mutable  bool
-	Name     *Identifier
-	Type     *Type
-	Value    Expression
-	Position Position
+	Public  bool // declared with 'pub'; only meaningful at top level
+	Mutable bool
+	Name    *Identifier
+	Type    *Type
+	// Inferred is true when the declaration used ':=' and Type was
+	// inferred by the parser rather than written in the source
+	Inferred    bool
+	Value       Expression
+	Position    Position
+	EndPosition Position
+}
+
+// ConstDecl declares a constant, whose value the analyzer computes before
+// the program runs
+type ConstDecl struct {
+	Public      bool // declared with 'pub'; only meaningful at top level
+	Name        *Identifier
+	Type        *Type // nil unless written in the source
+	Value       Expression
+	Folded      *Literal // Value computed by the analyzer; nil until folded
+	Position    Position
+	EndPosition Position
 }
 
 // AssignmentStatement represents mutable variable assignment
 type AssignmentStatement struct {
-	Name     *Identifier
-	Value    Expression
-	Position Position
+	Name        *Identifier
+	Value       Expression
+	Position    Position
+	EndPosition Position
 }
 
 // IndexAssignmentStatement represents array element assignment
 type IndexAssignmentStatement struct {
-	Object   Expression
-	Index    Expression
-	Value    Expression
-	Position Position
+	Object      Expression
+	Index       Expression
+	Value       Expression
+	Position    Position
+	EndPosition Position
+}
+
+// FieldAssignmentStatement represents struct field assignment
+type FieldAssignmentStatement struct {
+	Object      Expression
+	Field       *Identifier
+	Value       Expression
+	Position    Position
+	EndPosition Position
 }
 
 // FuncDecl represents a function declaration
 type FuncDecl struct {
-	Name      *Identifier
-	Signature *FunctionSignature
-	Body      *BlockStatement
-	Position  Position
+	Public      bool // declared with 'pub'
+	Name        *Identifier
+	Signature   *FunctionSignature
+	Body        *BlockStatement
+	Position    Position
+	EndPosition Position
 }
 
 // StructDecl represents a struct declaration
 type StructDecl struct {
-	Name     *Identifier
-	Fields   []*FieldDecl
-	Position Position
+	Public      bool // declared with 'pub'
+	Name        *Identifier
+	Fields      []*FieldDecl
+	Position    Position
+	EndPosition Position
+}
+
+// TypeDecl declares a named type: an alias, interchangeable with the type
+// it names (type UserId = int;), or a distinct type with the same
+// representation that only converts explicitly (type Meters int;)
+type TypeDecl struct {
+	Public      bool // declared with 'pub'
+	Name        *Identifier
+	Type        *Type // the aliased or underlying type
+	Alias       bool  // declared with '='
+	Position    Position
+	EndPosition Position
 }
 
 // UnsafeBlock represents an unsafe block
 type UnsafeBlock struct {
-	Body     *BlockStatement
-	Position Position
+	Body        *BlockStatement
+	Position    Position
+	EndPosition Position
 }
 
 // Parameter represents a function parameter
 type Parameter struct {
-	Name     *Identifier
-	Type     *Type
-	Position Position
+	Mutable     bool // declared with 'mut'; the function may assign it
+	Name        *Identifier
+	Type        *Type
+	Position    Position
+	EndPosition Position
 }
 
 // FieldDecl represents a struct field declaration
 type FieldDecl struct {
-	Name     *Identifier
-	Type     *Type
-	Position Position
+	Public      bool // declared with 'pub'
+	Name        *Identifier
+	Type        *Type
+	Position    Position
+	EndPosition Position
 }
 
 // BlockStatement represents a block of statements
 type BlockStatement struct {
-	Statements []Statement
-	Position   Position
+	Statements  []Statement
+	Position    Position
+	EndPosition Position
 }
 
 // IfStatement represents an if statement
@@ -122,53 +233,89 @@ type IfStatement struct {
 	Consequence *BlockStatement
 	Alternative *BlockStatement
 	Position    Position
+	EndPosition Position
 }
 
 // ForStatement represents a for statement
 type ForStatement struct {
-	Init      Statement
-	Condition Expression
-	Post      Statement
-	Body      *BlockStatement
-	Position  Position
+	Init        Statement
+	Condition   Expression
+	Post        Statement
+	Body        *BlockStatement
+	Position    Position
+	EndPosition Position
 }
 
 // WhileStatement represents a while loop
 type WhileStatement struct {
-	Condition Expression
-	Body      *BlockStatement
-	Position  Position
+	Condition   Expression
+	Body        *BlockStatement
+	Position    Position
+	EndPosition Position
+}
+
+// SpawnStatement runs a function call in a new task
+type SpawnStatement struct {
+	Call        *FunctionCall
+	Position    Position
+	EndPosition Position
+}
+
+// SelectStatement waits until one of its channel operations can proceed
+// and runs that case's body
+type SelectStatement struct {
+	Cases       []*SelectCase
+	Default     *BlockStatement // runs when no case is ready; nil to wait
+	Position    Position
+	EndPosition Position
+}
+
+// SelectCase is one channel operation of a select statement: send(ch, v),
+// recv(ch), or name := recv(ch)
+type SelectCase struct {
+	Send        bool
+	Channel     Expression
+	Value       Expression  // value to send; nil for receives
+	Name        *Identifier // variable the received value is bound to; nil if unused
+	Body        *BlockStatement
+	Position    Position
+	EndPosition Position
 }
 
 // PrintStatement represents a print/log statement
 type PrintStatement struct {
-	Expression Expression
-	Position   Position
+	Expression  Expression
+	Position    Position
+	EndPosition Position
 }
 
 // ReturnStatement represents a return statement
 type ReturnStatement struct {
-	Value    Expression
-	Position Position
+	Value       Expression
+	Position    Position
+	EndPosition Position
 }
 
 // ExpressionStatement represents an expression statement
 type ExpressionStatement struct {
-	Expression Expression
-	Position   Position
+	Expression  Expression
+	Position    Position
+	EndPosition Position
 }
 
 // Identifier represents an identifier
 type Identifier struct {
-	Name     string
-	Position Position
+	Name        string
+	Position    Position
+	EndPosition Position
 }
 
 // FunctionSignature represents a function's type signature
 type FunctionSignature struct {
-	Parameters []*Parameter
-	ReturnType *Type
-	Position   Position
+	Parameters  []*Parameter
+	ReturnType  *Type
+	Position    Position
+	EndPosition Position
 }
 
 // Type represents a type
@@ -177,101 +324,127 @@ type Type struct {
 	BaseType     string       // "int", "float", "string", "bool"
 	ArrayType    *Type        // For []T or [N]T
 	ArraySize    *int         // nil for dynamic slices, value for fixed arrays
+	ArrayLen     *Identifier  // For [N]T where N is a constant; the analyzer sets ArraySize from it
 	PointerType  *Type        // For *T
 	StructName   string       // For struct references
 	StructFields []*FieldDecl // For struct types - stores the field declarations
 	MapType      *Type        // For map[K]V
+	ChanType     *Type        // For chan[T], the element type
+	OptionalType *Type        // For ?T, a T or nil
 	Position     Position
+	EndPosition  Position
 	// Function signature for function types
 	FunctionSignature *FunctionSignature
 }
 
 // ArrayLiteral represents an array or slice literal
 type ArrayLiteral struct {
-	Elements []Expression
-	Position Position
+	Elements    []Expression
+	Position    Position
+	EndPosition Position
 }
 
 // StructLiteral represents a struct literal
 type StructLiteral struct {
-	Type     *Identifier
-	Fields   []*FieldInit
-	Position Position
+	Module      *Identifier // qualifies the type for mod.Type{...}; nil for local types
+	Type        *Identifier
+	Fields      []*FieldInit
+	Position    Position
+	EndPosition Position
 }
 
 // FieldInit represents a struct field initialization
 type FieldInit struct {
-	Name     *Identifier
-	Value    Expression
-	Position Position
+	Name        *Identifier
+	Value       Expression
+	Position    Position
+	EndPosition Position
 }
 
 // FunctionCall represents a function or method call
 type FunctionCall struct {
-	Function  Expression
-	Arguments []Expression
-	Position  Position
+	Function    Expression
+	Arguments   []Expression
+	Position    Position
+	EndPosition Position
 }
 
 // BinaryExpression represents a binary operation
 type BinaryExpression struct {
-	Left     Expression
-	Operator string
-	Right    Expression
-	Position Position
+	Left        Expression
+	Operator    string
+	Right       Expression
+	Position    Position
+	EndPosition Position
 }
 
 // UnaryExpression represents a unary operation
 type UnaryExpression struct {
-	Operator string
-	Right    Expression
-	Position Position
+	Operator    string
+	Right       Expression
+	Position    Position
+	EndPosition Position
 }
 
 // Literal represents a literal value (number, string, boolean, nil)
 type Literal struct {
-	Token    string
-	Value    interface{}
-	Position Position
+	Token       string
+	Value       interface{}
+	Position    Position
+	EndPosition Position
 }
 
 // MemberExpression represents object.member access
 type MemberExpression struct {
-	Object   Expression
-	Property *Identifier
-	Position Position
+	Object      Expression
+	Property    *Identifier
+	Position    Position
+	EndPosition Position
 }
 
 // BreakStatement represents a break within loops
 type BreakStatement struct {
-	Position Position
+	Position    Position
+	EndPosition Position
 }
 
 // ContinueStatement represents a continue within loops
 type ContinueStatement struct {
-	Position Position
+	Position    Position
+	EndPosition Position
 }
 
 // IndexExpression represents array indexing (a[i])
 type IndexExpression struct {
-	Object   Expression
-	Index    Expression
-	Position Position
+	Object      Expression
+	Index       Expression
+	Position    Position
+	EndPosition Position
 }
 
 type SliceExpression struct {
-	Object   Expression
-	Start    Expression // Can be nil for [:end]
-	End      Expression // Can be nil for [start:]
-	Position Position
+	Object      Expression
+	Start       Expression // Can be nil for [:end]
+	End         Expression // Can be nil for [start:]
+	Position    Position
+	EndPosition Position
+}
+
+// ChanLiteral creates a channel: chan[T]() or chan[T](capacity)
+type ChanLiteral struct {
+	ElemType    *Type
+	Capacity    Expression // nil for an unbuffered channel
+	Position    Position
+	EndPosition Position
 }
 
 // MapLiteral represents a map literal
 type MapLiteral struct {
-	KeyType   *Type
-	ValueType *Type
-	Elements  []Expression
-	Position  Position
+	KeyType     *Type
+	ValueType   *Type
+	Elements    []Expression
+	Position    Position
+	EndPosition Position
 }
 
 // TokenLiteral implementations
@@ -281,16 +454,23 @@ func (p *Program) TokenLiteral() string {
 	}
 	return ""
 }
+func (id *ImportDecl) TokenLiteral() string                { return "import" }
 func (vd *VarDecl) TokenLiteral() string                   { return vd.Name.TokenLiteral() }
+func (cd *ConstDecl) TokenLiteral() string                 { return "const" }
 func (as *AssignmentStatement) TokenLiteral() string       { return "=" }
 func (ias *IndexAssignmentStatement) TokenLiteral() string { return "=" }
+func (fas *FieldAssignmentStatement) TokenLiteral() string { return "=" }
 func (fd *FuncDecl) TokenLiteral() string                  { return fd.Name.TokenLiteral() }
 func (sd *StructDecl) TokenLiteral() string                { return sd.Name.TokenLiteral() }
+func (td *TypeDecl) TokenLiteral() string                  { return "type" }
 func (ub *UnsafeBlock) TokenLiteral() string               { return "unsafe" }
 func (bs *BlockStatement) TokenLiteral() string            { return "{" }
 func (is *IfStatement) TokenLiteral() string               { return "if" }
 func (fs *ForStatement) TokenLiteral() string              { return "for" }
 func (ws *WhileStatement) TokenLiteral() string            { return "while" }
+func (ss *SpawnStatement) TokenLiteral() string            { return "spawn" }
+func (ss *SelectStatement) TokenLiteral() string           { return "select" }
+func (sc *SelectCase) TokenLiteral() string                { return "case" }
 func (ps *PrintStatement) TokenLiteral() string            { return "log" }
 func (rs *ReturnStatement) TokenLiteral() string           { return "return" }
 func (es *ExpressionStatement) TokenLiteral() string       { return es.Expression.TokenLiteral() }
@@ -307,19 +487,28 @@ func (cs *ContinueStatement) TokenLiteral() string         { return "continue" }
 func (ie *IndexExpression) TokenLiteral() string           { return "[" }
 func (se *SliceExpression) TokenLiteral() string           { return "[" }
 func (ml *MapLiteral) TokenLiteral() string                { return "map" }
+func (cl *ChanLiteral) TokenLiteral() string               { return "chan" }
+func (fd *FieldDecl) TokenLiteral() string                 { return fd.Name.TokenLiteral() }
 
 // Position implementations
 func (p *Program) Pos() Position                    { return p.Position }
+func (id *ImportDecl) Pos() Position                { return id.Position }
 func (vd *VarDecl) Pos() Position                   { return vd.Position }
+func (cd *ConstDecl) Pos() Position                 { return cd.Position }
 func (as *AssignmentStatement) Pos() Position       { return as.Position }
 func (ias *IndexAssignmentStatement) Pos() Position { return ias.Position }
+func (fas *FieldAssignmentStatement) Pos() Position { return fas.Position }
 func (fd *FuncDecl) Pos() Position                  { return fd.Position }
 func (sd *StructDecl) Pos() Position                { return sd.Position }
+func (td *TypeDecl) Pos() Position                  { return td.Position }
 func (ub *UnsafeBlock) Pos() Position               { return ub.Position }
 func (bs *BlockStatement) Pos() Position            { return bs.Position }
 func (is *IfStatement) Pos() Position               { return is.Position }
 func (fs *ForStatement) Pos() Position              { return fs.Position }
 func (ws *WhileStatement) Pos() Position            { return ws.Position }
+func (ss *SpawnStatement) Pos() Position            { return ss.Position }
+func (ss *SelectStatement) Pos() Position           { return ss.Position }
+func (sc *SelectCase) Pos() Position                { return sc.Position }
 func (ps *PrintStatement) Pos() Position            { return ps.Position }
 func (rs *ReturnStatement) Pos() Position           { return rs.Position }
 func (es *ExpressionStatement) Pos() Position       { return es.Position }
@@ -336,16 +525,86 @@ func (cs *ContinueStatement) Pos() Position         { return cs.Position }
 func (ie *IndexExpression) Pos() Position           { return ie.Position }
 func (se *SliceExpression) Pos() Position           { return se.Position }
 func (ml *MapLiteral) Pos() Position                { return ml.Position }
+func (cl *ChanLiteral) Pos() Position               { return cl.Position }
+func (fd *FieldDecl) Pos() Position                 { return fd.Position }
+
+// End position implementations
+func (p *Program) EndPos() Position                    { return p.EndPosition }
+func (id *ImportDecl) EndPos() Position                { return id.EndPosition }
+func (vd *VarDecl) EndPos() Position                   { return vd.EndPosition }
+func (cd *ConstDecl) EndPos() Position                 { return cd.EndPosition }
+func (as *AssignmentStatement) EndPos() Position       { return as.EndPosition }
+func (ias *IndexAssignmentStatement) EndPos() Position { return ias.EndPosition }
+func (fas *FieldAssignmentStatement) EndPos() Position { return fas.EndPosition }
+func (fd *FuncDecl) EndPos() Position                  { return fd.EndPosition }
+func (sd *StructDecl) EndPos() Position                { return sd.EndPosition }
+func (td *TypeDecl) EndPos() Position                  { return td.EndPosition }
+func (ub *UnsafeBlock) EndPos() Position               { return ub.EndPosition }
+func (bs *BlockStatement) EndPos() Position            { return bs.EndPosition }
+func (is *IfStatement) EndPos() Position               { return is.EndPosition }
+func (fs *ForStatement) EndPos() Position              { return fs.EndPosition }
+func (ws *WhileStatement) EndPos() Position            { return ws.EndPosition }
+func (ss *SpawnStatement) EndPos() Position            { return ss.EndPosition }
+func (ss *SelectStatement) EndPos() Position           { return ss.EndPosition }
+func (sc *SelectCase) EndPos() Position                { return sc.EndPosition }
+func (ps *PrintStatement) EndPos() Position            { return ps.EndPosition }
+func (rs *ReturnStatement) EndPos() Position           { return rs.EndPosition }
+func (es *ExpressionStatement) EndPos() Position       { return es.EndPosition }
+func (i *Identifier) EndPos() Position                 { return i.EndPosition }
+func (al *ArrayLiteral) EndPos() Position              { return al.EndPosition }
+func (sl *StructLiteral) EndPos() Position             { return sl.EndPosition }
+func (fc *FunctionCall) EndPos() Position              { return fc.EndPosition }
+func (be *BinaryExpression) EndPos() Position          { return be.EndPosition }
+func (ue *UnaryExpression) EndPos() Position           { return ue.EndPosition }
+func (l *Literal) EndPos() Position                    { return l.EndPosition }
+func (me *MemberExpression) EndPos() Position          { return me.EndPosition }
+func (bs *BreakStatement) EndPos() Position            { return bs.EndPosition }
+func (cs *ContinueStatement) EndPos() Position         { return cs.EndPosition }
+func (ie *IndexExpression) EndPos() Position           { return ie.EndPosition }
+func (se *SliceExpression) EndPos() Position           { return se.EndPosition }
+func (ml *MapLiteral) EndPos() Position                { return ml.EndPosition }
+func (cl *ChanLiteral) EndPos() Position               { return cl.EndPosition }
+func (fd *FieldDecl) EndPos() Position                 { return fd.EndPosition }
+
+// Start returns the position at which a node's source begins, so that
+// Start(n) to n.EndPos() spans all of it. It is n.Pos() except for binary,
+// call, index, slice and member expressions, whose Pos is that of their
+// operator and which start with their left operand.
+func Start(n Node) Position {
+	var left Expression
+	switch n := n.(type) {
+	case *BinaryExpression:
+		left = n.Left
+	case *FunctionCall:
+		left = n.Function
+	case *IndexExpression:
+		left = n.Object
+	case *SliceExpression:
+		left = n.Object
+	case *MemberExpression:
+		left = n.Object
+	}
+	if left == nil {
+		return n.Pos()
+	}
+	return Start(left)
+}
 
 // Node type implementations
+func (id *ImportDecl) declarationNode()                {}
 func (vd *VarDecl) declarationNode()                   {}
 func (vd *VarDecl) statementNode()                     {}
+func (cd *ConstDecl) declarationNode()                 {}
+func (cd *ConstDecl) statementNode()                   {}
 func (as *AssignmentStatement) statementNode()         {}
 func (as *AssignmentStatement) declarationNode()       {}
 func (ias *IndexAssignmentStatement) statementNode()   {}
 func (ias *IndexAssignmentStatement) declarationNode() {}
+func (fas *FieldAssignmentStatement) statementNode()   {}
+func (fas *FieldAssignmentStatement) declarationNode() {}
 func (fd *FuncDecl) declarationNode()                  {}
 func (sd *StructDecl) declarationNode()                {}
+func (td *TypeDecl) declarationNode()                  {}
 func (ub *UnsafeBlock) declarationNode()               {}
 func (bs *BlockStatement) statementNode()              {}
 func (bs *BlockStatement) declarationNode()            {}
@@ -355,6 +614,10 @@ func (fs *ForStatement) statementNode()                {}
 func (fs *ForStatement) declarationNode()              {}
 func (ws *WhileStatement) statementNode()              {}
 func (ws *WhileStatement) declarationNode()            {}
+func (ss *SpawnStatement) statementNode()              {}
+func (ss *SpawnStatement) declarationNode()            {}
+func (ss *SelectStatement) statementNode()             {}
+func (ss *SelectStatement) declarationNode()           {}
 func (ps *PrintStatement) statementNode()              {}
 func (ps *PrintStatement) declarationNode()            {}
 func (rs *ReturnStatement) statementNode()             {}
@@ -376,14 +639,15 @@ func (cs *ContinueStatement) declarationNode()         {}
 func (ie *IndexExpression) expressionNode()            {}
 func (se *SliceExpression) expressionNode()            {}
 func (ml *MapLiteral) expressionNode()                 {}
+func (cl *ChanLiteral) expressionNode()                {}
 
 // method to check if type is a slice vs fixed array
 func (t *Type) IsSlice() bool {
-	return t.ArrayType != nil && t.ArraySize == nil
+	return t.ArrayType != nil && t.ArraySize == nil && t.ArrayLen == nil
 }
 
 func (t *Type) IsFixedArray() bool {
-	return t.ArrayType != nil && t.ArraySize != nil
+	return t.ArrayType != nil && (t.ArraySize != nil || t.ArrayLen != nil)
 }
 
 // Helper constructor functions for common types
@@ -457,6 +721,9 @@ func (t *Type) String() string {
 		return t.BaseType
 	}
 	if t.ArrayType != nil {
+		if t.ArrayLen != nil {
+			return fmt.Sprintf("[%s]%s", t.ArrayLen.Name, t.ArrayType.String())
+		}
 		if t.ArraySize != nil {
 			return fmt.Sprintf("[%d]%s", *t.ArraySize, t.ArrayType.String())
 		}
@@ -465,6 +732,12 @@ func (t *Type) String() string {
 	if t.PointerType != nil {
 		return fmt.Sprintf("*%s", t.PointerType.String())
 	}
+	if t.OptionalType != nil {
+		return fmt.Sprintf("?%s", t.OptionalType.String())
+	}
+	if t.ChanType != nil {
+		return fmt.Sprintf("chan[%s]", t.ChanType.String())
+	}
 	if t.StructName != "" {
 		if len(t.StructFields) > 0 {
 			var s string
@@ -481,8 +754,15 @@ func (t *Type) String() string {
 }
 
 // String implementations for statements
+func (id *ImportDecl) String() string {
+	return "import \"" + id.Path + "\";"
+}
+
 func (vd *VarDecl) String() string {
 	var s string
+	if vd.Public {
+		s += "pub "
+	}
 	if vd.Mutable {
 		s += "mut "
 	}
@@ -493,6 +773,18 @@ func (vd *VarDecl) String() string {
 	return s + ";"
 }
 
+func (cd *ConstDecl) String() string {
+	var s string
+	if cd.Public {
+		s += "pub "
+	}
+	s += "const " + cd.Name.Name
+	if cd.Type != nil {
+		s += " : " + cd.Type.String()
+	}
+	return s + " = " + cd.Value.String() + ";"
+}
+
 func (as *AssignmentStatement) String() string {
 	return as.Name.Name + " = " + as.Value.String() + ";"
 }
@@ -501,14 +793,21 @@ func (ias *IndexAssignmentStatement) String() string {
 	return ias.Object.String() + "[" + ias.Index.String() + "] = " + ias.Value.String() + ";"
 }
 
+func (fas *FieldAssignmentStatement) String() string {
+	return fas.Object.String() + "." + fas.Field.Name + " = " + fas.Value.String() + ";"
+}
+
 func (fd *FuncDecl) String() string {
 	var s string
+	if fd.Public {
+		s += "pub "
+	}
 	s += "func " + fd.Name.Name + "("
 	for i, param := range fd.Signature.Parameters {
 		if i > 0 {
 			s += ", "
 		}
-		s += param.Name.Name + " : " + param.Type.String()
+		s += param.String()
 	}
 	s += ")"
 	if fd.Signature.ReturnType != nil {
@@ -518,11 +817,30 @@ func (fd *FuncDecl) String() string {
 	return s
 }
 
+func (td *TypeDecl) String() string {
+	var s string
+	if td.Public {
+		s += "pub "
+	}
+	s += "type " + td.Name.Name
+	if td.Alias {
+		s += " ="
+	}
+	return s + " " + td.Type.String() + ";"
+}
+
 func (sd *StructDecl) String() string {
 	var s string
+	if sd.Public {
+		s += "pub "
+	}
 	s += "struct " + sd.Name.Name + " {"
 	for _, field := range sd.Fields {
-		s += "\n\t" + field.Name.Name + " : " + field.Type.String() + ";"
+		s += "\n\t"
+		if field.Public {
+			s += "pub "
+		}
+		s += field.Name.Name + " : " + field.Type.String() + ";"
 	}
 	s += "\n}"
 	return s
@@ -573,6 +891,37 @@ func (ws *WhileStatement) String() string {
 	return "while " + ws.Condition.String() + " " + ws.Body.String()
 }
 
+func (ss *SpawnStatement) String() string {
+	return "spawn " + ss.Call.String() + ";"
+}
+
+func (ss *SelectStatement) String() string {
+	var s string
+	s += "select {"
+	for _, c := range ss.Cases {
+		s += "\n\t" + c.String()
+	}
+	if ss.Default != nil {
+		s += "\n\tdefault " + ss.Default.String()
+	}
+	s += "\n}"
+	return s
+}
+
+func (sc *SelectCase) String() string {
+	var s string
+	s += "case "
+	if sc.Send {
+		s += "send(" + sc.Channel.String() + ", " + sc.Value.String() + ")"
+	} else {
+		if sc.Name != nil {
+			s += sc.Name.Name + " := "
+		}
+		s += "recv(" + sc.Channel.String() + ")"
+	}
+	return s + " " + sc.Body.String()
+}
+
 func (ps *PrintStatement) String() string {
 	return "log(" + ps.Expression.String() + ");"
 }
@@ -618,6 +967,9 @@ func (al *ArrayLiteral) String() string {
 
 func (sl *StructLiteral) String() string {
 	var s string
+	if sl.Module != nil {
+		s += sl.Module.Name + "."
+	}
 	s += sl.Type.Name + "{"
 	for i, field := range sl.Fields {
 		if i > 0 {
@@ -696,7 +1048,25 @@ func (ml *MapLiteral) String() string {
 	return s
 }
 
+func (cl *ChanLiteral) String() string {
+	var s string
+	s += "chan[" + cl.ElemType.String() + "]("
+	if cl.Capacity != nil {
+		s += cl.Capacity.String()
+	}
+	s += ")"
+	return s
+}
+
 // String returns a string representation of the function signature
+func (p *Parameter) String() string {
+	s := p.Name.Name + " : " + p.Type.String()
+	if p.Mutable {
+		s = "mut " + s
+	}
+	return s
+}
+
 func (fs *FunctionSignature) String() string {
 	var s string
 	s += "("
@@ -704,7 +1074,7 @@ func (fs *FunctionSignature) String() string {
 		if i > 0 {
 			s += ", "
 		}
-		s += param.Name.Name + " : " + param.Type.String()
+		s += param.String()
 	}
 	s += ")"
 	if fs.ReturnType != nil {
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -279,3 +280,104 @@ func TestPrintStatement(t *testing.T) {
 		t.Errorf("stmt.TokenLiteral wrong. got=%q", stmt.TokenLiteral())
 	}
 }
+
+func TestImportDecl(t *testing.T) {
+	decl := &ImportDecl{Path: "geometry/vec", Name: "vec"}
+
+	if decl.TokenLiteral() != "import" {
+		t.Errorf("decl.TokenLiteral wrong. got=%q", decl.TokenLiteral())
+	}
+	if decl.String() != `import "geometry/vec";` {
+		t.Errorf("decl.String wrong. got=%q", decl.String())
+	}
+}
+
+func TestModuleName(t *testing.T) {
+	tests := map[string]string{
+		"vec":          "vec",
+		"geometry/vec": "vec",
+		"a/b/c_2":      "c_2",
+		"geometry/":    "",
+		"":             "",
+		"vec.mars":     "",
+		"2d":           "",
+	}
+	for path, want := range tests {
+		if got := ModuleName(path); got != want {
+			t.Errorf("ModuleName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	// func f(n : int) { log(g(n + 1)); }
+	program := &Program{
+		Declarations: []Declaration{
+			&FuncDecl{
+				Name:      &Identifier{Name: "f"},
+				Signature: &FunctionSignature{Parameters: []*Parameter{{Name: &Identifier{Name: "n"}}}},
+				Body: &BlockStatement{Statements: []Statement{
+					&PrintStatement{Expression: &FunctionCall{
+						Function: &Identifier{Name: "g"},
+						Arguments: []Expression{&BinaryExpression{
+							Left:     &Identifier{Name: "n"},
+							Operator: "+",
+							Right:    &Literal{Token: "1", Value: 1},
+						}},
+					}},
+				}},
+			},
+		},
+	}
+
+	var identifiers []string
+	Inspect(program, func(n Node) bool {
+		if ident, ok := n.(*Identifier); ok {
+			identifiers = append(identifiers, ident.Name)
+		}
+		return true
+	})
+	if got := strings.Join(identifiers, " "); got != "f n g n" {
+		t.Errorf("identifiers in walk order = %q, want %q", got, "f n g n")
+	}
+
+	// Returning false skips a node's children
+	var calls, literals int
+	Inspect(program, func(n Node) bool {
+		switch n.(type) {
+		case *FunctionCall:
+			calls++
+			return false
+		case *Literal:
+			literals++
+		}
+		return true
+	})
+	if calls != 1 || literals != 0 {
+		t.Errorf("expected the call's arguments to be skipped, got calls=%d literals=%d", calls, literals)
+	}
+}
+
+func TestStart(t *testing.T) {
+	// a.b[0] + 1, where each infix and postfix node is positioned at its operator
+	expr := &BinaryExpression{
+		Position: Position{Line: 1, Column: 8},
+		Left: &IndexExpression{
+			Position: Position{Line: 1, Column: 4},
+			Object: &MemberExpression{
+				Position: Position{Line: 1, Column: 2},
+				Object:   &Identifier{Position: Position{Line: 1, Column: 1}, Name: "a"},
+				Property: &Identifier{Position: Position{Line: 1, Column: 3}, Name: "b"},
+			},
+			Index: &Literal{Position: Position{Line: 1, Column: 5}, Token: "0", Value: 0},
+		},
+		Operator: "+",
+		Right:    &Literal{Position: Position{Line: 1, Column: 10}, Token: "1", Value: 1},
+	}
+	if got := Start(expr); got != (Position{Line: 1, Column: 1}) {
+		t.Errorf("Start = %+v, want 1:1", got)
+	}
+	if got := Start(expr.Right); got != (Position{Line: 1, Column: 10}) {
+		t.Errorf("Start of a literal = %+v, want 1:10", got)
+	}
+}
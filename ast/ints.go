@@ -0,0 +1,59 @@
+package ast
+
+// IntType describes a sized integer type such as u8 or i32. Values of a
+// sized type wrap around on overflow, where int reports it.
+type IntType struct {
+	Name   string
+	Bits   uint
+	Signed bool
+}
+
+var intTypes = map[string]IntType{
+	"i8":   {"i8", 8, true},
+	"i16":  {"i16", 16, true},
+	"i32":  {"i32", 32, true},
+	"i64":  {"i64", 64, true},
+	"u8":   {"u8", 8, false},
+	"u16":  {"u16", 16, false},
+	"u32":  {"u32", 32, false},
+	"u64":  {"u64", 64, false},
+	"byte": {"u8", 8, false},
+}
+
+// LookupIntType returns the sized integer type a type name denotes; byte
+// is another name for u8
+func LookupIntType(name string) (IntType, bool) {
+	t, ok := intTypes[name]
+	return t, ok
+}
+
+// IsIntTypeName reports whether name is a sized integer type
+func IsIntTypeName(name string) bool {
+	_, ok := intTypes[name]
+	return ok
+}
+
+// Fits reports whether the int v is a value of the type
+func (t IntType) Fits(v int64) bool {
+	if t.Bits == 64 {
+		return t.Signed || v >= 0
+	}
+	if t.Signed {
+		limit := int64(1) << (t.Bits - 1)
+		return v >= -limit && v < limit
+	}
+	return v >= 0 && v < int64(1)<<t.Bits
+}
+
+// Wrap truncates v to the type's width: signed types sign-extend the
+// result, unsigned ones zero-extend it. A u64 keeps its bits in the int64.
+func (t IntType) Wrap(v int64) int64 {
+	if t.Bits == 64 {
+		return v
+	}
+	shift := 64 - t.Bits
+	if t.Signed {
+		return v << shift >> shift
+	}
+	return int64(uint64(v) << shift >> shift)
+}
@@ -0,0 +1,162 @@
+// ast/walk.go
+package ast
+
+// Inspect traverses the tree rooted at node in depth-first order. It calls
+// f(node) first; if f returns false, the node's children are skipped.
+// Types are not visited.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, decl := range n.Declarations {
+			Inspect(decl, f)
+		}
+	case *VarDecl:
+		inspectIdentifier(n.Name, f)
+		inspectExpression(n.Value, f)
+	case *ConstDecl:
+		inspectIdentifier(n.Name, f)
+		inspectExpression(n.Value, f)
+	case *AssignmentStatement:
+		inspectIdentifier(n.Name, f)
+		inspectExpression(n.Value, f)
+	case *IndexAssignmentStatement:
+		inspectExpression(n.Object, f)
+		inspectExpression(n.Index, f)
+		inspectExpression(n.Value, f)
+	case *FieldAssignmentStatement:
+		inspectExpression(n.Object, f)
+		inspectIdentifier(n.Field, f)
+		inspectExpression(n.Value, f)
+	case *FuncDecl:
+		inspectIdentifier(n.Name, f)
+		if n.Signature != nil {
+			for _, param := range n.Signature.Parameters {
+				if param != nil {
+					inspectIdentifier(param.Name, f)
+				}
+			}
+		}
+		inspectBlock(n.Body, f)
+	case *StructDecl:
+		inspectIdentifier(n.Name, f)
+		for _, field := range n.Fields {
+			if field != nil {
+				Inspect(field, f)
+			}
+		}
+	case *FieldDecl:
+		inspectIdentifier(n.Name, f)
+	case *TypeDecl:
+		inspectIdentifier(n.Name, f)
+	case *UnsafeBlock:
+		inspectBlock(n.Body, f)
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			if stmt != nil {
+				Inspect(stmt, f)
+			}
+		}
+	case *IfStatement:
+		inspectExpression(n.Condition, f)
+		inspectBlock(n.Consequence, f)
+		inspectBlock(n.Alternative, f)
+	case *ForStatement:
+		if n.Init != nil {
+			Inspect(n.Init, f)
+		}
+		inspectExpression(n.Condition, f)
+		if n.Post != nil {
+			Inspect(n.Post, f)
+		}
+		inspectBlock(n.Body, f)
+	case *WhileStatement:
+		inspectExpression(n.Condition, f)
+		inspectBlock(n.Body, f)
+	case *SpawnStatement:
+		if n.Call != nil {
+			Inspect(n.Call, f)
+		}
+	case *SelectStatement:
+		for _, c := range n.Cases {
+			if c != nil {
+				Inspect(c, f)
+			}
+		}
+		inspectBlock(n.Default, f)
+	case *SelectCase:
+		inspectExpression(n.Channel, f)
+		inspectExpression(n.Value, f)
+		inspectIdentifier(n.Name, f)
+		inspectBlock(n.Body, f)
+	case *PrintStatement:
+		inspectExpression(n.Expression, f)
+	case *ReturnStatement:
+		inspectExpression(n.Value, f)
+	case *ExpressionStatement:
+		inspectExpression(n.Expression, f)
+	case *ArrayLiteral:
+		for _, elem := range n.Elements {
+			inspectExpression(elem, f)
+		}
+	case *StructLiteral:
+		inspectIdentifier(n.Module, f)
+		inspectIdentifier(n.Type, f)
+		for _, field := range n.Fields {
+			if field != nil {
+				inspectIdentifier(field.Name, f)
+				inspectExpression(field.Value, f)
+			}
+		}
+	case *FunctionCall:
+		inspectExpression(n.Function, f)
+		for _, arg := range n.Arguments {
+			inspectExpression(arg, f)
+		}
+	case *BinaryExpression:
+		inspectExpression(n.Left, f)
+		inspectExpression(n.Right, f)
+	case *UnaryExpression:
+		inspectExpression(n.Right, f)
+	case *MemberExpression:
+		inspectExpression(n.Object, f)
+		inspectIdentifier(n.Property, f)
+	case *IndexExpression:
+		inspectExpression(n.Object, f)
+		inspectExpression(n.Index, f)
+	case *SliceExpression:
+		inspectExpression(n.Object, f)
+		inspectExpression(n.Start, f)
+		inspectExpression(n.End, f)
+	case *ChanLiteral:
+		inspectExpression(n.Capacity, f)
+	case *MapLiteral:
+		for _, elem := range n.Elements {
+			inspectExpression(elem, f)
+		}
+	}
+}
+
+// The helpers below skip nil children, which would otherwise reach
+// Inspect as non-nil interfaces holding nil pointers
+
+func inspectIdentifier(ident *Identifier, f func(Node) bool) {
+	if ident != nil {
+		Inspect(ident, f)
+	}
+}
+
+func inspectBlock(block *BlockStatement, f func(Node) bool) {
+	if block != nil {
+		Inspect(block, f)
+	}
+}
+
+func inspectExpression(expr Expression, f func(Node) bool) {
+	if expr != nil {
+		Inspect(expr, f)
+	}
+}
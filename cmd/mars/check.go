@@ -0,0 +1,194 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mars/errors"
+	"mars/lexer"
+	"mars/lint"
+	"mars/manifest"
+	"mars/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// collectPaths returns the .mars files under each of paths, or under the
+// current directory if there are none, printing the paths it can't read
+func collectPaths(paths []string) ([]string, bool) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	var files []string
+	ok := true
+	for _, path := range paths {
+		found, err := collectMarsFiles(path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			ok = false
+			continue
+		}
+		files = append(files, found...)
+	}
+	return files, ok
+}
+
+func runCheck(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	denyWarnings := flags.Bool("deny-warnings", false, "fail if the analyzer reports warnings, such as unused variables")
+	diagnosticsFormat := diagnosticsFlag(flags)
+	flags.Usage = func() {
+		fmt.Println("Usage: mars check [--deny-warnings] [--diagnostics text|json|sarif] [path ...]")
+		fmt.Println()
+		fmt.Println("Parses, type-checks and analyzes the given files, or every .mars file")
+		fmt.Println("under the given directories (default: the current directory), along")
+		fmt.Println("with the modules they import, without running anything. Exits with a")
+		fmt.Println("non-zero status if any of them has errors.")
+		fmt.Println()
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	setDiagnosticsFormat(*diagnosticsFormat)
+
+	files, ok := collectPaths(flags.Args())
+	checked := make(map[string]bool)
+	for _, file := range files {
+		abs, _ := filepath.Abs(file)
+		if checked[abs] {
+			continue
+		}
+		checked[abs] = true
+
+		graph, err := loadProgram(file, *denyWarnings)
+		if err != nil {
+			reportError(err)
+			ok = false
+			continue
+		}
+		for _, mod := range graph.Modules {
+			if abs, err := filepath.Abs(mod.File); err == nil {
+				checked[abs] = true
+			}
+		}
+	}
+
+	diagnostics.flush()
+	if !ok {
+		os.Exit(1)
+	}
+	modules := "modules"
+	if len(checked) == 1 {
+		modules = "module"
+	}
+	fmt.Printf("Checked %d %s\n", len(checked), modules)
+}
+
+func runLint(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	denyWarnings := flags.Bool("deny-warnings", false, "fail on warnings as well as errors")
+	listRules := flags.Bool("rules", false, "list the rules and their default severities, then exit")
+	flags.Usage = func() {
+		fmt.Println("Usage: mars lint [--deny-warnings] [--rules] [path ...]")
+		fmt.Println()
+		fmt.Println("Checks the given files, or every .mars file under the given directories")
+		fmt.Println("(default: the current directory), for suspicious code. Rules are")
+		fmt.Println("configured in the [lint] table of mars.toml:")
+		fmt.Println()
+		fmt.Println("  [lint]")
+		fmt.Println("  shadow = \"off\"")
+		fmt.Println("  long-function = { severity = \"error\", max-lines = \"80\" }")
+		fmt.Println()
+		fmt.Println("A '// mars:ignore RULE' comment at the end of a line, or alone on the")
+		fmt.Println("line above it, suppresses that rule's findings on the line. Exits with")
+		fmt.Println("a non-zero status if a rule with severity error reports anything.")
+		fmt.Println()
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *listRules {
+		for _, rule := range lint.Rules() {
+			fmt.Printf("  %-20s %-8s %s\n", rule.ID, rule.Severity, rule.Description)
+		}
+		return
+	}
+
+	files, ok := collectPaths(flags.Args())
+	configs := make(map[string]*lint.Config)
+	errorCount, warningCount := 0, 0
+	for _, file := range files {
+		config, err := lintConfig(filepath.Dir(file), configs)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Printf("Error reading file '%s': %v\n", file, err)
+			ok = false
+			continue
+		}
+		source := string(content)
+		p := parser.NewParserWithSource(lexer.New(source), strings.Split(source, "\n"))
+		program := p.ParseProgram()
+		if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+			reporter := errors.NewMarsReporter(source, file)
+			reporter.AddErrors(errs.Errors())
+			fmt.Printf("Parse errors in '%s':\n%s\n", file, reporter.String())
+			ok = false
+			continue
+		}
+
+		findings := lint.Lint(program, source, config)
+		if len(findings) == 0 {
+			continue
+		}
+		reporter := errors.NewMarsReporter(source, file)
+		for _, f := range findings {
+			if f.Severity == lint.Error {
+				errorCount++
+				reporter.AddErrorWithHelp(f.Position, f.Rule, f.Message, f.Help)
+			} else {
+				warningCount++
+				reporter.AddWarning(f.Position, f.Rule, f.Message, f.Help)
+			}
+		}
+		fmt.Println(reporter.String())
+	}
+
+	if errorCount > 0 || (*denyWarnings && warningCount > 0) {
+		ok = false
+	}
+	if !ok {
+		os.Exit(1)
+	}
+	if errorCount == 0 && warningCount == 0 {
+		fmt.Printf("No lint problems in %d files\n", len(files))
+	}
+}
+
+// lintConfig returns the lint configuration of the package containing dir,
+// read from the [lint] table of its manifest. configs caches them by
+// manifest file.
+func lintConfig(dir string, configs map[string]*lint.Config) (*lint.Config, error) {
+	m, err := manifest.Find(dir)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return lint.DefaultConfig(), nil
+	}
+	if config, ok := configs[m.File]; ok {
+		return config, nil
+	}
+
+	config := lint.DefaultConfig()
+	for _, setting := range m.Lint {
+		if err := config.Set(setting.Rule, setting.Options); err != nil {
+			return nil, &manifest.Error{File: m.File, Line: setting.Line, Message: err.Error()}
+		}
+	}
+	configs[m.File] = config
+	return config, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"mars/errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// checkSource writes files into a temporary directory, loads main.mars as
+// mars check and mars run do, and returns the codes of the errors found
+func checkSource(t *testing.T, files map[string]string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := loadProgram(filepath.Join(dir, "main.mars"), false)
+	if err == nil {
+		return nil
+	}
+	var codes []string
+	for _, d := range errorsOnly(errorDiagnostics(err)) {
+		codes = append(codes, d.Code)
+	}
+	return codes
+}
+
+// errorsOnly drops the warnings reported along with errors
+func errorsOnly(diagnostics []errors.Diagnostic) []errors.Diagnostic {
+	var errs []errors.Diagnostic
+	for _, d := range diagnostics {
+		if d.Severity == errors.ErrorSeverityError {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
+
+func TestLoadProgramTypeChecks(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		codes  string // codes reported, space separated
+	}{
+		{"type mismatch", `x: int = "hello"; log(x);`, "E0002"},
+		{"undefined variable", `count := 1; log(countr);`, "E0003"},
+		{"undefined function", `log(lenght([1]));`, "E0003"},
+		{"undefined field", `struct P { name: string; } p := P{name: "a"}; log(p.nmae);`, "E0008"},
+		{"distinct type as its representation", `type Meters int; m: Meters = Meters(3); i: int = m; log(i);`, "E0002"},
+		{"two distinct types mixed", `type Meters int; type Feet int; d := Meters(1) + Feet(2); log(d);`, "E0002"},
+		{"distinct type passed as its representation", `type Meters int; func f(n: int) -> int { return n; } log(f(Meters(3)));`, "E0002"},
+		{"distinct type converted", `type Meters int; m: Meters = Meters(3); i: int = int(m) + 1; log(i);`, ""},
+		{"well typed", `struct P { name: string; } p := P{name: "a"}; log(len(p.name));`, ""},
+		{"errors of independent passes", "x := 1;\nx = 2;\nlog(y);", "E0003 E0010"},
+		{"errors of every independent pass", "func f() -> int { z := 1; }\nx := 1;\nx = \"a\";\nfunc g() { mut n: int; log(n); }", "E0002 E0010 E0017 E0021"},
+		{"sized array starts with zeros", `const N = 3; func main() { mut dp: [N]int; dp[0] = 1; log(dp[2]); }`, ""},
+		{"sized array length mismatch", `const N = 2; xs: [N]int = [1, 2, 3]; log(xs);`, "E0002"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes := checkSource(t, map[string]string{"main.mars": tt.source})
+			if got := strings.Join(codes, " "); got != tt.codes {
+				t.Errorf("reported %q, want %q", got, tt.codes)
+			}
+		})
+	}
+}
+
+func TestLoadProgramTypeChecksModules(t *testing.T) {
+	codes := checkSource(t, map[string]string{
+		"geo.mars": `pub struct Point { pub x: int; pub y: int; }
+pub func add(a: int, b: int) -> int { return a + b; }`,
+		"main.mars": `import "geo";
+func norm(p: geo.Point) -> int { return p.x + p.y; }
+p := geo.Point{x: 1, y: 2};
+log(geo.add(norm(p), 1));`,
+	})
+	if len(codes) > 0 {
+		t.Errorf("references into another module reported %v", codes)
+	}
+}
+
+func TestLoadProgramFieldAssignmentVisibility(t *testing.T) {
+	lib := `pub struct Pos { pub x: int; y: int; }
+pub struct S { pub pos: Pos; y: int; }
+pub func make() -> S { return S{pos: Pos{x: 0, y: 0}, y: 0}; }`
+	tests := []struct {
+		name   string
+		source string
+		codes  string
+	}{
+		{"public field", `mut s := b.make(); s.pos = b.make().pos; log(s.pos.x);`, ""},
+		{"private field", `mut s := b.make(); s.y = 5; log(s.pos.x);`, "E0019"},
+		{"public nested field", `mut s := b.make(); s.pos.x = 5; log(s.pos.x);`, ""},
+		{"private nested field", `mut s := b.make(); s.pos.y = 5; log(s.pos.x);`, "E0019"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes := checkSource(t, map[string]string{
+				"lib/b.mars": lib,
+				"main.mars":  "import \"lib/b\";\n" + tt.source,
+			})
+			if got := strings.Join(codes, " "); got != tt.codes {
+				t.Errorf("reported %q, want %q", got, tt.codes)
+			}
+		})
+	}
+}
+
+func TestLoadProgramSuggestions(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		help   string
+	}{
+		{"variable", `count := 1; log(countr);`, "did you mean 'count'?"},
+		{"builtin", `log(lenght([1]));`, "did you mean 'len'?"},
+		{"function", `func total() -> int { return 1; } log(totl());`, "did you mean 'total'?"},
+		{"field", `struct P { name: string; } p := P{name: "a"}; log(p.nmae);`, "did you mean 'name'?"},
+		{"field in a literal", `struct P { name: string; } p := P{nmae: "a"}; log(p.name);`, "did you mean 'name'?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			file := filepath.Join(dir, "main.mars")
+			if err := os.WriteFile(file, []byte(tt.source), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadProgram(file, false)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.help) {
+				t.Errorf("expected the report to suggest %q, got:\n%s", tt.help, err)
+			}
+			if d := errorsOnly(errorDiagnostics(err)); len(d) != 1 || d[0].Help != tt.help {
+				t.Errorf("expected one error with help %q, got %+v", tt.help, d)
+			}
+		})
+	}
+}
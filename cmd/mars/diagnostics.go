@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mars/ast"
+	"mars/errors"
+	"mars/evaluator"
+	"mars/manifest"
+	"mars/module"
+	"os"
+	"sync"
+)
+
+// diagnosticsReport collects the errors and warnings of a command run with
+// --diagnostics=json or sarif, to write as one document to stderr when the
+// command ends. With text, the default, they are printed as they are found.
+type diagnosticsReport struct {
+	format      string
+	mu          sync.Mutex
+	diagnostics []errors.Diagnostic
+}
+
+var diagnostics = &diagnosticsReport{format: "text"}
+
+// diagnosticsFlag adds the --diagnostics flag to a command's flags
+func diagnosticsFlag(flags *flag.FlagSet) *string {
+	return flags.String("diagnostics", "text", "report errors and warnings as text, json or sarif (json and sarif are written to stderr)")
+}
+
+// setDiagnosticsFormat selects the format of the --diagnostics flag,
+// exiting if it is unknown
+func setDiagnosticsFormat(format string) {
+	switch format {
+	case "text", "json", "sarif":
+		diagnostics.format = format
+	default:
+		fmt.Printf("Error: unknown --diagnostics %q (want text, json or sarif)\n", format)
+		os.Exit(1)
+	}
+}
+
+// structured reports whether diagnostics are collected rather than printed
+func (r *diagnosticsReport) structured() bool {
+	return r.format != "text"
+}
+
+func (r *diagnosticsReport) add(ds ...errors.Diagnostic) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.diagnostics = append(r.diagnostics, ds...)
+}
+
+// flush writes the collected diagnostics to stderr in the JSON or SARIF
+// format. It does nothing for text.
+func (r *diagnosticsReport) flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	switch r.format {
+	case "json":
+		err = errors.WriteJSON(os.Stderr, r.diagnostics)
+	case "sarif":
+		err = errors.WriteSARIF(os.Stderr, "mars", version, r.diagnostics)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing diagnostics: %v\n", err)
+	}
+	r.diagnostics = nil
+}
+
+// reportError prints an error from loadProgram, or collects its
+// diagnostics with --diagnostics=json or sarif
+func reportError(err error) {
+	if !diagnostics.structured() {
+		fmt.Println(err)
+		return
+	}
+	diagnostics.add(errorDiagnostics(err)...)
+}
+
+// errorDiagnostics converts an error from loading a program to diagnostics
+func errorDiagnostics(err error) []errors.Diagnostic {
+	switch e := err.(type) {
+	case *loadError:
+		return e.diagnostics
+	case *module.Error:
+		return e.Diagnostics()
+	case *manifest.Error:
+		return []errors.Diagnostic{{
+			Location: errors.Location{File: e.File, Start: ast.Position{Line: e.Line}},
+			Severity: errors.ErrorSeverityError,
+			Message:  e.Message,
+		}}
+	}
+	return []errors.Diagnostic{{Severity: errors.ErrorSeverityError, Message: err.Error()}}
+}
+
+// moduleFiles returns a function giving the file of each module of graph
+// by import path, with "" for the entry program, as runtime errors name them
+func moduleFiles(graph *module.Graph) func(string) string {
+	files := map[string]string{"": graph.Main.File}
+	for _, mod := range graph.Modules {
+		if mod != graph.Main {
+			files[mod.Path] = mod.File
+		}
+	}
+	return func(path string) string {
+		return files[path]
+	}
+}
+
+// reportRuntimeError prints a runtime error of a program in graph, quoting
+// the line of the module it happened in, or collects it with
+// --diagnostics=json or sarif
+func reportRuntimeError(value evaluator.Value, graph *module.Graph) {
+	d := runtimeDiagnostic(value, moduleFiles(graph))
+	if diagnostics.structured() {
+		diagnostics.add(d)
+		return
+	}
+	source := graph.Main.Source
+	for _, mod := range graph.Modules {
+		if mod.File == d.File {
+			source = mod.Source
+		}
+	}
+	fmt.Println(d.MarsFormat(source))
+}
+
+// runtimeDiagnostic converts an error value to a diagnostic, with the
+// files of the modules it happened in given by fileOf
+func runtimeDiagnostic(value evaluator.Value, fileOf func(string) string) errors.Diagnostic {
+	if rtErr, ok := value.(*evaluator.RuntimeError); ok {
+		return rtErr.Diagnostic(fileOf)
+	}
+	return errors.Diagnostic{
+		Location: errors.Location{File: fileOf("")},
+		Severity: errors.ErrorSeverityError,
+		Message:  value.String(),
+	}
+}
@@ -0,0 +1,23 @@
+// Mars is the command line for the Mars language; mars help lists its
+// commands.
+//
+// loadProgram resolves imports from the root of the package whose mars.toml
+// contains the file, or from the file's directory, and runs the analyzer's
+// passes over every module.
+//
+// Every problem is converted to an errors.Diagnostic: parse errors,
+// analyzer errors and warnings, import errors and runtime errors, whose
+// frames are mapped to their module's file. diagnosticsReport collects them
+// and flush writes them as text, JSON or SARIF; loadError carries both the
+// text report and its diagnostics.
+//
+// mars test runs each top-level test_ function, or a whole file compared
+// against its EXPECT comments or its .out and .err golden files, in a fresh
+// evaluator, on up to -p workers. Files other test files import are helper
+// modules. Tests left out by --run are reported as skipped. The reporters
+// in test_report.go write text, JUnit XML, JSON or TAP. test_cover.go
+// writes coverage summaries, profiles and HTML.
+//
+// mars run --profile writes a gzipped pprof protobuf, encoded by hand in
+// profile.go, and collapsed stacks for flame graph tools.
+package main
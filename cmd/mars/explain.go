@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mars/errors"
+	"mars/lint"
+	"os"
+	"strings"
+)
+
+func runExplain(args []string) {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Println("Usage: mars explain [code]")
+		fmt.Println()
+		fmt.Println("Explains an error or warning code, such as E0010, with an example of")
+		fmt.Println("code that reports it and the example fixed. Lint rules, such as shadow,")
+		fmt.Println("are explained too. Without a code, lists every code.")
+	}
+	flags.Parse(args)
+
+	switch flags.NArg() {
+	case 0:
+		for _, info := range errors.Codes() {
+			fmt.Printf("  %s  %s\n", info.Code, info.Title)
+		}
+		return
+	case 1:
+	default:
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	code := flags.Arg(0)
+	info, ok := errors.Explain(code)
+	if !ok {
+		for _, rule := range lint.Rules() {
+			if rule.ID == code {
+				fmt.Printf("%s: %s\n\n", rule.ID, rule.Description)
+				fmt.Printf("A lint rule, reported by mars lint with severity %s unless the\n", rule.Severity)
+				fmt.Println("[lint] table of mars.toml configures it otherwise.")
+				return
+			}
+		}
+		fmt.Printf("Error: unknown code %q; run 'mars explain' to list them\n", code)
+		os.Exit(1)
+	}
+
+	if upper := strings.ToUpper(code); upper != info.Code {
+		fmt.Printf("%s is now %s.\n\n", upper, info.Code)
+	}
+	fmt.Printf("%s: %s\n\n%s\n", info.Code, info.Title, info.Explanation)
+	if info.Reserved() {
+		return
+	}
+	fmt.Printf("\nErroneous code example:\n\n%s\n", indent(info.Erroneous))
+	fmt.Printf("\nFixed:\n\n%s\n", indent(info.Fixed))
+}
+
+// indent indents each non-empty line of an example by four spaces
+func indent(example string) string {
+	lines := strings.Split(example, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "    " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"mars/ast"
 	"mars/lexer"
 	"mars/parser"
@@ -10,445 +13,618 @@ import (
 	"strings"
 )
 
-func formatFile(filename string) {
-	// Check if file exists
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		fmt.Printf("Error: File '%s' does not exist\n", filename)
-		os.Exit(1)
-	}
+// fmtOptions controls what 'mars fmt' does with formatted output
+type fmtOptions struct {
+	check bool // report unformatted files and exit non-zero, write nothing
+	diff  bool // print a unified diff instead of rewriting files
+}
 
-	// Read file content
-	content, err := os.ReadFile(filename)
-	if err != nil {
-		fmt.Printf("Error reading file '%s': %v\n", filename, err)
-		os.Exit(1)
+func runFmt(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "exit with a non-zero status if any file is not formatted")
+	diff := flags.Bool("diff", false, "print a diff of the changes instead of rewriting files")
+	flags.Usage = func() {
+		fmt.Println("Usage: mars fmt [--check] [--diff] [path ...]")
+		fmt.Println()
+		fmt.Println("Formats the given files, or every .mars file under the given directories.")
+		fmt.Println("With no paths, or with '-', reads from stdin and writes to stdout.")
+		fmt.Println()
+		flags.PrintDefaults()
 	}
+	flags.Parse(args)
+	opts := fmtOptions{check: *check, diff: *diff}
 
-	// Check file extension
-	if filepath.Ext(filename) != ".mars" {
-		fmt.Printf("Warning: File '%s' doesn't have .mars extension\n", filename)
+	paths := flags.Args()
+	if len(paths) == 0 || (len(paths) == 1 && paths[0] == "-") {
+		if !formatStdin(opts) {
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Lexical analysis
-	l := lexer.New(string(content))
-
-	// Parsing
-	p := parser.NewParser(l)
-	program := p.ParseProgram()
-
-	// Check for parser errors
-	errors := p.GetErrors()
-	if errors != nil && errors.HasErrors() {
-		fmt.Printf("Parse errors in '%s':\n", filename)
-		for _, err := range errors.Errors() {
-			fmt.Printf("  %s\n", err)
+	ok := true
+	for _, path := range paths {
+		files, err := collectMarsFiles(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			ok = false
+			continue
 		}
+		for _, file := range files {
+			if !formatFile(file, opts) {
+				ok = false
+			}
+		}
+	}
+	if !ok {
 		os.Exit(1)
 	}
+}
 
-	// Format the program
-	formatted := formatProgram(program)
-
-	// Write back to file
-	err = os.WriteFile(filename, []byte(formatted), 0644)
+// collectMarsFiles returns path itself if it is a file, or every .mars file
+// below it if it is a directory
+func collectMarsFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("file '%s' does not exist", path)
+	}
 	if err != nil {
-		fmt.Printf("Error writing formatted file '%s': %v\n", filename, err)
-		os.Exit(1)
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
 	}
 
-	fmt.Printf("Formatted '%s'\n", filename)
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(p) == ".mars" {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
 }
 
-func formatProgram(program *ast.Program) string {
-	var result strings.Builder
-
-	for i, decl := range program.Declarations {
-		if i > 0 {
-			result.WriteString("\n")
-		}
-		result.WriteString(formatDeclaration(decl, 0))
+// formatStdin formats stdin to stdout, and reports errors to stderr. It
+// reports whether the input was valid and, in check mode, already formatted.
+func formatStdin(opts fmtOptions) bool {
+	content, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+		return false
 	}
 
-	return result.String()
-}
+	formatted, err := formatSource(string(content))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Parse errors in '<stdin>':\n%v", err)
+		return false
+	}
 
-func formatDeclaration(decl ast.Declaration, indent int) string {
-	switch d := decl.(type) {
-	case *ast.VarDecl:
-		return formatVarDecl(d, indent)
-	case *ast.FuncDecl:
-		return formatFuncDecl(d, indent)
-	case *ast.StructDecl:
-		return formatStructDecl(d, indent)
-	case *ast.UnsafeBlock:
-		return formatUnsafeBlock(d, indent)
-	case *ast.BlockStatement:
-		return formatBlockStatement(d, indent)
-	case *ast.ExpressionStatement:
-		return formatExpressionStatement(d, indent)
-	default:
-		return fmt.Sprintf("// Unknown declaration type: %T\n", decl)
+	switch {
+	case opts.diff:
+		fmt.Print(unifiedDiff("<stdin>", "<stdin> (formatted)", string(content), formatted))
+	case !opts.check:
+		fmt.Print(formatted)
 	}
+	return !opts.check || formatted == string(content)
 }
 
-func formatVarDecl(vd *ast.VarDecl, indent int) string {
-	var result strings.Builder
-
-	// Add indentation
-	result.WriteString(strings.Repeat("    ", indent))
+// formatFile formats a single file according to opts. It reports whether
+// the file was valid and, in check mode, already formatted.
+func formatFile(filename string, opts fmtOptions) bool {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file '%s': %v\n", filename, err)
+		return false
+	}
 
-	// Mutable keyword
-	if vd.Mutable {
-		result.WriteString("mut ")
+	if filepath.Ext(filename) != ".mars" {
+		fmt.Fprintf(os.Stderr, "Warning: File '%s' doesn't have .mars extension\n", filename)
 	}
 
-	// Variable name
-	result.WriteString(vd.Name.Name)
+	formatted, err := formatSource(string(content))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Parse errors in '%s':\n%v", filename, err)
+		return false
+	}
 
-	// Type annotation
-	if vd.Type != nil {
-		result.WriteString(" : ")
-		result.WriteString(formatType(vd.Type))
+	if formatted == string(content) {
+		return true
 	}
 
-	// Assignment
-	if vd.Value != nil {
-		result.WriteString(" = ")
-		result.WriteString(formatExpression(vd.Value))
+	if opts.diff {
+		fmt.Print(unifiedDiff(filename, filename+" (formatted)", string(content), formatted))
+	}
+	if opts.check {
+		fmt.Println(filename)
+		return false
+	}
+	if opts.diff {
+		return true
 	}
 
-	result.WriteString(";")
-	return result.String()
+	if err := os.WriteFile(filename, []byte(formatted), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing formatted file '%s': %v\n", filename, err)
+		return false
+	}
+	fmt.Printf("Formatted '%s'\n", filename)
+	return true
 }
 
-func formatFuncDecl(fd *ast.FuncDecl, indent int) string {
-	var result strings.Builder
-
-	// Add indentation
-	result.WriteString(strings.Repeat("    ", indent))
-
-	// Function keyword and name
-	result.WriteString("func ")
-	result.WriteString(fd.Name.Name)
+// formatSource parses Mars source and prints it back in canonical form,
+// keeping comments and single blank lines between statements
+func formatSource(source string) (string, error) {
+	l := lexer.New(source)
+	p := parser.NewParserWithSource(l, strings.Split(source, "\n"))
+	program := p.ParseProgram()
 
-	// Parameters
-	result.WriteString("(")
-	for i, param := range fd.Signature.Parameters {
-		if i > 0 {
-			result.WriteString(", ")
+	errors := p.GetErrors()
+	if errors != nil && errors.HasErrors() {
+		var sb strings.Builder
+		for _, err := range errors.Errors() {
+			sb.WriteString(fmt.Sprintf("  %s\n", err))
 		}
-		result.WriteString(param.Name.Name)
-		result.WriteString(": ")
-		result.WriteString(formatType(param.Type))
-	}
-	result.WriteString(")")
-
-	// Return type
-	if fd.Signature.ReturnType != nil {
-		result.WriteString(" -> ")
-		result.WriteString(formatType(fd.Signature.ReturnType))
+		return "", fmt.Errorf("%s", sb.String())
 	}
 
-	// Function body
-	result.WriteString(" {\n")
-	result.WriteString(formatBlockStatement(fd.Body, indent+1))
-	result.WriteString("\n")
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString("}")
-
-	return result.String()
+	return formatProgram(program), nil
 }
 
-func formatStructDecl(sd *ast.StructDecl, indent int) string {
-	var result strings.Builder
-
-	// Add indentation
-	result.WriteString(strings.Repeat("    ", indent))
-
-	// Struct keyword and name
-	result.WriteString("struct ")
-	result.WriteString(sd.Name.Name)
-	result.WriteString(" {\n")
+func formatProgram(program *ast.Program) string {
+	pr := &printer{comments: program.Comments}
 
-	// Fields
-	for _, field := range sd.Fields {
-		result.WriteString(strings.Repeat("    ", indent+1))
-		result.WriteString(field.Name.Name)
-		result.WriteString(": ")
-		result.WriteString(formatType(field.Type))
-		result.WriteString(";\n")
+	nodes := make([]ast.Node, len(program.Declarations))
+	for i, decl := range program.Declarations {
+		nodes[i] = decl
 	}
+	pr.nodeList(nodes, pr.comments.Get(program))
 
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString("}")
-
-	return result.String()
+	return strings.TrimLeft(pr.out.String(), "\n")
 }
 
-func formatUnsafeBlock(ub *ast.UnsafeBlock, indent int) string {
-	var result strings.Builder
-
-	// Add indentation
-	result.WriteString(strings.Repeat("    ", indent))
+// printer writes an AST back out as source, one indentation level per block
+type printer struct {
+	out      strings.Builder
+	comments ast.CommentMap
+	indent   int
+}
 
-	result.WriteString("unsafe {\n")
-	result.WriteString(formatBlockStatement(ub.Body, indent+1))
-	result.WriteString("\n")
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString("}")
+func (pr *printer) write(s string) {
+	pr.out.WriteString(s)
+}
 
-	return result.String()
+func (pr *printer) writeIndent() {
+	pr.out.WriteString(strings.Repeat("    ", pr.indent))
 }
 
-func formatBlockStatement(bs *ast.BlockStatement, indent int) string {
-	var result strings.Builder
+// nodeList prints a sequence of statements, declarations or struct fields,
+// one per line, with their comments and the blank lines that separated them
+// in the source. owner holds the dangling comments of the enclosing node.
+func (pr *printer) nodeList(nodes []ast.Node, owner *ast.NodeComments) {
+	for i, node := range nodes {
+		nc := pr.comments.Get(node)
+		if nc == nil {
+			nc = &ast.NodeComments{}
+		}
 
-	for _, stmt := range bs.Statements {
-		result.WriteString(formatStatement(stmt, indent))
-		result.WriteString("\n")
-	}
+		for j, c := range nc.Leading {
+			if c.BlankBefore && (i > 0 || j > 0) {
+				pr.write("\n")
+			}
+			pr.writeIndent()
+			pr.write(c.Text)
+			pr.write("\n")
+		}
+		if nc.BlankBefore && (i > 0 || len(nc.Leading) > 0) {
+			pr.write("\n")
+		}
 
-	// Remove trailing newline
-	if len(bs.Statements) > 0 {
-		resultStr := result.String()
-		if strings.HasSuffix(resultStr, "\n") {
-			resultStr = resultStr[:len(resultStr)-1]
+		pr.writeIndent()
+		pr.node(node)
+		if nc.Trailing != nil {
+			pr.write(" ")
+			pr.write(nc.Trailing.Text)
 		}
-		return resultStr
+		pr.write("\n")
 	}
 
-	return result.String()
+	if owner == nil {
+		return
+	}
+	for j, c := range owner.Dangling {
+		if c.BlankBefore && (len(nodes) > 0 || j > 0) {
+			pr.write("\n")
+		}
+		pr.writeIndent()
+		pr.write(c.Text)
+		pr.write("\n")
+	}
 }
 
-func formatStatement(stmt ast.Statement, indent int) string {
-	switch s := stmt.(type) {
-	case *ast.VarDecl:
-		return formatVarDecl(s, indent)
-	case *ast.AssignmentStatement:
-		return formatAssignmentStatement(s, indent)
+// node prints a declaration or statement starting at the current column
+func (pr *printer) node(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.ImportDecl:
+		pr.write(fmt.Sprintf("import \"%s\";", n.Path))
+	case *ast.FuncDecl:
+		pr.funcDecl(n)
+	case *ast.StructDecl:
+		pr.structDecl(n)
+	case *ast.FieldDecl:
+		if n.Public {
+			pr.write("pub ")
+		}
+		pr.write(n.Name.Name + ": " + formatType(n.Type) + ";")
+	case *ast.UnsafeBlock:
+		pr.write("unsafe ")
+		pr.block(n.Body)
+	case *ast.BlockStatement:
+		pr.block(n)
 	case *ast.IfStatement:
-		return formatIfStatement(s, indent)
+		pr.ifStatement(n)
 	case *ast.ForStatement:
-		return formatForStatement(s, indent)
+		pr.forStatement(n)
+	case *ast.WhileStatement:
+		pr.write("while " + formatExpression(n.Condition) + " ")
+		pr.block(n.Body)
 	case *ast.ReturnStatement:
-		return formatReturnStatement(s, indent)
+		if n.Value == nil {
+			pr.write("return;")
+		} else {
+			pr.write("return " + formatExpression(n.Value) + ";")
+		}
 	case *ast.PrintStatement:
-		return formatPrintStatement(s, indent)
+		if n.Expression == nil {
+			pr.write("log();")
+		} else {
+			pr.write("log(" + formatExpression(n.Expression) + ");")
+		}
+	case *ast.SpawnStatement:
+		pr.write("spawn " + formatExpression(n.Call) + ";")
+	case *ast.SelectStatement:
+		pr.selectStatement(n)
 	case *ast.BreakStatement:
-		return formatBreakStatement(s, indent)
+		pr.write("break;")
 	case *ast.ContinueStatement:
-		return formatContinueStatement(s, indent)
-	case *ast.BlockStatement:
-		return formatBlockStatement(s, indent)
-	case *ast.ExpressionStatement:
-		return formatExpressionStatement(s, indent)
+		pr.write("continue;")
+	case *ast.ConstDecl:
+		pr.write(formatConstDecl(n) + ";")
+	case *ast.TypeDecl:
+		pr.write(formatTypeDecl(n) + ";")
+	case *ast.VarDecl, *ast.AssignmentStatement, *ast.IndexAssignmentStatement, *ast.FieldAssignmentStatement, *ast.ExpressionStatement:
+		pr.write(formatSimpleStatement(n.(ast.Statement)) + ";")
 	default:
-		return fmt.Sprintf("// Unknown statement type: %T", stmt)
+		pr.write(fmt.Sprintf("// Unknown node type: %T", node))
 	}
 }
 
-func formatAssignmentStatement(as *ast.AssignmentStatement, indent int) string {
-	var result strings.Builder
-
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString(as.Name.Name)
-	result.WriteString(" = ")
-	result.WriteString(formatExpression(as.Value))
-	result.WriteString(";")
-
-	return result.String()
+// block prints a braced block; the opening brace stays on the current line
+func (pr *printer) block(bs *ast.BlockStatement) {
+	pr.write("{\n")
+	if bs != nil {
+		nodes := make([]ast.Node, len(bs.Statements))
+		for i, stmt := range bs.Statements {
+			nodes[i] = stmt
+		}
+		pr.indent++
+		pr.nodeList(nodes, pr.comments.Get(bs))
+		pr.indent--
+	}
+	pr.writeIndent()
+	pr.write("}")
 }
 
-func formatIfStatement(is *ast.IfStatement, indent int) string {
-	var result strings.Builder
-
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString("if ")
-	result.WriteString(formatExpression(is.Condition))
-	result.WriteString(" {\n")
-	result.WriteString(formatBlockStatement(is.Consequence, indent+1))
-	result.WriteString("\n")
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString("}")
-
-	if is.Alternative != nil {
-		result.WriteString(" else {\n")
-		result.WriteString(formatBlockStatement(is.Alternative, indent+1))
-		result.WriteString("\n")
-		result.WriteString(strings.Repeat("    ", indent))
-		result.WriteString("}")
+func (pr *printer) funcDecl(fd *ast.FuncDecl) {
+	if fd.Public {
+		pr.write("pub ")
 	}
-
-	return result.String()
+	pr.write("func " + fd.Name.Name + "(")
+	for i, param := range fd.Signature.Parameters {
+		if i > 0 {
+			pr.write(", ")
+		}
+		if param.Mutable {
+			pr.write("mut ")
+		}
+		pr.write(param.Name.Name + ": " + formatType(param.Type))
+	}
+	pr.write(")")
+	if fd.Signature.ReturnType != nil {
+		pr.write(" -> " + formatType(fd.Signature.ReturnType))
+	}
+	pr.write(" ")
+	pr.block(fd.Body)
 }
 
-func formatForStatement(fs *ast.ForStatement, indent int) string {
-	var result strings.Builder
+func (pr *printer) structDecl(sd *ast.StructDecl) {
+	if sd.Public {
+		pr.write("pub ")
+	}
+	pr.write("struct " + sd.Name.Name + " {\n")
+	nodes := make([]ast.Node, len(sd.Fields))
+	for i, field := range sd.Fields {
+		nodes[i] = field
+	}
+	pr.indent++
+	pr.nodeList(nodes, pr.comments.Get(sd))
+	pr.indent--
+	pr.writeIndent()
+	pr.write("}")
+}
 
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString("for ")
+func (pr *printer) ifStatement(is *ast.IfStatement) {
+	pr.write("if " + formatExpression(is.Condition) + " ")
+	pr.block(is.Consequence)
 
-	if fs.Init != nil {
-		result.WriteString(formatStatement(fs.Init, 0))
-		result.WriteString(" ")
+	if is.Alternative == nil {
+		return
 	}
+	pr.write(" else ")
+	// The parser represents 'else if' as an else block holding a single
+	// if statement; print it back the same way unless comments live there.
+	if len(is.Alternative.Statements) == 1 && pr.comments.Get(is.Alternative) == nil {
+		if elseIf, ok := is.Alternative.Statements[0].(*ast.IfStatement); ok && pr.comments.Get(elseIf) == nil {
+			pr.ifStatement(elseIf)
+			return
+		}
+	}
+	pr.block(is.Alternative)
+}
 
-	result.WriteString(formatExpression(fs.Condition))
-
-	if fs.Post != nil {
-		result.WriteString("; ")
-		result.WriteString(formatStatement(fs.Post, 0))
+func (pr *printer) forStatement(fs *ast.ForStatement) {
+	pr.write("for ")
+	if fs.Init != nil || fs.Condition != nil || fs.Post != nil {
+		if fs.Init != nil {
+			pr.write(formatSimpleStatement(fs.Init))
+		}
+		pr.write("; ")
+		if fs.Condition != nil {
+			pr.write(formatExpression(fs.Condition))
+		}
+		pr.write(";")
+		if fs.Post != nil {
+			pr.write(" " + formatSimpleStatement(fs.Post))
+		}
+		pr.write(" ")
 	}
+	pr.block(fs.Body)
+}
 
-	result.WriteString(" {\n")
-	result.WriteString(formatBlockStatement(fs.Body, indent+1))
-	result.WriteString("\n")
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString("}")
+func (pr *printer) selectStatement(ss *ast.SelectStatement) {
+	pr.write("select {\n")
+	for _, c := range ss.Cases {
+		pr.writeIndent()
+		pr.write("case ")
+		if c.Send {
+			pr.write("send(" + formatExpression(c.Channel) + ", " + formatExpression(c.Value) + ") ")
+		} else {
+			if c.Name != nil {
+				pr.write(c.Name.Name + " := ")
+			}
+			pr.write("recv(" + formatExpression(c.Channel) + ") ")
+		}
+		pr.block(c.Body)
+		pr.write("\n")
+	}
+	if ss.Default != nil {
+		pr.writeIndent()
+		pr.write("default ")
+		pr.block(ss.Default)
+		pr.write("\n")
+	}
+	pr.writeIndent()
+	pr.write("}")
+}
 
-	return result.String()
+// formatSimpleStatement formats statements that can appear in a for loop
+// header, without the terminating semicolon
+func formatSimpleStatement(stmt ast.Statement) string {
+	switch s := stmt.(type) {
+	case *ast.VarDecl:
+		return formatVarDecl(s)
+	case *ast.AssignmentStatement:
+		return s.Name.Name + " = " + formatExpression(s.Value)
+	case *ast.IndexAssignmentStatement:
+		return formatPostfixOperand(s.Object) + "[" + formatExpression(s.Index) + "] = " + formatExpression(s.Value)
+	case *ast.FieldAssignmentStatement:
+		return formatPostfixOperand(s.Object) + "." + s.Field.Name + " = " + formatExpression(s.Value)
+	case *ast.ExpressionStatement:
+		return formatExpression(s.Expression)
+	default:
+		return fmt.Sprintf("/* unsupported statement: %T */", stmt)
+	}
 }
 
-func formatReturnStatement(rs *ast.ReturnStatement, indent int) string {
+func formatVarDecl(vd *ast.VarDecl) string {
 	var result strings.Builder
 
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString("return")
+	if vd.Public {
+		result.WriteString("pub ")
+	}
+	if vd.Mutable {
+		result.WriteString("mut ")
+	}
+	result.WriteString(vd.Name.Name)
 
-	if rs.Value != nil {
-		result.WriteString(" ")
-		result.WriteString(formatExpression(rs.Value))
+	if vd.Inferred {
+		result.WriteString(" := ")
+		result.WriteString(formatExpression(vd.Value))
+		return result.String()
 	}
 
-	result.WriteString(";")
+	if vd.Type != nil {
+		result.WriteString(" : ")
+		result.WriteString(formatType(vd.Type))
+	}
+	if vd.Value != nil {
+		result.WriteString(" = ")
+		result.WriteString(formatExpression(vd.Value))
+	}
 	return result.String()
 }
 
-func formatPrintStatement(ps *ast.PrintStatement, indent int) string {
+func formatConstDecl(cd *ast.ConstDecl) string {
 	var result strings.Builder
 
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString("log(")
-
-	if ps.Expression != nil {
-		result.WriteString(formatExpression(ps.Expression))
+	if cd.Public {
+		result.WriteString("pub ")
 	}
-
-	result.WriteString(");")
+	result.WriteString("const ")
+	result.WriteString(cd.Name.Name)
+	if cd.Type != nil {
+		result.WriteString(" : ")
+		result.WriteString(formatType(cd.Type))
+	}
+	result.WriteString(" = ")
+	result.WriteString(formatExpression(cd.Value))
 	return result.String()
 }
 
-func formatBreakStatement(bs *ast.BreakStatement, indent int) string {
+func formatTypeDecl(td *ast.TypeDecl) string {
 	var result strings.Builder
 
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString("break;")
+	if td.Public {
+		result.WriteString("pub ")
+	}
+	result.WriteString("type ")
+	result.WriteString(td.Name.Name)
+	if td.Alias {
+		result.WriteString(" =")
+	}
+	result.WriteString(" ")
+	result.WriteString(formatType(td.Type))
 	return result.String()
 }
 
-func formatContinueStatement(cs *ast.ContinueStatement, indent int) string {
-	var result strings.Builder
+// Operator precedence levels, lowest first, mirroring the parser's
+// parseLogicalOr .. parsePrimary chain
+const (
+	precLowest = iota
+	precOr
+	precAnd
+	precEquality
+	precComparison
+	precTerm
+	precFactor
+	precUnary
+	precPostfix
+)
 
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString("continue;")
-	return result.String()
+func binaryPrecedence(op string) int {
+	switch op {
+	case "||":
+		return precOr
+	case "&&":
+		return precAnd
+	case "==", "!=":
+		return precEquality
+	case "<", ">", "<=", ">=":
+		return precComparison
+	case "+", "-", "|", "^":
+		return precTerm
+	case "*", "/", "%", "<<", ">>", "&":
+		return precFactor
+	default:
+		return precLowest
+	}
 }
 
-func formatExpressionStatement(es *ast.ExpressionStatement, indent int) string {
-	var result strings.Builder
+func expressionPrecedence(expr ast.Expression) int {
+	switch e := expr.(type) {
+	case *ast.BinaryExpression:
+		return binaryPrecedence(e.Operator)
+	case *ast.UnaryExpression:
+		return precUnary
+	default:
+		return precPostfix
+	}
+}
 
-	result.WriteString(strings.Repeat("    ", indent))
-	result.WriteString(formatExpression(es.Expression))
-	result.WriteString(";")
-	return result.String()
+// formatOperand formats expr, parenthesizing it if it binds more loosely
+// than the surrounding operator
+func formatOperand(expr ast.Expression, minPrec int) string {
+	s := formatExpression(expr)
+	if expressionPrecedence(expr) < minPrec {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// formatPostfixOperand formats the object of a call, index or member access
+func formatPostfixOperand(expr ast.Expression) string {
+	return formatOperand(expr, precPostfix)
 }
 
 func formatExpression(expr ast.Expression) string {
 	switch e := expr.(type) {
+	case nil:
+		return ""
 	case *ast.Literal:
 		return formatLiteral(e)
 	case *ast.Identifier:
 		return e.Name
 	case *ast.BinaryExpression:
-		return formatBinaryExpression(e)
+		prec := binaryPrecedence(e.Operator)
+		// Operators are left-associative, so a right operand at the same
+		// level needs parentheses to keep its grouping
+		return formatOperand(e.Left, prec) + " " + e.Operator + " " + formatOperand(e.Right, prec+1)
 	case *ast.UnaryExpression:
-		return formatUnaryExpression(e)
+		return e.Operator + formatOperand(e.Right, precUnary)
 	case *ast.FunctionCall:
-		return formatFunctionCall(e)
+		return formatPostfixOperand(e.Function) + "(" + formatExpressionList(e.Arguments) + ")"
 	case *ast.ArrayLiteral:
-		return formatArrayLiteral(e)
+		return "[" + formatExpressionList(e.Elements) + "]"
 	case *ast.StructLiteral:
 		return formatStructLiteral(e)
 	case *ast.IndexExpression:
-		return formatIndexExpression(e)
+		return formatPostfixOperand(e.Object) + "[" + formatExpression(e.Index) + "]"
+	case *ast.SliceExpression:
+		return formatPostfixOperand(e.Object) + "[" + formatExpression(e.Start) + ":" + formatExpression(e.End) + "]"
 	case *ast.MemberExpression:
-		return formatMemberExpression(e)
+		return formatPostfixOperand(e.Object) + "." + e.Property.Name
+	case *ast.ChanLiteral:
+		return "chan[" + formatType(e.ElemType) + "](" + formatExpression(e.Capacity) + ")"
+	case *ast.MapLiteral:
+		return "map[" + formatType(e.KeyType) + "]" + formatType(e.ValueType) + "{" + formatExpressionList(e.Elements) + "}"
 	default:
-		return fmt.Sprintf("// Unknown expression type: %T", expr)
+		return fmt.Sprintf("/* unknown expression type: %T */", expr)
 	}
 }
 
+func formatExpressionList(exprs []ast.Expression) string {
+	parts := make([]string, len(exprs))
+	for i, expr := range exprs {
+		parts[i] = formatExpression(expr)
+	}
+	return strings.Join(parts, ", ")
+}
+
 func formatLiteral(lit *ast.Literal) string {
 	switch v := lit.Value.(type) {
 	case string:
 		return fmt.Sprintf("\"%s\"", v)
-	case int64:
-		return fmt.Sprintf("%d", v)
-	case float64:
-		return fmt.Sprintf("%g", v)
+	case nil:
+		return "nil"
 	case bool:
 		return fmt.Sprintf("%t", v)
 	default:
-		return fmt.Sprintf("%v", lit.Value)
-	}
-}
-
-func formatBinaryExpression(be *ast.BinaryExpression) string {
-	return fmt.Sprintf("%s %s %s",
-		formatExpression(be.Left),
-		be.Operator,
-		formatExpression(be.Right))
-}
-
-func formatUnaryExpression(ue *ast.UnaryExpression) string {
-	return fmt.Sprintf("%s%s", ue.Operator, formatExpression(ue.Right))
-}
-
-func formatFunctionCall(fc *ast.FunctionCall) string {
-	var result strings.Builder
-
-	result.WriteString(formatExpression(fc.Function))
-	result.WriteString("(")
-
-	for i, arg := range fc.Arguments {
-		if i > 0 {
-			result.WriteString(", ")
-		}
-		result.WriteString(formatExpression(arg))
-	}
-
-	result.WriteString(")")
-	return result.String()
-}
-
-func formatArrayLiteral(al *ast.ArrayLiteral) string {
-	var result strings.Builder
-
-	result.WriteString("[")
-	for i, elem := range al.Elements {
-		if i > 0 {
-			result.WriteString(", ")
+		// Keep numbers as written so '1.0' stays a float
+		if lit.Token != "" {
+			return lit.Token
 		}
-		result.WriteString(formatExpression(elem))
+		return fmt.Sprintf("%v", lit.Value)
 	}
-	result.WriteString("]")
-
-	return result.String()
 }
 
 func formatStructLiteral(sl *ast.StructLiteral) string {
 	var result strings.Builder
 
+	if sl.Module != nil {
+		result.WriteString(sl.Module.Name + ".")
+	}
 	result.WriteString(sl.Type.Name)
 	result.WriteString("{")
 
@@ -465,28 +641,23 @@ func formatStructLiteral(sl *ast.StructLiteral) string {
 	return result.String()
 }
 
-func formatIndexExpression(ie *ast.IndexExpression) string {
-	return fmt.Sprintf("%s[%s]",
-		formatExpression(ie.Object),
-		formatExpression(ie.Index))
-}
-
-func formatMemberExpression(me *ast.MemberExpression) string {
-	return fmt.Sprintf("%s.%s",
-		formatExpression(me.Object),
-		me.Property.Name)
-}
-
 func formatType(t *ast.Type) string {
 	if t == nil {
 		return ""
 	}
 
+	if t.IsFunctionType() {
+		return "func" + t.FunctionSignature.String()
+	}
+
 	if t.BaseType != "" {
 		return t.BaseType
 	}
 
 	if t.ArrayType != nil {
+		if t.ArrayLen != nil {
+			return fmt.Sprintf("[%s]%s", t.ArrayLen.Name, formatType(t.ArrayType))
+		}
 		if t.ArraySize != nil {
 			return fmt.Sprintf("[%d]%s", *t.ArraySize, formatType(t.ArrayType))
 		}
@@ -497,6 +668,14 @@ func formatType(t *ast.Type) string {
 		return fmt.Sprintf("*%s", formatType(t.PointerType))
 	}
 
+	if t.OptionalType != nil {
+		return fmt.Sprintf("?%s", formatType(t.OptionalType))
+	}
+
+	if t.ChanType != nil {
+		return fmt.Sprintf("chan[%s]", formatType(t.ChanType))
+	}
+
 	if t.StructName != "" {
 		return t.StructName
 	}
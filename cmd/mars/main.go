@@ -19,21 +19,21 @@ func main() {
 	case "repl":
 		runREPL()
 	case "run":
-		if len(os.Args) < 3 {
-			fmt.Println("Error: 'run' command requires a file path")
-			fmt.Println("Usage: mars run <file.mars>")
-			os.Exit(1)
-		}
-		runFile(os.Args[2])
+		runFile(os.Args[2:])
 	case "fmt":
-		if len(os.Args) < 3 {
-			fmt.Println("Error: 'fmt' command requires a file path")
-			fmt.Println("Usage: mars fmt <file.mars>")
-			os.Exit(1)
-		}
-		formatFile(os.Args[2])
+		runFmt(os.Args[2:])
 	case "test":
-		runTests()
+		runTests(os.Args[2:])
+	case "check":
+		runCheck(os.Args[2:])
+	case "lint":
+		runLint(os.Args[2:])
+	case "explain":
+		runExplain(os.Args[2:])
+	case "init":
+		runInit(os.Args[2:])
+	case "build":
+		runBuild(os.Args[2:])
 	case "version", "-v", "--version":
 		fmt.Printf("Mars Programming Language v%s\n", version)
 	case "help", "-h", "--help":
@@ -50,15 +50,27 @@ func printUsage() {
 	fmt.Printf("Version: %s\n\n", version)
 	fmt.Println("Usage:")
 	fmt.Println("  mars repl                    Start interactive REPL")
-	fmt.Println("  mars run <file.mars>         Parse and evaluate a file")
-	fmt.Println("  mars fmt <file.mars>         Format a Mars file")
-	fmt.Println("  mars test                    Run tests in tests/ directory")
+	fmt.Println("  mars run [flags] [file.mars] Parse and evaluate a file (default: the package entry)")
+	fmt.Println("  mars fmt [flags] [paths...]  Format files or directories (stdin if none)")
+	fmt.Println("  mars test [flags] [paths...] Run tests (default: tests/ directory)")
+	fmt.Println("  mars check [paths...]        Parse and analyze files without running them")
+	fmt.Println("  mars lint [paths...]         Report suspicious code, such as shadowed variables")
+	fmt.Println("  mars explain [code]          Explain an error or warning code, or list them all")
+	fmt.Println("  mars init [dir]              Create a package with a mars.toml manifest")
+	fmt.Println("  mars build [dir]             Check every module of a package without running it")
 	fmt.Println("  mars version                 Show version information")
 	fmt.Println("  mars help                    Show this help message")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  mars repl")
 	fmt.Println("  mars run hello.mars")
+	fmt.Println("  mars run --profile cpu.prof solution.mars")
 	fmt.Println("  mars fmt program.mars")
+	fmt.Println("  mars fmt --check src/")
+	fmt.Println("  mars check src/")
+	fmt.Println("  mars lint --deny-warnings .")
+	fmt.Println("  mars explain E0010")
 	fmt.Println("  mars test")
+	fmt.Println("  mars test --run 'test_sort' -p 4 spec/")
+	fmt.Println("  mars init shapes && cd shapes && mars run")
 }
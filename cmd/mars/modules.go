@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"mars/analyzer"
+	"mars/ast"
+	"mars/errors"
+	"mars/evaluator"
+	"mars/manifest"
+	"mars/module"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// printedWarnings records the modules whose warnings have been printed, so
+// that a module imported by several loaded files is only reported once
+var printedWarnings = make(map[string]bool)
+
+// loadError is a program that failed to load or check. Its message is the
+// report printed as text; diagnostics holds the same problems for
+// --diagnostics=json and sarif.
+type loadError struct {
+	text        string
+	diagnostics []errors.Diagnostic
+}
+
+func (e *loadError) Error() string {
+	return e.text
+}
+
+// loadProgram parses filename and every module it imports, and checks each
+// module: its references into the modules it imports, its types and names,
+// and the analyzer's other passes. Imports resolve from the
+// root of the package whose mars.toml contains the file, or from the file's
+// directory if there is none. Warnings are printed to stderr, or collected
+// with --diagnostics=json or sarif, or fail the load if denyWarnings is
+// set. The returned error is ready to print.
+func loadProgram(filename string, denyWarnings bool) (*module.Graph, error) {
+	resolver, err := resolverFor(filename)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := resolver.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	programs := graph.Programs()
+	var problems []string
+	var failed []errors.Diagnostic
+	for _, mod := range graph.Modules {
+		a := analyzer.New(mod.Source, mod.File)
+		problem := ""
+		if err := checkModule(a, mod.Program, programs); err != nil {
+			problem = err.Error()
+		} else if warnings := a.Warnings(); warnings != "" && denyWarnings {
+			problem = warnings + "error: warnings are errors with --deny-warnings"
+		} else if warnings != "" && !printedWarnings[mod.File] {
+			printedWarnings[mod.File] = true
+			if diagnostics.structured() {
+				diagnostics.add(a.Diagnostics()...)
+			} else {
+				fmt.Fprintln(os.Stderr, warnings)
+			}
+		}
+		if problem != "" {
+			problems = append(problems, problem)
+			failed = append(failed, a.Diagnostics()...)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &loadError{text: strings.Join(problems, "\n\n"), diagnostics: failed}
+	}
+	return graph, nil
+}
+
+// checkModule runs the analyzer's passes over a module. The imports,
+// constants and inferred types the later passes read are checked first, and
+// stop the checks if they fail; the later passes are independent, so all of
+// them run. Each pass reports to a's one reporter and returns everything it
+// holds, so the last error has every problem found.
+func checkModule(a *analyzer.Analyzer, program *ast.Program, programs map[string]*ast.Program) error {
+	if err := a.CheckImports(program, programs); err != nil {
+		return err
+	}
+	if err := a.CheckConstants(program); err != nil {
+		return err
+	}
+	if err := a.InferTypes(program); err != nil {
+		return err
+	}
+
+	var last error
+	for _, err := range []error{
+		a.TypeCheck(program),
+		a.CheckImmutability(program),
+		a.CheckControlFlow(program),
+		a.CheckDataflow(program),
+		a.CheckUnused(program),
+	} {
+		if err != nil {
+			last = err
+		}
+	}
+	return last
+}
+
+// resolverFor returns a resolver for the imports of filename: rooted at the
+// package containing it, with its dependencies importable by name
+func resolverFor(filename string) (*module.Resolver, error) {
+	m, err := manifest.Find(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return module.NewResolver(filepath.Dir(filename)), nil
+	}
+
+	packages, err := m.Packages()
+	if err != nil {
+		return nil, err
+	}
+	resolver := module.NewResolver(m.Dir)
+	for name, dir := range packages {
+		resolver.AddPackage(name, dir)
+	}
+	return resolver, nil
+}
+
+// findManifest returns the manifest of the package containing the current
+// directory, or nil if there is none. It exits if the manifest is invalid.
+func findManifest() *manifest.Manifest {
+	m, err := manifest.Find(".")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return m
+}
+
+// packagePath returns the path of a file in package m, relative to the
+// current directory when it is below it
+func packagePath(m *manifest.Manifest, name string) string {
+	path := filepath.Join(m.Dir, filepath.FromSlash(name))
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+// loadImports runs the top level of every module the entry program
+// imports, dependencies first. It returns the module that failed and its
+// error, or nil if all loaded.
+func loadImports(eval *evaluator.Evaluator, graph *module.Graph) (*module.Module, evaluator.Value) {
+	for _, mod := range graph.Modules {
+		if mod == graph.Main {
+			continue
+		}
+		if result := eval.LoadModule(mod.Path, mod.Program); isErrorValue(result) {
+			return mod, result
+		}
+	}
+	return nil, nil
+}
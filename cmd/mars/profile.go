@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mars/evaluator"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// writeProfiles writes the pprof profile to path and the collapsed stacks
+// to path + ".folded"
+func writeProfiles(path, filename string, samples []evaluator.ProfileSample, start time.Time, duration time.Duration) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writePprofProfile(f, filename, samples, start, duration); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	f, err = os.Create(path + ".folded")
+	if err != nil {
+		return err
+	}
+	writeCollapsedStacks(f, samples)
+	return f.Close()
+}
+
+// writeCollapsedStacks writes one "root;caller;callee nanoseconds" line per
+// function stack, the input format of flame graph tools
+func writeCollapsedStacks(w io.Writer, samples []evaluator.ProfileSample) {
+	totals := make(map[string]time.Duration)
+	for _, sample := range samples {
+		names := make([]string, len(sample.Stack))
+		for i, loc := range sample.Stack {
+			names[i] = loc.Function
+		}
+		totals[strings.Join(names, ";")] += sample.Time
+	}
+
+	stacks := make([]string, 0, len(totals))
+	for stack := range totals {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	for _, stack := range stacks {
+		if totals[stack] > 0 {
+			fmt.Fprintf(w, "%s %d\n", stack, totals[stack].Nanoseconds())
+		}
+	}
+}
+
+// Field numbers from github.com/google/pprof/proto/profile.proto
+const (
+	pprofProfileSampleType        = 1
+	pprofProfileSample            = 2
+	pprofProfileLocation          = 4
+	pprofProfileFunction          = 5
+	pprofProfileStringTable       = 6
+	pprofProfileTimeNanos         = 9
+	pprofProfileDurationNanos     = 10
+	pprofProfilePeriodType        = 11
+	pprofProfilePeriod            = 12
+	pprofProfileDefaultSampleType = 14
+
+	pprofValueTypeType = 1
+	pprofValueTypeUnit = 2
+
+	pprofSampleLocationID = 1
+	pprofSampleValue      = 2
+
+	pprofLocationID   = 1
+	pprofLocationLine = 4
+
+	pprofLineFunctionID = 1
+	pprofLineLine       = 2
+
+	pprofFunctionID         = 1
+	pprofFunctionName       = 2
+	pprofFunctionSystemName = 3
+	pprofFunctionFilename   = 4
+)
+
+// writePprofProfile writes a gzipped pprof protobuf with "calls" and "time"
+// sample values. Each (function, line) pair becomes one location.
+func writePprofProfile(w io.Writer, filename string, samples []evaluator.ProfileSample, start time.Time, duration time.Duration) error {
+	strs := newStringTable()
+	functionIDs := make(map[string]uint64)
+	locationIDs := make(map[evaluator.ProfileLocation]uint64)
+
+	var profile, functions, locations protoBuffer
+
+	for _, vt := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}} {
+		var valueType protoBuffer
+		valueType.int64Field(pprofValueTypeType, strs.index(vt[0]))
+		valueType.int64Field(pprofValueTypeUnit, strs.index(vt[1]))
+		profile.messageField(pprofProfileSampleType, &valueType)
+	}
+
+	for _, sample := range samples {
+		// pprof stacks are leaf first
+		ids := make([]uint64, 0, len(sample.Stack))
+		for i := len(sample.Stack) - 1; i >= 0; i-- {
+			loc := sample.Stack[i]
+
+			fnID, ok := functionIDs[loc.Function]
+			if !ok {
+				fnID = uint64(len(functionIDs) + 1)
+				functionIDs[loc.Function] = fnID
+
+				var fn protoBuffer
+				fn.uint64Field(pprofFunctionID, fnID)
+				fn.int64Field(pprofFunctionName, strs.index(loc.Function))
+				fn.int64Field(pprofFunctionSystemName, strs.index(loc.Function))
+				fn.int64Field(pprofFunctionFilename, strs.index(filename))
+				functions.messageField(pprofProfileFunction, &fn)
+			}
+
+			locID, ok := locationIDs[loc]
+			if !ok {
+				locID = uint64(len(locationIDs) + 1)
+				locationIDs[loc] = locID
+
+				var line, location protoBuffer
+				line.uint64Field(pprofLineFunctionID, fnID)
+				line.int64Field(pprofLineLine, int64(loc.Line))
+				location.uint64Field(pprofLocationID, locID)
+				location.messageField(pprofLocationLine, &line)
+				locations.messageField(pprofProfileLocation, &location)
+			}
+			ids = append(ids, locID)
+		}
+
+		var s protoBuffer
+		s.packedUint64Field(pprofSampleLocationID, ids)
+		s.packedInt64Field(pprofSampleValue, []int64{sample.Calls, sample.Time.Nanoseconds()})
+		profile.messageField(pprofProfileSample, &s)
+	}
+
+	profile.Write(locations.Bytes())
+	profile.Write(functions.Bytes())
+
+	// Intern the remaining strings before the table is written
+	var periodType protoBuffer
+	periodType.int64Field(pprofValueTypeType, strs.index("time"))
+	periodType.int64Field(pprofValueTypeUnit, strs.index("nanoseconds"))
+	defaultType := strs.index("time")
+
+	for _, s := range strs.strings {
+		profile.stringField(pprofProfileStringTable, s)
+	}
+	profile.int64Field(pprofProfileTimeNanos, start.UnixNano())
+	profile.int64Field(pprofProfileDurationNanos, duration.Nanoseconds())
+	profile.messageField(pprofProfilePeriodType, &periodType)
+	profile.int64Field(pprofProfilePeriod, 1)
+	profile.int64Field(pprofProfileDefaultSampleType, defaultType)
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// stringTable interns strings for a pprof profile. Index 0 is always "".
+type stringTable struct {
+	strings []string
+	indexes map[string]int64
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: []string{""}, indexes: map[string]int64{"": 0}}
+}
+
+func (t *stringTable) index(s string) int64 {
+	if i, ok := t.indexes[s]; ok {
+		return i
+	}
+	i := int64(len(t.strings))
+	t.strings = append(t.strings, s)
+	t.indexes[s] = i
+	return i
+}
+
+// protoBuffer encodes protobuf wire format fields
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+const (
+	protoWireVarint = 0
+	protoWireBytes  = 2
+)
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		b.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	b.WriteByte(byte(v))
+}
+
+func (b *protoBuffer) key(field int, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (b *protoBuffer) uint64Field(field int, v uint64) {
+	b.key(field, protoWireVarint)
+	b.varint(v)
+}
+
+func (b *protoBuffer) int64Field(field int, v int64) {
+	b.key(field, protoWireVarint)
+	b.varint(uint64(v))
+}
+
+func (b *protoBuffer) bytesField(field int, data []byte) {
+	b.key(field, protoWireBytes)
+	b.varint(uint64(len(data)))
+	b.Write(data)
+}
+
+func (b *protoBuffer) stringField(field int, s string) {
+	b.bytesField(field, []byte(s))
+}
+
+func (b *protoBuffer) messageField(field int, msg *protoBuffer) {
+	b.bytesField(field, msg.Bytes())
+}
+
+func (b *protoBuffer) packedUint64Field(field int, values []uint64) {
+	var packed protoBuffer
+	for _, v := range values {
+		packed.varint(v)
+	}
+	b.bytesField(field, packed.Bytes())
+}
+
+func (b *protoBuffer) packedInt64Field(field int, values []int64) {
+	var packed protoBuffer
+	for _, v := range values {
+		packed.varint(uint64(v))
+	}
+	b.bytesField(field, packed.Bytes())
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mars/evaluator"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var profileSamples = []evaluator.ProfileSample{
+	{
+		Stack: []evaluator.ProfileLocation{{Function: "main", Line: 9}},
+		Calls: 1,
+		Time:  2 * time.Millisecond,
+	},
+	{
+		Stack: []evaluator.ProfileLocation{{Function: "main", Line: 9}, {Function: "outer", Line: 5}, {Function: "inner", Line: 2}},
+		Calls: 2,
+		Time:  3 * time.Millisecond,
+	},
+	{
+		Stack: []evaluator.ProfileLocation{{Function: "main", Line: 9}, {Function: "outer", Line: 6}, {Function: "inner", Line: 2}},
+		Calls: 1,
+		Time:  time.Millisecond,
+	},
+	{
+		Stack: []evaluator.ProfileLocation{{Function: "main", Line: 10}},
+		Calls: 0,
+		Time:  0,
+	},
+}
+
+// protoField is one decoded protobuf field: a varint or a length-delimited
+// value
+type protoField struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+// decodeProto splits a protobuf message into its fields
+func decodeProto(t *testing.T, data []byte) []protoField {
+	t.Helper()
+	var fields []protoField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("bad field key in %x", data)
+		}
+		data = data[n:]
+		f := protoField{num: int(key >> 3)}
+		switch key & 7 {
+		case protoWireVarint:
+			f.varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				t.Fatalf("bad varint for field %d", f.num)
+			}
+			data = data[n:]
+		case protoWireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				t.Fatalf("bad length for field %d", f.num)
+			}
+			f.bytes = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d for field %d", key&7, f.num)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// decodePacked decodes a packed repeated varint field
+func decodePacked(t *testing.T, data []byte) []uint64 {
+	t.Helper()
+	var values []uint64
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("bad packed varint in %x", data)
+		}
+		values = append(values, v)
+		data = data[n:]
+	}
+	return values
+}
+
+func TestWritePprofProfile(t *testing.T) {
+	var buf bytes.Buffer
+	start := time.Unix(1700000000, 0)
+	if err := writePprofProfile(&buf, "prog.mars", profileSamples, start, 7*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Collect the profile's messages, then resolve them through the
+	// string table, which comes after the fields that refer to it
+	var (
+		strs                                []string
+		sampleTypes, samples, locs, fns     [][]protoField
+		period, defaultType, timeNanos, dur uint64
+		periodType                          []protoField
+	)
+	for _, f := range decodeProto(t, data) {
+		switch f.num {
+		case pprofProfileSampleType:
+			sampleTypes = append(sampleTypes, decodeProto(t, f.bytes))
+		case pprofProfileSample:
+			samples = append(samples, decodeProto(t, f.bytes))
+		case pprofProfileLocation:
+			locs = append(locs, decodeProto(t, f.bytes))
+		case pprofProfileFunction:
+			fns = append(fns, decodeProto(t, f.bytes))
+		case pprofProfileStringTable:
+			strs = append(strs, string(f.bytes))
+		case pprofProfileTimeNanos:
+			timeNanos = f.varint
+		case pprofProfileDurationNanos:
+			dur = f.varint
+		case pprofProfilePeriodType:
+			periodType = decodeProto(t, f.bytes)
+		case pprofProfilePeriod:
+			period = f.varint
+		case pprofProfileDefaultSampleType:
+			defaultType = f.varint
+		default:
+			t.Errorf("unexpected profile field %d", f.num)
+		}
+	}
+	str := func(i uint64) string {
+		t.Helper()
+		if i >= uint64(len(strs)) {
+			t.Fatalf("string index %d out of range of %d strings", i, len(strs))
+		}
+		return strs[i]
+	}
+
+	// The string table starts with "" and holds each string once
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table must start with \"\": %q", strs)
+	}
+	seen := make(map[string]bool)
+	for _, s := range strs {
+		if seen[s] {
+			t.Errorf("string %q appears twice in the table", s)
+		}
+		seen[s] = true
+	}
+
+	valueType := func(fields []protoField) string {
+		var typ, unit uint64
+		for _, f := range fields {
+			switch f.num {
+			case pprofValueTypeType:
+				typ = f.varint
+			case pprofValueTypeUnit:
+				unit = f.varint
+			}
+		}
+		return str(typ) + "/" + str(unit)
+	}
+	var types []string
+	for _, st := range sampleTypes {
+		types = append(types, valueType(st))
+	}
+	if want := []string{"calls/count", "time/nanoseconds"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("sample types %q, want %q", types, want)
+	}
+	if got := valueType(periodType); got != "time/nanoseconds" || period != 1 || str(defaultType) != "time" {
+		t.Errorf("period %s every %d, default sample type %q", got, period, str(defaultType))
+	}
+	if int64(timeNanos) != start.UnixNano() || dur != uint64(7*time.Millisecond) {
+		t.Errorf("time %d and duration %d", timeNanos, dur)
+	}
+
+	// Functions name their file, and locations a function and line
+	functions := make(map[uint64]string)
+	for _, fn := range fns {
+		var id uint64
+		var name, system, file string
+		for _, f := range fn {
+			switch f.num {
+			case pprofFunctionID:
+				id = f.varint
+			case pprofFunctionName:
+				name = str(f.varint)
+			case pprofFunctionSystemName:
+				system = str(f.varint)
+			case pprofFunctionFilename:
+				file = str(f.varint)
+			}
+		}
+		if id == 0 || functions[id] != "" || system != name || file != "prog.mars" {
+			t.Errorf("bad function %d: %q (%q) in %q", id, name, system, file)
+		}
+		functions[id] = name
+	}
+	locations := make(map[uint64]string)
+	for _, loc := range locs {
+		var id, fnID, line uint64
+		for _, f := range loc {
+			switch f.num {
+			case pprofLocationID:
+				id = f.varint
+			case pprofLocationLine:
+				for _, lf := range decodeProto(t, f.bytes) {
+					switch lf.num {
+					case pprofLineFunctionID:
+						fnID = lf.varint
+					case pprofLineLine:
+						line = lf.varint
+					}
+				}
+			}
+		}
+		if id == 0 || locations[id] != "" || functions[fnID] == "" {
+			t.Errorf("bad location %d: function %d line %d", id, fnID, line)
+		}
+		locations[id] = fmt.Sprintf("%s:%d", functions[fnID], line)
+	}
+	if len(functions) != 3 || len(locations) != 5 {
+		t.Errorf("expected 3 functions and 5 locations, got %v and %v", functions, locations)
+	}
+
+	// Samples list their stack leaf first
+	var got []string
+	for _, sample := range samples {
+		var stack []string
+		var values []uint64
+		for _, f := range sample {
+			switch f.num {
+			case pprofSampleLocationID:
+				for _, id := range decodePacked(t, f.bytes) {
+					stack = append(stack, locations[id])
+				}
+			case pprofSampleValue:
+				values = decodePacked(t, f.bytes)
+			}
+		}
+		got = append(got, fmt.Sprintf("%s %v", strings.Join(stack, " "), values))
+	}
+	want := []string{
+		"main:9 [1 2000000]",
+		"inner:2 outer:5 main:9 [2 3000000]",
+		"inner:2 outer:6 main:9 [1 1000000]",
+		"main:10 [0 0]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("samples:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestWriteCollapsedStacks(t *testing.T) {
+	var buf bytes.Buffer
+	writeCollapsedStacks(&buf, profileSamples)
+
+	// Stacks are sorted, the two through outer are merged, and stacks
+	// without time are left out
+	want := `main 2000000
+main;outer;inner 4000000
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
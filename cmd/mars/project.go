@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mars/manifest"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Files 'mars init' writes besides the manifest
+const (
+	initMain = `func main() {
+    log("Hello from Mars!");
+}
+`
+	initTest = `func test_addition() {
+    assert_eq(1 + 1, 2);
+}
+`
+)
+
+func runInit(args []string) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	name := flags.String("name", "", "package name (default: the directory name)")
+	flags.Usage = func() {
+		fmt.Println("Usage: mars init [--name name] [dir]")
+		fmt.Println()
+		fmt.Println("Creates a package in dir (default: the current directory) with a")
+		fmt.Println("mars.toml manifest, a main.mars entry file and a tests directory.")
+		fmt.Println("Existing files are left alone.")
+		fmt.Println()
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	dir := "."
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(1)
+	} else if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+
+	if *name == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		*name = strings.ReplaceAll(filepath.Base(abs), "-", "_")
+	}
+	if !manifest.ValidName(*name) {
+		fmt.Printf("Error: %q is not a valid package name; names must be identifiers\n", *name)
+		fmt.Println("Choose one with --name")
+		os.Exit(1)
+	}
+
+	manifestFile := filepath.Join(dir, manifest.FileName)
+	if _, err := os.Stat(manifestFile); err == nil {
+		fmt.Printf("Error: %s already exists\n", manifestFile)
+		os.Exit(1)
+	}
+
+	files := []struct {
+		path    string
+		content string
+	}{
+		{manifestFile, manifest.Template(*name)},
+		{filepath.Join(dir, "main.mars"), initMain},
+		{filepath.Join(dir, "tests", "main_test.mars"), initTest},
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f.path); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(f.path, []byte(f.content), 0o644); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Created %s\n", f.path)
+	}
+}
+
+func runBuild(args []string) {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	denyWarnings := flags.Bool("deny-warnings", false, "fail if the analyzer reports warnings, such as unused variables")
+	flags.Usage = func() {
+		fmt.Println("Usage: mars build [--deny-warnings] [dir]")
+		fmt.Println()
+		fmt.Println("Parses and checks every module of the package containing dir (default:")
+		fmt.Println("the current directory) and of the dependencies it imports, without")
+		fmt.Println("running anything. Files under tests/ and vendor/ are only checked when")
+		fmt.Println("imported.")
+		fmt.Println()
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	dir := "."
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(1)
+	} else if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+
+	m, err := manifest.Find(dir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if m == nil {
+		fmt.Printf("Error: no %s found in %s or its parents\n", manifest.FileName, dir)
+		fmt.Println("Run 'mars init' to create a package")
+		os.Exit(1)
+	}
+	if _, err := m.Packages(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// The entry file first, so its errors come first, then package files
+	// that nothing imports
+	files := []string{packagePath(m, m.Entry)}
+	others, err := collectMarsFiles(m.Dir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, file := range others {
+		rel, _ := filepath.Rel(m.Dir, file)
+		top := strings.Split(filepath.ToSlash(rel), "/")[0]
+		if top != "tests" && top != manifest.VendorDir {
+			files = append(files, packagePath(m, rel))
+		}
+	}
+
+	checked := make(map[string]bool)
+	failed := false
+	for _, file := range files {
+		abs, _ := filepath.Abs(file)
+		if checked[abs] {
+			continue
+		}
+		checked[abs] = true
+
+		graph, err := loadProgram(file, *denyWarnings)
+		if err != nil {
+			fmt.Println(err)
+			failed = true
+			continue
+		}
+		for _, mod := range graph.Modules {
+			if abs, err := filepath.Abs(mod.File); err == nil {
+				checked[abs] = true
+			}
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	modules := "modules"
+	if len(checked) == 1 {
+		modules = "module"
+	}
+	fmt.Printf("Built %s v%s (%d %s)\n", m.Name, m.Version, len(checked), modules)
+}
@@ -1,81 +1,186 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"mars/ast"
 	"mars/evaluator"
-	"mars/lexer"
-	"mars/parser"
+	"mars/module"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
-func runFile(filename string) {
-	// Check if file exists
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		fmt.Printf("Error: File '%s' does not exist\n", filename)
+// runOptions controls how 'mars run' executes a file
+type runOptions struct {
+	profile     string // write a pprof profile here, and collapsed stacks next to it
+	trace       bool   // log statements, assignments and calls as they run
+	traceOut    string // write the trace here instead of stderr
+	traceFormat string // text or json
+
+	denyWarnings bool // fail instead of printing the analyzer's warnings
+}
+
+func runFile(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	profile := flags.String("profile", "", "write a pprof profile to `file` and collapsed stacks to file.folded")
+	trace := flags.Bool("trace", false, "log each statement, assignment and function call to stderr")
+	traceOut := flags.String("trace-out", "", "write the trace to `file` (implies --trace)")
+	traceFormat := flags.String("trace-format", "text", "trace format: text or json (JSON lines)")
+	denyWarnings := flags.Bool("deny-warnings", false, "fail if the analyzer reports warnings, such as unused variables")
+	diagnosticsFormat := diagnosticsFlag(flags)
+	flags.Usage = func() {
+		fmt.Println("Usage: mars run [--profile file] [--trace] [--trace-out file] [--trace-format text|json]")
+		fmt.Println("                [--deny-warnings] [--diagnostics text|json|sarif] [file.mars]")
+		fmt.Println()
+		fmt.Println("Without a file, runs the entry file named by the package's mars.toml.")
+		fmt.Println()
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	// Without a file, run the entry of the package in the current directory
+	filename := flags.Arg(0)
+	if flags.NArg() == 0 {
+		if m := findManifest(); m != nil {
+			filename = packagePath(m, m.Entry)
+		}
+	}
+	if filename == "" || flags.NArg() > 1 {
+		fmt.Println("Error: 'run' command requires a file path outside a package")
+		fmt.Println("Usage: mars run [flags] [file.mars]")
 		os.Exit(1)
 	}
 
-	// Read file content
-	content, err := os.ReadFile(filename)
-	if err != nil {
-		fmt.Printf("Error reading file '%s': %v\n", filename, err)
+	if *traceFormat != "text" && *traceFormat != "json" {
+		fmt.Printf("Error: unknown --trace-format %q (want text or json)\n", *traceFormat)
 		os.Exit(1)
 	}
+	setDiagnosticsFormat(*diagnosticsFormat)
+
+	opts := runOptions{
+		profile:     *profile,
+		trace:       *trace || *traceOut != "",
+		traceOut:    *traceOut,
+		traceFormat: *traceFormat,
+
+		denyWarnings: *denyWarnings,
+	}
+	code := executeFile(filename, opts)
+	diagnostics.flush()
+	os.Exit(code)
+}
+
+// executeFile parses and evaluates filename after the modules it imports,
+// calling main() if it exists, and returns the process exit code
+func executeFile(filename string, opts runOptions) int {
+	// Check if file exists
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		fmt.Printf("Error: File '%s' does not exist\n", filename)
+		return 1
+	}
 
 	// Check file extension
 	if filepath.Ext(filename) != ".mars" {
 		fmt.Printf("Warning: File '%s' doesn't have .mars extension\n", filename)
 	}
 
-	// Lexical analysis
-	l := lexer.New(string(content))
+	// Parse the file and the modules it imports, and check the references
+	// between them before anything runs
+	graph, err := loadProgram(filename, opts.denyWarnings)
+	if err != nil {
+		reportError(err)
+		return 1
+	}
+
+	// Create evaluator
+	eval := evaluator.New()
 
-	// Split content into lines for error reporting
-	sourceLines := strings.Split(string(content), "\n")
+	var profiler *evaluator.Profiler
+	start := time.Now()
+	if opts.profile != "" {
+		profiler = evaluator.NewProfiler()
+		eval.SetProfiler(profiler)
+	}
 
-	// Parsing
-	p := parser.NewParserWithSource(l, sourceLines)
-	program := p.ParseProgram()
+	if opts.trace {
+		// Trace to stderr unbuffered so it interleaves with program output
+		var out io.Writer = os.Stderr
+		if opts.traceOut != "" {
+			f, err := os.Create(opts.traceOut)
+			if err != nil {
+				fmt.Printf("Error creating trace file: %v\n", err)
+				return 1
+			}
+			defer f.Close()
+			buffered := bufio.NewWriter(f)
+			defer buffered.Flush()
+			out = buffered
+		}
 
-	// Check for parser errors
-	errors := p.GetErrors()
-	if errors != nil && errors.HasErrors() {
-		fmt.Printf("Parse errors in '%s':\n", filename)
-		for _, err := range errors.Errors() {
-			fmt.Printf("  %s\n", err)
+		// Statements are shown with their source line, from whichever module they are in
+		sources := map[string][]string{"": strings.Split(graph.Main.Source, "\n")}
+		for _, mod := range graph.Modules {
+			if mod != graph.Main {
+				sources[mod.Path] = strings.Split(mod.Source, "\n")
+			}
 		}
-		os.Exit(1)
+		tracer := &traceWriter{w: out, json: opts.traceFormat == "json", sources: sources}
+		eval.SetTracer(tracer.event)
 	}
 
-	// Create evaluator
-	eval := evaluator.New()
+	exitCode := 0
+	if _, result := loadImports(eval, graph); result != nil {
+		reportRuntimeError(result, graph)
+		exitCode = 1
+	} else {
+		exitCode = evaluateProgram(eval, graph)
+	}
+	// Like a Go program, the run ends with main; tasks still running stop
+	eval.Stop()
+
+	if profiler != nil {
+		profiler.Stop()
+		if err := writeProfiles(opts.profile, filename, profiler.Samples(), start, time.Since(start)); err != nil {
+			fmt.Printf("Error writing profile: %v\n", err)
+			return 1
+		}
+	}
+	return exitCode
+}
 
+// evaluateProgram runs the top level of the graph's entry program and then
+// main(), reporting any runtime error, and returns the process exit code
+func evaluateProgram(eval *evaluator.Evaluator, graph *module.Graph) int {
 	// Evaluate the program (this defines functions and variables)
-	result := eval.Eval(program)
+	result := eval.Eval(graph.Main.Program)
 
 	// Check for evaluation errors
 	if result != nil && result.Type() == "ERROR" {
-		fmt.Printf("Runtime error in '%s': %s\n", filename, result.String())
-		os.Exit(1)
+		reportRuntimeError(result, graph)
+		return 1
 	}
 
-	// Try to call main function if it exists
-	_, exists := eval.GetEnvironment().Get("main")
-	if exists {
-		// Create a function call to main()
-		mainCall := &ast.FunctionCall{
-			Function:  &ast.Identifier{Name: "main"},
-			Arguments: []ast.Expression{},
-			Position:  ast.Position{Line: 1, Column: 1},
-		}
+	mainResult := callMain(eval)
+	if mainResult != nil && mainResult.Type() == "ERROR" {
+		reportRuntimeError(mainResult, graph)
+		return 1
+	}
+	return 0
+}
 
-		mainResult := eval.Eval(mainCall)
-		if mainResult != nil && mainResult.Type() == "ERROR" {
-			fmt.Printf("Runtime error in main(): %s\n", mainResult.String())
-			os.Exit(1)
-		}
+// callMain calls the main function of an evaluated program, if it declares
+// one, and returns its result. The call has no position, so it isn't
+// reported as a call site.
+func callMain(eval *evaluator.Evaluator) evaluator.Value {
+	if _, exists := eval.GetEnvironment().Get("main"); !exists {
+		return nil
 	}
+	return eval.Eval(&ast.FunctionCall{
+		Function:  &ast.Identifier{Name: "main"},
+		Arguments: []ast.Expression{},
+	})
 }
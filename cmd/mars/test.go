@@ -1,76 +1,256 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
 	"io"
-	"io/fs"
+	"mars/ast"
+	"mars/errors"
 	"mars/evaluator"
-	"mars/lexer"
-	"mars/parser"
+	"mars/module"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
 type TestResult struct {
 	Name     string
+	File     string
 	Passed   bool
+	Skipped  bool // left out by --run, so neither passed nor failed
 	Expected string
 	Actual   string
 	Error    string
+	Diff     string // unified diff against a golden file
 	Duration time.Duration
+	// Diagnostics are the errors that failed the test, for --diagnostics
+	Diagnostics []errors.Diagnostic
 }
 
 type TestFile struct {
-	Path     string
-	Content  string
-	Expected string
+	Path        string
+	Content     string
+	Expected    string
+	ExpectError string // runtime error code the file is expected to fail with
+}
+
+// testCase is a single runnable test: either a whole file whose output is
+// compared against its EXPECT comments, or one test_ function in a file
+type testCase struct {
+	Name        string
+	File        *TestFile
+	Program     *ast.Program
+	Graph       *module.Graph // the test file and the modules it imports
+	Function    string        // empty for whole-file tests
+	Expected    string
+	ExpectError string
+	ParseError  string              // parse and import errors, which fail the case before it runs
+	Diagnostics []errors.Diagnostic // ParseError's problems, for --diagnostics
+	Coverage    *evaluator.Coverage // shared by every case in the file; nil unless --cover
+	Skip        bool                // left out by --run; reported as skipped without running
 }
 
-func runTests() {
-	fmt.Println("Running Mars tests...")
-	fmt.Println()
+// testOptions controls which tests 'mars test' runs and how
+type testOptions struct {
+	run      *regexp.Regexp // only run tests whose name matches
+	parallel int            // number of tests to run at once
+	format   string         // how results are reported: text, junit, json or tap
+	update   bool           // rewrite golden files from actual output
 
-	// Look for tests directory
-	testDir := "tests"
-	if _, err := os.Stat(testDir); os.IsNotExist(err) {
-		fmt.Printf("Error: Tests directory '%s' not found\n", testDir)
-		fmt.Println("Create a 'tests' directory with .mars files to run tests")
-		os.Exit(1)
+	cover        bool   // collect statement and branch coverage
+	coverProfile string // write a coverprofile-style report here
+	coverHTML    string // write an HTML coverage report here
+
+	denyWarnings bool // fail files the analyzer reports warnings for
+}
+
+// testFunctionPrefix marks top-level functions that are run as tests
+const testFunctionPrefix = "test_"
+
+func runTests(args []string) {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	run := flags.String("run", "", "only run tests whose name matches this regular expression")
+	parallel := flags.Int("p", runtime.GOMAXPROCS(0), "number of tests to run in parallel")
+	format := flags.String("format", "text", "result format: text, junit, json or tap")
+	update := flags.Bool("update", false, "rewrite .out/.err golden files from actual output")
+	cover := flags.Bool("cover", false, "report statement and branch coverage")
+	coverProfile := flags.String("coverprofile", "", "write a coverage profile to `file` (implies --cover)")
+	coverHTML := flags.String("coverhtml", "", "write an HTML coverage report to `file` (implies --cover)")
+	denyWarnings := flags.Bool("deny-warnings", false, "fail test files the analyzer reports warnings for")
+	diagnosticsFormat := diagnosticsFlag(flags)
+	flags.Usage = func() {
+		fmt.Println("Usage: mars test [--run regexp] [-p N] [--format text|junit|json|tap] [--update]")
+		fmt.Println("                 [--cover] [--coverprofile file] [--coverhtml file] [--deny-warnings]")
+		fmt.Println("                 [--diagnostics text|json|sarif] [path ...]")
+		fmt.Println()
+		fmt.Println("Runs the .mars test files under the given paths (default: tests, in the")
+		fmt.Println("package root when there is a mars.toml).")
+		fmt.Println("Files with test_ functions run each function as a separate test;")
+		fmt.Println("other files are run whole and compared against their EXPECT comments,")
+		fmt.Println("or against sibling .out (output) and .err (error) golden files.")
+		fmt.Println("Files that other test files import are helper modules, not tests.")
+		fmt.Println()
+		flags.PrintDefaults()
 	}
+	flags.Parse(args)
 
-	// Find all .mars files in tests directory
-	testFiles, err := findTestFiles(testDir)
-	if err != nil {
-		fmt.Printf("Error finding test files: %v\n", err)
+	opts := testOptions{
+		parallel:     max(*parallel, 1),
+		format:       *format,
+		update:       *update,
+		cover:        *cover || *coverProfile != "" || *coverHTML != "",
+		coverProfile: *coverProfile,
+		coverHTML:    *coverHTML,
+
+		denyWarnings: *denyWarnings,
+	}
+	report, ok := testReporters[opts.format]
+	if !ok {
+		fmt.Printf("Error: unknown --format %q (want text, junit, json or tap)\n", opts.format)
 		os.Exit(1)
 	}
+	if *run != "" {
+		re, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Printf("Error: invalid --run pattern: %v\n", err)
+			os.Exit(1)
+		}
+		opts.run = re
+	}
+	setDiagnosticsFormat(*diagnosticsFormat)
+
+	// Default to the tests directory of the package we are in, if any
+	roots := flags.Args()
+	if len(roots) == 0 {
+		roots = []string{"tests"}
+		if m := findManifest(); m != nil {
+			roots = []string{packagePath(m, "tests")}
+		}
+	}
+
+	if opts.format == "text" {
+		fmt.Println("Running Mars tests...")
+		fmt.Println()
+	}
+
+	// Find all .mars files under the test roots
+	var testFiles []TestFile
+	for _, root := range roots {
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			fmt.Printf("Error: Tests directory '%s' not found\n", root)
+			fmt.Println("Create a 'tests' directory with .mars files to run tests")
+			os.Exit(1)
+		}
+
+		files, err := findTestFiles(root)
+		if err != nil {
+			fmt.Printf("Error finding test files: %v\n", err)
+			os.Exit(1)
+		}
+		testFiles = append(testFiles, files...)
+	}
 
 	if len(testFiles) == 0 {
-		fmt.Printf("No .mars test files found in '%s' directory\n", testDir)
+		fmt.Printf("No .mars test files found in '%s'\n", strings.Join(roots, "', '"))
 		fmt.Println("Create .mars files in the tests directory to run tests")
 		os.Exit(1)
 	}
 
-	// Run tests
-	var results []TestResult
-	passed := 0
-	failed := 0
+	// Expand files into test cases. Files that other test files import are
+	// helper modules rather than tests.
+	discovered := make([][]testCase, len(testFiles))
+	imported := make(map[string]bool)
+	for i := range testFiles {
+		discovered[i] = discoverTests(&testFiles[i], opts.denyWarnings)
+		if graph := discovered[i][0].Graph; graph != nil {
+			for _, mod := range graph.Modules {
+				if mod != graph.Main {
+					imported[filepath.Clean(mod.File)] = true
+				}
+			}
+		}
+	}
+
+	// Apply the --run filter. The tests it leaves out are reported as skipped.
+	var cases []testCase
+	selected := 0
+	var coverage []fileCoverage
+	for i, fileCases := range discovered {
+		if imported[filepath.Clean(testFiles[i].Path)] {
+			continue
+		}
 
-	for _, testFile := range testFiles {
-		result := runTest(testFile)
-		results = append(results, result)
+		if opts.cover && fileCases[0].Program != nil {
+			fc := fileCoverage{
+				Path:     testFiles[i].Path,
+				Source:   strings.Split(testFiles[i].Content, "\n"),
+				Coverage: evaluator.NewCoverage(),
+			}
+			fc.Coverage.Register(fileCases[0].Program)
+			coverage = append(coverage, fc)
+			for j := range fileCases {
+				fileCases[j].Coverage = fc.Coverage
+			}
+		}
+
+		for _, tc := range fileCases {
+			tc.Skip = opts.run != nil && !opts.run.MatchString(tc.Name)
+			if !tc.Skip {
+				selected++
+			}
+			cases = append(cases, tc)
+		}
+	}
+
+	if selected == 0 && opts.format == "text" {
+		fmt.Println("No tests match the --run pattern")
+		diagnostics.flush()
+		return
+	}
+
+	results := runTestCases(cases, opts)
 
-		if result.Passed {
+	passed := 0
+	failed := 0
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+		case result.Passed:
 			passed++
-		} else {
+		default:
 			failed++
 		}
 	}
 
 	// Print results
-	printTestResults(results, passed, failed)
+	report(os.Stdout, results, passed, failed)
+	for _, result := range results {
+		diagnostics.add(result.Diagnostics...)
+	}
+	diagnostics.flush()
+
+	if opts.cover {
+		if opts.format == "text" {
+			printCoverageSummary(os.Stdout, coverage)
+		}
+		if opts.coverProfile != "" {
+			if err := writeCoverProfile(opts.coverProfile, coverage); err != nil {
+				fmt.Printf("Error writing coverage profile: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if opts.coverHTML != "" {
+			if err := writeCoverHTML(opts.coverHTML, coverage); err != nil {
+				fmt.Printf("Error writing coverage report: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
 
 	// Exit with appropriate code
 	if failed > 0 {
@@ -79,179 +259,319 @@ func runTests() {
 }
 
 func findTestFiles(testDir string) ([]TestFile, error) {
-	var testFiles []TestFile
+	paths, err := collectMarsFiles(testDir)
+	if err != nil {
+		return nil, err
+	}
 
-	err := filepath.WalkDir(testDir, func(path string, d fs.DirEntry, err error) error {
+	var testFiles []TestFile
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
 		if err != nil {
-			return err
-		}
-
-		if !d.IsDir() && strings.HasSuffix(path, ".mars") {
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return err
-			}
-
-			expected := extractExpectedOutput(string(content))
-			testFiles = append(testFiles, TestFile{
-				Path:     path,
-				Content:  string(content),
-				Expected: expected,
-			})
+			return nil, err
 		}
 
-		return nil
-	})
+		expected, expectError := extractDirectives(strings.Split(string(content), "\n"))
+		testFiles = append(testFiles, TestFile{
+			Path:        path,
+			Content:     string(content),
+			Expected:    expected,
+			ExpectError: expectError,
+		})
+	}
 
-	return testFiles, err
+	return testFiles, nil
 }
 
-func extractExpectedOutput(content string) string {
-	// Look for EXPECTED: or EXPECT: comments
-	lines := strings.Split(content, "\n")
+// extractDirectives collects the expected output from EXPECTED:/EXPECT:
+// comments and the error code from an EXPECT-ERROR: comment. Runtime codes
+// from before they were renumbered, such as E003, still match.
+func extractDirectives(lines []string) (expected string, expectError string) {
 	var expectedLines []string
 
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "// EXPECTED:") || strings.HasPrefix(trimmed, "// EXPECT:") {
-			expected := strings.TrimSpace(strings.TrimPrefix(trimmed, "// EXPECTED:"))
-			expected = strings.TrimSpace(strings.TrimPrefix(expected, "// EXPECT:"))
-			expectedLines = append(expectedLines, expected)
+		switch {
+		case strings.HasPrefix(trimmed, "// EXPECT-ERROR:"):
+			expectError = errors.LegacyCode(strings.TrimSpace(strings.TrimPrefix(trimmed, "// EXPECT-ERROR:")))
+		case strings.HasPrefix(trimmed, "// EXPECTED:"):
+			expectedLines = append(expectedLines, strings.TrimSpace(strings.TrimPrefix(trimmed, "// EXPECTED:")))
+		case strings.HasPrefix(trimmed, "// EXPECT:"):
+			expectedLines = append(expectedLines, strings.TrimSpace(strings.TrimPrefix(trimmed, "// EXPECT:")))
 		}
 	}
 
-	return strings.Join(expectedLines, "\n")
+	return strings.Join(expectedLines, "\n"), expectError
 }
 
-func runTest(testFile TestFile) TestResult {
-	start := time.Now()
-
-	// Capture stdout
-	originalStdout := os.Stdout
-	r, w, err := os.Pipe()
+// discoverTests parses a test file and returns one case per test_ function,
+// or a single whole-file case if it has none. Directives for a test function
+// are read from the comments directly above it. With denyWarnings, warnings
+// fail the file like errors.
+func discoverTests(testFile *TestFile, denyWarnings bool) []testCase {
+	graph, err := loadProgram(testFile.Path, denyWarnings)
 	if err != nil {
-		return TestResult{
-			Name:   testFile.Path,
-			Passed: false,
-			Error:  fmt.Sprintf("Failed to capture stdout: %v", err),
+		return []testCase{{Name: testFile.Path, File: testFile, ParseError: err.Error() + "\n", Diagnostics: errorDiagnostics(err)}}
+	}
+	program := graph.Main.Program
+
+	var cases []testCase
+	for _, decl := range program.Declarations {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || !strings.HasPrefix(fn.Name.Name, testFunctionPrefix) {
+			continue
+		}
+		if fn.Signature != nil && len(fn.Signature.Parameters) > 0 {
+			continue
+		}
+
+		var lines []string
+		if comments := program.Comments.Get(fn); comments != nil {
+			for _, comment := range comments.Leading {
+				lines = append(lines, comment.Text)
+			}
 		}
+		expected, expectError := extractDirectives(lines)
+
+		cases = append(cases, testCase{
+			Name:        testFile.Path + "::" + fn.Name.Name,
+			File:        testFile,
+			Program:     program,
+			Graph:       graph,
+			Function:    fn.Name.Name,
+			Expected:    expected,
+			ExpectError: expectError,
+		})
 	}
-	os.Stdout = w
 
-	// Run the test
-	var actualOutput string
-	var runtimeError string
+	if len(cases) == 0 {
+		cases = append(cases, testCase{
+			Name:        testFile.Path,
+			File:        testFile,
+			Program:     program,
+			Graph:       graph,
+			Expected:    testFile.Expected,
+			ExpectError: testFile.ExpectError,
+		})
+	}
+	return cases
+}
 
-	func() {
-		defer func() {
-			if r := recover(); r != nil {
-				runtimeError = fmt.Sprintf("Panic: %v", r)
+// runTestCases runs cases on up to opts.parallel workers and returns the results
+// in the same order as cases
+func runTestCases(cases []testCase, opts testOptions) []TestResult {
+	results := make([]TestResult, len(cases))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(opts.parallel, len(cases)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = runTest(cases[i], opts.update)
 			}
 		}()
+	}
 
-		// Lexical analysis
-		l := lexer.New(testFile.Content)
+	for i := range cases {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 
-		// Parsing
-		p := parser.NewParser(l)
-		program := p.ParseProgram()
+	return results
+}
 
-		// Check for parser errors
-		errors := p.GetErrors()
-		if errors != nil && errors.HasErrors() {
-			runtimeError = "Parse errors:\n"
-			for _, err := range errors.Errors() {
-				runtimeError += fmt.Sprintf("  %s\n", err)
+// runTest runs one test case in its own evaluator, capturing its output
+func runTest(tc testCase, update bool) TestResult {
+	if tc.Skip {
+		return TestResult{Name: tc.Name, File: tc.File.Path, Skipped: true}
+	}
+	start := time.Now()
+	result := TestResult{Name: tc.Name, File: tc.File.Path, Expected: tc.Expected}
+
+	output, value, failure := executeTest(tc)
+	result.Actual = strings.TrimSpace(output)
+	result.Duration = time.Since(start)
+
+	// Whole-file tests with golden files, or without inline expectations
+	// when updating, are checked against the .out/.err files
+	if tc.Function == "" {
+		golden := goldenBase(tc.File.Path)
+		if fileExists(golden+".out") || fileExists(golden+".err") ||
+			(update && tc.Expected == "" && tc.ExpectError == "") {
+			diagnostics := failure
+			if diagnostics == "" && isErrorValue(value) {
+				diagnostics = describeError(value)
 			}
-			return
+			return checkGolden(result, golden, output, diagnostics, update)
 		}
+	}
 
-		// Create evaluator
-		eval := evaluator.New()
+	if failure != "" {
+		result.Error = failure
+		result.Diagnostics = tc.Diagnostics
+		return result
+	}
 
-		// Evaluate the program
-		result := eval.Eval(program)
+	// A runtime error the test didn't expect is reported as a diagnostic
+	if isErrorValue(value) && errorCode(value) != tc.ExpectError {
+		result.Diagnostics = []errors.Diagnostic{runtimeDiagnostic(value, moduleFiles(tc.Graph))}
+	}
 
-		// Check for evaluation errors
-		if result != nil && result.Type() == "ERROR" {
-			runtimeError = fmt.Sprintf("Runtime error: %s", result.String())
-			return
+	// Check runtime errors against EXPECT-ERROR
+	code := ""
+	if isErrorValue(value) {
+		code = errorCode(value)
+	}
+	switch {
+	case tc.ExpectError != "" && code == "":
+		if isErrorValue(value) {
+			result.Error = fmt.Sprintf("expected error %s, got: %s", tc.ExpectError, describeError(value))
+		} else {
+			result.Error = fmt.Sprintf("expected error %s, but the test succeeded", tc.ExpectError)
 		}
-
-		// Get final result if it's not null
-		if result != nil && result.Type() != "NULL" {
-			fmt.Printf("Result: %s\n", result.String())
+		return result
+	case tc.ExpectError != "" && code != tc.ExpectError:
+		result.Error = fmt.Sprintf("expected error %s, got: %s", tc.ExpectError, describeError(value))
+		return result
+	case tc.ExpectError == "" && isErrorValue(value):
+		result.Error = fmt.Sprintf("Runtime error: %s", describeError(value))
+		if rtErr, ok := value.(*evaluator.RuntimeError); ok && rtErr.Detail.ErrorCode == evaluator.ErrAssertion {
+			result.Expected = rtErr.Detail.Expected
+			result.Actual = rtErr.Detail.Actual
 		}
-	}()
+		return result
+	}
 
-	// Restore stdout and get captured output
-	w.Close()
-	os.Stdout = originalStdout
+	// Test functions only compare output when they declare EXPECT lines
+	if tc.Function != "" && tc.Expected == "" {
+		result.Passed = true
+		return result
+	}
+	result.Passed = result.Actual == tc.Expected
+	return result
+}
 
-	var buf strings.Builder
-	_, err = io.Copy(&buf, r)
-	if err != nil {
-		return TestResult{
-			Name:   testFile.Path,
-			Passed: false,
-			Error:  fmt.Sprintf("Failed to read captured output: %v", err),
-		}
+// executeTest evaluates a test case and returns its captured output, the
+// final value, and a failure message for parse errors or panics
+func executeTest(tc testCase) (output string, value evaluator.Value, failure string) {
+	if tc.ParseError != "" {
+		return "", nil, tc.ParseError
 	}
-	actualOutput = strings.TrimSpace(buf.String())
 
-	duration := time.Since(start)
+	var buf bytes.Buffer
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				failure = fmt.Sprintf("Panic: %v", r)
+			}
+		}()
+
+		eval := evaluator.New()
+		defer eval.Stop()
+		eval.SetOutput(&buf)
+		if tc.Coverage != nil {
+			eval.SetCoverage(tc.Coverage)
+		}
+
+		// Load imported modules, then evaluate the program (this defines
+		// functions and variables)
+		if _, value = loadImports(eval, tc.Graph); value != nil {
+			return
+		}
+		value = eval.Eval(tc.Program)
+		if isErrorValue(value) {
+			return
+		}
 
-	// Check for runtime errors
-	if runtimeError != "" {
-		return TestResult{
-			Name:     testFile.Path,
-			Passed:   false,
-			Expected: testFile.Expected,
-			Actual:   actualOutput,
-			Error:    runtimeError,
-			Duration: duration,
+		// Whole files run like mars run does, calling main if they have one
+		if tc.Function == "" {
+			value = callMain(eval)
+			return
 		}
+
+		// Call the test function
+		value = eval.Eval(&ast.FunctionCall{
+			Function:  &ast.Identifier{Name: tc.Function},
+			Arguments: []ast.Expression{},
+		})
+	}()
+
+	return buf.String(), value, failure
+}
+
+func isErrorValue(value evaluator.Value) bool {
+	return value != nil && value.Type() == "ERROR"
+}
+
+// errorCode returns the error code of a runtime error, if it has one
+func errorCode(value evaluator.Value) string {
+	if rtErr, ok := value.(*evaluator.RuntimeError); ok {
+		return rtErr.Detail.ErrorCode
 	}
+	return ""
+}
 
-	// Compare output
-	passed := actualOutput == testFile.Expected
+// describeError formats an error value on one line, without colours or stack trace
+func describeError(value evaluator.Value) string {
+	rtErr, ok := value.(*evaluator.RuntimeError)
+	if !ok {
+		return value.String()
+	}
 
-	return TestResult{
-		Name:     testFile.Path,
-		Passed:   passed,
-		Expected: testFile.Expected,
-		Actual:   actualOutput,
-		Duration: duration,
+	desc := fmt.Sprintf("error[%s]: %s", rtErr.Detail.ErrorCode, rtErr.Detail.Message)
+	if rtErr.Detail.Location.Line > 0 {
+		desc += " at "
+		if rtErr.Detail.Module != "" {
+			desc += rtErr.Detail.Module + ":"
+		}
+		desc += fmt.Sprintf("%d:%d", rtErr.Detail.Location.Line, rtErr.Detail.Location.Column)
 	}
+	return desc
 }
 
-func printTestResults(results []TestResult, passed, failed int) {
-	fmt.Println("Test Results:")
-	fmt.Println("=============")
+func printTestResults(w io.Writer, results []TestResult, passed, failed int) {
+	fmt.Fprintln(w, "Test Results:")
+	fmt.Fprintln(w, "=============")
 
+	skipped := 0
 	for _, result := range results {
-		if result.Passed {
-			fmt.Printf("✅ %s (%v)\n", result.Name, result.Duration)
+		if result.Skipped {
+			skipped++
+		} else if result.Passed {
+			fmt.Fprintf(w, "✅ %s (%v)\n", result.Name, result.Duration)
 		} else {
-			fmt.Printf("❌ %s (%v)\n", result.Name, result.Duration)
+			fmt.Fprintf(w, "❌ %s (%v)\n", result.Name, result.Duration)
 			if result.Error != "" {
-				fmt.Printf("   Error: %s\n", result.Error)
+				fmt.Fprintf(w, "   Error: %s\n", result.Error)
+			}
+			if result.Diff != "" {
+				for _, line := range splitLines(result.Diff) {
+					fmt.Fprintf(w, "   %s\n", line)
+				}
+				continue
 			}
 			if result.Expected != "" {
-				fmt.Printf("   Expected: %s\n", result.Expected)
+				fmt.Fprintf(w, "   Expected: %s\n", result.Expected)
 			}
 			if result.Actual != "" {
-				fmt.Printf("   Actual:   %s\n", result.Actual)
+				fmt.Fprintf(w, "   Actual:   %s\n", result.Actual)
 			}
 		}
 	}
 
-	fmt.Println()
-	fmt.Printf("Summary: %d passed, %d failed\n", passed, failed)
+	fmt.Fprintln(w)
+	if skipped > 0 {
+		fmt.Fprintf(w, "Summary: %d passed, %d failed, %d skipped\n", passed, failed, skipped)
+	} else {
+		fmt.Fprintf(w, "Summary: %d passed, %d failed\n", passed, failed)
+	}
 
 	if failed > 0 {
-		fmt.Println("\nSome tests failed. Check the output above for details.")
+		fmt.Fprintln(w, "\nSome tests failed. Check the output above for details.")
 	} else {
-		fmt.Println("\nAll tests passed! 🎉")
+		fmt.Fprintln(w, "\nAll tests passed! 🎉")
 	}
 }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"mars/evaluator"
+	"os"
+	"strings"
+)
+
+// fileCoverage is the coverage collected for one test file across all of
+// its tests
+type fileCoverage struct {
+	Path     string
+	Source   []string
+	Coverage *evaluator.Coverage
+}
+
+// lineStatus classifies a source line for coverage reports
+type lineStatus int
+
+const (
+	lineNotCode   lineStatus = iota // no statements on the line
+	lineCovered                     // a statement ran and every branch on the line went both ways
+	linePartial                     // a statement ran but a branch on the line only went one way
+	lineUncovered                   // no statement on the line ran
+)
+
+// lineStatuses classifies every line that holds a statement, keyed by line number
+func (fc fileCoverage) lineStatuses() map[int]lineStatus {
+	statuses := make(map[int]lineStatus)
+	for _, stmt := range fc.Coverage.Statements() {
+		line := stmt.Pos.Line
+		if stmt.Count > 0 {
+			statuses[line] = lineCovered
+		} else if statuses[line] == lineNotCode {
+			statuses[line] = lineUncovered
+		}
+	}
+	for _, branch := range fc.Coverage.Branches() {
+		if statuses[branch.Pos.Line] == lineCovered && (branch.True == 0 || branch.False == 0) {
+			statuses[branch.Pos.Line] = linePartial
+		}
+	}
+	return statuses
+}
+
+// lineStats returns how many statement lines ran, out of all statement lines
+func (fc fileCoverage) lineStats() (covered, total int) {
+	for _, status := range fc.lineStatuses() {
+		total++
+		if status != lineUncovered {
+			covered++
+		}
+	}
+	return covered, total
+}
+
+// branchStats returns how many branch outcomes (true and false for every
+// condition) were taken, out of all branch outcomes
+func (fc fileCoverage) branchStats() (covered, total int) {
+	for _, branch := range fc.Coverage.Branches() {
+		total += 2
+		if branch.True > 0 {
+			covered++
+		}
+		if branch.False > 0 {
+			covered++
+		}
+	}
+	return covered, total
+}
+
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// printCoverageSummary prints line and branch coverage for each file
+func printCoverageSummary(w io.Writer, files []fileCoverage) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Coverage:")
+	for _, fc := range files {
+		lines, totalLines := fc.lineStats()
+		branches, totalBranches := fc.branchStats()
+		fmt.Fprintf(w, "  %s: lines %.1f%% (%d/%d), branches %.1f%% (%d/%d)\n",
+			fc.Path,
+			percent(lines, totalLines), lines, totalLines,
+			percent(branches, totalBranches), branches, totalBranches)
+	}
+}
+
+// writeCoverProfile writes statement counts in the text format used by
+// 'go test -coverprofile'. Each statement is a block running from its
+// start to the end of its line.
+func writeCoverProfile(path string, files []fileCoverage) error {
+	var sb strings.Builder
+	sb.WriteString("mode: count\n")
+	for _, fc := range files {
+		for _, stmt := range fc.Coverage.Statements() {
+			endCol := stmt.Pos.Column + 1
+			if stmt.Pos.Line >= 1 && stmt.Pos.Line <= len(fc.Source) {
+				endCol = len(fc.Source[stmt.Pos.Line-1]) + 1
+			}
+			fmt.Fprintf(&sb, "%s:%d.%d,%d.%d 1 %d\n",
+				fc.Path, stmt.Pos.Line, stmt.Pos.Column, stmt.Pos.Line, endCol, stmt.Count)
+		}
+	}
+	return os.WriteFile(path, []byte(sb.String()), 0644)
+}
+
+type coverHTMLLine struct {
+	Number int
+	Text   string
+	Class  string
+}
+
+type coverHTMLFile struct {
+	Path     string
+	Summary  string
+	Lines    []coverHTMLLine
+	AnchorID string
+}
+
+var coverHTMLTemplate = template.Must(template.New("cover").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Mars coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { font-family: monospace; line-height: 1.3; }
+.line { display: block; }
+.num { color: #999; display: inline-block; width: 4em; text-align: right; margin-right: 1em; user-select: none; }
+.covered { background: #d6f5d6; }
+.partial { background: #fff3c4; }
+.uncovered { background: #f8d0d0; }
+</style>
+</head>
+<body>
+<h1>Mars coverage</h1>
+<p><span class="covered">covered</span> <span class="partial">partially covered branch</span> <span class="uncovered">not covered</span></p>
+<ul>
+{{range .}}<li><a href="#{{.AnchorID}}">{{.Path}}</a>: {{.Summary}}</li>
+{{end}}</ul>
+{{range .}}<h2 id="{{.AnchorID}}">{{.Path}}</h2>
+<p>{{.Summary}}</p>
+<pre>{{range .Lines}}<span class="line {{.Class}}"><span class="num">{{.Number}}</span>{{.Text}}</span>{{end}}</pre>
+{{end}}</body>
+</html>
+`))
+
+// writeCoverHTML writes an HTML page showing each file's source with
+// covered, partially covered and uncovered lines highlighted
+func writeCoverHTML(path string, files []fileCoverage) error {
+	classes := map[lineStatus]string{
+		lineCovered:   "covered",
+		linePartial:   "partial",
+		lineUncovered: "uncovered",
+	}
+
+	var pages []coverHTMLFile
+	for i, fc := range files {
+		lines, totalLines := fc.lineStats()
+		branches, totalBranches := fc.branchStats()
+		page := coverHTMLFile{
+			Path: fc.Path,
+			Summary: fmt.Sprintf("lines %.1f%% (%d/%d), branches %.1f%% (%d/%d)",
+				percent(lines, totalLines), lines, totalLines,
+				percent(branches, totalBranches), branches, totalBranches),
+			AnchorID: fmt.Sprintf("file%d", i),
+		}
+
+		statuses := fc.lineStatuses()
+		for n, text := range fc.Source {
+			page.Lines = append(page.Lines, coverHTMLLine{
+				Number: n + 1,
+				Text:   text,
+				Class:  classes[statuses[n+1]],
+			})
+		}
+		pages = append(pages, page)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := coverHTMLTemplate.Execute(f, pages); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"mars/evaluator"
+	"mars/lexer"
+	"mars/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteCoverProfile(t *testing.T) {
+	// The test file calls into a module whose statements sit on lines the
+	// test file leaves blank; they must not show up in the test file's profile
+	lib := `pub func double(n: int) -> int {
+    if n > 100 {
+        return 0;
+    }
+    return n * 2;
+}`
+	source := `import "util";
+func test_double() {
+
+    assert_eq(util.double(2), 4);
+}
+test_double();`
+
+	fc := fileCoverage{
+		Path:     "tests/b.mars",
+		Source:   strings.Split(source, "\n"),
+		Coverage: evaluator.NewCoverage(),
+	}
+	program := parser.NewParser(lexer.New(source)).ParseProgram()
+	fc.Coverage.Register(program)
+	eval := evaluator.New()
+	eval.SetCoverage(fc.Coverage)
+	if result := eval.LoadModule("util", parser.NewParser(lexer.New(lib)).ParseProgram()); isErrorValue(result) {
+		t.Fatalf("unexpected error loading module: %s", result)
+	}
+	if result := eval.Eval(program); isErrorValue(result) {
+		t.Fatalf("unexpected error: %s", result)
+	}
+
+	path := filepath.Join(t.TempDir(), "cover.out")
+	if err := writeCoverProfile(path, []fileCoverage{fc}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `mode: count
+tests/b.mars:4.5,4.34 1 1
+tests/b.mars:6.1,6.15 1 1
+`
+	if string(got) != want {
+		t.Errorf("got profile:\n%s\nwant:\n%s", got, want)
+	}
+}
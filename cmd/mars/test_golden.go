@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// goldenBase returns the path golden files are named after: a test file
+// tests/foo.mars has goldens tests/foo.out and tests/foo.err
+func goldenBase(path string) string {
+	return strings.TrimSuffix(path, ".mars")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// checkGolden compares a whole-file test's output with <base>.out and its
+// diagnostics with <base>.err, or rewrites both when update is set. A test
+// with no .err file must not produce diagnostics.
+func checkGolden(result TestResult, base, output, diagnostics string, update bool) TestResult {
+	diagnostics = normalizeDiagnostics(diagnostics)
+
+	if update {
+		if err := updateGoldens(base, output, diagnostics); err != nil {
+			result.Error = fmt.Sprintf("Failed to update golden files: %v", err)
+			return result
+		}
+		result.Passed = true
+		return result
+	}
+
+	var diffs strings.Builder
+	if expected, err := os.ReadFile(base + ".out"); err == nil {
+		result.Expected = strings.TrimSpace(string(expected))
+		diffs.WriteString(unifiedDiff(base+".out", "actual output", string(expected), output))
+	}
+
+	if expected, err := os.ReadFile(base + ".err"); err == nil {
+		diffs.WriteString(unifiedDiff(base+".err", "actual errors", string(expected), diagnostics))
+	} else if diagnostics != "" {
+		result.Error = strings.TrimSpace(diagnostics)
+		return result
+	}
+
+	result.Diff = diffs.String()
+	if result.Diff != "" {
+		result.Error = "output does not match golden files (run with --update to accept)"
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+// updateGoldens writes output to <base>.out and diagnostics to <base>.err,
+// removing a stale .err file when the test no longer fails
+func updateGoldens(base, output, diagnostics string) error {
+	if err := os.WriteFile(base+".out", []byte(output), 0644); err != nil {
+		return err
+	}
+
+	if diagnostics != "" {
+		return os.WriteFile(base+".err", []byte(diagnostics), 0644)
+	}
+	if err := os.Remove(base + ".err"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// normalizeDiagnostics trims surrounding whitespace and ends non-empty
+// diagnostics with a single newline, matching how .err files are written
+func normalizeDiagnostics(diagnostics string) string {
+	diagnostics = strings.TrimSpace(diagnostics)
+	if diagnostics == "" {
+		return ""
+	}
+	return diagnostics + "\n"
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeGolden writes a golden file, failing the test on error
+func writeGolden(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckGolden(t *testing.T) {
+	tests := []struct {
+		name        string
+		out, err    string // golden files; an empty .err isn't written, nor an empty .out next to one
+		output      string
+		diagnostics string
+		passed      bool
+		error       string
+		diff        string
+	}{
+		{
+			name:   "output matches",
+			out:    "hello\nworld\n",
+			output: "hello\nworld\n",
+			passed: true,
+		},
+		{
+			name:        "output and errors match",
+			out:         "hello\n",
+			err:         "error[E1004]: division by zero\n",
+			output:      "hello\n",
+			diagnostics: "  error[E1004]: division by zero\n\n",
+			passed:      true,
+		},
+		{
+			name:   "output differs",
+			out:    "hello\nworld\n",
+			output: "hello\nmars\n",
+			error:  "output does not match golden files (run with --update to accept)",
+			diff:   "--- GOLDEN.out\n+++ actual output\n@@ -1,2 +1,2 @@\n hello\n-world\n+mars\n",
+		},
+		{
+			name:        "errors differ",
+			out:         "",
+			err:         "error[E1004]: division by zero\n",
+			diagnostics: "error[E1012]: integer overflow\n",
+			error:       "output does not match golden files (run with --update to accept)",
+			diff:        "--- GOLDEN.err\n+++ actual errors\n@@ -1,1 +1,1 @@\n-error[E1004]: division by zero\n+error[E1012]: integer overflow\n",
+		},
+		{
+			name:        "errors without an .err file",
+			out:         "hello\n",
+			output:      "hello\n",
+			diagnostics: "error[E1004]: division by zero\n",
+			error:       "error[E1004]: division by zero",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := filepath.Join(t.TempDir(), "hello")
+			if tt.out != "" || tt.err == "" {
+				writeGolden(t, base+".out", tt.out)
+			}
+			if tt.err != "" {
+				writeGolden(t, base+".err", tt.err)
+			}
+
+			result := checkGolden(TestResult{Name: "hello"}, base, tt.output, tt.diagnostics, false)
+			if result.Passed != tt.passed {
+				t.Errorf("passed = %v, want %v", result.Passed, tt.passed)
+			}
+			if result.Error != tt.error {
+				t.Errorf("error = %q, want %q", result.Error, tt.error)
+			}
+			if want := strings.ReplaceAll(tt.diff, "GOLDEN", base); result.Diff != want {
+				t.Errorf("diff:\n%s\nwant:\n%s", result.Diff, want)
+			}
+		})
+	}
+}
+
+func TestCheckGoldenUpdate(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "hello")
+	writeGolden(t, base+".out", "stale\n")
+
+	// A failing run writes both golden files
+	result := checkGolden(TestResult{}, base, "hello\n", "error[E1004]: division by zero\n\n", true)
+	if !result.Passed || result.Error != "" {
+		t.Fatalf("update failed: %+v", result)
+	}
+	assertFile(t, base+".out", "hello\n")
+	assertFile(t, base+".err", "error[E1004]: division by zero\n")
+
+	// The goldens now match
+	if result := checkGolden(TestResult{}, base, "hello\n", "error[E1004]: division by zero", false); !result.Passed {
+		t.Errorf("updated goldens don't match: %+v", result)
+	}
+
+	// A passing run removes the stale .err file
+	if result := checkGolden(TestResult{}, base, "fixed\n", "", true); !result.Passed {
+		t.Fatalf("update failed: %+v", result)
+	}
+	assertFile(t, base+".out", "fixed\n")
+	if fileExists(base + ".err") {
+		t.Error("expected the stale .err file to be removed")
+	}
+}
+
+// assertFile checks the content of the file at path
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("%s contains %q, want %q", path, got, want)
+	}
+}
+
+func TestRunTestGolden(t *testing.T) {
+	dir := t.TempDir()
+	writeGolden(t, filepath.Join(dir, "hello.mars"), "log(\"hello\");\nlog(1 / 0);\n")
+	run := func(update bool) TestResult {
+		t.Helper()
+		files, err := findTestFiles(dir)
+		if err != nil || len(files) != 1 {
+			t.Fatalf("found %v, %v", files, err)
+		}
+		return runTest(discoverTests(&files[0], false)[0], update)
+	}
+
+	// --update records the output and the runtime error, which then match
+	if result := run(true); !result.Passed {
+		t.Fatalf("update failed: %+v", result)
+	}
+	assertFile(t, filepath.Join(dir, "hello.out"), "hello\n")
+	if !fileExists(filepath.Join(dir, "hello.err")) {
+		t.Fatal("expected hello.err to be written")
+	}
+	if result := run(false); !result.Passed {
+		t.Errorf("expected the goldens to match: %+v", result)
+	}
+
+	// A changed golden fails with a diff
+	writeGolden(t, filepath.Join(dir, "hello.out"), "goodbye\n")
+	result := run(false)
+	if result.Passed || !strings.Contains(result.Diff, "-goodbye\n+hello\n") {
+		t.Errorf("expected a diff against hello.out, got %+v", result)
+	}
+}
+
+func TestRunTestGoldenMain(t *testing.T) {
+	// A whole file runs as mars run runs it: top level first, then main,
+	// with nothing added for the final value
+	dir := t.TempDir()
+	writeGolden(t, filepath.Join(dir, "app.mars"), "log(\"start\");\nfunc main() { log(\"in main\"); }\ntotal := 1 + 2;\n")
+	writeGolden(t, filepath.Join(dir, "app.out"), "start\nin main\n")
+	files, err := findTestFiles(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("found %v, %v", files, err)
+	}
+	if result := runTest(discoverTests(&files[0], false)[0], false); !result.Passed {
+		t.Errorf("expected the golden to match: %+v", result)
+	}
+}
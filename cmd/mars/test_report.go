@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// testReporter writes the results of a test run in one output format
+type testReporter func(w io.Writer, results []TestResult, passed, failed int)
+
+// testReporters maps --format values to their reporters
+var testReporters = map[string]testReporter{
+	"text":  printTestResults,
+	"junit": writeJUnitResults,
+	"json":  writeJSONResults,
+	"tap":   writeTAPResults,
+}
+
+// testCaseName is the name of a result within its file: the test function
+// for test_ functions, or the file's base name for whole-file tests
+func testCaseName(result TestResult) string {
+	if name, ok := strings.CutPrefix(result.Name, result.File+"::"); ok {
+		return name
+	}
+	return filepath.Base(result.Name)
+}
+
+// skipMessage is why a skipped test didn't run
+const skipMessage = "not selected by --run"
+
+// failureMessage is the one-line reason a test failed
+func failureMessage(result TestResult) string {
+	if result.Error != "" {
+		return strings.SplitN(strings.TrimSpace(result.Error), "\n", 2)[0]
+	}
+	return "output did not match expected output"
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     float64         `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnitResults writes JUnit XML with one testsuite per file
+func writeJUnitResults(w io.Writer, results []TestResult, passed, failed int) {
+	report := junitTestSuites{Tests: len(results), Failures: failed}
+	suiteIndex := make(map[string]int)
+
+	for _, result := range results {
+		idx, ok := suiteIndex[result.File]
+		if !ok {
+			idx = len(report.Suites)
+			suiteIndex[result.File] = idx
+			report.Suites = append(report.Suites, junitTestSuite{Name: result.File})
+		}
+		suite := &report.Suites[idx]
+
+		tc := junitTestCase{
+			Name:      testCaseName(result),
+			Classname: result.File,
+			Time:      result.Duration.Seconds(),
+		}
+		switch {
+		case result.Skipped:
+			tc.Skipped = &junitSkipped{Message: skipMessage}
+			suite.Skipped++
+			report.Skipped++
+		case !result.Passed:
+			var body strings.Builder
+			if result.Error != "" {
+				fmt.Fprintf(&body, "Error: %s\n", result.Error)
+			}
+			if result.Expected != "" {
+				fmt.Fprintf(&body, "Expected: %s\n", result.Expected)
+			}
+			if result.Actual != "" {
+				fmt.Fprintf(&body, "Actual: %s\n", result.Actual)
+			}
+			body.WriteString(result.Diff)
+			tc.Failure = &junitFailure{Message: failureMessage(result), Body: body.String()}
+			suite.Failures++
+		}
+
+		suite.Tests++
+		suite.Time += tc.Time
+		suite.Cases = append(suite.Cases, tc)
+		report.Time += tc.Time
+	}
+
+	fmt.Fprint(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		fmt.Fprintf(w, "<!-- error writing report: %v -->", err)
+	}
+	fmt.Fprintln(w)
+}
+
+type jsonTestReport struct {
+	Passed  int              `json:"passed"`
+	Failed  int              `json:"failed"`
+	Skipped int              `json:"skipped"`
+	Tests   []jsonTestResult `json:"tests"`
+}
+
+type jsonTestResult struct {
+	Name     string  `json:"name"`
+	File     string  `json:"file"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration_seconds"`
+	Expected string  `json:"expected,omitempty"`
+	Actual   string  `json:"actual,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	Diff     string  `json:"diff,omitempty"`
+}
+
+// writeJSONResults writes a single JSON document describing every test
+func writeJSONResults(w io.Writer, results []TestResult, passed, failed int) {
+	report := jsonTestReport{Passed: passed, Failed: failed, Tests: []jsonTestResult{}}
+	for _, result := range results {
+		status := "pass"
+		switch {
+		case result.Skipped:
+			status = "skip"
+			report.Skipped++
+		case !result.Passed:
+			status = "fail"
+		}
+		report.Tests = append(report.Tests, jsonTestResult{
+			Name:     result.Name,
+			File:     result.File,
+			Status:   status,
+			Duration: result.Duration.Seconds(),
+			Expected: result.Expected,
+			Actual:   result.Actual,
+			Error:    result.Error,
+			Diff:     result.Diff,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		fmt.Fprintf(w, "error writing report: %v\n", err)
+	}
+}
+
+// writeTAPResults writes TAP version 13, with a YAML block for failures
+func writeTAPResults(w io.Writer, results []TestResult, passed, failed int) {
+	fmt.Fprintln(w, "TAP version 13")
+	fmt.Fprintf(w, "1..%d\n", len(results))
+
+	for i, result := range results {
+		if result.Skipped {
+			fmt.Fprintf(w, "ok %d - %s # SKIP %s\n", i+1, result.Name, skipMessage)
+			continue
+		}
+		if result.Passed {
+			fmt.Fprintf(w, "ok %d - %s\n", i+1, result.Name)
+			continue
+		}
+
+		fmt.Fprintf(w, "not ok %d - %s\n", i+1, result.Name)
+		fmt.Fprintln(w, "  ---")
+		fmt.Fprintf(w, "  message: %q\n", failureMessage(result))
+		writeTAPField(w, "error", result.Error)
+		writeTAPField(w, "expected", result.Expected)
+		writeTAPField(w, "actual", result.Actual)
+		writeTAPField(w, "diff", result.Diff)
+		fmt.Fprintf(w, "  duration_ms: %.3f\n", float64(result.Duration.Microseconds())/1000)
+		fmt.Fprintln(w, "  ...")
+	}
+}
+
+// writeTAPField writes a YAML literal block, skipping empty values
+func writeTAPField(w io.Writer, key, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(w, "  %s: |\n", key)
+	for _, line := range strings.Split(strings.TrimRight(value, "\n"), "\n") {
+		fmt.Fprintf(w, "    %s\n", line)
+	}
+}
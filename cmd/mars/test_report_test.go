@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// reportResults are one passing, one failing and one skipped test
+var reportResults = []TestResult{
+	{
+		Name:     "tests/math.mars::test_add",
+		File:     "tests/math.mars",
+		Passed:   true,
+		Duration: 1500 * time.Microsecond,
+	},
+	{
+		Name:     "tests/math.mars::test_sub",
+		File:     "tests/math.mars",
+		Expected: "1",
+		Actual:   "2",
+		Error:    "Runtime error: assert_eq failed\nat test_sub",
+		Duration: 250 * time.Microsecond,
+	},
+	{
+		Name:    "tests/hello.mars",
+		File:    "tests/hello.mars",
+		Skipped: true,
+	},
+}
+
+func TestTestReporters(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"junit", `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="3" failures="1" skipped="1" time="0.00175">
+  <testsuite name="tests/math.mars" tests="2" failures="1" skipped="0" time="0.00175">
+    <testcase name="test_add" classname="tests/math.mars" time="0.0015"></testcase>
+    <testcase name="test_sub" classname="tests/math.mars" time="0.00025">
+      <failure message="Runtime error: assert_eq failed">Error: Runtime error: assert_eq failed&#xA;at test_sub&#xA;Expected: 1&#xA;Actual: 2&#xA;</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="tests/hello.mars" tests="1" failures="0" skipped="1" time="0">
+    <testcase name="hello.mars" classname="tests/hello.mars" time="0">
+      <skipped message="not selected by --run"></skipped>
+    </testcase>
+  </testsuite>
+</testsuites>
+`},
+		{"json", `{
+  "passed": 1,
+  "failed": 1,
+  "skipped": 1,
+  "tests": [
+    {
+      "name": "tests/math.mars::test_add",
+      "file": "tests/math.mars",
+      "status": "pass",
+      "duration_seconds": 0.0015
+    },
+    {
+      "name": "tests/math.mars::test_sub",
+      "file": "tests/math.mars",
+      "status": "fail",
+      "duration_seconds": 0.00025,
+      "expected": "1",
+      "actual": "2",
+      "error": "Runtime error: assert_eq failed\nat test_sub"
+    },
+    {
+      "name": "tests/hello.mars",
+      "file": "tests/hello.mars",
+      "status": "skip",
+      "duration_seconds": 0
+    }
+  ]
+}
+`},
+		{"tap", `TAP version 13
+1..3
+ok 1 - tests/math.mars::test_add
+not ok 2 - tests/math.mars::test_sub
+  ---
+  message: "Runtime error: assert_eq failed"
+  error: |
+    Runtime error: assert_eq failed
+    at test_sub
+  expected: |
+    1
+  actual: |
+    2
+  duration_ms: 0.250
+  ...
+ok 3 - tests/hello.mars # SKIP not selected by --run
+`},
+		{"text", `Test Results:
+=============
+✅ tests/math.mars::test_add (1.5ms)
+❌ tests/math.mars::test_sub (250µs)
+   Error: Runtime error: assert_eq failed
+at test_sub
+   Expected: 1
+   Actual:   2
+
+Summary: 1 passed, 1 failed, 1 skipped
+
+Some tests failed. Check the output above for details.
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			testReporters[tt.format](&buf, reportResults, 1, 1)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mars/evaluator"
+	"strings"
+	"sync"
+)
+
+// traceWriter renders evaluator trace events as indented text or JSON lines.
+// Spawned tasks trace concurrently, so events are written one at a time.
+type traceWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	json    bool
+	sources map[string][]string // source lines by module path; "" is the entry program
+}
+
+// traceRecord is the JSON lines form of a trace event
+type traceRecord struct {
+	Kind   string   `json:"kind"`
+	Task   int      `json:"task,omitempty"`
+	Depth  int      `json:"depth"`
+	Module string   `json:"module,omitempty"`
+	Line   int      `json:"line"`
+	Column int      `json:"column"`
+	Source string   `json:"source,omitempty"`
+	Name   string   `json:"name,omitempty"`
+	Value  string   `json:"value,omitempty"`
+	Args   []string `json:"args,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// sourceLine returns the trimmed source text of a line in a module, or ""
+// if unknown
+func (t *traceWriter) sourceLine(module string, line int) string {
+	source := t.sources[module]
+	if line < 1 || line > len(source) {
+		return ""
+	}
+	return strings.TrimSpace(source[line-1])
+}
+
+func (t *traceWriter) event(ev evaluator.TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.json {
+		record := traceRecord{
+			Kind:   ev.Kind,
+			Task:   ev.Task,
+			Depth:  ev.Depth,
+			Module: ev.Module,
+			Line:   ev.Position.Line,
+			Column: ev.Position.Column,
+			Name:   ev.Name,
+			Value:  ev.Value,
+			Args:   ev.Args,
+			Error:  ev.Error,
+		}
+		if ev.Kind == evaluator.TraceStatement {
+			record.Source = t.sourceLine(ev.Module, ev.Position.Line)
+		}
+		data, _ := json.Marshal(record)
+		fmt.Fprintf(t.w, "%s\n", data)
+		return
+	}
+
+	var detail string
+	switch ev.Kind {
+	case evaluator.TraceStatement:
+		detail = t.sourceLine(ev.Module, ev.Position.Line)
+	case evaluator.TraceAssign:
+		detail = ev.Name + " = " + ev.Value
+	case evaluator.TraceCall:
+		detail = ev.Name + "(" + strings.Join(ev.Args, ", ") + ")"
+	case evaluator.TraceReturn:
+		if ev.Error != "" {
+			detail = ev.Name + " failed: " + ev.Error
+		} else {
+			detail = ev.Name + " -> " + ev.Value
+		}
+	}
+
+	location := fmt.Sprintf("%d:%d", ev.Position.Line, ev.Position.Column)
+	if ev.Module != "" {
+		location = ev.Module + ":" + location
+	}
+	// Events of spawned tasks are tagged with the task
+	var task string
+	if ev.Task > 0 {
+		task = fmt.Sprintf("[task %d] ", ev.Task)
+	}
+	fmt.Fprintf(t.w, "%s%s%-9s %s  %s\n", task, strings.Repeat("  ", ev.Depth), ev.Kind, location, detail)
+}
@@ -0,0 +1,569 @@
+// errors/catalog.go
+package errors
+
+import "strings"
+
+// Diagnostic codes are numbered by where they come from:
+//
+//	E0001-E0999  parse and analysis errors, reported before a program runs
+//	W0001-W0999  analysis warnings
+//	E1001-E1999  runtime errors, reported by the evaluator
+//
+// Runtime errors used to be numbered E001-E012, which read like the
+// analysis codes; LegacyCode maps those to their current numbers.
+
+// CodeInfo documents a diagnostic code for mars explain
+type CodeInfo struct {
+	Code        string
+	Title       string
+	Explanation string
+	Erroneous   string // A program that reports the code; empty if nothing reports it any more
+	Fixed       string // Erroneous with the problem fixed
+}
+
+// Reserved reports whether the code is no longer reported by anything
+func (c CodeInfo) Reserved() bool {
+	return c.Erroneous == ""
+}
+
+// Runtime error codes, as the evaluator reports them
+const (
+	RuntimeCodeTypeMismatch   = "E1001"
+	RuntimeCodeUndefinedVar   = "E1002"
+	RuntimeCodeDivisionByZero = "E1003"
+	RuntimeCodeNotAFunction   = "E1004"
+	RuntimeCodeWrongArgCount  = "E1005"
+	RuntimeCodeSyntaxError    = "E1006"
+	RuntimeCodeImmutable      = "E1007"
+	RuntimeCodeUndefined      = "E1008"
+	RuntimeCodeRuntimeError   = "E1009"
+	RuntimeCodeAssertion      = "E1010"
+	RuntimeCodeDeadlock       = "E1011"
+	RuntimeCodeOverflow       = "E1012"
+)
+
+// LegacyCode returns the current number of a runtime code from before
+// runtime errors were renumbered, such as E1003 for E003, and any other
+// code unchanged
+func LegacyCode(code string) string {
+	if len(code) == 4 && code[0] == 'E' && code[1] == '0' {
+		if _, ok := Explain("E1" + code[1:]); ok {
+			return "E1" + code[1:]
+		}
+	}
+	return code
+}
+
+// Explain returns the documentation of code, accepting lower case and the
+// runtime codes from before they were renumbered
+func Explain(code string) (CodeInfo, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) == 4 {
+		code = LegacyCode(code)
+	}
+	for _, info := range codes {
+		if info.Code == code {
+			return info, true
+		}
+	}
+	return CodeInfo{}, false
+}
+
+// Codes returns every documented code: analysis errors, warnings, then
+// runtime errors
+func Codes() []CodeInfo {
+	return append([]CodeInfo(nil), codes...)
+}
+
+// codes documents every code reported anywhere in Mars
+var codes = []CodeInfo{
+	{
+		Code:  ErrCodeSyntaxError,
+		Title: "syntax error",
+		Explanation: `The parser could not read a declaration, type or literal at this
+position because it isn't written the way the grammar expects. The
+message says what the parser was looking for; docs/grammar.md has the
+full grammar.`,
+		Erroneous: `const LIMIT := 10;
+println(LIMIT);`,
+		Fixed: `const LIMIT = 10;
+println(LIMIT);`,
+	},
+	{
+		Code:  ErrCodeTypeError,
+		Title: "type mismatch",
+		Explanation: `A value has a different type from the one expected where it is used:
+the declared type of a variable, the operands of an operator, the
+parameters of a function or its return type. Mars never converts
+between types implicitly; convert explicitly with int(x), float(x),
+string(x) and so on.`,
+		Erroneous: `count: int = "five";
+println(count);`,
+		Fixed: `count: int = 5;
+println(count);`,
+	},
+	{
+		Code:  ErrCodeUndefinedVar,
+		Title: "undefined name",
+		Explanation: `A name is used that isn't declared in any enclosing scope, or a module
+is asked for a member it doesn't declare. Names must be declared before
+they are used, and a variable declared inside a block is not visible
+after it.`,
+		Erroneous: `func main() {
+    println(total);
+}`,
+		Fixed: `func main() {
+    total := 10;
+    println(total);
+}`,
+	},
+	{
+		Code:  ErrCodeDuplicateDecl,
+		Title: "duplicate declaration",
+		Explanation: `The same name is declared twice in one scope: two functions, structs,
+types, constants or variables, a struct with two fields of the same
+name, or a struct literal that sets a field twice. Rename one of them,
+or assign to the existing variable instead of declaring it again.`,
+		Erroneous: `func area(w: int, h: int) -> int { return w * h; }
+func area(r: int) -> int { return 3 * r * r; }
+println(area(2, 3));`,
+		Fixed: `func area(w: int, h: int) -> int { return w * h; }
+func circleArea(r: int) -> int { return 3 * r * r; }
+println(area(2, 3));
+println(circleArea(2));`,
+	},
+	{
+		Code:  ErrCodeInvalidType,
+		Title: "type defined in terms of itself",
+		Explanation: `A named type must be declared with a type that already exists. A type
+that refers to itself, directly or through other named types, has no
+underlying type to take its values and operators from.`,
+		Erroneous: `type Celsius Celsius;
+c := Celsius(20);
+println(c);`,
+		Fixed: `type Celsius int;
+c := Celsius(20);
+println(c);`,
+	},
+	{
+		Code:  ErrCodeUnsafeError,
+		Title: "unsafe block error",
+		Explanation: `Reserved for errors in unsafe blocks. Nothing reports it in this
+version of Mars.`,
+	},
+	{
+		Code:  ErrCodeImmutableError,
+		Title: "assignment to an immutable variable",
+		Explanation: `Reserved. Assignments to immutable variables are reported as E0010 by
+the analyzer, and as E1007 when they happen at runtime.`,
+	},
+	{
+		Code:  ErrCodeUndefinedField,
+		Title: "undefined field",
+		Explanation: `A field is read or set that the struct doesn't declare. Check the
+spelling against the struct declaration, or add the field to it.`,
+		Erroneous: `struct Point { x: int; y: int; }
+p := Point{x: 1, y: 2};
+println(p.z);`,
+		Fixed: `struct Point { x: int; y: int; }
+p := Point{x: 1, y: 2};
+println(p.y);`,
+	},
+	{
+		Code:  ErrCodeUndefinedType,
+		Title: "undefined type",
+		Explanation: `A struct literal names a struct that isn't declared. Declare the struct,
+or import the module that declares it and write module.Name{...}.`,
+		Erroneous: `struct Point { x: int; y: int; }
+p := Pont{x: 1, y: 2};
+println(p.x);`,
+		Fixed: `struct Point { x: int; y: int; }
+p := Point{x: 1, y: 2};
+println(p.x);`,
+	},
+	{
+		Code:  ErrCodeImmutable,
+		Title: "modification of an immutable value",
+		Explanation: `Variables, parameters and fields are immutable unless declared with
+mut. An immutable value can't be assigned to, have its elements or
+fields assigned, be changed by builtins such as push, or be passed to
+a mut parameter. The related location shows where it was declared.`,
+		Erroneous: `func main() {
+    total := 0;
+    total = total + 1;
+    println(total);
+}`,
+		Fixed: `func main() {
+    mut total := 0;
+    total = total + 1;
+    println(total);
+}`,
+	},
+	{
+		Code:  ErrCodeParserState,
+		Title: "unexpected token in expression",
+		Explanation: `The parser found a token where an expression should start, such as an
+operator with nothing after it or a closing brace in the middle of an
+expression. This is usually a missing operand, a missing semicolon or
+an unbalanced bracket just before the position shown.`,
+		Erroneous: `x := 1 + ;
+println(x);`,
+		Fixed: `x := 1 + 2;
+println(x);`,
+	},
+	{
+		Code:  ErrCodeUnexpectedToken,
+		Title: "unexpected token",
+		Explanation: `The parser expected a particular token, such as a semicolon, a brace or
+a parenthesis, and found another one. The message names what is
+missing; the mistake is often just before the position shown.`,
+		Erroneous: `x := (1 + 2;
+println(x);`,
+		Fixed: `x := (1 + 2);
+println(x);`,
+	},
+	{
+		Code:  ErrCodeMissingToken,
+		Title: "missing token",
+		Explanation: `Reserved. A missing token is reported as E0012, naming the token that
+was expected.`,
+	},
+	{
+		Code:  ErrCodeInvalidExpression,
+		Title: "invalid constant expression",
+		Explanation: `A constant's value is computed when the program is checked, and the
+computation failed: it divides by zero or shifts by a negative count.`,
+		Erroneous: `const PER_PAGE = 0;
+const PAGES = 100 / PER_PAGE;
+println(PAGES);`,
+		Fixed: `const PER_PAGE = 20;
+const PAGES = 100 / PER_PAGE;
+println(PAGES);`,
+	},
+	{
+		Code:        ErrCodeArrayIndexError,
+		Title:       "malformed index expression",
+		Explanation: `An index expression is missing its closing bracket.`,
+		Erroneous: `xs := [1, 2, 3];
+println(xs[0);`,
+		Fixed: `xs := [1, 2, 3];
+println(xs[0]);`,
+	},
+	{
+		Code:  ErrCodeFunctionCallError,
+		Title: "wrong number of arguments",
+		Explanation: `A conversion such as int(x) is given something other than exactly one
+value, or a call to a function of another module passes a different
+number of arguments from the number of parameters the function
+declares. Calls to functions of the same module are checked with the
+rest of their types, as E0002.`,
+		Erroneous: `n := int(4.5, 2.5);
+println(n);`,
+		Fixed: `n := int(4.5);
+println(n);`,
+	},
+	{
+		Code:  ErrCodeControlFlowError,
+		Title: "control flow error",
+		Explanation: `A statement that controls the flow of the program is malformed or
+incomplete: an if, for, while or select without its braces, a select
+without cases, or a function with a return type that can reach its end
+without returning a value.`,
+		Erroneous: `func sign(x: int) -> int {
+    if x < 0 {
+        return -1;
+    }
+}
+println(sign(5));`,
+		Fixed: `func sign(x: int) -> int {
+    if x < 0 {
+        return -1;
+    }
+    return 1;
+}
+println(sign(5));`,
+	},
+	{
+		Code:  ErrCodeImportError,
+		Title: "import error",
+		Explanation: `An import can't be resolved: the module file doesn't exist, the path is
+invalid, two imports have the same last segment, or modules import each
+other in a cycle. Import paths are relative to the project root, the
+directory holding mars.toml.`,
+		Erroneous: `import "geometry/vectr";
+println(vectr.length(3, 4));`,
+		Fixed: `import "geometry/vector";
+println(vector.length(3, 4));`,
+	},
+	{
+		Code:  ErrCodePrivateAccess,
+		Title: "private member of another module",
+		Explanation: `Only declarations and struct fields marked pub can be used from other
+modules. Mark the declaration pub in the module that declares it, or
+use a public function of that module instead.`,
+		Erroneous: `// geometry/vector.mars
+func length(x: int, y: int) -> int { return x * x + y * y; }
+
+// main.mars
+import "geometry/vector";
+println(vector.length(3, 4));`,
+		Fixed: `// geometry/vector.mars
+pub func length(x: int, y: int) -> int { return x * x + y * y; }
+
+// main.mars
+import "geometry/vector";
+println(vector.length(3, 4));`,
+	},
+	{
+		Code:  ErrCodeNotConstant,
+		Title: "not a constant expression",
+		Explanation: `A constant, an array size or another place that needs a value known
+before the program runs uses a variable, a parameter or a function
+call. Constants may only use literals, other constants and operators,
+and may not be defined in terms of themselves.`,
+		Erroneous: `limit := 10;
+const MAX = limit * 2;
+println(MAX);`,
+		Fixed: `const LIMIT = 10;
+const MAX = LIMIT * 2;
+println(MAX);`,
+	},
+	{
+		Code:  ErrCodeUninitialized,
+		Title: "use before assignment",
+		Explanation: `A variable declared without a value is read on a path where nothing has
+assigned it yet. Give it a value when it is declared, or assign it on
+every path before the read.`,
+		Erroneous: `func describe(n: int) -> string {
+    mut label: string;
+    if n > 0 {
+        label = "positive";
+    }
+    return label;
+}
+println(describe(1));`,
+		Fixed: `func describe(n: int) -> string {
+    mut label := "not positive";
+    if n > 0 {
+        label = "positive";
+    }
+    return label;
+}
+println(describe(1));`,
+	},
+	{
+		Code:  ErrCodeNilSafety,
+		Title: "possibly nil value",
+		Explanation: `Only optional types, written ?T, can hold nil, and an optional value
+must be compared with nil before it is used as a T. The check can also
+mean nil was given to a variable or parameter whose type isn't
+optional.`,
+		Erroneous: `func next(n: ?int) -> int {
+    return n + 1;
+}
+println(next(1));`,
+		Fixed: `func next(n: ?int) -> int {
+    if n == nil {
+        return 0;
+    }
+    return n + 1;
+}
+println(next(1));`,
+	},
+	{
+		Code:  ErrCodeCannotInfer,
+		Title: "cannot infer a type",
+		Explanation: `A variable was declared from a value with no type of its own, such as
+an empty array or nil, and nothing later in the program fixes its type.
+Declare the type explicitly.`,
+		Erroneous: `xs := [];
+println(len(xs));`,
+		Fixed: `xs: []int = [];
+println(len(xs));`,
+	},
+	{
+		Code:  WarnCodeUnusedVar,
+		Title: "unused declaration",
+		Explanation: `A variable, parameter, function or struct is declared but never used.
+Remove it, name a variable or parameter _ to discard it on purpose, or
+mark a top-level declaration pub if other modules use it.`,
+		Erroneous: `func main() {
+    unused := 42;
+    println("hello");
+}`,
+		Fixed: `func main() {
+    println("hello");
+}`,
+	},
+	{
+		Code:  WarnCodeUnusedImport,
+		Title: "unused import",
+		Explanation: `Reserved for imports that are never used. Nothing reports it in this
+version of Mars.`,
+	},
+	{
+		Code:  WarnCodeDeprecated,
+		Title: "deprecated",
+		Explanation: `Reserved for uses of deprecated declarations. Nothing reports it in
+this version of Mars.`,
+	},
+	{
+		Code:  WarnCodeUnreachable,
+		Title: "unreachable code",
+		Explanation: `No path through the function reaches the statement, because a return,
+break or continue before it always jumps away. Remove the statement, or
+the jump if it was left in by mistake.`,
+		Erroneous: `func main() {
+    return;
+    println("done");
+}`,
+		Fixed: `func main() {
+    println("done");
+}`,
+	},
+	{
+		Code:  RuntimeCodeTypeMismatch,
+		Title: "type mismatch at runtime",
+		Explanation: `An operation got values of types it can't work with while the program
+ran, such as a conversion of a string that isn't a number or an
+operator applied to values of different types.`,
+		Erroneous: `n := bigint("12a");
+println(n);`,
+		Fixed: `n := bigint("12");
+println(n);`,
+	},
+	{
+		Code:  RuntimeCodeUndefinedVar,
+		Title: "undefined variable at runtime",
+		Explanation: `A name was looked up before the declaration that defines it ran, such as
+a top-level variable read above its declaration. The analyzer reports
+names that nothing declares as E0003 before the program runs.`,
+		Erroneous: `println(total);
+total := 10;`,
+		Fixed: `total := 10;
+println(total);`,
+	},
+	{
+		Code:  RuntimeCodeDivisionByZero,
+		Title: "division by zero",
+		Explanation: `An integer was divided by zero, or taken modulo zero. Check the divisor
+before dividing.`,
+		Erroneous: `func average(sum: int, count: int) -> int {
+    return sum / count;
+}
+println(average(10, 0));`,
+		Fixed: `func average(sum: int, count: int) -> int {
+    if count == 0 {
+        return 0;
+    }
+    return sum / count;
+}
+println(average(10, 0));`,
+	},
+	{
+		Code:  RuntimeCodeNotAFunction,
+		Title: "call of a value that isn't a function",
+		Explanation: `Something other than a function was called, such as an array element
+that holds a number. The analyzer reports calls of variables that aren't
+functions as E0002 before the program runs.`,
+		Erroneous: `counts := [3];
+println(counts[0](1));`,
+		Fixed: `func inc(n: int) -> int { return n + 1; }
+counts := [3];
+println(inc(counts[0]));`,
+	},
+	{
+		Code:  RuntimeCodeWrongArgCount,
+		Title: "wrong number of arguments at runtime",
+		Explanation: `A function was called with more or fewer arguments than it declares
+parameters, or a conversion was given other than one value. The analyzer
+reports direct calls with the wrong count as E0002 before the program
+runs; calls of functions taken from arrays are only checked when made.`,
+		Erroneous: `func add(a: int, b: int) -> int { return a + b; }
+ops := [add];
+println(ops[0](1));`,
+		Fixed: `func add(a: int, b: int) -> int { return a + b; }
+ops := [add];
+println(ops[0](1, 2));`,
+	},
+	{
+		Code:  RuntimeCodeSyntaxError,
+		Title: "malformed syntax tree",
+		Explanation: `The evaluator was given a declaration or assignment with a missing
+part. The parser never produces these, so it only happens to syntax
+trees built by hand, and means there is a bug in the tool that built
+them.`,
+	},
+	{
+		Code:  RuntimeCodeImmutable,
+		Title: "assignment to an immutable variable at runtime",
+		Explanation: `A variable declared without mut was assigned to. The analyzer reports
+these as E0010 before the program runs.`,
+		Erroneous: `x := 1;
+x = 2;
+println(x);`,
+		Fixed: `mut x := 1;
+x = 2;
+println(x);`,
+	},
+	{
+		Code:  RuntimeCodeUndefined,
+		Title: "undefined name at runtime",
+		Explanation: `An assignment targets a variable that was never declared, or code
+refers to a module or module member that isn't loaded. Declare a
+variable with := before assigning to it with =.`,
+		Erroneous: `count = 1;
+println(count);`,
+		Fixed: `mut count := 0;
+count = 1;
+println(count);`,
+	},
+	{
+		Code:  RuntimeCodeRuntimeError,
+		Title: "runtime error",
+		Explanation: `An operation failed while the program ran: an index out of bounds, a
+shift by a negative count, a send on a closed channel, or an access to
+a field that doesn't exist.`,
+		Erroneous: `xs := [1, 2, 3];
+println(xs[3]);`,
+		Fixed: `xs := [1, 2, 3];
+println(xs[len(xs) - 1]);`,
+	},
+	{
+		Code:  RuntimeCodeAssertion,
+		Title: "assertion failed",
+		Explanation: `An assert, assert_eq or assert_ne call failed. In mars test the test
+that made the call fails and the message shows the expected and
+actual values.`,
+		Erroneous: `func double(n: int) -> int { return n + n; }
+assert_eq(double(2), 5);`,
+		Fixed: `func double(n: int) -> int { return n + n; }
+assert_eq(double(2), 4);`,
+	},
+	{
+		Code:  RuntimeCodeDeadlock,
+		Title: "deadlock",
+		Explanation: `Every task of the program is blocked on a channel, so none of them can
+ever continue. A receive needs another task to send, and a send on an
+unbuffered channel needs another task to receive.`,
+		Erroneous: `c := chan[int]();
+send(c, 1);
+println(recv(c));`,
+		Fixed: `c := chan[int](1);
+send(c, 1);
+println(recv(c));`,
+	},
+	{
+		Code:  RuntimeCodeOverflow,
+		Title: "integer overflow",
+		Explanation: `A value doesn't fit in its integer type: int arithmetic overflowed, a
+division of any integer type overflowed (MIN / -1), a shift count was at
+least the type's width, or int(x) was given a bigint that is too large. Literals out of range for a
+sized type are reported as E0002 before the program runs. Use a wider
+type, or bigint for values without a limit.`,
+		Erroneous: `big := 9223372036854775807;
+println(big + 1);`,
+		Fixed: `big: bigint = 9223372036854775807;
+println(big + 1);`,
+	},
+}
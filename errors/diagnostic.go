@@ -0,0 +1,314 @@
+// errors/diagnostic.go
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mars/ast"
+	"path/filepath"
+	"strings"
+)
+
+// Location is a span of a source file. End is zero when only the start is
+// known.
+type Location struct {
+	File  string
+	Start ast.Position
+	End   ast.Position
+}
+
+// Related is another location a diagnostic refers to, such as the
+// declaration an error is about or a call on a runtime error's stack
+type Related struct {
+	Location
+	Message string
+}
+
+// Diagnostic is the one shape every parse error, analyzer error or warning
+// and runtime error converts to for tools: editors, CI and the JSON and
+// SARIF writers
+type Diagnostic struct {
+	Location
+	Code     string
+	Severity ErrorSeverity
+	Message  string
+	Help     string
+	Related  []Related
+}
+
+// Diagnostic converts the error to a diagnostic in file
+func (e *Error) Diagnostic(file string) Diagnostic {
+	return Diagnostic{
+		Location: Location{
+			File:  file,
+			Start: ast.Position{Line: e.Line, Column: e.Column},
+			End:   ast.Position{Line: e.EndLine, Column: e.EndColumn},
+		},
+		Code:     e.Code,
+		Severity: e.Severity,
+		Message:  e.Message,
+		Help:     e.Help,
+	}
+}
+
+// Diagnostics converts every error in the list to a diagnostic in file
+func (el *ErrorList) Diagnostics(file string) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0, len(el.errors))
+	for _, err := range el.errors {
+		diagnostics = append(diagnostics, err.Diagnostic(file))
+	}
+	return diagnostics
+}
+
+// Diagnostic converts the error to a diagnostic in file, keeping its span
+// and related locations
+func (d *DiagnosticError) Diagnostic(file string) Diagnostic {
+	diagnostic := d.Error.Diagnostic(file)
+	if d.EndPos.Line > 0 {
+		diagnostic.End = d.EndPos
+	}
+	for _, related := range d.Related {
+		if related.File == "" {
+			related.File = file
+		}
+		diagnostic.Related = append(diagnostic.Related, related)
+	}
+	return diagnostic
+}
+
+// MarsFormat formats the diagnostic in the detailed style of MarsReporter,
+// quoting source, the content of d.File, and listing its related locations
+func (d Diagnostic) MarsFormat(source string) string {
+	de := &DiagnosticError{
+		Error: &Error{
+			Message:  d.Message,
+			Line:     d.Start.Line,
+			Column:   d.Start.Column,
+			Severity: d.Severity,
+			Code:     d.Code,
+			Help:     d.Help,
+		},
+		SourceCode: source,
+		EndPos:     d.End,
+	}
+	var sb strings.Builder
+	sb.WriteString(de.MarsFormat(d.File))
+	for _, related := range d.Related {
+		sb.WriteString(fmt.Sprintf(" \033[34m=\033[0m \033[1mnote\033[0m: %s at %s:%d:%d\n",
+			related.Message, related.File, related.Start.Line, related.Start.Column))
+	}
+	return sb.String()
+}
+
+// Diagnostics returns everything reported so far, errors and warnings, in
+// the order it was reported
+func (cr *MarsReporter) Diagnostics() []Diagnostic {
+	diagnostics := make([]Diagnostic, 0, len(cr.errors))
+	for _, err := range cr.errors {
+		diagnostics = append(diagnostics, err.Diagnostic(cr.filename))
+	}
+	return diagnostics
+}
+
+// jsonPosition is a line and column, both 1-based
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type jsonRelated struct {
+	File    string        `json:"file"`
+	Start   jsonPosition  `json:"start"`
+	End     *jsonPosition `json:"end,omitempty"`
+	Message string        `json:"message"`
+}
+
+type jsonDiagnostic struct {
+	File     string        `json:"file"`
+	Start    jsonPosition  `json:"start"`
+	End      *jsonPosition `json:"end,omitempty"`
+	Code     string        `json:"code"`
+	Severity string        `json:"severity"`
+	Message  string        `json:"message"`
+	Help     string        `json:"help,omitempty"`
+	Related  []jsonRelated `json:"related,omitempty"`
+}
+
+type jsonReport struct {
+	Diagnostics []jsonDiagnostic `json:"diagnostics"`
+}
+
+// jsonEnd returns the end of a span, or nil if it isn't known
+func jsonEnd(pos ast.Position) *jsonPosition {
+	if pos.Line == 0 {
+		return nil
+	}
+	return &jsonPosition{Line: pos.Line, Column: pos.Column}
+}
+
+// WriteJSON writes diagnostics as a single JSON document:
+// {"diagnostics": [{"file", "start", "end", "code", "severity", "message",
+// "help", "related"}, ...]}
+func WriteJSON(w io.Writer, diagnostics []Diagnostic) error {
+	report := jsonReport{Diagnostics: []jsonDiagnostic{}}
+	for _, d := range diagnostics {
+		jd := jsonDiagnostic{
+			File:     d.File,
+			Start:    jsonPosition{Line: d.Start.Line, Column: d.Start.Column},
+			End:      jsonEnd(d.End),
+			Code:     d.Code,
+			Severity: d.Severity.String(),
+			Message:  d.Message,
+			Help:     d.Help,
+		}
+		for _, r := range d.Related {
+			jd.Related = append(jd.Related, jsonRelated{
+				File:    r.File,
+				Start:   jsonPosition{Line: r.Start.Line, Column: r.Start.Column},
+				End:     jsonEnd(r.End),
+				Message: r.Message,
+			})
+		}
+		report.Diagnostics = append(report.Diagnostics, jd)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// The subset of SARIF 2.1.0 that WriteSARIF produces
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version,omitempty"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string        `json:"id"`
+	ShortDescription *sarifMessage `json:"shortDescription,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string            `json:"ruleId,omitempty"`
+	Level            string            `json:"level"`
+	Message          sarifMessage      `json:"message"`
+	Locations        []sarifLocation   `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation   `json:"relatedLocations,omitempty"`
+	Properties       map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// sarifLevels maps severities to SARIF result levels
+var sarifLevels = map[ErrorSeverity]string{
+	ErrorSeverityError:   "error",
+	ErrorSeverityWarning: "warning",
+	ErrorSeverityInfo:    "note",
+}
+
+func sarifLocationOf(loc Location) sarifLocation {
+	physical := sarifPhysicalLocation{ArtifactLocation: sarifArtifact{URI: filepath.ToSlash(loc.File)}}
+	// SARIF lines start at 1; a diagnostic without one is about the whole file
+	if loc.Start.Line > 0 {
+		physical.Region = &sarifRegion{StartLine: loc.Start.Line, StartColumn: loc.Start.Column}
+		if loc.End.Line > 0 {
+			physical.Region.EndLine = loc.End.Line
+			physical.Region.EndColumn = loc.End.Column
+		}
+	}
+	return sarifLocation{PhysicalLocation: physical}
+}
+
+// WriteSARIF writes diagnostics as a SARIF 2.1.0 log with one run of the
+// named tool. Each code becomes a rule, described by its title in the
+// catalog, and help is kept as the result's "help" property. Diagnostics
+// without a code, such as manifest errors, have no rule, and those without
+// a file have no location.
+func WriteSARIF(w io.Writer, tool, version string, diagnostics []Diagnostic) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: tool, Version: version, Rules: []sarifRule{}}},
+		Results: []sarifResult{},
+	}
+	seen := make(map[string]bool)
+	for _, d := range diagnostics {
+		if d.Code != "" && !seen[d.Code] {
+			seen[d.Code] = true
+			rule := sarifRule{ID: d.Code}
+			if info, ok := Explain(d.Code); ok {
+				rule.ShortDescription = &sarifMessage{Text: info.Title}
+			}
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+		}
+
+		result := sarifResult{
+			RuleID:  d.Code,
+			Level:   sarifLevels[d.Severity],
+			Message: sarifMessage{Text: d.Message},
+		}
+		if d.File != "" {
+			result.Locations = []sarifLocation{sarifLocationOf(d.Location)}
+		}
+		if d.Help != "" {
+			result.Properties = map[string]string{"help": d.Help}
+		}
+		for i, r := range d.Related {
+			loc := sarifLocationOf(r.Location)
+			id := i + 1
+			loc.ID = &id
+			loc.Message = &sarifMessage{Text: r.Message}
+			result.RelatedLocations = append(result.RelatedLocations, loc)
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
@@ -15,6 +15,10 @@ type Error struct {
 	Code       string
 	Help       string
 	SourceLine string // The actual line of source code
+	// EndLine and EndColumn locate the character just past the code the
+	// error is about; they are zero when only the start is known
+	EndLine   int
+	EndColumn int
 }
 
 // ErrorSeverity represents the severity level of an error
@@ -57,9 +61,13 @@ func (e *Error) String() string {
 	// Source line if provided
 	if e.SourceLine != "" {
 		sb.WriteString(fmt.Sprintf("  %s\n", e.SourceLine))
-		// Add a caret pointing to the error position
+		// Add carets under the error's span, or its position
 		if e.Column > 0 && e.Column <= len(e.SourceLine) {
-			caret := strings.Repeat(" ", e.Column-1) + "^"
+			width := 1
+			if e.EndLine == e.Line && e.EndColumn > e.Column {
+				width = e.EndColumn - e.Column
+			}
+			caret := strings.Repeat(" ", e.Column-1) + strings.Repeat("^", width)
 			sb.WriteString(fmt.Sprintf("  %s\n", caret))
 		}
 	}
@@ -112,6 +120,14 @@ func (e *Error) WithSeverity(severity ErrorSeverity) *Error {
 	return e
 }
 
+// WithEnd sets the position just past the code the error is about, so
+// that it is underlined in full
+func (e *Error) WithEnd(line, column int) *Error {
+	e.EndLine = line
+	e.EndColumn = column
+	return e
+}
+
 // WithSourceLine sets the source line for better error reporting
 func (e *Error) WithSourceLine(sourceLine string) *Error {
 	e.SourceLine = sourceLine
@@ -205,10 +221,17 @@ const (
 	ErrCodeArrayIndexError   = "E0015"
 	ErrCodeFunctionCallError = "E0016"
 	ErrCodeControlFlowError  = "E0017"
+	ErrCodeImportError       = "E0018"
+	ErrCodePrivateAccess     = "E0019"
+	ErrCodeNotConstant       = "E0020"
+	ErrCodeUninitialized     = "E0021"
+	ErrCodeNilSafety         = "E0022"
+	ErrCodeCannotInfer       = "E0023"
 
 	WarnCodeUnusedVar    = "W0001"
 	WarnCodeUnusedImport = "W0002"
 	WarnCodeDeprecated   = "W0003"
+	WarnCodeUnreachable  = "W0004"
 )
 
 // Common error constructors
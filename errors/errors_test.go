@@ -2,6 +2,17 @@
 package errors
 
 import (
+	"bytes"
+	"encoding/json"
+	goast "go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"mars/ast"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -102,6 +113,206 @@ func TestErrorChaining(t *testing.T) {
 	}
 }
 
+func TestDiagnostics(t *testing.T) {
+	reporter := NewMarsReporter("x := 1;\nx = 2;\n", "main.mars")
+	reporter.AddErrorWithSpan(ast.Position{Line: 2, Column: 1}, ast.Position{Line: 2, Column: 6},
+		ErrCodeImmutable, "cannot assign to immutable variable 'x'", "add 'mut'")
+	reporter.Relate(ast.Position{Line: 1, Column: 1}, "'x' is declared here")
+	reporter.AddWarning(ast.Position{Line: 1, Column: 1}, WarnCodeUnusedVar, "unused variable 'x'", "")
+
+	diagnostics := reporter.Diagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d", len(diagnostics))
+	}
+	d := diagnostics[0]
+	if d.File != "main.mars" || d.Start.Line != 2 || d.End.Column != 6 || d.Code != ErrCodeImmutable || d.Severity != ErrorSeverityError {
+		t.Errorf("unexpected diagnostic %+v", d)
+	}
+	if len(d.Related) != 1 || d.Related[0].File != "main.mars" || d.Related[0].Start.Line != 1 {
+		t.Errorf("expected the declaration as a related location in the same file, got %+v", d.Related)
+	}
+	if diagnostics[1].Severity != ErrorSeverityWarning || len(diagnostics[1].Related) != 0 {
+		t.Errorf("unexpected warning %+v", diagnostics[1])
+	}
+
+	list := NewErrorList()
+	list.Add(NewSyntaxError("unexpected token", 3, 4))
+	if got := list.Diagnostics("lib.mars"); len(got) != 1 || got[0].File != "lib.mars" || got[0].Start.Column != 4 || got[0].Code != ErrCodeSyntaxError {
+		t.Errorf("unexpected diagnostics from an error list: %+v", got)
+	}
+}
+
+func TestDiagnosticMarsFormat(t *testing.T) {
+	d := Diagnostic{
+		Location: Location{File: "lib.mars", Start: ast.Position{Line: 2, Column: 14}},
+		Code:     "E1003",
+		Severity: ErrorSeverityError,
+		Message:  "division by zero",
+		Related: []Related{{
+			Location: Location{File: "main.mars", Start: ast.Position{Line: 5, Column: 12}},
+			Message:  "div called here",
+		}},
+	}
+	out := d.MarsFormat("func div(a: int, b: int) -> int {\n    return a / b;\n}\n")
+	for _, want := range []string{
+		"error[E1003]\033[0m: division by zero\n",
+		" \033[34m-->\033[0m lib.mars:2:14\n",
+		"2 |\033[0m     return a / b;\n",
+		"note\033[0m: div called here at main.mars:5:12\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestErrorSpans(t *testing.T) {
+	err := NewSyntaxError("expected ')'", 1, 7).WithEnd(1, 10).WithSourceLine("log(1 22);")
+	if !strings.Contains(err.String(), "  log(1 22);\n        ^^^\n") {
+		t.Errorf("expected the span to be underlined, got:\n%s", err.String())
+	}
+	if d := err.Diagnostic("main.mars"); d.End.Line != 1 || d.End.Column != 10 {
+		t.Errorf("expected the diagnostic to end at 1:10, got %+v", d.End)
+	}
+
+	reporter := NewMarsReporter("log(x\nlog(y);\n", "main.mars")
+	reporter.AddErrors([]*Error{NewSyntaxError("unclosed call", 1, 4).WithEnd(2, 1)})
+	diagnostics := reporter.Diagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].Start.Column != 4 || diagnostics[0].End.Line != 2 {
+		t.Fatalf("unexpected diagnostics %+v", diagnostics)
+	}
+	if out := reporter.String(); !strings.Contains(out, "m^^\033") {
+		t.Errorf("expected a multi-line span to be underlined to the end of its first line, got:\n%s", out)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	diagnostics := []Diagnostic{{
+		Location: Location{File: "main.mars", Start: ast.Position{Line: 2, Column: 1}},
+		Code:     ErrCodeImmutable,
+		Severity: ErrorSeverityError,
+		Message:  "cannot assign",
+		Related:  []Related{{Location: Location{File: "main.mars", Start: ast.Position{Line: 1, Column: 1}}, Message: "declared here"}},
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, diagnostics); err != nil {
+		t.Fatal(err)
+	}
+	var report map[string][]map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	got := report["diagnostics"]
+	if len(got) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %s", buf.String())
+	}
+	if got[0]["file"] != "main.mars" || got[0]["code"] != "E0010" || got[0]["severity"] != "error" {
+		t.Errorf("unexpected diagnostic %v", got[0])
+	}
+	if _, ok := got[0]["end"]; ok {
+		t.Errorf("expected no end for a diagnostic without one, got %v", got[0]["end"])
+	}
+	if related, ok := got[0]["related"].([]interface{}); !ok || len(related) != 1 {
+		t.Errorf("expected one related location, got %v", got[0]["related"])
+	}
+
+	buf.Reset()
+	if err := WriteJSON(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"diagnostics\": []\n}\n"; buf.String() != want {
+		t.Errorf("expected an empty list, got %q", buf.String())
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	diagnostics := []Diagnostic{
+		{
+			Location: Location{File: "src/main.mars", Start: ast.Position{Line: 2, Column: 1}, End: ast.Position{Line: 2, Column: 6}},
+			Code:     ErrCodeImmutable,
+			Severity: ErrorSeverityError,
+			Message:  "cannot assign",
+			Help:     "add 'mut'",
+		},
+		{
+			Location: Location{File: "src/main.mars", Start: ast.Position{Line: 1, Column: 1}},
+			Code:     WarnCodeUnusedVar,
+			Severity: ErrorSeverityWarning,
+			Message:  "unused variable",
+		},
+		{
+			Location: Location{File: "src/lib.mars", Start: ast.Position{Line: 5, Column: 3}},
+			Code:     ErrCodeImmutable,
+			Severity: ErrorSeverityError,
+			Message:  "cannot assign",
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, "mars", "1.0.0", diagnostics); err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						ID               string `json:"id"`
+						ShortDescription struct {
+							Text string `json:"text"`
+						} `json:"shortDescription"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID     string            `json:"ruleId"`
+				Level      string            `json:"level"`
+				Properties map[string]string `json:"properties"`
+				Locations  []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine int `json:"startLine"`
+							EndColumn int `json:"endColumn"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || log.Runs[0].Tool.Driver.Name != "mars" {
+		t.Fatalf("unexpected log %s", buf.String())
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[0].ID != "E0010" || run.Tool.Driver.Rules[1].ID != "W0001" {
+		t.Errorf("expected one rule per code, got %+v", run.Tool.Driver.Rules)
+	} else if run.Tool.Driver.Rules[0].ShortDescription.Text != "modification of an immutable value" {
+		t.Errorf("expected the rule's title from the catalog, got %+v", run.Tool.Driver.Rules[0])
+	}
+	if len(run.Results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(run.Results))
+	}
+	first := run.Results[0]
+	loc := first.Locations[0].PhysicalLocation
+	if first.Level != "error" || loc.ArtifactLocation.URI != "src/main.mars" || loc.Region.StartLine != 2 || loc.Region.EndColumn != 6 {
+		t.Errorf("unexpected first result %+v", first)
+	}
+	if first.Properties["help"] != "add 'mut'" {
+		t.Errorf("expected help as a property, got %v", first.Properties)
+	}
+	if run.Results[1].Level != "warning" {
+		t.Errorf("expected a warning level, got %q", run.Results[1].Level)
+	}
+}
+
 // Helper function to check if a string contains a substring
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr ||
@@ -118,3 +329,119 @@ func containsSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+// TestCatalogCoversEveryCode finds every diagnostic code written as a
+// string literal in the tree and checks that mars explain documents it
+func TestCatalogCoversEveryCode(t *testing.T) {
+	code := regexp.MustCompile(`^[EW][0-9]{3,4}$`)
+	found := make(map[string]string)
+	err := filepath.WalkDir("..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != ".." && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		if err != nil {
+			return err
+		}
+		goast.Inspect(file, func(n goast.Node) bool {
+			if lit, ok := n.(*goast.BasicLit); ok && lit.Kind == token.STRING {
+				if s, err := strconv.Unquote(lit.Value); err == nil && code.MatchString(s) {
+					found[s] = path
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) < len(codes) {
+		t.Fatalf("found only %d codes in the tree, want at least %d", len(found), len(codes))
+	}
+	for c, path := range found {
+		if info, ok := Explain(c); !ok || info.Code != c {
+			t.Errorf("%s, used in %s, is not in the catalog", c, path)
+		}
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, info := range Codes() {
+		if seen[info.Code] {
+			t.Errorf("%s is documented twice", info.Code)
+		}
+		seen[info.Code] = true
+		if info.Title == "" || info.Explanation == "" {
+			t.Errorf("%s needs a title and an explanation", info.Code)
+		}
+		if (info.Erroneous == "") != (info.Fixed == "") {
+			t.Errorf("%s needs both an erroneous and a fixed example, or neither", info.Code)
+		}
+	}
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"E0010", "E0010"},
+		{"e0010", "E0010"},
+		{"E003", "E1003"},
+		{"W0001", "W0001"},
+	}
+	for _, tt := range tests {
+		info, ok := Explain(tt.code)
+		if !ok || info.Code != tt.want {
+			t.Errorf("Explain(%q) = %s, %t, want %s", tt.code, info.Code, ok, tt.want)
+		}
+	}
+	for _, c := range []string{"E0999", "E013", "shadow", ""} {
+		if _, ok := Explain(c); ok {
+			t.Errorf("Explain(%q) found a code", c)
+		}
+	}
+	if LegacyCode("E012") != "E1012" || LegacyCode("E0012") != "E0012" {
+		t.Errorf("LegacyCode maps E012 to %s and E0012 to %s", LegacyCode("E012"), LegacyCode("E0012"))
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"len", "length", "total", "true", "println", "x", "y"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"lenght", "length"}, // a swap beats a prefix
+		{"totl", "total"},
+		{"ture", "true"},
+		{"prinltn", "println"},
+		{"z", "x"}, // one edit is always close enough; ties go alphabetically
+		{"count", ""},
+		{"len", ""}, // the name itself is not a suggestion
+	}
+	for _, tt := range tests {
+		if got := Suggest(tt.name, candidates); got != tt.want {
+			t.Errorf("Suggest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if got := Suggest("lenght", []string{"len", "push"}); got != "len" {
+		t.Errorf("expected a prefix of the name to be suggested, got %q", got)
+	}
+	if got := Suggest("maxValue", []string{"max"}); got != "" {
+		t.Errorf("expected a prefix much shorter than the name not to be suggested, got %q", got)
+	}
+	if got := DidYouMean("totl", candidates); got != "did you mean 'total'?" {
+		t.Errorf("DidYouMean = %q", got)
+	}
+	if got := DidYouMean("count", candidates); got != "" {
+		t.Errorf("expected no help without a suggestion, got %q", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"mars/ast"
 	"strings"
+	"unicode/utf8"
 )
 
 // DiagnosticError represents a rich error with source context
@@ -12,6 +13,7 @@ type DiagnosticError struct {
 	*Error     // Embed your existing Error
 	SourceCode string
 	EndPos     ast.Position // For multi-token errors
+	Related    []Related    // Other locations the error is about; File is empty for this file
 }
 
 // MarsReporter provides beautiful error formatting
@@ -74,6 +76,51 @@ func (cr *MarsReporter) AddErrorWithSpan(startPos, endPos ast.Position, code, me
 	})
 }
 
+// AddErrors adds errors collected without a reporter, such as the
+// parser's, underlining the span of each that has one
+func (cr *MarsReporter) AddErrors(errs []*Error) {
+	for _, err := range errs {
+		start := ast.Position{Line: err.Line, Column: err.Column}
+		end := ast.Position{Line: err.EndLine, Column: err.EndColumn}
+		cr.AddErrorWithSpan(start, end, err.Code, err.Message, err.Help)
+	}
+}
+
+// AddWarning adds a warning, which is reported without failing the check
+func (cr *MarsReporter) AddWarning(pos ast.Position, code, message, help string) {
+	cr.errors = append(cr.errors, &DiagnosticError{
+		Error: &Error{
+			Message:  message,
+			Line:     pos.Line,
+			Column:   pos.Column,
+			Severity: ErrorSeverityWarning,
+			Code:     code,
+			Help:     help,
+		},
+		SourceCode: cr.sourceCode,
+	})
+}
+
+// Relate attaches a related location in the same file, such as the
+// declaration an error is about, to the diagnostic reported last
+func (cr *MarsReporter) Relate(pos ast.Position, message string) {
+	if len(cr.errors) == 0 {
+		return
+	}
+	last := cr.errors[len(cr.errors)-1]
+	last.Related = append(last.Related, Related{Location: Location{Start: pos}, Message: message})
+}
+
+// HasWarnings returns true if there are any warnings
+func (cr *MarsReporter) HasWarnings() bool {
+	for _, e := range cr.errors {
+		if e.Severity == ErrorSeverityWarning {
+			return true
+		}
+	}
+	return false
+}
+
 // HasErrors returns true if there are any errors
 func (cr *MarsReporter) HasErrors() bool {
 	for _, e := range cr.errors {
@@ -170,11 +217,16 @@ func (d *DiagnosticError) MarsFormat(filename string) string {
 		// Error pointer
 		sb.WriteString(fmt.Sprintf("%s \033[34m|\033[0m ", strings.Repeat(" ", lineNumWidth)))
 
-		// Calculate underline
+		// Calculate underline; a span that continues on later lines is
+		// underlined to the end of its first
 		underlineStart := d.Column - 1
 		underlineLen := 1
 		if d.EndPos.Line == d.Line && d.EndPos.Column > d.Column {
 			underlineLen = d.EndPos.Column - d.Column
+		} else if d.EndPos.Line > d.Line {
+			if rest := utf8.RuneCountInString(lines[d.Line-1]) - underlineStart; rest > 1 {
+				underlineLen = rest
+			}
 		}
 
 		sb.WriteString(strings.Repeat(" ", underlineStart))
@@ -0,0 +1,77 @@
+// errors/suggest.go
+package errors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Suggest returns the candidate closest to name, a misspelled identifier,
+// or "" if none is close enough. A candidate is close enough when at most
+// a third of name's characters must be inserted, deleted, changed or
+// swapped with a neighbour to reach it, or when it starts name and is at
+// least as long as the rest, as len starts lenght. Ties go to the
+// candidate first in alphabetical order.
+func Suggest(name string, candidates []string) string {
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+
+	best, bestDistance := "", -1
+	limit := len([]rune(name)) / 3
+	if limit < 1 {
+		limit = 1
+	}
+	for _, candidate := range sorted {
+		if candidate == name || candidate == "" {
+			continue
+		}
+		d := editDistance(name, candidate)
+		ok := d <= limit
+		if !ok && len(candidate) >= 3 && strings.HasPrefix(name, candidate) {
+			ok = d <= len(candidate)
+		}
+		if ok && (bestDistance < 0 || d < bestDistance) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// DidYouMean returns help suggesting the candidate closest to name, as
+// "did you mean 'len'?", or "" if none is close enough
+func DidYouMean(name string, candidates []string) string {
+	if suggestion := Suggest(name, candidates); suggestion != "" {
+		return fmt.Sprintf("did you mean '%s'?", suggestion)
+	}
+	return ""
+}
+
+// editDistance counts the insertions, deletions, substitutions and swaps
+// of adjacent runes that turn a into b
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// rows[i][j] is the distance between s[:i] and t[:j]
+	rows := make([][]int, len(s)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(t)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d := min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d = min(d, rows[i-2][j-2]+1)
+			}
+			rows[i][j] = d
+		}
+	}
+	return rows[len(s)][len(t)]
+}
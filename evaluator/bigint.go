@@ -0,0 +1,131 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// maxShift bounds bigint shift counts so a typo can't exhaust memory
+const maxShift = 1 << 20
+
+// isBig reports whether v is a bigint
+func isBig(v Value) bool {
+	_, ok := v.(*BigIntValue)
+	return ok
+}
+
+// toBig returns a bigint or plain int as a big.Int. Sized ints don't mix
+// with bigints without a conversion, as they don't mix with int.
+func toBig(v Value) (*big.Int, bool) {
+	switch v := v.(type) {
+	case *BigIntValue:
+		return v.Value, true
+	case *IntegerValue:
+		if v.Kind == "" {
+			return big.NewInt(v.Value), true
+		}
+	}
+	return nil, false
+}
+
+// bigOperation applies an operator to a bigint and a bigint or plain int,
+// which is promoted. Results are bigints and never overflow.
+func bigOperation(operator string, left, right Value) Value {
+	l, lok := toBig(left)
+	r, rok := toBig(right)
+	if !lok || !rok {
+		return &Error{Code: ErrTypeMismatch, Message: fmt.Sprintf("mismatched types: %s %s %s",
+			valueTypeName(left), operator, valueTypeName(right))}
+	}
+
+	v := new(big.Int)
+	switch operator {
+	case "+":
+		v.Add(l, r)
+	case "-":
+		v.Sub(l, r)
+	case "*":
+		v.Mul(l, r)
+	case "/", "%":
+		if r.Sign() == 0 {
+			return &Error{Message: "division by zero", Code: ErrDivisionByZero}
+		}
+		if operator == "/" {
+			v.Quo(l, r)
+		} else {
+			v.Rem(l, r)
+		}
+	case "&":
+		v.And(l, r)
+	case "|":
+		v.Or(l, r)
+	case "^":
+		v.Xor(l, r)
+	case "<<", ">>":
+		if r.Sign() < 0 {
+			return &Error{Code: ErrRuntimeError, Message: fmt.Sprintf("negative shift count %s", r)}
+		}
+		if r.Cmp(big.NewInt(maxShift)) > 0 {
+			return &Error{Code: ErrRuntimeError, Message: fmt.Sprintf("shift count %s too large", r)}
+		}
+		if operator == "<<" {
+			v.Lsh(l, uint(r.Int64()))
+		} else {
+			v.Rsh(l, uint(r.Int64()))
+		}
+	case "==":
+		return boolToValue(l.Cmp(r) == 0)
+	case "!=":
+		return boolToValue(l.Cmp(r) != 0)
+	case "<", ">", "<=", ">=":
+		c := l.Cmp(r)
+		return compareInts(operator, c == 0, c < 0)
+	default:
+		return &Error{Code: ErrTypeMismatch, Message: fmt.Sprintf("unknown operator: bigint %s bigint", operator)}
+	}
+	return &BigIntValue{Value: v}
+}
+
+// toBigInt converts an int of any type, a float or a decimal string to a
+// bigint. Floats are truncated toward zero.
+func toBigInt(v Value) (Value, bool) {
+	switch v := v.(type) {
+	case *BigIntValue:
+		return v, true
+	case *IntegerValue:
+		if isUnsigned64(intTypeOf(v)) {
+			return &BigIntValue{Value: new(big.Int).SetUint64(uint64(v.Value))}, true
+		}
+		return &BigIntValue{Value: big.NewInt(v.Value)}, true
+	case *FloatValue:
+		if math.IsNaN(v.Value) || math.IsInf(v.Value, 0) {
+			return nil, false
+		}
+		i, _ := big.NewFloat(v.Value).Int(nil)
+		return &BigIntValue{Value: i}, true
+	case *StringValue:
+		i, ok := new(big.Int).SetString(strings.TrimPrefix(v.Value, "+"), 10)
+		if !ok {
+			return nil, false
+		}
+		return &BigIntValue{Value: i}, true
+	}
+	return nil, false
+}
+
+// bigToInt converts a bigint to int, reporting values int can't hold
+func bigToInt(b *BigIntValue) Value {
+	if !b.Value.IsInt64() {
+		return &Error{Code: ErrOverflow, Message: fmt.Sprintf("%s overflows int", b.Value)}
+	}
+	return &IntegerValue{Value: b.Value.Int64()}
+}
+
+// lowBits returns the low 64 bits of a bigint in two's complement, which
+// a conversion to a sized type then wraps like any other int
+func lowBits(i *big.Int) int64 {
+	mask := new(big.Int).SetUint64(math.MaxUint64)
+	return int64(new(big.Int).And(i, mask).Uint64())
+}
@@ -2,7 +2,10 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
 	"math"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -12,6 +15,7 @@ type BuiltinFunction struct {
 	Name       string
 	Parameters []string
 	Function   func(args []Value) Value
+	Output     func(out io.Writer, args []Value) Value // Used instead of Function for builtins that write output
 }
 
 // BuiltinFunctions holds all registered built-in functions
@@ -29,17 +33,17 @@ var BuiltinFunctions = map[string]*BuiltinFunction{
 	"print": {
 		Name:       "print",
 		Parameters: []string{"value"},
-		Function:   builtinPrint,
+		Output:     builtinPrint,
 	},
 	"println": {
 		Name:       "println",
 		Parameters: []string{"value"},
-		Function:   builtinPrintln,
+		Output:     builtinPrintln,
 	},
 	"printf": {
 		Name:       "printf",
 		Parameters: []string{"format", "values..."},
-		Function:   builtinPrintf,
+		Output:     builtinPrintf,
 	},
 	"sin": {
 		Name:       "sin",
@@ -156,6 +160,36 @@ var BuiltinFunctions = map[string]*BuiltinFunction{
 		Parameters: []string{"array", "separator"},
 		Function:   builtinJoin,
 	},
+	"send": {
+		Name:       "send",
+		Parameters: []string{"channel", "value"},
+		Function:   builtinSend,
+	},
+	"recv": {
+		Name:       "recv",
+		Parameters: []string{"channel"},
+		Function:   builtinRecv,
+	},
+	"close": {
+		Name:       "close",
+		Parameters: []string{"channel"},
+		Function:   builtinClose,
+	},
+	"assert": {
+		Name:       "assert",
+		Parameters: []string{"condition", "message?"},
+		Function:   builtinAssert,
+	},
+	"assert_eq": {
+		Name:       "assert_eq",
+		Parameters: []string{"actual", "expected"},
+		Function:   builtinAssertEq,
+	},
+	"assert_ne": {
+		Name:       "assert_ne",
+		Parameters: []string{"actual", "unexpected"},
+		Function:   builtinAssertNe,
+	},
 }
 
 // builtinLen returns the length of a string or array
@@ -169,7 +203,7 @@ func builtinLen(args []Value) Value {
 	case STRING_TYPE:
 		return &IntegerValue{Value: int64(len(arg.(*StringValue).Value))}
 	case ARRAY_TYPE:
-		return &IntegerValue{Value: int64(len(arg.(*ArrayValue).Elements))}
+		return &IntegerValue{Value: int64(arg.(*ArrayValue).length())}
 	default:
 		return &Error{Message: fmt.Sprintf("len() not supported for type %s", arg.Type())}
 	}
@@ -188,36 +222,32 @@ func builtinAppend(args []Value) Value {
 		return &Error{Message: fmt.Sprintf("append() first argument must be array, got %s", slice.Type())}
 	}
 
-	array := slice.(*ArrayValue)
-	newElements := make([]Value, len(array.Elements)+1)
-	copy(newElements, array.Elements)
-	newElements[len(array.Elements)] = value
-
+	newElements := append(slice.(*ArrayValue).elements(), value)
 	return &ArrayValue{Elements: newElements}
 }
 
 // builtinPrint prints a value without newline
-func builtinPrint(args []Value) Value {
+func builtinPrint(out io.Writer, args []Value) Value {
 	if len(args) != 1 {
 		return &Error{Message: fmt.Sprintf("print() expects 1 argument, got %d", len(args))}
 	}
 
-	fmt.Print(formatValueForOutput(args[0]))
+	fmt.Fprint(out, formatValueForOutput(args[0]))
 	return NULL
 }
 
 // builtinPrintln prints a value with newline
-func builtinPrintln(args []Value) Value {
+func builtinPrintln(out io.Writer, args []Value) Value {
 	if len(args) != 1 {
 		return &Error{Message: fmt.Sprintf("println() expects 1 argument, got %d", len(args))}
 	}
 
-	fmt.Println(formatValueForOutput(args[0]))
+	fmt.Fprintln(out, formatValueForOutput(args[0]))
 	return NULL
 }
 
 // builtinPrintf prints formatted output
-func builtinPrintf(args []Value) Value {
+func builtinPrintf(out io.Writer, args []Value) Value {
 	if len(args) < 1 {
 		return &Error{Message: fmt.Sprintf("printf() expects at least 1 argument, got %d", len(args))}
 	}
@@ -234,7 +264,7 @@ func builtinPrintf(args []Value) Value {
 		formatArgs[i] = formatValueForOutput(arg)
 	}
 
-	fmt.Printf(formatStr, formatArgs...)
+	fmt.Fprintf(out, formatStr, formatArgs...)
 	return NULL
 }
 
@@ -650,6 +680,8 @@ func builtinPush(args []Value) Value {
 	}
 
 	arr := array.(*ArrayValue)
+	arr.mu.Lock()
+	defer arr.mu.Unlock()
 	arr.Elements = append(arr.Elements, value)
 	return array // Return the modified array
 }
@@ -667,6 +699,8 @@ func builtinPop(args []Value) Value {
 	}
 
 	arr := array.(*ArrayValue)
+	arr.mu.Lock()
+	defer arr.mu.Unlock()
 	if len(arr.Elements) == 0 {
 		return &Error{Message: "pop() called on empty array"}
 	}
@@ -693,6 +727,8 @@ func builtinReverse(args []Value) Value {
 	}
 
 	arr := array.(*ArrayValue)
+	arr.mu.Lock()
+	defer arr.mu.Unlock()
 
 	// Reverse the array in place
 	for i, j := 0, len(arr.Elements)-1; i < j; i, j = i+1, j-1 {
@@ -718,16 +754,16 @@ func builtinJoin(args []Value) Value {
 		return &Error{Message: fmt.Sprintf("join() expects string as second argument, got %s", separator.Type())}
 	}
 
-	arr := array.(*ArrayValue)
+	elements := array.(*ArrayValue).elements()
 	sep := separator.(*StringValue).Value
 
-	if len(arr.Elements) == 0 {
+	if len(elements) == 0 {
 		return &StringValue{Value: ""}
 	}
 
 	// Convert all elements to strings and join them
 	var result strings.Builder
-	for i, element := range arr.Elements {
+	for i, element := range elements {
 		if i > 0 {
 			result.WriteString(sep)
 		}
@@ -736,3 +772,171 @@ func builtinJoin(args []Value) Value {
 
 	return &StringValue{Value: result.String()}
 }
+
+// builtinSend sends a value on a channel, waiting until it can
+func builtinSend(args []Value) Value {
+	if len(args) != 2 {
+		return &Error{Message: fmt.Sprintf("send() expects 2 arguments, got %d", len(args))}
+	}
+	ch, ok := args[0].(*ChanValue)
+	if !ok {
+		return &Error{Message: fmt.Sprintf("send() expects a channel, got %s", args[0].Type())}
+	}
+	if !ch.accepts(args[1]) {
+		return &Error{Message: fmt.Sprintf("cannot send %s on %s", getValueType(args[1]), ch.String())}
+	}
+	return ch.send(args[1])
+}
+
+// builtinRecv receives a value from a channel, waiting for one to be sent
+func builtinRecv(args []Value) Value {
+	if len(args) != 1 {
+		return &Error{Message: fmt.Sprintf("recv() expects 1 argument, got %d", len(args))}
+	}
+	ch, ok := args[0].(*ChanValue)
+	if !ok {
+		return &Error{Message: fmt.Sprintf("recv() expects a channel, got %s", args[0].Type())}
+	}
+	return ch.recv()
+}
+
+// builtinClose closes a channel so receivers stop waiting once it is drained
+func builtinClose(args []Value) Value {
+	if len(args) != 1 {
+		return &Error{Message: fmt.Sprintf("close() expects 1 argument, got %d", len(args))}
+	}
+	ch, ok := args[0].(*ChanValue)
+	if !ok {
+		return &Error{Message: fmt.Sprintf("close() expects a channel, got %s", args[0].Type())}
+	}
+	return ch.close()
+}
+
+// AssertionFailure is returned by the assert builtins. The evaluator turns it
+// into a RuntimeError with code E010 at the call site.
+type AssertionFailure struct {
+	Message  string
+	Expected Value // nil for plain assert()
+	Actual   Value
+}
+
+func (a *AssertionFailure) Type() string   { return ERROR_TYPE }
+func (a *AssertionFailure) String() string { return "ERROR: " + a.Message }
+func (a *AssertionFailure) IsTruthy() bool { return false }
+
+// builtinAssert fails unless its condition is true
+func builtinAssert(args []Value) Value {
+	if len(args) < 1 || len(args) > 2 {
+		return &Error{Message: fmt.Sprintf("assert() expects 1 or 2 arguments, got %d", len(args))}
+	}
+
+	condition, ok := args[0].(*BooleanValue)
+	if !ok {
+		return &Error{Message: fmt.Sprintf("assert() condition must be bool, got %s", args[0].Type())}
+	}
+	if condition.Value {
+		return NULL
+	}
+
+	message := "assertion failed"
+	if len(args) == 2 {
+		message += ": " + formatValueForOutput(args[1])
+	}
+	return &AssertionFailure{Message: message}
+}
+
+// builtinAssertEq fails unless both values are deeply equal
+func builtinAssertEq(args []Value) Value {
+	if len(args) != 2 {
+		return &Error{Message: fmt.Sprintf("assert_eq() expects 2 arguments, got %d", len(args))}
+	}
+
+	if valuesEqual(args[0], args[1]) {
+		return NULL
+	}
+	return &AssertionFailure{
+		Message:  "assert_eq failed: values are not equal",
+		Expected: args[1],
+		Actual:   args[0],
+	}
+}
+
+// builtinAssertNe fails if both values are deeply equal
+func builtinAssertNe(args []Value) Value {
+	if len(args) != 2 {
+		return &Error{Message: fmt.Sprintf("assert_ne() expects 2 arguments, got %d", len(args))}
+	}
+
+	if !valuesEqual(args[0], args[1]) {
+		return NULL
+	}
+	return &AssertionFailure{
+		Message: fmt.Sprintf("assert_ne failed: both values are %s", inspectValue(args[0])),
+	}
+}
+
+// valuesEqual compares two values, descending into arrays and structs
+func valuesEqual(left, right Value) bool {
+	switch l := left.(type) {
+	case *ArrayValue:
+		r, ok := right.(*ArrayValue)
+		if !ok {
+			return false
+		}
+		le, re := l.elements(), r.elements()
+		if len(le) != len(re) {
+			return false
+		}
+		for i := range le {
+			if !valuesEqual(le[i], re[i]) {
+				return false
+			}
+		}
+		return true
+	case *StructValue:
+		r, ok := right.(*StructValue)
+		if !ok || l.TypeName != r.TypeName {
+			return false
+		}
+		lf, rf := l.fields(), r.fields()
+		if len(lf) != len(rf) {
+			return false
+		}
+		for name, value := range lf {
+			other, exists := rf[name]
+			if !exists || !valuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return equal(left, right).IsTruthy()
+}
+
+// inspectValue renders a value unambiguously for assertion messages:
+// strings are quoted and struct fields are sorted
+func inspectValue(value Value) string {
+	switch v := value.(type) {
+	case *StringValue:
+		return strconv.Quote(v.Value)
+	case *ArrayValue:
+		var elements []string
+		for _, elem := range v.elements() {
+			elements = append(elements, inspectValue(elem))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *StructValue:
+		values := v.fields()
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fields := make([]string, len(names))
+		for i, name := range names {
+			fields[i] = name + ": " + inspectValue(values[name])
+		}
+		return v.TypeName + "{" + strings.Join(fields, ", ") + "}"
+	}
+	return formatValueForOutput(value)
+}
@@ -1,6 +1,10 @@
 package evaluator
 
 import (
+	"bytes"
+	"mars/lexer"
+	"mars/parser"
+	"strings"
 	"testing"
 )
 
@@ -152,11 +156,15 @@ func TestBuiltinPrint(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := builtinPrint([]Value{tt.input})
+			var out bytes.Buffer
+			result := builtinPrint(&out, []Value{tt.input})
 
 			if result.Type() != NULL_TYPE {
 				t.Errorf("Expected NULL, got %T: %v", result, result)
 			}
+			if out.String() != tt.expected {
+				t.Errorf("Expected output %q, got %q", tt.expected, out.String())
+			}
 		})
 	}
 }
@@ -302,6 +310,85 @@ func TestBuiltinFunctionCall(t *testing.T) {
 	}
 }
 
+func TestEvaluatorSetOutput(t *testing.T) {
+	program := parser.NewParser(lexer.New(`log("first"); println(2); printf("%s!", "three");`)).ParseProgram()
+
+	var out bytes.Buffer
+	eval := New()
+	eval.SetOutput(&out)
+	if result := eval.Eval(program); isError(result) {
+		t.Fatalf("unexpected error: %s", result)
+	}
+
+	if out.String() != "first\n2\nthree!" {
+		t.Errorf("Expected output to be captured, got %q", out.String())
+	}
+}
+
+func TestBuiltinAssertions(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		message  string // empty when the assertion should pass
+		expected string
+		actual   string
+	}{
+		{name: "assert true", code: `assert(1 < 2);`},
+		{name: "assert false", code: `assert(1 > 2);`, message: "assertion failed"},
+		{name: "assert with message", code: `assert(false, "boom");`, message: "assertion failed: boom"},
+		{name: "assert_eq equal", code: `assert_eq(1 + 1, 2);`},
+		{name: "assert_eq arrays", code: `assert_eq([1, 2], [1, 2]);`},
+		{
+			name:     "assert_eq strings",
+			code:     `assert_eq("abc", "abd");`,
+			message:  "assert_eq failed",
+			expected: `"abd"`,
+			actual:   `"abc"`,
+		},
+		{
+			name:     "assert_eq arrays differ",
+			code:     `assert_eq([1, 2], [1, 3]);`,
+			message:  "assert_eq failed",
+			expected: "[1, 3]",
+			actual:   "[1, 2]",
+		},
+		{name: "assert_ne different", code: `assert_ne(1, 2);`},
+		{name: "assert_ne equal", code: `assert_ne("a", "a");`, message: `both values are "a"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parser.NewParser(lexer.New(tt.code)).ParseProgram()
+			result := New().Eval(program)
+
+			if tt.message == "" {
+				if isError(result) {
+					t.Fatalf("Expected assertion to pass, got %s", result)
+				}
+				return
+			}
+
+			err, ok := result.(*RuntimeError)
+			if !ok {
+				t.Fatalf("Expected RuntimeError, got %T: %v", result, result)
+			}
+			if err.Detail.ErrorCode != ErrAssertion {
+				t.Errorf("Expected code %s, got %s", ErrAssertion, err.Detail.ErrorCode)
+			}
+			if err.Detail.Location.Line != 1 {
+				t.Errorf("Expected location on line 1, got %d", err.Detail.Location.Line)
+			}
+			if !strings.Contains(err.Detail.Message, tt.message) {
+				t.Errorf("Expected message containing %q, got %q", tt.message, err.Detail.Message)
+			}
+			if err.Detail.Expected != tt.expected || err.Detail.Actual != tt.actual {
+				t.Errorf("Expected expected/actual %q/%q, got %q/%q",
+					tt.expected, tt.actual, err.Detail.Expected, err.Detail.Actual)
+			}
+		})
+	}
+}
+
 // Helper function for floating point comparison
 func abs(x float64) float64 {
 	if x < 0 {
@@ -0,0 +1,188 @@
+package evaluator
+
+import (
+	"mars/ast"
+	"sort"
+	"sync"
+)
+
+// Coverage records which statements and branches of a program have run.
+// It is safe for concurrent use, so evaluators running tests from the same
+// file in parallel can share one. Only the program passed to Register is
+// covered: statements run in the modules it imports are not counted.
+type Coverage struct {
+	mu         sync.Mutex
+	statements map[coverKey]int
+	branches   map[coverKey]*[2]int // hit counts for the true and false outcomes
+}
+
+// coverKey identifies a statement or branch point by the module it is in,
+// "" for the program being covered, and its position there. Positions alone
+// would mix up statements on the same line and column of different files.
+type coverKey struct {
+	module string
+	pos    ast.Position
+}
+
+// StatementCount is the number of times the statement at Pos ran
+type StatementCount struct {
+	Pos   ast.Position
+	Count int
+}
+
+// BranchCount is the number of times the condition at Pos was true and false
+type BranchCount struct {
+	Pos   ast.Position
+	True  int
+	False int
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{
+		statements: make(map[coverKey]int),
+		branches:   make(map[coverKey]*[2]int),
+	}
+}
+
+// Register records every statement and branch point in program with a zero
+// count, so code that never runs is reported as uncovered
+func (c *Coverage) Register(program *ast.Program) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, decl := range program.Declarations {
+		c.registerNode(decl)
+	}
+}
+
+func (c *Coverage) registerNode(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		c.registerNode(n.Body)
+		return
+	case *ast.UnsafeBlock:
+		c.registerNode(n.Body)
+		return
+	case *ast.BlockStatement:
+		if n != nil {
+			for _, stmt := range n.Statements {
+				c.registerNode(stmt)
+			}
+		}
+		return
+	}
+
+	if !isCoverable(node) {
+		return
+	}
+	key := coverKey{pos: node.Pos()}
+	if _, ok := c.statements[key]; !ok {
+		c.statements[key] = 0
+	}
+
+	switch n := node.(type) {
+	case *ast.IfStatement:
+		c.registerBranch(n.Position)
+		c.registerNode(n.Consequence)
+		c.registerNode(n.Alternative)
+	case *ast.ForStatement:
+		if n.Init != nil {
+			c.registerNode(n.Init)
+		}
+		if n.Condition != nil {
+			c.registerBranch(n.Position)
+		}
+		if n.Post != nil {
+			c.registerNode(n.Post)
+		}
+		c.registerNode(n.Body)
+	case *ast.WhileStatement:
+		c.registerBranch(n.Position)
+		c.registerNode(n.Body)
+	case *ast.SelectStatement:
+		for _, sc := range n.Cases {
+			c.registerNode(sc.Body)
+		}
+		c.registerNode(n.Default)
+	}
+}
+
+func (c *Coverage) registerBranch(pos ast.Position) {
+	key := coverKey{pos: pos}
+	if _, ok := c.branches[key]; !ok {
+		c.branches[key] = &[2]int{}
+	}
+}
+
+// isCoverable reports whether node is a statement that coverage counts.
+// Blocks are not counted themselves, only the statements inside them.
+func isCoverable(node ast.Node) bool {
+	if _, ok := node.(*ast.BlockStatement); ok {
+		return false
+	}
+	_, ok := node.(ast.Statement)
+	return ok
+}
+
+// hitStatement counts a run of the statement at pos in module, the import
+// path of the module the statement is in or "" for the covered program.
+// Statements Register didn't record are ignored.
+func (c *Coverage) hitStatement(module string, pos ast.Position) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := coverKey{module, pos}
+	if count, ok := c.statements[key]; ok {
+		c.statements[key] = count + 1
+	}
+}
+
+// hitBranch counts an outcome of the condition at pos in module, like
+// hitStatement
+func (c *Coverage) hitBranch(module string, pos ast.Position, taken bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts, ok := c.branches[coverKey{module, pos}]
+	if !ok {
+		return
+	}
+	if taken {
+		counts[0]++
+	} else {
+		counts[1]++
+	}
+}
+
+// Statements returns the hit count of every statement, in source order
+func (c *Coverage) Statements() []StatementCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make([]StatementCount, 0, len(c.statements))
+	for key, count := range c.statements {
+		counts = append(counts, StatementCount{Pos: key.pos, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool { return positionLess(counts[i].Pos, counts[j].Pos) })
+	return counts
+}
+
+// Branches returns the outcome counts of every branch point, in source order
+func (c *Coverage) Branches() []BranchCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make([]BranchCount, 0, len(c.branches))
+	for key, hits := range c.branches {
+		counts = append(counts, BranchCount{Pos: key.pos, True: hits[0], False: hits[1]})
+	}
+	sort.Slice(counts, func(i, j int) bool { return positionLess(counts[i].Pos, counts[j].Pos) })
+	return counts
+}
+
+func positionLess(a, b ast.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
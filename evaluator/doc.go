@@ -0,0 +1,31 @@
+// Package evaluator runs Mars programs by walking their syntax tree.
+//
+// A sized integer (i8..i64, u8..u64) is an IntegerValue that carries its
+// type in Kind and keeps its bits in the int64, so a u64 divides, compares
+// and shifts as unsigned. Plain int arithmetic reports overflow as E1012,
+// while sized types wrap on +, - and * and report a quotient that doesn't
+// fit or a shift by their width or more. fitInt gives a plain int the sized
+// or bigint type it is assigned, passed or returned as.
+//
+// A bigint is a BigIntValue backed by math/big; operations allocate a new
+// big.Int, so values can be shared freely.
+//
+// A value of a distinct type is a NamedValue wrapping the underlying value,
+// and operators unwrap it and rewrap arithmetic results.
+//
+// Each spawned task runs in its own Evaluator, made by fork, with its own
+// call stack; the scheduler in task.go blocks tasks on channel operations
+// and halts every task when one fails or all are blocked (E1011). Tasks
+// share Environments, arrays and structs, which lock each access, and
+// serialize their output. Only the main task is profiled.
+//
+// Coverage counts the statements and branches that run of the program
+// passed to Register, keyed by module and position, so statements of the
+// modules it imports are not counted.
+//
+// The Profiler charges time to functions and lines: builtins to the line
+// that called them and top-level code to the (program) frame.
+//
+// The tracer reports statements, assignments, calls and returns as
+// TraceEvents, indented by call depth.
+package evaluator
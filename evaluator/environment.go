@@ -1,14 +1,21 @@
 package evaluator
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+)
 
 type Binding struct {
 	Value     Value
 	IsMutable bool
+	Optional  string // the declared type of a ?T variable, which may hold nil
 }
 
-// Environment stores variables in the current scope
+// Environment stores variables in the current scope. It is safe for
+// concurrent use, since spawned tasks share the scopes their functions
+// close over.
 type Environment struct {
+	mu    sync.RWMutex
 	store map[string]Binding
 	outer *Environment
 }
@@ -30,40 +37,71 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 
 // Get retrieves a value from the environment
 func (e *Environment) Get(name string) (Binding, bool) {
-	binding, ok := e.store[name]
 	//check current scope
-	if ok {
+	if binding, ok := e.GetLocal(name); ok {
 		return binding, true
 	}
 	//check outer scope
 	if e.outer != nil {
-		binding, ok = e.outer.Get(name)
-		if ok {
-			return binding, true
-		}
+		return e.outer.Get(name)
 	}
 
 	return Binding{}, false
 }
 
+// GetLocal retrieves a value from this scope only, ignoring outer scopes
+func (e *Environment) GetLocal(name string) (Binding, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	binding, ok := e.store[name]
+	return binding, ok
+}
+
+// Names returns the names bound in this scope and the scopes enclosing it
+func (e *Environment) Names() []string {
+	var names []string
+	for env := e; env != nil; env = env.outer {
+		env.mu.RLock()
+		for name := range env.store {
+			names = append(names, name)
+		}
+		env.mu.RUnlock()
+	}
+	return names
+}
+
 // Set stores a value in the environment
 func (e *Environment) Set(name string, val Value, isMutable bool) Binding {
-	bind := Binding{val, isMutable}
+	return e.bind(name, Binding{Value: val, IsMutable: isMutable})
+}
+
+// SetOptional stores a variable declared with an optional type, which
+// keeps accepting nil and values of typ's element type when reassigned
+func (e *Environment) SetOptional(name string, val Value, isMutable bool, typ string) Binding {
+	return e.bind(name, Binding{Value: val, IsMutable: isMutable, Optional: typ})
+}
+
+func (e *Environment) bind(name string, bind Binding) Binding {
+	e.mu.Lock()
 	e.store[name] = bind
+	e.mu.Unlock()
 	return bind
 }
 
 // Update updates an existing variable (for mutable variables)
 func (e *Environment) Update(name string, val Value) error {
 	// Check current scope
+	e.mu.Lock()
 	if binding, ok := e.store[name]; ok {
+		defer e.mu.Unlock()
 		if binding.IsMutable == false {
 			return fmt.Errorf("cannot assign to immutable variable '%s'", name)
 		}
-		bind := e.Set(name, val, binding.IsMutable)
-		e.store[name] = bind
+		binding.Value = val
+		e.store[name] = binding
 		return nil
 	}
+	e.mu.Unlock()
 
 	// Check outer scopes
 	if e.outer != nil {
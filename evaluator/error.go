@@ -3,14 +3,18 @@ package evaluator
 import (
 	"fmt"
 	"mars/ast"
+	"mars/errors"
 	"strings"
 )
 
 type ErrorDetail struct {
 	Message   string
 	Location  ast.Position
+	Module    string // import path of the module Location is in; empty for the entry program
 	Hint      string
 	ErrorCode string
+	Expected  string // Set by failed assertions so tools can diff the values
+	Actual    string
 }
 
 type RuntimeError struct {
@@ -30,7 +34,17 @@ func (e *RuntimeError) formatError() string {
 
 	//Location if available
 	if e.Detail.Location.Line > 0 {
-		sb.WriteString(fmt.Sprintf("  \\033[34m-->\\033[0m %d:%d\\n", e.Detail.Location.Line, e.Detail.Location.Column))
+		location := fmt.Sprintf("%d:%d", e.Detail.Location.Line, e.Detail.Location.Column)
+		if e.Detail.Module != "" {
+			location = e.Detail.Module + ":" + location
+		}
+		sb.WriteString(fmt.Sprintf("  \033[34m-->\033[0m %s\n", location))
+	}
+
+	//Expected and actual values for failed assertions
+	if e.Detail.Expected != "" || e.Detail.Actual != "" {
+		sb.WriteString(fmt.Sprintf("  expected: %s\n", e.Detail.Expected))
+		sb.WriteString(fmt.Sprintf("  actual:   %s\n", e.Detail.Actual))
 	}
 
 	//Hint if provided
@@ -49,3 +63,32 @@ func (e *RuntimeError) formatError() string {
 
 	return sb.String()
 }
+
+// Diagnostic converts the error to a diagnostic. fileOf returns the file
+// of a module's import path, "" being the entry program. The function
+// calls on the stack become related locations at their call sites,
+// innermost first, and a failed assertion's values are added to the
+// message.
+func (e *RuntimeError) Diagnostic(fileOf func(module string) string) errors.Diagnostic {
+	d := errors.Diagnostic{
+		Location: errors.Location{File: fileOf(e.Detail.Module), Start: e.Detail.Location},
+		Code:     e.Detail.ErrorCode,
+		Severity: errors.ErrorSeverityError,
+		Message:  e.Detail.Message,
+		Help:     e.Detail.Hint,
+	}
+	if e.Detail.Expected != "" || e.Detail.Actual != "" {
+		d.Message += fmt.Sprintf("\nexpected: %s\nactual:   %s", e.Detail.Expected, e.Detail.Actual)
+	}
+	for i := len(e.StackTrace) - 1; i >= 0; i-- {
+		frame := e.StackTrace[i]
+		if frame.Context != "call" || frame.Location.Line == 0 {
+			continue
+		}
+		d.Related = append(d.Related, errors.Related{
+			Location: errors.Location{File: fileOf(frame.Module), Start: frame.Location},
+			Message:  frame.Function + " called here",
+		})
+	}
+	return d
+}
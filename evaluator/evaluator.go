@@ -2,27 +2,44 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
 	"mars/ast"
+	"mars/errors"
+	"mars/lexer"
+	"math/big"
+	"os"
 	"strings"
 )
 
-// Error codes
+// Error codes, documented in the errors package's catalog
 const (
-	ErrTypeMismatch   = "E001"
-	ErrUndefinedVar   = "E002"
-	ErrDivisionByZero = "E003"
-	ErrNotAFunction   = "E004"
-	ErrWrongArgCount  = "E005"
-	ErrSyntaxError    = "E006"
-	ErrImmutable      = "E007"
-	ErrUndefined      = "E008"
-	ErrRuntimeError   = "E009"
+	ErrTypeMismatch   = errors.RuntimeCodeTypeMismatch
+	ErrUndefinedVar   = errors.RuntimeCodeUndefinedVar
+	ErrDivisionByZero = errors.RuntimeCodeDivisionByZero
+	ErrNotAFunction   = errors.RuntimeCodeNotAFunction
+	ErrWrongArgCount  = errors.RuntimeCodeWrongArgCount
+	ErrSyntaxError    = errors.RuntimeCodeSyntaxError
+	ErrImmutable      = errors.RuntimeCodeImmutable
+	ErrUndefined      = errors.RuntimeCodeUndefined
+	ErrRuntimeError   = errors.RuntimeCodeRuntimeError
+	ErrAssertion      = errors.RuntimeCodeAssertion
+	ErrDeadlock       = errors.RuntimeCodeDeadlock
+	ErrOverflow       = errors.RuntimeCodeOverflow
 )
 
 type Evaluator struct {
 	env        *Environment
+	builtins   *Environment            // Encloses the top level of every module
+	modules    map[string]*ModuleValue // Loaded modules by import path
+	module     *ModuleValue            // Module whose code is running; nil for the entry program
 	callStack  []StackFrame
-	sourceCode string // For showing code snippets
+	sourceCode string    // For showing code snippets
+	out        io.Writer // Destination for print statements and output builtins; nil means os.Stdout
+	coverage   *Coverage // Records executed statements and branches when set
+	profiler   *Profiler // Measures time per function and line when set
+	tracer     func(TraceEvent)
+	sched      *scheduler // Shared by every task of the program
+	task       int        // Task this evaluator runs; 0 for the main task
 }
 
 type binaryOpFn func(left, right Value) Value
@@ -39,6 +56,11 @@ var binaryOps = map[string]binaryOpFn{
 	">":  greaterThan,
 	"<=": lessThanOrEqual,
 	">=": greaterThanOrEqual,
+	"&":  intOperator("&"),
+	"|":  intOperator("|"),
+	"^":  intOperator("^"),
+	"<<": intOperator("<<"),
+	">>": intOperator(">>"),
 }
 
 // Handler for the '+' operator
@@ -47,7 +69,7 @@ func add(left, right Value) Value {
 	if left.Type() == INTEGER_TYPE && right.Type() == INTEGER_TYPE {
 		lv := left.(*IntegerValue).Value
 		rv := right.(*IntegerValue).Value
-		return &IntegerValue{Value: lv + rv}
+		return checkedInt("+", lv, rv)
 	}
 	// Handle float addition
 	if left.Type() == FLOAT_TYPE && right.Type() == FLOAT_TYPE {
@@ -83,7 +105,7 @@ func subtract(left, right Value) Value {
 	if left.Type() == INTEGER_TYPE && right.Type() == INTEGER_TYPE {
 		lv := left.(*IntegerValue).Value
 		rv := right.(*IntegerValue).Value
-		return &IntegerValue{Value: lv - rv}
+		return checkedInt("-", lv, rv)
 	}
 	// Handle float subtraction
 	if left.Type() == FLOAT_TYPE && right.Type() == FLOAT_TYPE {
@@ -111,7 +133,7 @@ func multiply(left, right Value) Value {
 	if left.Type() == INTEGER_TYPE && right.Type() == INTEGER_TYPE {
 		lv := left.(*IntegerValue).Value
 		rv := right.(*IntegerValue).Value
-		return &IntegerValue{Value: lv * rv}
+		return checkedInt("*", lv, rv)
 	}
 	// Handle float multiplication
 	if left.Type() == FLOAT_TYPE && right.Type() == FLOAT_TYPE {
@@ -140,16 +162,16 @@ func divide(left, right Value) Value {
 		lv := left.(*IntegerValue).Value
 		rv := right.(*IntegerValue).Value
 		if rv == 0 {
-			return newError("division by zero")
+			return &Error{Message: "division by zero", Code: ErrDivisionByZero}
 		}
-		return &IntegerValue{Value: lv / rv}
+		return checkedInt("/", lv, rv)
 	}
 	// Handle float division
 	if left.Type() == FLOAT_TYPE && right.Type() == FLOAT_TYPE {
 		lv := left.(*FloatValue).Value
 		rv := right.(*FloatValue).Value
 		if rv == 0.0 {
-			return newError("division by zero")
+			return &Error{Message: "division by zero", Code: ErrDivisionByZero}
 		}
 		return &FloatValue{Value: lv / rv}
 	}
@@ -158,7 +180,7 @@ func divide(left, right Value) Value {
 		lv := left.(*FloatValue).Value
 		rv := float64(right.(*IntegerValue).Value)
 		if rv == 0.0 {
-			return newError("division by zero")
+			return &Error{Message: "division by zero", Code: ErrDivisionByZero}
 		}
 		return &FloatValue{Value: lv / rv}
 	}
@@ -166,7 +188,7 @@ func divide(left, right Value) Value {
 		lv := float64(left.(*IntegerValue).Value)
 		rv := right.(*FloatValue).Value
 		if rv == 0.0 {
-			return newError("division by zero")
+			return &Error{Message: "division by zero", Code: ErrDivisionByZero}
 		}
 		return &FloatValue{Value: lv / rv}
 	}
@@ -180,7 +202,7 @@ func modulo(left, right Value) Value {
 		lv := left.(*IntegerValue).Value
 		rv := right.(*IntegerValue).Value
 		if rv == 0 {
-			return newError("modulo by zero")
+			return &Error{Message: "modulo by zero", Code: ErrDivisionByZero}
 		}
 		return &IntegerValue{Value: lv % rv}
 	}
@@ -189,7 +211,7 @@ func modulo(left, right Value) Value {
 		lv := int64(left.(*FloatValue).Value)
 		rv := int64(right.(*FloatValue).Value)
 		if rv == 0 {
-			return newError("modulo by zero")
+			return &Error{Message: "modulo by zero", Code: ErrDivisionByZero}
 		}
 		return &IntegerValue{Value: lv % rv}
 	}
@@ -198,7 +220,7 @@ func modulo(left, right Value) Value {
 		lv := int64(left.(*FloatValue).Value)
 		rv := right.(*IntegerValue).Value
 		if rv == 0 {
-			return newError("modulo by zero")
+			return &Error{Message: "modulo by zero", Code: ErrDivisionByZero}
 		}
 		return &IntegerValue{Value: lv % rv}
 	}
@@ -206,7 +228,7 @@ func modulo(left, right Value) Value {
 		lv := left.(*IntegerValue).Value
 		rv := int64(right.(*FloatValue).Value)
 		if rv == 0 {
-			return newError("modulo by zero")
+			return &Error{Message: "modulo by zero", Code: ErrDivisionByZero}
 		}
 		return &IntegerValue{Value: lv % rv}
 	}
@@ -215,6 +237,11 @@ func modulo(left, right Value) Value {
 
 // Handler for the '==' operator
 func equal(left, right Value) Value {
+	if isBig(left) || isBig(right) {
+		l, lok := toBig(left)
+		r, rok := toBig(right)
+		return boolToValue(lok && rok && l.Cmp(r) == 0)
+	}
 	if left.Type() != right.Type() {
 		return FALSE
 	}
@@ -316,11 +343,20 @@ func (e *Evaluator) pushFrame(name string, pos ast.Position, context string) {
 		Location: pos,
 		Context:  context,
 	}
+	if e.module != nil {
+		frame.Module = e.module.Path
+	}
 	e.callStack = append(e.callStack, frame)
+	if e.profiler != nil && context == "call" {
+		e.profiler.enter(name)
+	}
 }
 
 func (e *Evaluator) popFrame() {
 	if len(e.callStack) > 0 {
+		if e.profiler != nil && e.callStack[len(e.callStack)-1].Context == "call" {
+			e.profiler.exit()
+		}
 		e.callStack = e.callStack[:len(e.callStack)-1]
 	}
 }
@@ -334,7 +370,7 @@ func (e *Evaluator) captureStackTrace() []StackFrame {
 
 // Update your newError function
 func (e *Evaluator) newError(pos ast.Position, code, format string, args ...interface{}) *RuntimeError {
-	return &RuntimeError{
+	err := &RuntimeError{
 		Detail: ErrorDetail{
 			Message:   fmt.Sprintf(format, args...),
 			Location:  pos,
@@ -342,6 +378,49 @@ func (e *Evaluator) newError(pos ast.Position, code, format string, args ...inte
 		},
 		StackTrace: e.captureStackTrace(),
 	}
+	if e.module != nil {
+		err.Detail.Module = e.module.Path
+	}
+	return err
+}
+
+// undefined reports a name no scope binds, suggesting a bound name or
+// keyword it may be a misspelling of
+func (e *Evaluator) undefined(pos ast.Position, code, name string) *RuntimeError {
+	err := e.newError(pos, code, "undefined variable '%s'", name)
+	err.Detail.Hint = errors.DidYouMean(name, append(e.env.Names(), lexer.ValueKeywords()...))
+	return err
+}
+
+// missingField reports a field sv doesn't have, suggesting one it may be
+// a misspelling of
+func (e *Evaluator) missingField(pos ast.Position, sv *StructValue, field string) *RuntimeError {
+	err := e.newError(pos, ErrRuntimeError, "field '%s' not found on %s", field, sv.TypeName)
+	var names []string
+	for name := range sv.fields() {
+		names = append(names, name)
+	}
+	err.Detail.Hint = errors.DidYouMean(field, names)
+	return err
+}
+
+// located converts an error with a code, as returned by a builtin, into a
+// RuntimeError at pos. Other values are returned unchanged.
+func (e *Evaluator) located(pos ast.Position, value Value) Value {
+	if err, ok := value.(*Error); ok && err.Code != "" {
+		return e.newError(pos, err.Code, "%s", err.Message)
+	}
+	return value
+}
+
+// assertionError converts a failed assert builtin into a RuntimeError at the call site
+func (e *Evaluator) assertionError(pos ast.Position, failure *AssertionFailure) *RuntimeError {
+	err := e.newError(pos, ErrAssertion, "%s", failure.Message)
+	if failure.Expected != nil {
+		err.Detail.Expected = inspectValue(failure.Expected)
+		err.Detail.Actual = inspectValue(failure.Actual)
+	}
+	return err
 }
 
 // Helper for type mismatch with hint
@@ -358,24 +437,35 @@ func (e *Evaluator) typeMismatchError(pos ast.Position, op string, left, right V
 }
 
 func New() *Evaluator {
-	evaluator := &Evaluator{env: NewEnvironment()}
+	evaluator := &Evaluator{builtins: NewEnvironment(), modules: make(map[string]*ModuleValue), sched: newScheduler()}
+	evaluator.env = NewEnclosedEnvironment(evaluator.builtins)
 
 	// Register builtin functions
 	for name, builtin := range BuiltinFunctions {
+		fn := builtin.Function
+		if builtin.Output != nil {
+			// Bind output builtins to this evaluator's writer
+			output := builtin.Output
+			fn = func(args []Value) Value { return output(evaluator.output(), args) }
+		}
+
 		// Create a FunctionValue for the builtin function
 		function := &FunctionValue{
 			Name:       name,
 			Parameters: []*ast.Parameter{}, // Builtins handle their own parameter validation
 			Body:       nil,                // Builtins don't have AST bodies
 			ReturnType: nil,                // Builtins can return different types
-			Env:        evaluator.env,
+			Env:        evaluator.builtins,
 			Position:   ast.Position{Line: 0, Column: 0},
 			IsBuiltin:  true,
-			BuiltinFn:  builtin.Function,
+			BuiltinFn:  fn,
 		}
 
 		// Store the builtin function in the environment
-		evaluator.env.Set(name, function, false)
+		evaluator.builtins.Set(name, function, false)
+	}
+	for _, name := range baseTypes {
+		evaluator.builtins.Set(name, &TypeValue{Name: name, Underlying: ast.NewBaseType(name), Alias: true}, false)
 	}
 
 	return evaluator
@@ -383,6 +473,9 @@ func New() *Evaluator {
 
 func (e *Evaluator) Eval(node ast.Node) Value {
 	//fmt.Printf("Evaluating: %T\n", node)
+	if e.coverage != nil || e.profiler != nil || e.tracer != nil {
+		e.instrument(node)
+	}
 	switch n := node.(type) {
 	case *ast.Program:
 		e.pushFrame("main", n.Position, "program")
@@ -390,6 +483,9 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 
 		var result Value
 		for _, decl := range n.Declarations {
+			if failure := e.halted(); failure != nil {
+				return failure
+			}
 			result = e.Eval(decl)
 			if isError(result) {
 				return result
@@ -399,6 +495,8 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 			}
 		}
 		return result
+	case *ast.ImportDecl:
+		return e.evalImportDecl(n)
 	case *ast.ExpressionStatement:
 		return e.Eval(n.Expression)
 	case *ast.Literal:
@@ -443,10 +541,19 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 			return right
 		}
 		if handler, ok := binaryOps[n.Operator]; ok {
-			result := handler(left, right)
+			var result Value
+			if left.Type() == NAMED_TYPE || right.Type() == NAMED_TYPE {
+				result = namedOperation(n, left, right, handler)
+			} else {
+				result = applyOperator(n.Operator, left, right, handler)
+			}
 			// Convert old errors to new format
 			if err, ok := result.(*Error); ok {
-				return e.newError(n.Position, ErrTypeMismatch, err.Message)
+				code := err.Code
+				if code == "" {
+					code = ErrTypeMismatch
+				}
+				return e.newError(n.Position, code, "%s", err.Message)
 			}
 			return result
 		}
@@ -461,16 +568,26 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 		return e.evalUnary(n.Operator, n.Position, right)
 	case *ast.VarDecl:
 		return e.EvalVariableDecl(n)
+	case *ast.ConstDecl:
+		return e.evalConstDecl(n)
+	case *ast.TypeDecl:
+		return e.evalTypeDecl(n)
 	case *ast.AssignmentStatement:
 		return e.EvalAssignment(n)
 	case *ast.IndexAssignmentStatement:
 		return e.EvalIndexAssignment(n)
+	case *ast.FieldAssignmentStatement:
+		return e.evalFieldAssignment(n)
 	case *ast.IfStatement:
 		return e.EvalConditional(n)
 	case *ast.ForStatement:
 		return e.EvalForStatement(n)
 	case *ast.WhileStatement:
 		return e.EvalWhileStatement(n)
+	case *ast.SpawnStatement:
+		return e.evalSpawnStatement(n)
+	case *ast.SelectStatement:
+		return e.evalSelectStatement(n)
 	case *ast.BlockStatement:
 		e.pushFrame("main", n.Position, "block")
 		defer e.popFrame()
@@ -499,9 +616,11 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 		return e.evalIndexExpression(n)
 	case *ast.SliceExpression:
 		return e.evalSliceExpression(n)
+	case *ast.ChanLiteral:
+		return e.evalChanLiteral(n)
 	case *ast.PrintStatement:
 		if n.Expression == nil {
-			fmt.Println("null")
+			fmt.Fprintln(e.output(), "null")
 			return NULL
 		}
 
@@ -512,7 +631,7 @@ func (e *Evaluator) Eval(node ast.Node) Value {
 		}
 
 		// Print the value
-		fmt.Println(formatValueForOutput(value))
+		fmt.Fprintln(e.output(), formatValueForOutput(value))
 		return NULL
 	case ast.Expression:
 		return e.Eval(n.(ast.Node))
@@ -534,16 +653,34 @@ func (e *Evaluator) evalReturnStatement(n *ast.ReturnStatement) Value {
 }
 
 func (e *Evaluator) evalUnary(operator string, position ast.Position, right Value) Value {
+	if named, ok := right.(*NamedValue); ok && (operator == "-" || operator == "^") {
+		result := e.evalUnary(operator, position, named.Value)
+		if isError(result) {
+			return result
+		}
+		return &NamedValue{TypeOf: named.TypeOf, Value: result}
+	}
 	switch operator {
 	case "!":
 		return boolToValue(!right.IsTruthy())
 	case "-":
 		if right.Type() == INTEGER_TYPE {
-			return &IntegerValue{Value: -right.(*IntegerValue).Value}
+			return e.located(position, negateInt(right.(*IntegerValue)))
 		}
 		if right.Type() == FLOAT_TYPE {
 			return &FloatValue{Value: -right.(*FloatValue).Value}
 		}
+		if b, ok := right.(*BigIntValue); ok {
+			return &BigIntValue{Value: new(big.Int).Neg(b.Value)}
+		}
+		return e.newError(position, ErrTypeMismatch, "unknown operator: %s%s", operator, right.Type())
+	case "^":
+		if i, ok := right.(*IntegerValue); ok {
+			return &IntegerValue{Value: intTypeOf(i).Wrap(^i.Value), Kind: i.Kind}
+		}
+		if b, ok := right.(*BigIntValue); ok {
+			return &BigIntValue{Value: new(big.Int).Not(b.Value)}
+		}
 		return e.newError(position, ErrTypeMismatch, "unknown operator: %s%s", operator, right.Type())
 	default:
 		return nil
@@ -566,6 +703,10 @@ func (e *Evaluator) evalLiteral(lit *ast.Literal) Value {
 		return FALSE
 	case float64:
 		return &FloatValue{Value: v}
+	case *big.Int:
+		return &BigIntValue{Value: v}
+	case nil:
+		return NULL
 	default:
 		return newError("unknown literal type: %T", lit.Value)
 	}
@@ -579,13 +720,21 @@ func (e *Evaluator) evalFunctionDecl(n *ast.FuncDecl) Value {
 	e.pushFrame(n.Name.Name, n.Position, n.Signature.String())
 	defer e.popFrame()
 
+	// Functions in imported modules are named after their module in
+	// stack traces, traces and profiles
+	name := n.Name.Name
+	if e.module != nil {
+		name = e.module.Name + "." + name
+	}
+
 	// Create a function value that encapsulates the function definition
 	function := &FunctionValue{
-		Name:       n.Name.Name,
+		Name:       name,
 		Parameters: n.Signature.Parameters,
 		Body:       n.Body,
 		ReturnType: n.Signature.ReturnType,
 		Env:        e.env, // Capture current environment for closures
+		Module:     e.module,
 		Position:   n.Position,
 	}
 
@@ -616,11 +765,23 @@ func (e *Evaluator) EvalVariableDecl(n *ast.VarDecl) Value {
 		// If type is specified, check compatibility
 		if n.Type != nil {
 			expectedType := n.Type.BaseType
+			if expectedType == "" {
+				expectedType = e.typeString(n.Type)
+			}
+			fitted, fitErr := fitInt(value, expectedType)
+			if fitErr != nil {
+				return e.located(n.Position, fitErr)
+			}
+			value = fitted
 			actualType := getValueType(value)
 			if !e.TypesCompatible(expectedType, actualType) {
 				return e.newError(n.Position, ErrTypeMismatch, "type mismatch: cannot assign %s to %s",
 					actualType, expectedType)
 			}
+			if arr, ok := value.(*ArrayValue); ok && n.Type.ArraySize != nil && arr.length() != *n.Type.ArraySize {
+				return e.newError(n.Position, ErrTypeMismatch, "array length mismatch: cannot assign %d elements to %s",
+					arr.length(), expectedType)
+			}
 		}
 	} else if n.Type != nil {
 		// Case 2: Only type, no value (x: int)
@@ -632,14 +793,53 @@ func (e *Evaluator) EvalVariableDecl(n *ast.VarDecl) Value {
 			"variable '%s' needs type or initial value", n.Name.Name)
 	}
 
-	// Store in environment
-	e.env.Set(n.Name.Name, value, n.Mutable)
+	// Store in environment; values declared as _ are discarded
+	if n.Name.Name == "_" {
+		return value
+	}
+	if n.Type != nil && n.Type.OptionalType != nil {
+		e.env.SetOptional(n.Name.Name, value, n.Mutable, e.typeString(n.Type))
+	} else {
+		e.env.Set(n.Name.Name, value, n.Mutable)
+	}
+	e.traceAssign(n.Position, n.Name.Name, value)
 
 	// Variable declarations typically return nil/void
 	// or the value for REPL convenience
 	return value
 }
 
+// evalConstDecl binds a constant to the value the analyzer folded for it.
+// Programs that weren't analyzed evaluate the value instead.
+func (e *Evaluator) evalConstDecl(n *ast.ConstDecl) Value {
+	var value Value
+	if n.Folded != nil {
+		value = e.evalLiteral(n.Folded)
+	} else {
+		value = e.Eval(n.Value)
+	}
+	if isError(value) {
+		return value
+	}
+	if n.Type != nil {
+		expectedType := e.typeString(n.Type)
+		fitted, fitErr := fitInt(value, expectedType)
+		if fitErr != nil {
+			return e.located(n.Position, fitErr)
+		}
+		value = fitted
+		actualType := getValueType(value)
+		if !e.TypesCompatible(expectedType, actualType) {
+			return e.newError(n.Position, ErrTypeMismatch, "type mismatch: cannot assign %s to %s",
+				actualType, expectedType)
+		}
+	}
+
+	e.env.Set(n.Name.Name, value, false)
+	e.traceAssign(n.Position, n.Name.Name, value)
+	return value
+}
+
 // For Assignment (x = 50)
 func (e *Evaluator) EvalAssignment(n *ast.AssignmentStatement) Value {
 	// Validate AST structure
@@ -660,7 +860,7 @@ func (e *Evaluator) EvalAssignment(n *ast.AssignmentStatement) Value {
 	// Check if variable exists (optional but good for clarity)
 	bind, exist := e.env.Get(n.Name.Name)
 	if !exist {
-		return e.newError(n.Position, ErrUndefined, "undefined variable '%s'", n.Name.Name)
+		return e.undefined(n.Position, ErrUndefined, n.Name.Name)
 	}
 
 	// Check if variable is mutable (if your environment supports this)
@@ -674,8 +874,15 @@ func (e *Evaluator) EvalAssignment(n *ast.AssignmentStatement) Value {
 			"cannot assign to immutable variable '%s'", n.Name.Name)
 	}
 
-	valueType := getValueType(value)
 	varType := getValueType(bind.Value)
+	if bind.Optional != "" {
+		varType = bind.Optional
+	}
+	value, fitErr := fitInt(value, varType)
+	if fitErr != nil {
+		return e.located(n.Position, fitErr)
+	}
+	valueType := getValueType(value)
 	if !e.TypesCompatible(varType, valueType) {
 		return e.newError(n.Position, ErrTypeMismatch,
 			"type mismatch: cannot assign %s to %s", valueType, varType)
@@ -686,6 +893,7 @@ func (e *Evaluator) EvalAssignment(n *ast.AssignmentStatement) Value {
 	if err != nil {
 		return e.newError(n.Position, ErrRuntimeError, "assignment failed: %s", err.Error())
 	}
+	e.traceAssign(n.Position, n.Name.Name, value)
 
 	return value
 }
@@ -711,11 +919,12 @@ func (e *Evaluator) EvalIndexAssignment(n *ast.IndexAssignmentStatement) Value {
 		return object
 	}
 
-	// Evaluate the index
+	// Evaluate the index; a distinct int type indexes like an int
 	index := e.Eval(n.Index)
 	if isError(index) {
 		return index
 	}
+	index = unwrapNamed(index)
 
 	// Evaluate the value to be assigned
 	value := e.Eval(n.Value)
@@ -733,20 +942,24 @@ func (e *Evaluator) EvalIndexAssignment(n *ast.IndexAssignmentStatement) Value {
 	// Handle array assignment
 	if object.Type() == ARRAY_TYPE {
 		array := object.(*ArrayValue)
-		if indexValue < 0 || indexValue >= int64(len(array.Elements)) {
+		old, ok := array.get(indexValue)
+		if !ok {
 			return e.newError(n.Position, ErrRuntimeError, "index out of bounds: %d", indexValue)
 		}
 
 		// Check type compatibility
-		elementType := getValueType(array.Elements[indexValue])
+		elementType := getValueType(old)
 		valueType := getValueType(value)
 		if elementType != valueType {
 			return e.newError(n.Position, ErrTypeMismatch,
 				"type mismatch: cannot assign %s to array element of type %s", valueType, elementType)
 		}
 
-		// Perform the assignment
-		array.Elements[indexValue] = value
+		// Perform the assignment; another task may have shrunk the array
+		if !array.set(indexValue, value) {
+			return e.newError(n.Position, ErrRuntimeError, "index out of bounds: %d", indexValue)
+		}
+		e.traceAssign(n.Position, fmt.Sprintf("%s[%d]", n.Object.String(), indexValue), value)
 		return value
 	}
 
@@ -758,23 +971,81 @@ func (e *Evaluator) EvalIndexAssignment(n *ast.IndexAssignmentStatement) Value {
 	return e.newError(n.Position, ErrTypeMismatch, "cannot assign to index of type %s", object.Type())
 }
 
+// evalFieldAssignment sets a field of a struct (p.x = 5). Struct values
+// are shared, so every variable holding the struct sees the change.
+func (e *Evaluator) evalFieldAssignment(n *ast.FieldAssignmentStatement) Value {
+	object := e.Eval(n.Object)
+	if isError(object) {
+		return object
+	}
+	value := e.Eval(n.Value)
+	if isError(value) {
+		return value
+	}
+
+	sv, ok := object.(*StructValue)
+	if !ok {
+		return e.newError(n.Position, ErrTypeMismatch, "cannot assign to field of type %s", object.Type())
+	}
+	old, ok := sv.field(n.Field.Name)
+	if !ok {
+		return e.missingField(n.Field.Position, sv, n.Field.Name)
+	}
+
+	// A field holding nil may be optional, so it takes any value
+	if old != NULL {
+		fieldType := getValueType(old)
+		fitted, fitErr := fitInt(value, fieldType)
+		if fitErr != nil {
+			return e.located(n.Position, fitErr)
+		}
+		value = fitted
+		if valueType := getValueType(value); value != NULL && !e.TypesCompatible(fieldType, valueType) {
+			return e.newError(n.Position, ErrTypeMismatch,
+				"type mismatch: cannot assign %s to field '%s' of type %s", valueType, n.Field.Name, fieldType)
+		}
+	}
+
+	sv.setField(n.Field.Name, value)
+	e.traceAssign(n.Position, n.Object.String()+"."+n.Field.Name, value)
+	return value
+}
+
 func (e *Evaluator) initializeToZero(t *ast.Type) Value {
+	// A fixed-size array starts with that many zero elements
+	if t.ArrayType != nil && t.ArraySize != nil {
+		elements := make([]Value, *t.ArraySize)
+		for i := range elements {
+			elements[i] = e.initializeToZero(t.ArrayType)
+		}
+		return &ArrayValue{Elements: elements}
+	}
+
 	v := t.BaseType
 	switch v {
-	case "STRING":
+	case "STRING", "string":
 		return &StringValue{Value: ""}
-	case "INTEGER":
+	case "INTEGER", "int":
 		return &IntegerValue{Value: 0}
-	case "FLOAT":
+	case "FLOAT", "float":
 		return &FloatValue{Value: 0.00}
-	case "BOOLEAN":
+	case "BOOLEAN", "bool":
 		return &BooleanValue{Value: false}
+	case "bigint":
+		return &BigIntValue{Value: new(big.Int)}
 	default:
+		if typ, ok := ast.LookupIntType(v); ok {
+			return &IntegerValue{Kind: typ.Name}
+		}
 		return NULL
 	}
 }
 
 func (e *Evaluator) TypesCompatible(expectedType string, actualType string) bool {
+	return typesCompatible(expectedType, actualType)
+}
+
+func typesCompatible(expectedType string, actualType string) bool {
 	// Handle case-insensitive type matching
 	expected := strings.ToLower(expectedType)
 	actual := strings.ToLower(actualType)
@@ -789,12 +1060,27 @@ func (e *Evaluator) TypesCompatible(expectedType string, actualType string) bool
 		return true
 	}
 
+	// An optional type holds nil or a value of the type it wraps
+	if strings.HasPrefix(expected, "?") {
+		return actual == "null" || typesCompatible(expected[1:], actual)
+	}
+
+	// Types of other modules are named mod.T in annotations
+	if _, name, ok := strings.Cut(expected, "."); ok && name == actual {
+		return true
+	}
+
 	// Handle array types
 	if strings.HasPrefix(expected, "[]") && strings.HasPrefix(actual, "[]") {
 		// Extract element types and compare them
 		expectedElement := strings.TrimPrefix(expected, "[]")
 		actualElement := strings.TrimPrefix(actual, "[]")
-		return e.TypesCompatible(expectedElement, actualElement)
+		return typesCompatible(expectedElement, actualElement)
+	}
+
+	// Handle channel types
+	if strings.HasPrefix(expected, "chan[") && strings.HasPrefix(actual, "chan[") {
+		return typesCompatible(expected[5:len(expected)-1], actual[5:len(actual)-1])
 	}
 
 	// Handle fixed array types
@@ -815,6 +1101,11 @@ func (e *Evaluator) TypesCompatible(expectedType string, actualType string) bool
 		return true
 	}
 
+	if (expected == "byte" && actual == "u8") ||
+		(expected == "u8" && actual == "byte") {
+		return true
+	}
+
 	if (expected == "bool" && actual == "boolean") ||
 		(expected == "boolean" && actual == "bool") {
 		return true
@@ -832,6 +1123,7 @@ func (e *Evaluator) EvalConditional(n *ast.IfStatement) Value {
 		return condition
 	}
 
+	e.recordBranch(n.Position, condition.IsTruthy())
 	if condition.IsTruthy() {
 		return e.Eval(n.Consequence)
 	} else if n.Alternative != nil {
@@ -864,6 +1156,7 @@ func (e *Evaluator) EvalForStatement(n *ast.ForStatement) Value {
 			if isError(cond) {
 				return cond
 			}
+			e.recordBranch(n.Position, cond.IsTruthy())
 			if !cond.IsTruthy() {
 				break
 			}
@@ -911,6 +1204,7 @@ func (e *Evaluator) EvalWhileStatement(n *ast.WhileStatement) Value {
 		if isError(cond) {
 			return cond
 		}
+		e.recordBranch(n.Position, cond.IsTruthy())
 		if !cond.IsTruthy() {
 			break
 		}
@@ -943,6 +1237,9 @@ func (e *Evaluator) evalBlock(n *ast.BlockStatement) Value {
 	var result Value = NULL
 
 	for _, stmt := range n.Statements {
+		if failure := e.halted(); failure != nil {
+			return failure
+		}
 		result = e.Eval(stmt)
 		if isError(result) {
 			return result
@@ -964,8 +1261,7 @@ func (e *Evaluator) EvalIdentifier(n *ast.Identifier) Value {
 	// Look up the variable in the environment
 	binding, exists := e.env.Get(n.Name)
 	if !exists {
-		return e.newError(n.Position, ErrUndefinedVar,
-			"undefined variable '%s'", n.Name)
+		return e.undefined(n.Position, ErrUndefinedVar, n.Name)
 	}
 
 	return binding.Value
@@ -1003,26 +1299,44 @@ func (e *Evaluator) evalFunctionCall(n *ast.FunctionCall) Value {
 		return results[0]
 	}
 
+	if typ, ok := function.(*TypeValue); ok {
+		return e.convert(n, typ, results)
+	}
 	isFunction, ok := function.(*FunctionValue)
 	if !ok {
 		return e.newError(n.Position, ErrNotAFunction,
 			"'%s' is not a function", function.Type())
 	}
+	return e.callFunction(n, isFunction, results)
+}
 
+// callFunction calls a builtin or user-defined function with evaluated arguments
+func (e *Evaluator) callFunction(n *ast.FunctionCall, isFunction *FunctionValue, results []Value) Value {
 	// Handle built-in functions
 	if isFunction.IsBuiltin {
 		e.pushFrame(isFunction.Name, n.Position, "builtin")
 		defer e.popFrame()
-		return isFunction.BuiltinFn(results)
+		result := isFunction.BuiltinFn(results)
+		if failure, ok := result.(*AssertionFailure); ok {
+			return e.assertionError(n.Position, failure)
+		}
+		return e.located(n.Position, result)
 	}
 
-	// Handle user-defined functions
+	if e.tracer != nil {
+		return e.tracedCall(n, isFunction, results)
+	}
+	return e.applyFunction(n, isFunction, results)
+}
+
+// applyFunction calls a user-defined function with evaluated arguments
+func (e *Evaluator) applyFunction(n *ast.FunctionCall, isFunction *FunctionValue, results []Value) Value {
 	e.pushFrame(isFunction.Name, n.Position, "call")
 	defer e.popFrame()
 
-	oldEnv := e.env
-	e.env = NewEnclosedEnvironment(isFunction.Env)
-	defer func() { e.env = oldEnv }()
+	oldEnv, oldModule := e.env, e.module
+	e.env, e.module = NewEnclosedEnvironment(isFunction.Env), isFunction.Module
+	defer func() { e.env, e.module = oldEnv, oldModule }()
 
 	if len(results) != len(isFunction.Parameters) {
 		return e.newError(n.Position, ErrWrongArgCount,
@@ -1031,8 +1345,11 @@ func (e *Evaluator) evalFunctionCall(n *ast.FunctionCall) Value {
 	}
 
 	for paramIdx, param := range isFunction.Parameters {
-		argValue := results[paramIdx]
-		paramType := getTypeString(param.Type)
+		paramType := e.typeString(param.Type)
+		argValue, fitErr := fitInt(results[paramIdx], paramType)
+		if fitErr != nil {
+			return e.located(n.Position, fitErr)
+		}
 		argType := getValueType(argValue)
 
 		if !e.TypesCompatible(paramType, argType) {
@@ -1041,14 +1358,23 @@ func (e *Evaluator) evalFunctionCall(n *ast.FunctionCall) Value {
 				strings.ToLower(argType), strings.ToLower(paramType))
 		}
 
-		e.env.Set(param.Name.Name, argValue, false)
+		if param.Name.Name != "_" {
+			e.env.Set(param.Name.Name, argValue, param.Mutable)
+		}
 	}
 	execution := e.Eval(isFunction.Body)
 	if isError(execution) {
 		return execution
 	}
 	if returnValue, ok := execution.(*ReturnValue); ok {
-		return returnValue.Value
+		if isFunction.ReturnType == nil {
+			return returnValue.Value
+		}
+		fitted, fitErr := fitInt(returnValue.Value, e.typeString(isFunction.ReturnType))
+		if fitErr != nil {
+			return e.located(n.Position, fitErr)
+		}
+		return fitted
 	}
 
 	// If no explicit return, return NULL
@@ -1073,6 +1399,20 @@ func (e *Evaluator) evalStructLiteral(n *ast.StructLiteral) Value {
 	if n.Type == nil {
 		return e.newError(n.Position, ErrRuntimeError, "struct literal missing type")
 	}
+	if n.Module != nil {
+		obj := e.Eval(n.Module)
+		if isError(obj) {
+			return obj
+		}
+		module, ok := obj.(*ModuleValue)
+		if !ok {
+			return e.newError(n.Module.Position, ErrUndefined, "'%s' is not an imported module", n.Module.Name)
+		}
+		if !module.Public[n.Type.Name] {
+			return e.newError(n.Type.Position, ErrUndefined,
+				"'%s' is not public in module '%s'", n.Type.Name, module.Name)
+		}
+	}
 
 	fields := make(map[string]Value)
 	for _, f := range n.Fields {
@@ -1094,12 +1434,24 @@ func (e *Evaluator) evalMemberExpression(n *ast.MemberExpression) Value {
 	if isError(obj) {
 		return obj
 	}
+	if module, ok := obj.(*ModuleValue); ok {
+		binding, exists := module.Env.GetLocal(n.Property.Name)
+		if !exists {
+			return e.newError(n.Property.Position, ErrUndefined,
+				"module '%s' has no member '%s'", module.Name, n.Property.Name)
+		}
+		if !module.Public[n.Property.Name] {
+			return e.newError(n.Property.Position, ErrUndefined,
+				"'%s' is not public in module '%s'", n.Property.Name, module.Name)
+		}
+		return binding.Value
+	}
 	if obj.Type() == STRUCT_TYPE {
 		sv := obj.(*StructValue)
-		if val, ok := sv.Fields[n.Property.Name]; ok {
+		if val, ok := sv.field(n.Property.Name); ok {
 			return val
 		}
-		return e.newError(n.Position, ErrRuntimeError, "field '%s' not found on %s", n.Property.Name, sv.TypeName)
+		return e.missingField(n.Position, sv, n.Property.Name)
 	}
 	return e.newError(n.Position, ErrRuntimeError, "cannot access member on type %s", obj.Type())
 }
@@ -1107,18 +1459,22 @@ func (e *Evaluator) evalMemberExpression(n *ast.MemberExpression) Value {
 func getValueType(v Value) string {
 	switch v.Type() {
 	case INTEGER_TYPE:
+		if kind := v.(*IntegerValue).Kind; kind != "" {
+			return kind
+		}
 		return "INTEGER"
 	case FLOAT_TYPE:
 		return "FLOAT"
+	case BIGINT_TYPE:
+		return "BIGINT"
 	case STRING_TYPE:
 		return "STRING"
 	case BOOLEAN_TYPE:
 		return "BOOLEAN"
 	case ARRAY_TYPE:
 		// For arrays, we need to determine the element type
-		array := v.(*ArrayValue)
-		if len(array.Elements) > 0 {
-			elementType := getValueType(array.Elements[0])
+		if first, ok := v.(*ArrayValue).get(0); ok {
+			elementType := getValueType(first)
 			// Convert to lowercase to match our type system
 			switch elementType {
 			case "INTEGER":
@@ -1129,11 +1485,22 @@ func getValueType(v Value) string {
 				return "[]string"
 			case "BOOLEAN":
 				return "[]bool"
+			case "BIGINT":
+				return "[]bigint"
 			default:
+				if ast.IsIntTypeName(elementType) {
+					return "[]" + elementType
+				}
 				return "[]unknown"
 			}
 		}
 		return "[]unknown"
+	case CHAN_TYPE:
+		return v.String()
+	case STRUCT_TYPE:
+		return v.(*StructValue).TypeName
+	case NAMED_TYPE:
+		return v.(*NamedValue).TypeOf.Name
 	default:
 		return v.Type()
 	}
@@ -1155,6 +1522,12 @@ func getTypeString(t *ast.Type) string {
 	if t.PointerType != nil {
 		return fmt.Sprintf("*%s", getTypeString(t.PointerType))
 	}
+	if t.OptionalType != nil {
+		return fmt.Sprintf("?%s", getTypeString(t.OptionalType))
+	}
+	if t.ChanType != nil {
+		return fmt.Sprintf("chan[%s]", getTypeString(t.ChanType))
+	}
 	if t.StructName != "" {
 		return t.StructName
 	}
@@ -1179,11 +1552,12 @@ func (e *Evaluator) evalIndexExpression(n *ast.IndexExpression) Value {
 		return object
 	}
 
-	// Evaluate the index
+	// Evaluate the index; a distinct int type indexes like an int
 	index := e.Eval(n.Index)
 	if isError(index) {
 		return index
 	}
+	index = unwrapNamed(index)
 
 	// Check if index is an integer
 	if index.Type() != INTEGER_TYPE {
@@ -1194,11 +1568,11 @@ func (e *Evaluator) evalIndexExpression(n *ast.IndexExpression) Value {
 
 	// Handle array indexing
 	if object.Type() == ARRAY_TYPE {
-		array := object.(*ArrayValue)
-		if indexValue < 0 || indexValue >= int64(len(array.Elements)) {
+		element, ok := object.(*ArrayValue).get(indexValue)
+		if !ok {
 			return e.newError(n.Position, ErrRuntimeError, "index out of bounds: %d", indexValue)
 		}
-		return array.Elements[indexValue]
+		return element
 	}
 
 	// Handle string indexing
@@ -1286,8 +1660,8 @@ func (e *Evaluator) evalSliceExpression(n *ast.SliceExpression) Value {
 
 	// Handle array slicing
 	if object.Type() == ARRAY_TYPE {
-		array := object.(*ArrayValue)
-		arrayLen := int64(len(array.Elements))
+		elements := object.(*ArrayValue).elements()
+		arrayLen := int64(len(elements))
 
 		// Handle negative indices (Python-style)
 		if startIndex < 0 {
@@ -1321,7 +1695,7 @@ func (e *Evaluator) evalSliceExpression(n *ast.SliceExpression) Value {
 		// Create new array with sliced elements
 		slicedElements := make([]Value, 0, endIndex-startIndex)
 		for i := startIndex; i < endIndex; i++ {
-			slicedElements = append(slicedElements, array.Elements[i])
+			slicedElements = append(slicedElements, elements[i])
 		}
 		return &ArrayValue{Elements: slicedElements}
 	}
@@ -1334,7 +1708,7 @@ func formatValueForOutput(value Value) string {
 	case *StringValue:
 		return v.Value // Don't add quotes for log output
 	case *IntegerValue:
-		return fmt.Sprintf("%d", v.Value)
+		return v.String()
 	case *FloatValue:
 		return fmt.Sprintf("%g", v.Value)
 	case *BooleanValue:
@@ -1352,6 +1726,68 @@ func formatValueForOutput(value Value) string {
 	}
 }
 
+// SetOutput redirects print statements and output builtins to w
+func (e *Evaluator) SetOutput(w io.Writer) {
+	e.out = w
+}
+
+// SetCoverage records executed statements and branches into c
+func (e *Evaluator) SetCoverage(c *Coverage) {
+	e.coverage = c
+}
+
+// SetProfiler measures time and calls per function and line into p
+func (e *Evaluator) SetProfiler(p *Profiler) {
+	e.profiler = p
+}
+
+// instrument reports a statement that is about to run to the coverage
+// recorder, profiler and tracer
+func (e *Evaluator) instrument(node ast.Node) {
+	if !isCoverable(node) {
+		return
+	}
+	if e.coverage != nil {
+		e.coverage.hitStatement(e.modulePath(), node.Pos())
+	}
+	if e.profiler != nil {
+		e.profiler.line(node.Pos().Line)
+	}
+	if e.tracer != nil {
+		e.trace(TraceEvent{Kind: TraceStatement, Position: node.Pos()})
+	}
+}
+
+// modulePath returns the import path of the module whose code is running,
+// or "" for the entry program
+func (e *Evaluator) modulePath() string {
+	if e.module != nil {
+		return e.module.Path
+	}
+	return ""
+}
+
+// recordBranch records which way a condition went, and moves the profiler
+// back to the condition's line so loop bookkeeping is charged there
+func (e *Evaluator) recordBranch(pos ast.Position, taken bool) {
+	if e.coverage != nil {
+		e.coverage.hitBranch(e.modulePath(), pos, taken)
+	}
+	if e.profiler != nil {
+		e.profiler.line(pos.Line)
+	}
+}
+
+// output returns the writer for program output
+func (e *Evaluator) output() io.Writer {
+	out := e.out
+	if out == nil {
+		out = os.Stdout
+	}
+	// Tasks write to the same output, one write at a time
+	return &lockedWriter{mu: &e.sched.output, w: out}
+}
+
 // GetEnvironment returns the current environment
 func (e *Evaluator) GetEnvironment() *Environment {
 	return e.env
@@ -2,11 +2,16 @@ package evaluator
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"mars/ast"
+	"mars/errors"
+	"mars/lexer"
+	"mars/parser"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestIntegerValue_Type(t *testing.T) {
@@ -937,7 +942,7 @@ func TestErrorMessages(t *testing.T) {
 				Position: ast.Position{Line: 1, Column: 1},
 			},
 			expectedError: "type mismatch: cannot add INTEGER and BOOLEAN",
-			expectedCode:  "E001",
+			expectedCode:  "E1001",
 			hasStackTrace: true,
 		},
 		{
@@ -964,7 +969,7 @@ func TestErrorMessages(t *testing.T) {
 				Position: ast.Position{Line: 1, Column: 1},
 			},
 			expectedError: "division by zero",
-			expectedCode:  "E001", // using 001 for now because I havn't implemented the other error codes
+			expectedCode:  "E1003",
 			hasStackTrace: true,
 		},
 	}
@@ -3711,3 +3716,930 @@ func TestPrintStatement(t *testing.T) {
 		})
 	}
 }
+
+func TestCoverage(t *testing.T) {
+	input := `func sign(n: int) -> int {
+    if n < 0 {
+        return -1;
+    }
+    return 1;
+}
+func count() {
+    mut i := 0;
+    while i < 2 {
+        i = i + 1;
+    }
+}
+x := sign(5);
+count();
+`
+	program := parser.NewParser(lexer.New(input)).ParseProgram()
+
+	coverage := NewCoverage()
+	coverage.Register(program)
+	eval := New()
+	eval.SetCoverage(coverage)
+	if result := eval.Eval(program); isError(result) {
+		t.Fatalf("unexpected error: %s", result)
+	}
+
+	counts := make(map[int]int)
+	for _, stmt := range coverage.Statements() {
+		counts[stmt.Pos.Line] += stmt.Count
+	}
+	expected := map[int]int{2: 1, 3: 0, 5: 1, 8: 1, 9: 1, 10: 2, 13: 1, 14: 1}
+	if len(counts) != len(expected) {
+		t.Errorf("expected statements on lines %v, got %v", expected, counts)
+	}
+	for line, count := range expected {
+		if counts[line] != count {
+			t.Errorf("line %d: expected %d hits, got %d", line, count, counts[line])
+		}
+	}
+
+	branches := coverage.Branches()
+	if len(branches) != 2 {
+		t.Fatalf("expected 2 branch points, got %d", len(branches))
+	}
+	if branches[0].Pos.Line != 2 || branches[0].True != 0 || branches[0].False != 1 {
+		t.Errorf("unexpected if branch counts: %+v", branches[0])
+	}
+	if branches[1].Pos.Line != 9 || branches[1].True != 2 || branches[1].False != 1 {
+		t.Errorf("unexpected while branch counts: %+v", branches[1])
+	}
+}
+
+func TestCoverageIgnoresModules(t *testing.T) {
+	// The module's statements share positions with the program's, but only
+	// the program's are counted
+	lib := parser.NewParser(lexer.New(`pub func double(n: int) -> int {
+    if n > 100 {
+        return 0;
+    }
+    return n * 2;
+}`)).ParseProgram()
+	program := parser.NewParser(lexer.New(`import "lib";
+func twice(n: int) -> int {
+    return lib.double(n);
+}
+x := twice(2);`)).ParseProgram()
+
+	coverage := NewCoverage()
+	coverage.Register(program)
+	eval := New()
+	eval.SetCoverage(coverage)
+	if result := eval.LoadModule("lib", lib); isError(result) {
+		t.Fatalf("unexpected error loading module: %s", result)
+	}
+	if result := eval.Eval(program); isError(result) {
+		t.Fatalf("unexpected error: %s", result)
+	}
+
+	var got []string
+	for _, stmt := range coverage.Statements() {
+		got = append(got, fmt.Sprintf("%d.%d=%d", stmt.Pos.Line, stmt.Pos.Column, stmt.Count))
+	}
+	if want := "3.5=1 5.1=1"; strings.Join(got, " ") != want {
+		t.Errorf("expected statement counts %s, got %s", want, strings.Join(got, " "))
+	}
+	if branches := coverage.Branches(); len(branches) != 0 {
+		t.Errorf("expected no branch points, got %+v", branches)
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	input := `func inner() -> int {
+    return 1;
+}
+func outer() -> int {
+    a := inner();
+    b := inner();
+    return a + b;
+}
+x := outer();
+`
+	program := parser.NewParser(lexer.New(input)).ParseProgram()
+
+	// Each clock reading advances time by one millisecond
+	clock := time.Unix(0, 0)
+	profiler := newProfilerWithClock(func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	})
+	eval := New()
+	eval.SetProfiler(profiler)
+	if result := eval.Eval(program); isError(result) {
+		t.Fatalf("unexpected error: %s", result)
+	}
+	profiler.Stop()
+
+	calls := make(map[string]int64)
+	var total time.Duration
+	for _, sample := range profiler.Samples() {
+		if sample.Stack[0].Function != ProfileRoot {
+			t.Errorf("sample does not start at the root: %+v", sample.Stack)
+		}
+		calls[sample.Stack[len(sample.Stack)-1].Function] += sample.Calls
+		total += sample.Time
+	}
+
+	if calls["outer"] != 1 || calls["inner"] != 2 {
+		t.Errorf("expected outer called once and inner twice, got %v", calls)
+	}
+	if total != clock.Sub(time.Unix(0, 0))-time.Millisecond {
+		t.Errorf("expected all time between start and stop to be charged, got %v", total)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	input := `func double(n: int) -> int {
+    return n * 2;
+}
+mut xs := [1, 2];
+xs[0] = double(5);
+`
+	program := parser.NewParser(lexer.New(input)).ParseProgram()
+
+	var events []string
+	eval := New()
+	eval.SetTracer(func(ev TraceEvent) {
+		desc := fmt.Sprintf("%d %s %d", ev.Depth, ev.Kind, ev.Position.Line)
+		if ev.Name != "" {
+			desc += " " + ev.Name
+		}
+		if len(ev.Args) > 0 {
+			desc += "(" + strings.Join(ev.Args, ", ") + ")"
+		}
+		if ev.Value != "" {
+			desc += " = " + ev.Value
+		}
+		events = append(events, desc)
+	})
+	if result := eval.Eval(program); isError(result) {
+		t.Fatalf("unexpected error: %s", result)
+	}
+
+	expected := []string{
+		"0 statement 4",
+		"0 assign 4 xs = [1, 2]",
+		"0 statement 5",
+		"0 call 5 double(5)",
+		"1 statement 2",
+		"0 return 5 double = 10",
+		"0 assign 5 xs[0] = 10",
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected trace:\n%s\nwant:\n%s", strings.Join(events, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestModules(t *testing.T) {
+	parse := func(input string) *ast.Program {
+		p := parser.NewParser(lexer.New(input))
+		program := p.ParseProgram()
+		if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+			t.Fatalf("parse errors: %s", errs.Error())
+		}
+		return program
+	}
+
+	eval := New()
+	counter := parse(`pub mut count := 0;
+pub func next() -> int {
+    count = count + 1;
+    return count;
+}
+pub func fail() -> int {
+    return 1 / 0;
+}
+func secret() -> int { return 42; }
+struct Hidden { n: int; }
+pub struct Shown { n: int; }`)
+	if result := eval.LoadModule("lib/counter", counter); isError(result) {
+		t.Fatalf("unexpected error loading module: %s", result)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Module state persists across calls, and isn't visible unqualified
+		{`import "lib/counter"; counter.next(); counter.next();`, "2"},
+		{`import "lib/counter"; counter.count;`, "2"},
+		{`import "lib/counter"; count;`, "undefined variable 'count'"},
+		// Only the module's own declarations are members, not builtins
+		{`import "lib/counter"; counter.len;`, "module 'counter' has no member 'len'"},
+		{`import "lib/other";`, "module 'lib/other' is not loaded"},
+		// Only 'pub' declarations can be reached from outside the module
+		{`import "lib/counter"; counter.secret();`, "'secret' is not public in module 'counter'"},
+		{`import "lib/counter"; counter.Hidden{n: 1};`, "'Hidden' is not public in module 'counter'"},
+		{`import "lib/counter"; counter.Shown{n: 3}.n;`, "3"},
+	}
+	for _, tt := range tests {
+		result := eval.Eval(parse(tt.input))
+		if result == nil {
+			t.Fatalf("%s: nil result", tt.input)
+		}
+		got := result.String()
+		if rtErr, ok := result.(*RuntimeError); ok {
+			got = rtErr.Detail.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%s: got %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+
+	// Errors inside a module's functions name the module, and the
+	// function is qualified by it in the stack trace
+	result := eval.Eval(parse(`import "lib/counter"; counter.fail();`))
+	rtErr, ok := result.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected a runtime error, got %T (%v)", result, result)
+	}
+	if rtErr.Detail.Module != "lib/counter" || rtErr.Detail.Location.Line != 7 {
+		t.Errorf("expected error at lib/counter:7, got %s:%d", rtErr.Detail.Module, rtErr.Detail.Location.Line)
+	}
+	var calls []string
+	for _, frame := range rtErr.StackTrace {
+		if frame.Context == "call" {
+			calls = append(calls, frame.Function)
+		}
+	}
+	if strings.Join(calls, " ") != "counter.fail" {
+		t.Errorf("expected call frames [counter.fail], got %v", calls)
+	}
+
+	// As a diagnostic, the error is in the module's file and the call is a
+	// related location in the program that made it
+	files := map[string]string{"": "main.mars", "lib/counter": "lib/counter.mars"}
+	d := rtErr.Diagnostic(func(path string) string { return files[path] })
+	if d.File != "lib/counter.mars" || d.Start.Line != 7 || d.Code != ErrDivisionByZero {
+		t.Errorf("unexpected diagnostic %+v", d)
+	}
+	if len(d.Related) != 1 || d.Related[0].File != "main.mars" || d.Related[0].Message != "counter.fail called here" {
+		t.Errorf("expected the call in main.mars as the related location, got %+v", d.Related)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string // printed output, or the error message
+		code     string // expected error code
+	}{
+		{
+			name: "unbuffered channel",
+			input: `func square(n: int, out: chan[int]) { send(out, n * n); }
+c := chan[int]();
+spawn square(7, c);
+log(recv(c));`,
+			expected: "49\n",
+		},
+		{
+			name: "workers drain a closed buffered channel",
+			input: `func worker(jobs: chan[int], done: chan[int]) {
+    mut sum := 0;
+    for {
+        j := recv(jobs);
+        if j == nil { break; }
+        sum = sum + j;
+    }
+    send(done, sum);
+}
+jobs := chan[int](8);
+done := chan[int]();
+spawn worker(jobs, done);
+spawn worker(jobs, done);
+for mut i := 1; i <= 8; i = i + 1 { send(jobs, i); }
+close(jobs);
+log(recv(done) + recv(done));`,
+			expected: "36\n",
+		},
+		{
+			name: "select runs the first ready case",
+			input: `a := chan[string](1);
+b := chan[string](1);
+send(b, "from b");
+select {
+case v := recv(a) { log(v); }
+case v := recv(b) { log(v); }
+}
+select {
+case recv(a) { log("a"); }
+default { log("nothing ready"); }
+}
+select {
+case send(a, "x") { log("sent"); }
+}
+log(recv(a));`,
+			expected: "from b\nnothing ready\nsent\nx\n",
+		},
+		{
+			name: "select waits for a task",
+			input: `func produce(c: chan[int]) { send(c, 5); }
+c := chan[int]();
+spawn produce(c);
+select {
+case n := recv(c) { log(n + 1); }
+}`,
+			expected: "6\n",
+		},
+		{
+			name:     "deadlock",
+			input:    "c := chan[int]();\nrecv(c);",
+			expected: "deadlock: all tasks are blocked on channels",
+			code:     ErrDeadlock,
+		},
+		{
+			name: "deadlock after a task finishes",
+			input: `func nothing(c: chan[int]) { }
+c := chan[int]();
+spawn nothing(c);
+recv(c);`,
+			expected: "deadlock: all tasks are blocked on channels",
+			code:     ErrDeadlock,
+		},
+		{
+			name:     "send on closed channel",
+			input:    "c := chan[int](1);\nclose(c);\nsend(c, 1);",
+			expected: "send on closed channel",
+			code:     ErrRuntimeError,
+		},
+		{
+			name:     "close of closed channel",
+			input:    "c := chan[int]();\nclose(c);\nclose(c);",
+			expected: "close of closed channel",
+			code:     ErrRuntimeError,
+		},
+		{
+			name: "a failing task halts the program",
+			input: `func fail(c: chan[int]) { x := 1 / 0; send(c, x); }
+c := chan[int]();
+spawn fail(c);
+recv(c);`,
+			expected: "division by zero",
+			code:     ErrDivisionByZero,
+		},
+		{
+			name:     "spawn needs a function",
+			input:    "x := 1;\nspawn x();",
+			expected: "'INTEGER' is not a function",
+			code:     ErrNotAFunction,
+		},
+		{
+			name:     "negative capacity",
+			input:    "c := chan[int](-1);",
+			expected: "channel capacity must not be negative, got -1",
+			code:     ErrRuntimeError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.NewParser(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+				t.Fatalf("parse errors: %s", errs.Error())
+			}
+
+			var buf bytes.Buffer
+			eval := New()
+			eval.SetOutput(&buf)
+			result := eval.Eval(program)
+			eval.Stop()
+
+			if tt.code == "" {
+				if isError(result) {
+					t.Fatalf("unexpected error: %s", result)
+				}
+				if buf.String() != tt.expected {
+					t.Errorf("got output %q, want %q", buf.String(), tt.expected)
+				}
+				return
+			}
+			rtErr, ok := result.(*RuntimeError)
+			if !ok {
+				t.Fatalf("expected a runtime error, got %T (%v)", result, result)
+			}
+			if rtErr.Detail.ErrorCode != tt.code || rtErr.Detail.Message != tt.expected {
+				t.Errorf("got error[%s] %q, want error[%s] %q",
+					rtErr.Detail.ErrorCode, rtErr.Detail.Message, tt.code, tt.expected)
+			}
+		})
+	}
+}
+
+// TestSharedValuesAcrossTasks has two tasks write the same array and
+// struct while the main task reads them. Run it with -race.
+func TestSharedValuesAcrossTasks(t *testing.T) {
+	input := `struct Tally { hits: int; last: int; }
+func writer(id: int, xs: []int, tally: Tally, done: chan[int]) {
+    for mut i := 0; i < 200; i = i + 1 {
+        xs[i % 4] = id;
+        push(xs, id);
+        pop(xs);
+        tally.last = id;
+        tally.hits = tally.hits + 0;
+    }
+    send(done, id);
+}
+xs := [0, 0, 0, 0];
+tally := Tally{hits: 0, last: 0};
+done := chan[int]();
+spawn writer(1, xs, tally, done);
+spawn writer(2, xs, tally, done);
+mut seen := 0;
+for mut i := 0; i < 200; i = i + 1 {
+    if xs[i % 4] != 0 && tally.last != 0 { seen = seen + 1; }
+    s := join(xs, ",");
+}
+recv(done);
+recv(done);
+log(len(xs));
+log(xs[0] == 1 || xs[0] == 2);
+log(tally.last == 1 || tally.last == 2);`
+	program := parser.NewParser(lexer.New(input)).ParseProgram()
+
+	var buf bytes.Buffer
+	eval := New()
+	eval.SetOutput(&buf)
+	if result := eval.Eval(program); isError(result) {
+		t.Fatalf("unexpected error: %s", result)
+	}
+	eval.Stop()
+	if got := buf.String(); got != "4\ntrue\ntrue\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestStopHaltsTasks(t *testing.T) {
+	input := `func spin(c: chan[int]) {
+    mut i := 0;
+    while true { i = i + 1; }
+}
+func wait(c: chan[int]) { recv(c); }
+c := chan[int]();
+spawn spin(c);
+spawn wait(c);`
+	program := parser.NewParser(lexer.New(input)).ParseProgram()
+
+	eval := New()
+	if result := eval.Eval(program); isError(result) {
+		t.Fatalf("unexpected error: %s", result)
+	}
+	// Stop returns only once both the busy and the blocked task have halted
+	eval.Stop()
+}
+
+func TestConstants(t *testing.T) {
+	run := func(input string, fold func(*ast.Program)) (string, Value) {
+		t.Helper()
+		p := parser.NewParser(lexer.New(input))
+		program := p.ParseProgram()
+		if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+			t.Fatalf("parse errors: %s", errs.Error())
+		}
+		if fold != nil {
+			fold(program)
+		}
+		var buf bytes.Buffer
+		eval := New()
+		eval.SetOutput(&buf)
+		result := eval.Eval(program)
+		return buf.String(), result
+	}
+
+	// Without the analyzer, constants are evaluated like variables
+	out, result := run("const N = 6 * 7;\nconst LABEL: string = \"n=\";\nlog(LABEL);\nlog(N);", nil)
+	if isError(result) || out != "n=\n42\n" {
+		t.Errorf("got %q (%v), want %q", out, result, "n=\n42\n")
+	}
+
+	// A folded value is used instead of evaluating the initializer again
+	out, result = run("const N = 1 + 1;\nlog(N);", func(program *ast.Program) {
+		program.Declarations[0].(*ast.ConstDecl).Folded = &ast.Literal{Token: "3", Value: 3}
+	})
+	if isError(result) || out != "3\n" {
+		t.Errorf("got %q (%v), want the folded value", out, result)
+	}
+
+	// Array sizes resolved from constants, as the analyzer leaves them
+	out, result = run("const N = 3;\ngrid: [N]int = [1, 2, 3];\nlog(grid);", func(program *ast.Program) {
+		size := 3
+		program.Declarations[1].(*ast.VarDecl).Type.ArraySize = &size
+	})
+	if isError(result) || out != "[1, 2, 3]\n" {
+		t.Errorf("got %q (%v), want %q", out, result, "[1, 2, 3]\n")
+	}
+
+	// A sized array declared without a value starts with N zeros
+	out, result = run("const N = 3;\nmut dp: [N]int;\ndp[1] = 5;\ngrid: [2][2]string;\nlog(dp);\nlog(len(grid[1]));", func(program *ast.Program) {
+		size, rows := 3, 2
+		program.Declarations[1].(*ast.VarDecl).Type.ArraySize = &size
+		program.Declarations[3].(*ast.VarDecl).Type.ArraySize = &rows
+	})
+	if isError(result) || out != "[0, 5, 0]\n2\n" {
+		t.Errorf("got %q (%v), want %q", out, result, "[0, 5, 0]\n2\n")
+	}
+
+	// and can only be initialized with exactly N elements
+	_, result = run("func make() -> []int { return [0]; }\nxs: [21]int = make();", nil)
+	if rtErr, ok := result.(*RuntimeError); !ok || rtErr.Detail.ErrorCode != ErrTypeMismatch ||
+		rtErr.Detail.Message != "array length mismatch: cannot assign 1 elements to [21]int" {
+		t.Errorf("expected an array length mismatch, got %v", result)
+	}
+
+	_, result = run("const N = 1;\nN = 2;", nil)
+	rtErr, ok := result.(*RuntimeError)
+	if !ok || !strings.Contains(rtErr.Detail.Message, "cannot assign to immutable variable 'N'") {
+		t.Errorf("expected assigning a constant to fail, got %v", result)
+	}
+
+	_, result = run("const N: int = \"six\";", nil)
+	if rtErr, ok := result.(*RuntimeError); !ok || rtErr.Detail.ErrorCode != ErrTypeMismatch {
+		t.Errorf("expected a type mismatch, got %v", result)
+	}
+}
+
+func TestNamedTypes(t *testing.T) {
+	run := func(input string) (string, Value) {
+		t.Helper()
+		p := parser.NewParser(lexer.New(input))
+		program := p.ParseProgram()
+		if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+			t.Fatalf("parse errors: %s", errs.Error())
+		}
+		var buf bytes.Buffer
+		eval := New()
+		eval.SetOutput(&buf)
+		result := eval.Eval(program)
+		return buf.String(), result
+	}
+	decls := "type UserId = int;\ntype Meters int;\ntype Feet int;\n"
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"id: UserId = 5;\nlog(id + 1);", "6\n"},
+		{"d := Meters(5) + Meters(1);\nlog(d);", "6\n"},
+		{"func double(m: Meters) -> Meters { return m * 2; }\nlog(double(Meters(4)));", "8\n"},
+		{"d := Meters(7);\nn: int = int(d);\nlog(n + 1);", "8\n"},
+		{"log(-Meters(2));\nlog(Meters(3) > Meters(2));", "-2\ntrue\n"},
+		{"xs := [10, 20];\nlog(xs[Meters(1)]);", "20\n"},
+		{"log(int(2.7));\nlog(float(2) / float(4));", "2\n0.5\n"},
+		{"struct P { x: int; }\nfunc f(p: P) -> int { return p.x; }\np: P = P{x: 3};\nlog(f(p));", "3\n"},
+	}
+	for _, tt := range tests {
+		out, result := run(decls + tt.input)
+		if isError(result) || out != tt.expected {
+			t.Errorf("%s: got %q (%v), want %q", tt.input, out, result, tt.expected)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		contains string
+	}{
+		{"d: Meters = 5;", "cannot assign INTEGER to Meters"},
+		{"n: int = Meters(1);", "cannot assign Meters to int"},
+		{"x := Meters(1) + Feet(2);", "mismatched types: Meters + Feet"},
+		{"x := Meters(\"far\");", "cannot convert string to Meters"},
+		{"x := Meters(1, 2);", "conversion to Meters takes one value, got 2"},
+	}
+	for _, tt := range errorTests {
+		_, result := run(decls + tt.input)
+		rtErr, ok := result.(*RuntimeError)
+		if !ok || !strings.Contains(rtErr.Detail.Message, tt.contains) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.input, tt.contains, result)
+		}
+	}
+}
+
+func TestSizedIntegersAndBitwiseOperators(t *testing.T) {
+	run := func(input string) (string, Value) {
+		t.Helper()
+		p := parser.NewParser(lexer.New(input))
+		program := p.ParseProgram()
+		if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+			t.Fatalf("parse errors: %s", errs.Error())
+		}
+		var buf bytes.Buffer
+		eval := New()
+		eval.SetOutput(&buf)
+		result := eval.Eval(program)
+		return buf.String(), result
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"log(0b1100 & 0b1010);\nlog(0b1100 | 0b1010);\nlog(0b1100 ^ 0b1010);\nlog(^0);", "8\n14\n6\n-1\n"},
+		{"log(1 << 10);\nlog(-16 >> 2);\nlog(-1 << 63);", "1024\n-4\n-9223372036854775808\n"},
+		{"log(0xff + 0o17 + 1_000);\nlog(6 & 3 == 2);", "1270\ntrue\n"},
+		{"a: u8 = 250;\nlog(a + 10);\nb: i8 = 127;\nlog(b + 1);\nlog(-b - 2);", "4\n-128\n127\n"},
+		{"m: u64 = 0;\nlog(m - 1);\nlog(m - 1 > 1);\nlog((m - 1) >> 63);\nlog((m - 1) / 2);", "18446744073709551615\ntrue\n1\n9223372036854775807\n"},
+		{"x: u32 = 0xF0;\nlog(^x);\nlog(x << 28);", "4294967055\n0\n"},
+		{"log(u8(300));\nlog(i8(200));\nlog(u16(-1));\nlog(int(u8(255)) + 1);\nlog(u8(3.9));", "44\n-56\n65535\n256\n3\n"},
+		{"xs: []byte = [1, 2, 255];\nlog(xs[2] + 1);\nlog(xs[u8(1)]);", "0\n2\n"},
+		{"func low(x: u16) -> u16 { return x & 0xFF; }\nlog(low(0x1234));", "52\n"},
+		{"x: i16;\nlog(x);\nmut y: u8 = 1;\ny = 255;\nlog(y + 1);", "0\n0\n"},
+		{"type Flags u8;\nf := Flags(1) | Flags(4);\nlog(f);\nlog(^f);", "5\n250\n"},
+	}
+	for _, tt := range tests {
+		out, result := run(tt.input)
+		if isError(result) || out != tt.expected {
+			t.Errorf("%s: got %q (%v), want %q", tt.input, out, result, tt.expected)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		code     string
+		contains string
+	}{
+		{"x := 9223372036854775807 + 1;", ErrOverflow, "integer overflow: 9223372036854775807 + 1 overflows int"},
+		{"x := (-9223372036854775807 - 1) * -1;", ErrOverflow, "overflows int"},
+		{"x: u8 = 256;", ErrOverflow, "256 overflows u8"},
+		{"xs: []u8 = [1, 300];", ErrOverflow, "300 overflows u8"},
+		{"a: u8 = 1;\nb: i8 = 1;\nx := a + b;", ErrTypeMismatch, "mismatched types: u8 + i8"},
+		{"a: u8 = 1;\nx := a + 0.5;", ErrTypeMismatch, "mismatched types: u8 + float"},
+		{"x := 1 << -1;", ErrRuntimeError, "negative shift count -1"},
+		{"x := 1 << 64;", ErrOverflow, "shift count 64 is out of range for int"},
+		{"x := 1.5 | 1;", ErrTypeMismatch, "operator | not defined on FLOAT and INTEGER"},
+		{"a: u16 = 1;\nx := a / 0;", ErrDivisionByZero, "division by zero"},
+	}
+	for _, tt := range errorTests {
+		_, result := run(tt.input)
+		rtErr, ok := result.(*RuntimeError)
+		if !ok || rtErr.Detail.ErrorCode != tt.code || !strings.Contains(rtErr.Detail.Message, tt.contains) {
+			t.Errorf("%s: expected %s error containing %q, got %v", tt.input, tt.code, tt.contains, result)
+		}
+	}
+}
+
+// TestIntegerOverflowEdges checks the one overflow rule at the edges of
+// each operator: int reports any result it can't hold, sized types wrap
+// +, -, * and negation, and every type reports a quotient that doesn't
+// fit and a shift by its width or more
+func TestIntegerOverflowEdges(t *testing.T) {
+	const minInt = "(-9223372036854775807 - 1)"
+	tests := []struct {
+		input    string
+		expected string // the value logged, or the overflow error's message
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1 overflows int"},
+		{minInt + " - 1", "integer overflow: -9223372036854775808 - 1 overflows int"},
+		{minInt + " * -1", "integer overflow: -9223372036854775808 * -1 overflows int"},
+		{"-" + minInt, "integer overflow: -(-9223372036854775808) overflows int"},
+		{minInt + " / -1", "integer overflow: -9223372036854775808 / -1 overflows int"},
+		{minInt + " / 1", "-9223372036854775808"},
+		{minInt + " % -1", "0"},
+		{"1 << 62", "4611686018427387904"},
+		{"1 << 63", "integer overflow: 1 << 63 overflows int"},
+		{"1 << 100", "integer overflow: shift count 100 is out of range for int"},
+		{"-8 >> 64", "integer overflow: shift count 64 is out of range for int"},
+		{"-8 >> 63", "-1"},
+		{"i8(127) + i8(1)", "-128"},
+		{"i8(-128) - i8(1)", "127"},
+		{"-i8(-128)", "-128"},
+		{"i8(-128) / i8(-1)", "integer overflow: -128 / -1 overflows i8"},
+		{"i8(-128) / i8(2)", "-64"},
+		{"i8(-128) % i8(-1)", "0"},
+		{"i64(1) << 63", "-9223372036854775808"},
+		{"i64(1) << 64", "integer overflow: shift count 64 is out of range for i64"},
+		{"u8(255) << 1", "254"},
+		{"u8(1) << 8", "integer overflow: shift count 8 is out of range for u8"},
+		{"u8(128) >> 7", "1"},
+		{"u64(1) << 63", "9223372036854775808"},
+		{"u64(0) - u64(1)", "18446744073709551615"},
+	}
+	for _, tt := range tests {
+		p := parser.NewParser(lexer.New("log(" + tt.input + ");"))
+		program := p.ParseProgram()
+		if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+			t.Fatalf("%s: parse errors: %s", tt.input, errs.Error())
+		}
+		var buf bytes.Buffer
+		eval := New()
+		eval.SetOutput(&buf)
+		result := eval.Eval(program)
+		got := strings.TrimSuffix(buf.String(), "\n")
+		if rtErr, ok := result.(*RuntimeError); ok {
+			if rtErr.Detail.ErrorCode != ErrOverflow {
+				t.Errorf("%s: expected an overflow, got %s", tt.input, rtErr.Detail.ErrorCode)
+			}
+			got = rtErr.Detail.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%s: got %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	run := func(input string) (string, Value) {
+		t.Helper()
+		p := parser.NewParser(lexer.New(input))
+		program := p.ParseProgram()
+		if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+			t.Fatalf("parse errors: %s", errs.Error())
+		}
+		var buf bytes.Buffer
+		eval := New()
+		eval.SetOutput(&buf)
+		result := eval.Eval(program)
+		return buf.String(), result
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"mut f: bigint = 1;\nfor mut i := 2; i <= 30; i = i + 1 { f = f * i; }\nlog(f);", "265252859812191058636308480000000\n"},
+		{"y := 9223372036854775808;\nlog(y - 1);\nlog(y + 9223372036854775807);", "9223372036854775807\n18446744073709551615\n"},
+		{"b := 123456789012345678901234567890;\nlog(b / 1000);\nlog(-b % 1000);\nlog(b > 1);\nlog(b == 123456789012345678901234567890);", "123456789012345678901234567\n-890\ntrue\ntrue\n"},
+		{"log(0x1_0000_0000_0000_0000 >> 60);\nx: bigint = 6;\nlog(x & 3 | 8);\nlog(^x);\nlog(x << 100 >> 99);", "16\n10\n-7\n12\n"},
+		{"x: bigint = 42;\nlog(int(x) + 1);\nlog(float(x));\nlog(string(x) + \"!\");\nlog(string(7));", "43\n42\n42!\n7\n"},
+		{"log(bigint(\"-987654321987654321987654321\") + 1);\nlog(bigint(2.9));\nlog(u8(bigint(300)));\nm: u64 = 0;\nlog(bigint(m - 1) + 1);", "-987654321987654321987654320\n2\n44\n18446744073709551616\n"},
+		{"func twice(x: bigint) -> bigint { return x * 2; }\nlog(twice(5));\nx: bigint;\nlog(x);\nconst C: bigint = 3;\nlog(C * 100000000000000000000);", "10\n0\n300000000000000000000\n"},
+		{"xs: []bigint = [1, 100000000000000000000];\nlog(xs[1] + xs[0]);", "100000000000000000001\n"},
+		{"func one() -> bigint { x := 1; return x; }\nlog(one() << 70);", "1180591620717411303424\n"},
+		{"func top() -> u8 { return 255; }\nlog(top() + 1);", "0\n"},
+		{"func ones() -> []bigint { return [1, 2]; }\nxs := ones();\nlog(xs[1] << 70);", "2361183241434822606848\n"},
+	}
+	for _, tt := range tests {
+		out, result := run(tt.input)
+		if isError(result) || out != tt.expected {
+			t.Errorf("%s: got %q (%v), want %q", tt.input, out, result, tt.expected)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		code     string
+		contains string
+	}{
+		{"x := 100000000000000000000;\ny := x / 0;", ErrDivisionByZero, "division by zero"},
+		{"x := 100000000000000000000;\ny := int(x);", ErrOverflow, "100000000000000000000 overflows int"},
+		{"x := 100000000000000000000;\ny := x + 0.5;", ErrTypeMismatch, "mismatched types: bigint + float"},
+		{"x := 100000000000000000000;\na: u8 = 1;\ny := x + a;", ErrTypeMismatch, "mismatched types: bigint + u8"},
+		{"x := 100000000000000000000;\ny := x << -1;", ErrRuntimeError, "negative shift count -1"},
+		{"x := bigint(\"12ab\");", ErrTypeMismatch, "cannot convert \"12ab\" to bigint"},
+		{"func low() -> u8 { x := 300; return x; }\ny := low();", ErrOverflow, "300 overflows u8"},
+	}
+	for _, tt := range errorTests {
+		_, result := run(tt.input)
+		rtErr, ok := result.(*RuntimeError)
+		if !ok || rtErr.Detail.ErrorCode != tt.code || !strings.Contains(rtErr.Detail.Message, tt.contains) {
+			t.Errorf("%s: expected %s error containing %q, got %v", tt.input, tt.code, tt.contains, result)
+		}
+	}
+}
+
+func TestDiscardName(t *testing.T) {
+	input := `func pick(_: int, b: int, _: int) -> int { return b; }
+_ := pick(1, 2, 3);
+_ := 4;
+log(pick(5, 6, 7));
+log(_);`
+	p := parser.NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+		t.Fatalf("parse errors: %s", errs.Error())
+	}
+	var buf bytes.Buffer
+	eval := New()
+	eval.SetOutput(&buf)
+	result := eval.Eval(program)
+
+	if buf.String() != "6\n" {
+		t.Errorf("expected output %q, got %q", "6\n", buf.String())
+	}
+	rtErr, ok := result.(*RuntimeError)
+	if !ok || !strings.Contains(rtErr.Detail.Message, "'_'") {
+		t.Errorf("expected reading _ to fail, got %v", result)
+	}
+}
+
+func TestOptionalTypes(t *testing.T) {
+	input := `func find(n: int) -> ?int { if n > 0 { return n; } return nil; }
+mut a: ?u8 = nil;
+log(a);
+a = 7;
+log(a);
+a = nil;
+log(a);
+log(find(3));
+log(find(0));
+mut n: int;
+n = 2;
+log(n);`
+	p := parser.NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+		t.Fatalf("parse errors: %s", errs.Error())
+	}
+	var buf bytes.Buffer
+	eval := New()
+	eval.SetOutput(&buf)
+	if result := eval.Eval(program); isError(result) {
+		t.Fatalf("unexpected error: %v", result)
+	}
+
+	expected := "null\n7\nnull\n3\nnull\n2\n"
+	if buf.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, buf.String())
+	}
+}
+
+func TestFieldAssignment(t *testing.T) {
+	input := `struct P { x: int; xs: []int; }
+func bump(mut p: P, mut n: int) -> int { p.x = p.x + n; n = n * 2; return n; }
+mut p := P{x: 1, xs: [1, 2]};
+p.x = 5;
+p.xs[1] = 7;
+log(bump(p, 3));
+log(p.x);
+log(p.xs);
+p.x = "five";`
+	p := parser.NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+		t.Fatalf("parse errors: %s", errs.Error())
+	}
+	var buf bytes.Buffer
+	eval := New()
+	eval.SetOutput(&buf)
+	result := eval.Eval(program)
+
+	if expected := "6\n8\n[1, 7]\n"; buf.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, buf.String())
+	}
+	rtErr, ok := result.(*RuntimeError)
+	if !ok || !strings.Contains(rtErr.Detail.Message, "cannot assign STRING to field 'x'") {
+		t.Errorf("expected a type mismatch, got %v", result)
+	}
+}
+
+// TestCatalogExamples checks that the erroneous example of each runtime
+// code mars explain documents fails with that code, and that the fixed one
+// runs
+func TestCatalogExamples(t *testing.T) {
+	run := func(t *testing.T, input string) Value {
+		t.Helper()
+		p := parser.NewParser(lexer.New(input))
+		program := p.ParseProgram()
+		if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+			t.Fatalf("parse errors: %s", errs.Error())
+		}
+		eval := New()
+		eval.SetOutput(io.Discard)
+		return eval.Eval(program)
+	}
+
+	for _, info := range errors.Codes() {
+		if info.Reserved() || !strings.HasPrefix(info.Code, "E1") {
+			continue
+		}
+		t.Run(info.Code, func(t *testing.T) {
+			rtErr, ok := run(t, info.Erroneous).(*RuntimeError)
+			if !ok || rtErr.Detail.ErrorCode != info.Code {
+				t.Errorf("erroneous example gave %v, want a %s error", rtErr, info.Code)
+			}
+			if result := run(t, info.Fixed); isError(result) {
+				t.Errorf("fixed example failed: %s", result)
+			}
+		})
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	tests := []struct {
+		input string
+		code  string
+		hint  string
+	}{
+		{"xs := [1, 2];\nlog(lenght(xs));", ErrUndefinedVar, "did you mean 'len'?"},
+		{"mut total := 0;\ntotl = 1;", ErrUndefined, "did you mean 'total'?"},
+		{"ok := ture;", ErrUndefinedVar, "did you mean 'true'?"},
+		{"struct P { x: int; count: int; }\np := P{x: 1, count: 2};\nlog(p.cout);", ErrRuntimeError, "did you mean 'count'?"},
+		{"struct P { x: int; count: int; }\nmut p := P{x: 1, count: 2};\np.conut = 3;", ErrRuntimeError, "did you mean 'count'?"},
+		{"log(zzz);", ErrUndefinedVar, ""},
+	}
+	for _, tt := range tests {
+		p := parser.NewParser(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+			t.Fatalf("%s: parse errors: %s", tt.input, errs.Error())
+		}
+		eval := New()
+		eval.SetOutput(io.Discard)
+		rtErr, ok := eval.Eval(program).(*RuntimeError)
+		if !ok || rtErr.Detail.ErrorCode != tt.code || rtErr.Detail.Hint != tt.hint {
+			t.Errorf("%s: expected a %s error with hint %q, got %v", tt.input, tt.code, tt.hint, rtErr)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package evaluator
+
+import (
+	"fmt"
+	"mars/ast"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// intTypeOf returns the type of an int value: its sized type, or int's
+// 64 signed bits for a plain int
+func intTypeOf(i *IntegerValue) ast.IntType {
+	if typ, ok := ast.LookupIntType(i.Kind); ok {
+		return typ
+	}
+	return ast.IntType{Name: "int", Bits: 64, Signed: true}
+}
+
+// isSized reports whether v is a value of a sized integer type
+func isSized(v Value) bool {
+	i, ok := v.(*IntegerValue)
+	return ok && i.Kind != ""
+}
+
+// isUnsigned64 reports whether a type's values need unsigned 64-bit
+// operations: the other unsigned types hold non-negative int64s
+func isUnsigned64(typ ast.IntType) bool {
+	return !typ.Signed && typ.Bits == 64
+}
+
+// valueTypeName names a value's type in operator errors
+func valueTypeName(v Value) string {
+	if i, ok := v.(*IntegerValue); ok {
+		return intTypeOf(i).Name
+	}
+	return strings.ToLower(getValueType(v))
+}
+
+// applyOperator applies a binary operator, giving sized integers their
+// wrapping arithmetic and bigints their unbounded one
+func applyOperator(operator string, left, right Value, handler binaryOpFn) Value {
+	if isBig(left) || isBig(right) {
+		return bigOperation(operator, left, right)
+	}
+	if isSized(left) || isSized(right) {
+		return intOperation(operator, left, right)
+	}
+	return handler(left, right)
+}
+
+// intOperator is the handler of an operator only defined on ints
+func intOperator(operator string) binaryOpFn {
+	return func(left, right Value) Value {
+		if left.Type() != INTEGER_TYPE || right.Type() != INTEGER_TYPE {
+			return newError("type mismatch: operator %s not defined on %s and %s", operator, left.Type(), right.Type())
+		}
+		return intOperation(operator, left, right)
+	}
+}
+
+// intOperation applies an operator to two ints of the same type. A plain
+// int operand takes the other's sized type if it fits, as a literal would.
+// Results wrap to the type's width, except a quotient, which is reported
+// when it doesn't fit, as in i8(-128) / i8(-1).
+func intOperation(operator string, left, right Value) Value {
+	l, lok := left.(*IntegerValue)
+	r, rok := right.(*IntegerValue)
+	if !lok || !rok {
+		return &Error{Code: ErrTypeMismatch, Message: fmt.Sprintf("mismatched types: %s %s %s",
+			valueTypeName(left), operator, valueTypeName(right))}
+	}
+	if operator == "<<" || operator == ">>" {
+		return shift(operator, l, r)
+	}
+
+	kind := l.Kind
+	if kind == "" {
+		kind = r.Kind
+	}
+	if l.Kind != "" && r.Kind != "" && l.Kind != r.Kind {
+		return &Error{Code: ErrTypeMismatch, Message: fmt.Sprintf("mismatched types: %s %s %s",
+			l.Kind, operator, r.Kind)}
+	}
+	typ := intTypeOf(&IntegerValue{Kind: kind})
+	for _, operand := range []*IntegerValue{l, r} {
+		if operand.Kind == "" && !typ.Fits(operand.Value) {
+			return &Error{Code: ErrOverflow, Message: fmt.Sprintf("%d overflows %s", operand.Value, typ.Name)}
+		}
+	}
+
+	a, b := l.Value, r.Value
+	var v int64
+	switch operator {
+	case "+":
+		v = a + b
+	case "-":
+		v = a - b
+	case "*":
+		v = a * b
+	case "/", "%":
+		if b == 0 {
+			return &Error{Message: "division by zero", Code: ErrDivisionByZero}
+		}
+		switch {
+		case isUnsigned64(typ) && operator == "/":
+			v = int64(uint64(a) / uint64(b))
+		case isUnsigned64(typ):
+			v = int64(uint64(a) % uint64(b))
+		case operator == "/":
+			if typ.Signed && b == -1 && (a == math.MinInt64 || !typ.Fits(-a)) {
+				return &Error{Code: ErrOverflow, Message: fmt.Sprintf("integer overflow: %d / %d overflows %s", a, b, typ.Name)}
+			}
+			v = a / b
+		default:
+			v = a % b
+		}
+	case "&":
+		v = a & b
+	case "|":
+		v = a | b
+	case "^":
+		v = a ^ b
+	case "==":
+		return boolToValue(a == b)
+	case "!=":
+		return boolToValue(a != b)
+	case "<", ">", "<=", ">=":
+		less := a < b
+		if isUnsigned64(typ) {
+			less = uint64(a) < uint64(b)
+		}
+		return compareInts(operator, a == b, less)
+	default:
+		return &Error{Code: ErrTypeMismatch, Message: fmt.Sprintf("unknown operator: %s %s %s",
+			typ.Name, operator, typ.Name)}
+	}
+	return &IntegerValue{Value: typ.Wrap(v), Kind: kind}
+}
+
+// compareInts applies an ordering operator given whether the operands are
+// equal and whether the left one is less
+func compareInts(operator string, eq, less bool) Value {
+	switch operator {
+	case "<":
+		return boolToValue(less)
+	case ">":
+		return boolToValue(!less && !eq)
+	case "<=":
+		return boolToValue(less || eq)
+	default:
+		return boolToValue(!less)
+	}
+}
+
+// shift shifts an int of any type by a count of any integer type. The
+// count must be less than the type's width. Bits a sized type shifts out
+// are lost, as its arithmetic wraps; an int reports them as overflow.
+func shift(operator string, l, r *IntegerValue) Value {
+	if r.Value < 0 && !isUnsigned64(intTypeOf(r)) {
+		return &Error{Code: ErrRuntimeError, Message: fmt.Sprintf("negative shift count %d", r.Value)}
+	}
+	count := uint64(r.Value)
+	typ := intTypeOf(l)
+	if count >= uint64(typ.Bits) {
+		return &Error{Code: ErrOverflow, Message: fmt.Sprintf("integer overflow: shift count %d is out of range for %s", count, typ.Name)}
+	}
+
+	var v int64
+	switch {
+	case operator == "<<":
+		v = l.Value << count
+		if l.Kind == "" && v>>count != l.Value {
+			return &Error{Code: ErrOverflow, Message: fmt.Sprintf("integer overflow: %d << %d overflows int", l.Value, count)}
+		}
+	case isUnsigned64(typ):
+		v = int64(uint64(l.Value) >> count)
+	default:
+		v = l.Value >> count
+	}
+	return &IntegerValue{Value: typ.Wrap(v), Kind: l.Kind}
+}
+
+// checkedInt applies +, -, * or a non-zero / to two plain ints, which
+// report overflow where a sized type would wrap
+func checkedInt(operator string, a, b int64) Value {
+	var v int64
+	var overflow bool
+	switch operator {
+	case "+":
+		v = a + b
+		overflow = (b > 0 && v < a) || (b < 0 && v > a)
+	case "-":
+		v = a - b
+		overflow = (b < 0 && v < a) || (b > 0 && v > a)
+	case "*":
+		v = a * b
+		overflow = a != 0 && (v/a != b || (a == -1 && b == math.MinInt64))
+	case "/":
+		v = a / b
+		overflow = a == math.MinInt64 && b == -1
+	}
+	if overflow {
+		return &Error{Code: ErrOverflow, Message: fmt.Sprintf("integer overflow: %d %s %d overflows int", a, operator, b)}
+	}
+	return &IntegerValue{Value: v}
+}
+
+// negateInt negates an int: sized types wrap, int reports overflow
+func negateInt(i *IntegerValue) Value {
+	if i.Kind != "" {
+		return &IntegerValue{Value: intTypeOf(i).Wrap(-i.Value), Kind: i.Kind}
+	}
+	if i.Value == math.MinInt64 {
+		return &Error{Code: ErrOverflow, Message: fmt.Sprintf("integer overflow: -(%d) overflows int", i.Value)}
+	}
+	return &IntegerValue{Value: -i.Value}
+}
+
+// toIntType converts an int, bigint or float to a sized integer type,
+// truncating floats toward zero and wrapping values the type can't hold
+func toIntType(name string, v Value) Value {
+	typ, _ := ast.LookupIntType(name)
+	var bits int64
+	switch v := v.(type) {
+	case *IntegerValue:
+		bits = v.Value
+	case *BigIntValue:
+		bits = lowBits(v.Value)
+	case *FloatValue:
+		bits = int64(v.Value)
+	}
+	return &IntegerValue{Value: typ.Wrap(bits), Kind: typ.Name}
+}
+
+// intToFloat converts an int of any type to a float
+func intToFloat(i *IntegerValue) float64 {
+	if isUnsigned64(intTypeOf(i)) {
+		return float64(uint64(i.Value))
+	}
+	return float64(i.Value)
+}
+
+// fitInt gives a plain int the sized integer type it is assigned to, as in
+// x: u8 = 200, or promotes it to a bigint, including the elements of an
+// array assigned to []u8.
+// Values the type can't hold are reported; anything else is returned as is.
+func fitInt(value Value, expected string) (Value, *Error) {
+	expected = strings.TrimPrefix(expected, "?")
+	if strings.HasPrefix(expected, "[") {
+		array, ok := value.(*ArrayValue)
+		if !ok {
+			return value, nil
+		}
+		elemType := expected[strings.Index(expected, "]")+1:]
+		elements := array.elements()
+		changed := false
+		for i, elem := range elements {
+			fitted, err := fitInt(elem, elemType)
+			if err != nil {
+				return nil, err
+			}
+			if fitted != elem {
+				elements[i], changed = fitted, true
+			}
+		}
+		if !changed {
+			return value, nil
+		}
+		return &ArrayValue{Elements: elements}, nil
+	}
+
+	i, ok := value.(*IntegerValue)
+	if ok && i.Kind == "" && expected == "bigint" {
+		return &BigIntValue{Value: big.NewInt(i.Value)}, nil
+	}
+	typ, sized := ast.LookupIntType(expected)
+	if !ok || !sized || i.Kind != "" {
+		return value, nil
+	}
+	if !typ.Fits(i.Value) {
+		return nil, &Error{Code: ErrOverflow, Message: fmt.Sprintf("%d overflows %s", i.Value, typ.Name)}
+	}
+	return &IntegerValue{Value: i.Value, Kind: typ.Name}, nil
+}
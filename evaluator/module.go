@@ -0,0 +1,63 @@
+package evaluator
+
+import "mars/ast"
+
+// LoadModule runs the top level of an imported module in its own namespace
+// and records it under path, so later import declarations can bind it.
+// Load modules before the programs that import them. Only declarations
+// marked 'pub' can be reached from other modules.
+func (e *Evaluator) LoadModule(path string, program *ast.Program) Value {
+	module := &ModuleValue{
+		Path:   path,
+		Name:   ast.ModuleName(path),
+		Env:    NewEnclosedEnvironment(e.builtins),
+		Public: publicNames(program),
+	}
+
+	oldEnv, oldModule := e.env, e.module
+	e.env, e.module = module.Env, module
+	defer func() { e.env, e.module = oldEnv, oldModule }()
+
+	e.pushFrame(path, program.Position, "module")
+	defer e.popFrame()
+
+	for _, decl := range program.Declarations {
+		result := e.Eval(decl)
+		if isError(result) {
+			return result
+		}
+	}
+
+	e.modules[path] = module
+	return module
+}
+
+// evalImportDecl binds a loaded module to its name in the current scope
+func (e *Evaluator) evalImportDecl(n *ast.ImportDecl) Value {
+	module, ok := e.modules[n.Path]
+	if !ok {
+		return e.newError(n.Position, ErrUndefined, "module '%s' is not loaded", n.Path)
+	}
+	e.env.Set(n.Name, module, false)
+	return module
+}
+
+// publicNames returns the top-level names a program declares with 'pub'
+func publicNames(program *ast.Program) map[string]bool {
+	public := make(map[string]bool)
+	for _, decl := range program.Declarations {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			public[d.Name.Name] = d.Public
+		case *ast.StructDecl:
+			public[d.Name.Name] = d.Public
+		case *ast.VarDecl:
+			public[d.Name.Name] = d.Public
+		case *ast.ConstDecl:
+			public[d.Name.Name] = d.Public
+		case *ast.TypeDecl:
+			public[d.Name.Name] = d.Public
+		}
+	}
+	return public
+}
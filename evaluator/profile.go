@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProfileRoot is the name of the frame that top-level code runs in
+const ProfileRoot = "(program)"
+
+// Profiler measures wall time and call counts for user functions and the
+// source lines within them. Every moment between Start and Stop is charged
+// to exactly one stack of (function, line) locations.
+type Profiler struct {
+	now     func() time.Time
+	stack   []ProfileLocation // active user function calls, root first
+	last    time.Time         // when time was last charged
+	samples map[string]*ProfileSample
+}
+
+// ProfileLocation is a line within a function. Line is 0 before the
+// function's first statement runs.
+type ProfileLocation struct {
+	Function string
+	Line     int
+}
+
+// ProfileSample is the time spent at one stack, and the number of calls
+// that entered it
+type ProfileSample struct {
+	Stack []ProfileLocation // root first
+	Calls int64
+	Time  time.Duration
+}
+
+func NewProfiler() *Profiler {
+	return newProfilerWithClock(time.Now)
+}
+
+func newProfilerWithClock(now func() time.Time) *Profiler {
+	return &Profiler{
+		now:     now,
+		stack:   []ProfileLocation{{Function: ProfileRoot}},
+		last:    now(),
+		samples: make(map[string]*ProfileSample),
+	}
+}
+
+// charge adds the time since the last event to the current stack
+func (p *Profiler) charge() {
+	now := p.now()
+	p.sample().Time += now.Sub(p.last)
+	p.last = now
+}
+
+// sample returns the sample for the current stack, creating it if needed
+func (p *Profiler) sample() *ProfileSample {
+	var key strings.Builder
+	for _, loc := range p.stack {
+		key.WriteString(loc.Function)
+		key.WriteByte(':')
+		key.WriteString(strconv.Itoa(loc.Line))
+		key.WriteByte(';')
+	}
+
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &ProfileSample{Stack: append([]ProfileLocation(nil), p.stack...)}
+		p.samples[key.String()] = s
+	}
+	return s
+}
+
+func (p *Profiler) enter(function string) {
+	p.charge()
+	p.stack = append(p.stack, ProfileLocation{Function: function})
+	p.sample().Calls++
+}
+
+func (p *Profiler) exit() {
+	p.charge()
+	if len(p.stack) > 1 {
+		p.stack = p.stack[:len(p.stack)-1]
+	}
+}
+
+// line moves the innermost call to a new source line
+func (p *Profiler) line(line int) {
+	top := &p.stack[len(p.stack)-1]
+	if top.Line != line {
+		p.charge()
+		top.Line = line
+	}
+}
+
+// Stop charges the time since the last event. Call it once evaluation ends.
+func (p *Profiler) Stop() {
+	p.charge()
+}
+
+// Samples returns every recorded stack, ordered by stack
+func (p *Profiler) Samples() []ProfileSample {
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	samples := make([]ProfileSample, len(keys))
+	for i, key := range keys {
+		samples[i] = *p.samples[key]
+	}
+	return samples
+}
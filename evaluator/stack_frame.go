@@ -5,5 +5,6 @@ import "mars/ast"
 type StackFrame struct {
 	Function string
 	Location ast.Position
+	Module   string // import path of the module Location is in; empty for the entry program
 	Context  string // "function call", "if statement", etc.
 }
@@ -0,0 +1,412 @@
+package evaluator
+
+import (
+	"io"
+	"mars/ast"
+	"sync"
+	"sync/atomic"
+)
+
+// scheduler coordinates the tasks of one program: the task that calls Eval
+// and every task started with spawn. Tasks block on it in channel
+// operations, and it halts every task when one of them fails, when all of
+// them are blocked, or when the program is stopped.
+type scheduler struct {
+	mu      sync.Mutex
+	changed *sync.Cond // broadcast when a channel changes, a task finishes or tasks halt
+	gen     int        // incremented whenever a channel changes
+	live    int        // tasks that haven't finished, including the main one
+	blocked int        // tasks that have blocked since the last channel change
+	nextID  int
+	halted  atomic.Bool
+	failure Value      // why the tasks were halted
+	output  sync.Mutex // serializes writes to the program's output
+}
+
+// errStopped halts the tasks still running when the program is stopped
+var errStopped = &Error{Message: "program stopped"}
+
+func newScheduler() *scheduler {
+	s := &scheduler{live: 1}
+	s.changed = sync.NewCond(&s.mu)
+	return s
+}
+
+// wait blocks until a channel changes, with s.mu held. It returns false if
+// the tasks were halted instead, which happens here when every live task
+// is waiting and none can ever proceed.
+func (s *scheduler) wait() bool {
+	if s.halted.Load() {
+		return false
+	}
+	s.blocked++
+	if s.blocked >= s.live {
+		s.halt(&Error{Message: "deadlock: all tasks are blocked on channels", Code: ErrDeadlock})
+		return false
+	}
+	gen := s.gen
+	for gen == s.gen && !s.halted.Load() {
+		s.changed.Wait()
+	}
+	return !s.halted.Load()
+}
+
+// notify wakes the waiting tasks to check their channels again, with s.mu
+// held. They count as blocked again only once they wait again.
+func (s *scheduler) notify() {
+	s.gen++
+	s.blocked = 0
+	s.changed.Broadcast()
+}
+
+// halt stops every task with failure, with s.mu held. Only the first
+// failure is kept.
+func (s *scheduler) halt(failure Value) {
+	if s.halted.Load() {
+		return
+	}
+	s.failure = failure
+	s.halted.Store(true)
+	s.changed.Broadcast()
+}
+
+// fail halts every task because one of them failed, like an unrecovered
+// panic in a goroutine
+func (s *scheduler) fail(failure Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.halt(failure)
+}
+
+// start registers a task that is about to be spawned and returns its id
+func (s *scheduler) start() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.live++
+	s.nextID++
+	return s.nextID
+}
+
+// finish removes a task that returned. The tasks left may all be blocked
+// waiting for it.
+func (s *scheduler) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.live--
+	if s.live > 0 && s.blocked >= s.live {
+		s.halt(&Error{Message: "deadlock: all tasks are blocked on channels", Code: ErrDeadlock})
+	}
+	s.changed.Broadcast()
+}
+
+// halted returns why the tasks were halted, or nil while they may run.
+// Tasks check it between statements.
+func (e *Evaluator) halted() Value {
+	if e.sched.halted.Load() {
+		return e.sched.failure
+	}
+	return nil
+}
+
+// Stop halts the tasks spawned by the program that are still running or
+// blocked, and waits for them to finish. Call it once the program is done;
+// the evaluator can't run anything afterwards.
+func (e *Evaluator) Stop() {
+	s := e.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.halt(errStopped)
+	for s.live > 1 {
+		s.changed.Wait()
+	}
+}
+
+// fork returns an evaluator for a new task. Tasks share the program's
+// modules, output and instrumentation, but each has its own call stack.
+// Only the main task is profiled.
+func (e *Evaluator) fork(id int) *Evaluator {
+	return &Evaluator{
+		env:        e.env,
+		builtins:   e.builtins,
+		modules:    e.modules,
+		module:     e.module,
+		sourceCode: e.sourceCode,
+		out:        e.out,
+		coverage:   e.coverage,
+		tracer:     e.tracer,
+		sched:      e.sched,
+		task:       id,
+	}
+}
+
+// evalSpawnStatement evaluates the call's function and arguments, then runs
+// the call in a new task without waiting for it. The task's result is
+// discarded; if it fails, every task halts with its error.
+func (e *Evaluator) evalSpawnStatement(n *ast.SpawnStatement) Value {
+	function := e.Eval(n.Call.Function)
+	if isError(function) {
+		return function
+	}
+	var args []Value
+	for _, arg := range n.Call.Arguments {
+		value := e.Eval(arg)
+		if isError(value) {
+			return value
+		}
+		args = append(args, value)
+	}
+	fn, ok := function.(*FunctionValue)
+	if !ok {
+		return e.newError(n.Position, ErrNotAFunction,
+			"'%s' is not a function", function.Type())
+	}
+
+	task := e.fork(e.sched.start())
+	go func() {
+		defer e.sched.finish()
+		if result := task.callFunction(n.Call, fn, args); isError(result) {
+			e.sched.fail(result)
+		}
+	}()
+	return NULL
+}
+
+// evalChanLiteral creates a channel, buffered if a capacity is given
+func (e *Evaluator) evalChanLiteral(n *ast.ChanLiteral) Value {
+	capacity := 0
+	if n.Capacity != nil {
+		value := e.Eval(n.Capacity)
+		if isError(value) {
+			return value
+		}
+		size, ok := value.(*IntegerValue)
+		if !ok {
+			return e.newError(n.Position, ErrTypeMismatch,
+				"channel capacity must be an int, got %s", value.Type())
+		}
+		if size.Value < 0 {
+			return e.newError(n.Position, ErrRuntimeError,
+				"channel capacity must not be negative, got %d", size.Value)
+		}
+		capacity = int(size.Value)
+	}
+	return &ChanValue{ElemType: n.ElemType, Capacity: capacity, sched: e.sched}
+}
+
+// evalSelectStatement runs the first case, in source order, whose channel
+// operation can proceed. Without one it runs the default case, or waits.
+// Channels and values to send are evaluated once, before waiting.
+func (e *Evaluator) evalSelectStatement(n *ast.SelectStatement) Value {
+	channels := make([]*ChanValue, len(n.Cases))
+	values := make([]Value, len(n.Cases))
+	for i, c := range n.Cases {
+		value := e.Eval(c.Channel)
+		if isError(value) {
+			return value
+		}
+		ch, ok := value.(*ChanValue)
+		if !ok {
+			return e.newError(c.Position, ErrTypeMismatch,
+				"select case needs a channel, got %s", value.Type())
+		}
+		channels[i] = ch
+		if c.Send {
+			if values[i] = e.Eval(c.Value); isError(values[i]) {
+				return values[i]
+			}
+			if !ch.accepts(values[i]) {
+				return e.newError(c.Position, ErrTypeMismatch,
+					"cannot send %s on %s", getValueType(values[i]), ch.String())
+			}
+		}
+	}
+
+	s := e.sched
+	s.mu.Lock()
+	chosen, registered := -1, false
+	for {
+		for i, c := range n.Cases {
+			if channels[i].ready(c.Send) {
+				chosen = i
+				break
+			}
+		}
+		if chosen >= 0 || n.Default != nil {
+			break
+		}
+		if !registered {
+			// Let unbuffered sends to the channels received from proceed
+			for i, c := range n.Cases {
+				if !c.Send {
+					channels[i].waiting++
+				}
+			}
+			s.notify()
+			registered = true
+		}
+		if !s.wait() {
+			break
+		}
+	}
+	if registered {
+		for i, c := range n.Cases {
+			if !c.Send {
+				channels[i].waiting--
+			}
+		}
+	}
+
+	if chosen < 0 && n.Default == nil {
+		s.mu.Unlock()
+		return e.located(n.Position, s.failure)
+	}
+	var received Value
+	if chosen >= 0 {
+		if n.Cases[chosen].Send {
+			received = channels[chosen].put(values[chosen])
+		} else {
+			received = channels[chosen].take()
+		}
+	}
+	s.mu.Unlock()
+
+	if chosen < 0 {
+		return e.Eval(n.Default)
+	}
+	c := n.Cases[chosen]
+	if isError(received) {
+		return e.located(c.Position, received)
+	}
+	if c.Name == nil {
+		return e.Eval(c.Body)
+	}
+	// The received value is bound in a scope around the case's body
+	oldEnv := e.env
+	e.env = NewEnclosedEnvironment(e.env)
+	defer func() { e.env = oldEnv }()
+	e.env.Set(c.Name.Name, received, false)
+	e.traceAssign(c.Position, c.Name.Name, received)
+	return e.Eval(c.Body)
+}
+
+// accepts reports whether v can be sent on the channel
+func (c *ChanValue) accepts(v Value) bool {
+	return typesCompatible(getTypeString(c.ElemType), getValueType(v))
+}
+
+// ready reports whether a send or receive on the channel would proceed
+// without waiting, with the scheduler's lock held. Sending on a closed
+// channel proceeds, to fail.
+func (c *ChanValue) ready(send bool) bool {
+	if !send {
+		return len(c.queue) > 0 || c.closed
+	}
+	if c.closed {
+		return true
+	}
+	if c.Capacity > 0 {
+		return len(c.queue) < c.Capacity
+	}
+	// An unbuffered send needs a receiver for each value queued
+	return c.waiting > len(c.queue)
+}
+
+// send sends v on the channel, waiting for room in its buffer, or for a
+// receiver to take it if it is unbuffered
+func (c *ChanValue) send(v Value) Value {
+	s := c.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !c.ready(true) {
+		if !s.wait() {
+			return s.failure
+		}
+	}
+	return c.put(v)
+}
+
+// recv receives a value from the channel, waiting for one to be sent.
+// Once the channel is closed and drained it returns null.
+func (c *ChanValue) recv() Value {
+	s := c.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !c.ready(false) {
+		c.waiting++
+		s.notify()
+		defer func() { c.waiting-- }()
+	}
+	for !c.ready(false) {
+		if !s.wait() {
+			return s.failure
+		}
+	}
+	return c.take()
+}
+
+// put adds v to a channel that is ready to send, with the scheduler's lock
+// held. An unbuffered send then waits until v has been received.
+func (c *ChanValue) put(v Value) Value {
+	s := c.sched
+	if c.closed {
+		return &Error{Message: "send on closed channel", Code: ErrRuntimeError}
+	}
+	ticket := c.sent
+	c.sent++
+	c.queue = append(c.queue, v)
+	s.notify()
+	if c.Capacity > 0 {
+		return NULL
+	}
+	for c.received <= ticket {
+		if c.closed {
+			return &Error{Message: "channel closed before the value sent was received", Code: ErrRuntimeError}
+		}
+		if !s.wait() {
+			return s.failure
+		}
+	}
+	return NULL
+}
+
+// take removes the next value from a channel that is ready to receive,
+// with the scheduler's lock held
+func (c *ChanValue) take() Value {
+	if len(c.queue) == 0 {
+		return NULL
+	}
+	v := c.queue[0]
+	c.queue = c.queue[1:]
+	c.received++
+	c.sched.notify()
+	return v
+}
+
+// close closes the channel. Values already buffered can still be
+// received; unbuffered sends still waiting fail.
+func (c *ChanValue) close() Value {
+	s := c.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.closed {
+		return &Error{Message: "close of closed channel", Code: ErrRuntimeError}
+	}
+	c.closed = true
+	if c.Capacity == 0 {
+		c.queue = nil
+	}
+	s.notify()
+	return NULL
+}
+
+// lockedWriter serializes writes from concurrent tasks to the same output
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,76 @@
+package evaluator
+
+import "mars/ast"
+
+// Trace event kinds
+const (
+	TraceStatement = "statement" // a statement is about to run
+	TraceAssign    = "assign"    // a variable or array element was assigned
+	TraceCall      = "call"      // a user function was called
+	TraceReturn    = "return"    // a user function returned or failed
+)
+
+// TraceEvent describes one step of execution. Values are rendered as they
+// appear in assertion messages, with strings quoted.
+type TraceEvent struct {
+	Kind     string
+	Task     int    // task the event happened in; 0 for the main task
+	Depth    int    // number of user function calls active, not counting a call's own call/return events
+	Module   string // import path of the module whose code Position is in; empty for the entry program
+	Position ast.Position
+	Name     string   // assigned target or called function
+	Value    string   // assigned or returned value
+	Args     []string // call arguments
+	Error    string   // set on return when the call failed
+}
+
+// SetTracer calls tracer for every statement, assignment, and user function
+// call and return
+func (e *Evaluator) SetTracer(tracer func(TraceEvent)) {
+	e.tracer = tracer
+}
+
+// trace sends event to the tracer with the current task, call depth and
+// module
+func (e *Evaluator) trace(event TraceEvent) {
+	event.Task = e.task
+	if e.module != nil {
+		event.Module = e.module.Path
+	}
+	for _, frame := range e.callStack {
+		if frame.Context == "call" {
+			event.Depth++
+		}
+	}
+	e.tracer(event)
+}
+
+// traceAssign reports an assignment of value to target, if tracing
+func (e *Evaluator) traceAssign(pos ast.Position, target string, value Value) {
+	if e.tracer != nil {
+		e.trace(TraceEvent{Kind: TraceAssign, Position: pos, Name: target, Value: inspectValue(value)})
+	}
+}
+
+// tracedCall runs a user function between call and return events
+func (e *Evaluator) tracedCall(n *ast.FunctionCall, function *FunctionValue, args []Value) Value {
+	rendered := make([]string, len(args))
+	for i, arg := range args {
+		rendered[i] = inspectValue(arg)
+	}
+	e.trace(TraceEvent{Kind: TraceCall, Position: n.Position, Name: function.Name, Args: rendered})
+
+	result := e.applyFunction(n, function, args)
+
+	event := TraceEvent{Kind: TraceReturn, Position: n.Position, Name: function.Name}
+	switch r := result.(type) {
+	case *RuntimeError:
+		event.Error = r.Detail.Message
+	case *Error:
+		event.Error = r.Message
+	default:
+		event.Value = inspectValue(result)
+	}
+	e.trace(event)
+	return result
+}
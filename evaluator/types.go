@@ -0,0 +1,176 @@
+package evaluator
+
+import (
+	"fmt"
+	"mars/ast"
+	"math/big"
+	"strings"
+)
+
+// baseTypes are bound in every program so that int(d) and friends convert
+var baseTypes = []string{"int", "float", "string", "bool",
+	"i8", "i16", "i32", "i64", "u8", "u16", "u32", "u64", "byte", "bigint"}
+
+// evalTypeDecl binds a declared type to its name, where calls convert to it
+// and annotations look it up
+func (e *Evaluator) evalTypeDecl(n *ast.TypeDecl) Value {
+	typ := &TypeValue{Name: n.Name.Name, Underlying: n.Type, Alias: n.Alias}
+	e.env.Set(n.Name.Name, typ, false)
+	return typ
+}
+
+// lookupType returns the declared type a name in an annotation refers to,
+// such as Meters or units.Meters, or nil if it names a struct or nothing
+func (e *Evaluator) lookupType(name string) *TypeValue {
+	env := e.env
+	if module, member, ok := strings.Cut(name, "."); ok {
+		binding, found := e.env.Get(module)
+		mod, isModule := binding.Value.(*ModuleValue)
+		if !found || !isModule {
+			return nil
+		}
+		env, name = mod.Env, member
+	}
+	binding, ok := env.Get(name)
+	if !ok {
+		return nil
+	}
+	typ, _ := binding.Value.(*TypeValue)
+	return typ
+}
+
+// typeString is getTypeString with the program's declared types resolved:
+// aliases become the type they stand for, and distinct types their name
+func (e *Evaluator) typeString(t *ast.Type) string {
+	return e.resolvedTypeString(t, 0)
+}
+
+func (e *Evaluator) resolvedTypeString(t *ast.Type, depth int) string {
+	switch {
+	case t == nil:
+		return "unknown"
+	case t.ArrayType != nil && t.ArraySize != nil:
+		return fmt.Sprintf("[%d]%s", *t.ArraySize, e.resolvedTypeString(t.ArrayType, depth))
+	case t.ArrayType != nil:
+		return "[]" + e.resolvedTypeString(t.ArrayType, depth)
+	case t.PointerType != nil:
+		return "*" + e.resolvedTypeString(t.PointerType, depth)
+	case t.OptionalType != nil:
+		return "?" + e.resolvedTypeString(t.OptionalType, depth)
+	case t.ChanType != nil:
+		return "chan[" + e.resolvedTypeString(t.ChanType, depth) + "]"
+	case t.StructName != "":
+		typ := e.lookupType(t.StructName)
+		if typ == nil {
+			return t.StructName
+		}
+		// An alias cycle names no type; the analyzer reports it
+		if typ.Alias && depth < 100 {
+			return e.resolvedTypeString(typ.Underlying, depth+1)
+		}
+		return typ.Name
+	}
+	return t.BaseType
+}
+
+// convert calls a type: T(x) gives x the type T if x has T's
+// representation, converts between numeric types, or formats an integer
+// as a string
+func (e *Evaluator) convert(n *ast.FunctionCall, typ *TypeValue, args []Value) Value {
+	if len(args) != 1 {
+		return e.newError(n.Position, ErrWrongArgCount,
+			"conversion to %s takes one value, got %d", typ.Name, len(args))
+	}
+	value := unwrapNamed(args[0])
+	target := e.representation(typ)
+
+	switch {
+	case target == "bigint":
+		converted, ok := toBigInt(value)
+		if str, isString := value.(*StringValue); !ok && isString {
+			return e.newError(n.Position, ErrTypeMismatch, "cannot convert %q to %s", str.Value, typ.Name)
+		}
+		if !ok {
+			return e.newError(n.Position, ErrTypeMismatch,
+				"cannot convert %s to %s", strings.ToLower(getValueType(args[0])), typ.Name)
+		}
+		value = converted
+	case target == "string" && (value.Type() == INTEGER_TYPE || value.Type() == BIGINT_TYPE):
+		value = &StringValue{Value: value.String()}
+	case ast.IsIntTypeName(target) && (value.Type() == INTEGER_TYPE || value.Type() == FLOAT_TYPE || value.Type() == BIGINT_TYPE):
+		value = toIntType(target, value)
+	case target == "int" && value.Type() == BIGINT_TYPE:
+		value = bigToInt(value.(*BigIntValue))
+		if isError(value) {
+			return e.located(n.Position, value)
+		}
+	case target == "float" && value.Type() == BIGINT_TYPE:
+		f, _ := new(big.Float).SetInt(value.(*BigIntValue).Value).Float64()
+		value = &FloatValue{Value: f}
+	case target == "int" && value.Type() == INTEGER_TYPE:
+		value = &IntegerValue{Value: value.(*IntegerValue).Value}
+	case target == "int" && value.Type() == FLOAT_TYPE:
+		value = &IntegerValue{Value: int64(value.(*FloatValue).Value)}
+	case target == "float" && value.Type() == INTEGER_TYPE:
+		value = &FloatValue{Value: intToFloat(value.(*IntegerValue))}
+	case !e.TypesCompatible(target, getValueType(value)):
+		return e.newError(n.Position, ErrTypeMismatch,
+			"cannot convert %s to %s", strings.ToLower(getValueType(args[0])), typ.Name)
+	}
+
+	if typ.Alias {
+		return value
+	}
+	return &NamedValue{TypeOf: typ, Value: value}
+}
+
+// representation returns the type string of the values a type holds,
+// following distinct types to the types they were declared with
+func (e *Evaluator) representation(typ *TypeValue) string {
+	for depth := 0; depth < 100; depth++ {
+		t := typ.Underlying
+		if t.StructName == "" {
+			break
+		}
+		next := e.lookupType(t.StructName)
+		if next == nil {
+			break
+		}
+		typ = next
+	}
+	return e.typeString(typ.Underlying)
+}
+
+// unwrapNamed returns the value a distinct type's value holds
+func unwrapNamed(v Value) Value {
+	if named, ok := v.(*NamedValue); ok {
+		return named.Value
+	}
+	return v
+}
+
+// namedOperation applies a binary operator where either operand has a
+// distinct type. Both must have the same type, or one a plain value of its
+// representation; arithmetic keeps the type.
+func namedOperation(n *ast.BinaryExpression, left, right Value, op binaryOpFn) Value {
+	leftNamed, _ := left.(*NamedValue)
+	rightNamed, _ := right.(*NamedValue)
+	typ := leftNamed
+	if typ == nil {
+		typ = rightNamed
+	}
+	if leftNamed != nil && rightNamed != nil && leftNamed.TypeOf != rightNamed.TypeOf {
+		return &Error{Code: ErrTypeMismatch, Message: fmt.Sprintf("mismatched types: %s %s %s",
+			leftNamed.TypeOf.Name, n.Operator, rightNamed.TypeOf.Name)}
+	}
+
+	result := applyOperator(n.Operator, unwrapNamed(left), unwrapNamed(right), op)
+	if isError(result) {
+		return result
+	}
+	switch n.Operator {
+	case "+", "-", "*", "/", "%", "&", "|", "^", "<<", ">>":
+		return &NamedValue{TypeOf: typ.TypeOf, Value: result}
+	}
+	return result
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"mars/ast"
+	"math/big"
 	"strings"
+	"sync"
 )
 
 // Type constants
@@ -21,6 +23,11 @@ const (
 	CONTINUE_TYPE = "CONTINUE"
 	ARRAY_TYPE    = "ARRAY"
 	STRUCT_TYPE   = "STRUCT"
+	MODULE_TYPE   = "MODULE"
+	CHAN_TYPE     = "CHAN"
+	TYPE_TYPE     = "TYPE"
+	NAMED_TYPE    = "NAMED"
+	BIGINT_TYPE   = "BIGINT"
 )
 
 // Value interface  all runtime values implement this
@@ -33,12 +40,28 @@ type Value interface {
 // IntegerValue represents integer values
 type IntegerValue struct {
 	Value int64
+	Kind  string // Sized type such as "u8", or "" for int; a u64 keeps its bits in Value
 }
 
-func (i *IntegerValue) Type() string   { return INTEGER_TYPE }
-func (i *IntegerValue) String() string { return fmt.Sprintf("%d", i.Value) }
+func (i *IntegerValue) Type() string { return INTEGER_TYPE }
+func (i *IntegerValue) String() string {
+	if i.Kind == "u64" {
+		return fmt.Sprintf("%d", uint64(i.Value))
+	}
+	return fmt.Sprintf("%d", i.Value)
+}
 func (i *IntegerValue) IsTruthy() bool { return i.Value != 0 }
 
+// BigIntValue represents arbitrary-precision integers. Operations return
+// new values and never modify Value.
+type BigIntValue struct {
+	Value *big.Int
+}
+
+func (b *BigIntValue) Type() string   { return BIGINT_TYPE }
+func (b *BigIntValue) String() string { return b.Value.String() }
+func (b *BigIntValue) IsTruthy() bool { return b.Value.Sign() != 0 }
+
 // BooleanValue represents boolean values
 type BooleanValue struct {
 	Value bool
@@ -76,6 +99,7 @@ func (n *NullValue) IsTruthy() bool { return false }
 // Error represents runtime errors
 type Error struct {
 	Message string
+	Code    string // Error code to report; an operator error without one becomes ErrTypeMismatch (E1001)
 }
 
 func (e *Error) Type() string   { return ERROR_TYPE }
@@ -110,6 +134,7 @@ type FunctionValue struct {
 	Body       *ast.BlockStatement
 	ReturnType *ast.Type
 	Env        *Environment // For closure support
+	Module     *ModuleValue // Module the function was declared in; nil for the entry program
 	Position   ast.Position
 	IsBuiltin  bool                     // True if this is a builtin function
 	BuiltinFn  func(args []Value) Value // Builtin function implementation
@@ -138,34 +163,101 @@ func (fv *FunctionValue) IsTruthy() bool {
 	return true
 }
 
-// ArrayValue represents array values
+// ArrayValue represents array values. Arrays are shared by every variable,
+// and every task, holding them, so once an array may be reachable from
+// another task its elements are only accessed under mu, through the
+// methods below.
 type ArrayValue struct {
+	mu       sync.RWMutex
 	Elements []Value
 }
 
 func (a *ArrayValue) Type() string { return ARRAY_TYPE }
 func (a *ArrayValue) String() string {
 	var elements []string
-	for _, elem := range a.Elements {
+	for _, elem := range a.elements() {
 		elements = append(elements, elem.String())
 	}
 	return "[" + strings.Join(elements, ", ") + "]"
 }
-func (a *ArrayValue) IsTruthy() bool { return len(a.Elements) > 0 }
+func (a *ArrayValue) IsTruthy() bool { return a.length() > 0 }
+
+// elements returns a copy of the array's elements
+func (a *ArrayValue) elements() []Value {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Value(nil), a.Elements...)
+}
+
+// length returns the number of elements in the array
+func (a *ArrayValue) length() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.Elements)
+}
 
-// StructValue represents a struct instance at runtime
+// get returns the element at i, or false if i is out of bounds
+func (a *ArrayValue) get(i int64) (Value, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if i < 0 || i >= int64(len(a.Elements)) {
+		return nil, false
+	}
+	return a.Elements[i], true
+}
+
+// set replaces the element at i, or returns false if i is out of bounds
+func (a *ArrayValue) set(i int64, v Value) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if i < 0 || i >= int64(len(a.Elements)) {
+		return false
+	}
+	a.Elements[i] = v
+	return true
+}
+
+// StructValue represents a struct instance at runtime. Like arrays,
+// structs are shared, so their fields are accessed under mu.
 type StructValue struct {
+	mu       sync.RWMutex
 	TypeName string
 	Fields   map[string]Value
 }
 
+// fields returns a copy of the struct's fields
+func (s *StructValue) fields() map[string]Value {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fields := make(map[string]Value, len(s.Fields))
+	for name, v := range s.Fields {
+		fields[name] = v
+	}
+	return fields
+}
+
+// field returns the value of the named field, or false if there's none
+func (s *StructValue) field(name string) (Value, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.Fields[name]
+	return v, ok
+}
+
+// setField sets the named field, which must exist
+func (s *StructValue) setField(name string, v Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Fields[name] = v
+}
+
 func (s *StructValue) Type() string { return STRUCT_TYPE }
 func (s *StructValue) String() string {
 	var b bytes.Buffer
 	b.WriteString(s.TypeName)
 	b.WriteString("{")
 	first := true
-	for k, v := range s.Fields {
+	for k, v := range s.fields() {
 		if !first {
 			b.WriteString(", ")
 		}
@@ -179,6 +271,59 @@ func (s *StructValue) String() string {
 }
 func (s *StructValue) IsTruthy() bool { return true }
 
+// ModuleValue is an imported module's namespace, the environment its top
+// level ran in
+type ModuleValue struct {
+	Path   string // import path
+	Name   string // name the module is bound to by import
+	Env    *Environment
+	Public map[string]bool // top-level names declared with 'pub'
+}
+
+func (m *ModuleValue) Type() string   { return MODULE_TYPE }
+func (m *ModuleValue) String() string { return fmt.Sprintf("module %q", m.Path) }
+func (m *ModuleValue) IsTruthy() bool { return true }
+
+// ChanValue is a channel that tasks send values of ElemType through. Its
+// state is guarded by the scheduler of the evaluator that created it.
+type ChanValue struct {
+	ElemType *ast.Type
+	Capacity int // 0 for an unbuffered channel
+	sched    *scheduler
+	queue    []Value // values sent but not yet received
+	closed   bool
+	sent     int // values sent so far, numbering unbuffered sends
+	received int // values received so far
+	waiting  int // tasks blocked receiving, so an unbuffered send in a select can proceed
+}
+
+func (c *ChanValue) Type() string   { return CHAN_TYPE }
+func (c *ChanValue) String() string { return "chan[" + getTypeString(c.ElemType) + "]" }
+func (c *ChanValue) IsTruthy() bool { return true }
+
+// TypeValue is a type declared with 'type', or a base type, bound to its
+// name so that calling it converts a value: Meters(5), int(d)
+type TypeValue struct {
+	Name       string
+	Underlying *ast.Type // the aliased or underlying type
+	Alias      bool      // aliases and base types convert to plain values
+}
+
+func (t *TypeValue) Type() string   { return TYPE_TYPE }
+func (t *TypeValue) String() string { return "type " + t.Name }
+func (t *TypeValue) IsTruthy() bool { return true }
+
+// NamedValue is a value of a distinct type. It prints and tests like the
+// value it wraps, but only matches its own type.
+type NamedValue struct {
+	TypeOf *TypeValue
+	Value  Value
+}
+
+func (n *NamedValue) Type() string   { return NAMED_TYPE }
+func (n *NamedValue) String() string { return n.Value.String() }
+func (n *NamedValue) IsTruthy() bool { return n.Value.IsTruthy() }
+
 func (i *BreakValue) Type() string   { return BREAK_TYPE }
 func (i *BreakValue) String() string { return fmt.Sprintf("%d", i.Value) }
 func (i *BreakValue) IsTruthy() bool { return false }
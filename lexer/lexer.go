@@ -33,6 +33,7 @@ func (l *Lexer) readChar() {
 
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // EOF
+		l.position = len(l.input)
 	} else {
 		r, size := utf8.DecodeRuneInString(l.input[l.readPosition:])
 		l.ch = r
@@ -58,6 +59,13 @@ func (l *Lexer) peekChar() rune {
 
 // NextToken returns the next token from the input
 func (l *Lexer) NextToken() Token {
+	tok := l.scan()
+	tok.EndLine, tok.EndColumn = l.line, l.column
+	return tok
+}
+
+// scan reads the next token, leaving the lexer on the character after it
+func (l *Lexer) scan() Token {
 	var tok Token
 
 	l.skipWhitespace()
@@ -97,6 +105,11 @@ func (l *Lexer) NextToken() Token {
 			l.readChar()
 			tok.Type = LTEQ
 			tok.Literal = string(ch) + string(l.ch)
+		} else if l.peekChar() == '<' {
+			ch := l.ch
+			l.readChar()
+			tok.Type = SHL
+			tok.Literal = string(ch) + string(l.ch)
 		} else {
 			tok.Type = LT
 			tok.Literal = string(l.ch)
@@ -109,6 +122,11 @@ func (l *Lexer) NextToken() Token {
 			l.readChar()
 			tok.Type = GTEQ
 			tok.Literal = string(ch) + string(l.ch)
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok.Type = SHR
+			tok.Literal = string(ch) + string(l.ch)
 		} else {
 			tok.Type = GT
 			tok.Literal = string(l.ch)
@@ -122,7 +140,7 @@ func (l *Lexer) NextToken() Token {
 			tok.Type = AND
 			tok.Literal = string(ch) + string(l.ch)
 		} else {
-			tok.Type = ILLEGAL
+			tok.Type = AMP
 			tok.Literal = string(l.ch)
 		}
 		l.readChar()
@@ -134,11 +152,16 @@ func (l *Lexer) NextToken() Token {
 			tok.Type = OR
 			tok.Literal = string(ch) + string(l.ch)
 		} else {
-			tok.Type = ILLEGAL
+			tok.Type = PIPE
 			tok.Literal = string(l.ch)
 		}
 		l.readChar()
 		return tok
+	case '^':
+		tok.Type = CARET
+		tok.Literal = string(l.ch)
+		l.readChar()
+		return tok
 	case '+':
 		tok.Type = PLUS
 		tok.Literal = string(l.ch)
@@ -227,16 +250,17 @@ func (l *Lexer) NextToken() Token {
 			l.readChar()
 			tok.Type = COLONEQ
 			tok.Literal = string(ch) + string(l.ch)
-			tok.Line = l.line
-			tok.Column = l.column
 		} else {
 			tok.Type = COLON
 			tok.Literal = string(l.ch)
-			tok.Line = l.line
-			tok.Column = l.column
 		}
 		l.readChar()
 		return tok
+	case '?':
+		tok.Type = QUESTION
+		tok.Literal = string(l.ch)
+		l.readChar()
+		return tok
 	case ';':
 		tok.Type = SEMICOLON
 		tok.Literal = string(l.ch)
@@ -252,7 +276,7 @@ func (l *Lexer) NextToken() Token {
 		tok.Literal = ""
 		return tok
 	default:
-		if isLetter(l.ch) {
+		if isLetter(l.ch) || l.ch == '_' {
 			tok.Literal = l.readIdentifier()
 			tok.Type = LookupIdent(tok.Literal)
 			return tok
@@ -294,22 +318,47 @@ func (l *Lexer) readIdentifier() string {
 	return string(identifier)
 }
 
-// readNumber reads a number literal
+// readNumber reads a number literal: a decimal int or float, or an int
+// with a 0x, 0b or 0o prefix. Digits may be separated by single
+// underscores, as in 1_000_000; the parser drops them.
 func (l *Lexer) readNumber() string {
 	var number []rune
 
-	for isDigit(l.ch) {
+	isBaseDigit := isDigit
+	prefixed := true
+	switch {
+	case l.ch != '0':
+		prefixed = false
+	case l.peekChar() == 'x' || l.peekChar() == 'X':
+		isBaseDigit = isHexDigit
+	case l.peekChar() == 'b' || l.peekChar() == 'B':
+		isBaseDigit = func(ch rune) bool { return ch == '0' || ch == '1' }
+	case l.peekChar() == 'o' || l.peekChar() == 'O':
+		isBaseDigit = func(ch rune) bool { return ch >= '0' && ch <= '7' }
+	default:
+		prefixed = false
+	}
+	readDigits := func() {
+		for isBaseDigit(l.ch) || (l.ch == '_' && isBaseDigit(l.peekChar())) {
+			number = append(number, l.ch)
+			l.readChar()
+		}
+	}
+
+	if prefixed {
 		number = append(number, l.ch)
 		l.readChar()
+		number = append(number, l.ch)
+		l.readChar()
+		readDigits()
+		return string(number)
 	}
 
+	readDigits()
 	if l.ch == '.' && isDigit(l.peekChar()) {
 		number = append(number, l.ch)
 		l.readChar()
-		for isDigit(l.ch) {
-			number = append(number, l.ch)
-			l.readChar()
-		}
+		readDigits()
 	}
 
 	return string(number)
@@ -344,6 +393,10 @@ func isDigit(ch rune) bool {
 	return unicode.IsDigit(ch)
 }
 
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
 // readBlockComment reads a block comment /* ... */
 func (l *Lexer) readBlockComment() string {
 	position := l.position
@@ -370,11 +423,7 @@ func (l *Lexer) readBlockComment() string {
 			l.readChar() // Skip '*'
 			l.readChar() // Skip '/'
 		} else {
-			// Track newlines in comments
-			if l.ch == '\n' {
-				l.line++
-				l.column = 0
-			}
+			// readChar tracks line and column, including newlines inside comments
 			l.readChar()
 		}
 	}
@@ -40,7 +40,7 @@ func TestNextToken(t *testing.T) {
 	}{
 		{MUT, "mut", 2, 3},
 		{IDENT, "x", 2, 7},
-		{COLONEQ, ":=", 2, 10},
+		{COLONEQ, ":=", 2, 9},
 		{NUMBER, "42", 2, 12},
 		{SEMICOLON, ";", 2, 14},
 		{COMMENT, "/* This is a block comment */", 3, 3},
@@ -65,69 +65,69 @@ func TestNextToken(t *testing.T) {
 		{SEMICOLON, ";", 5, 16},
 		{RBRACE, "}", 6, 3},
 		{COMMENT, "/* This is a\n\t\t   multi-line\n\t\t   block comment */", 7, 3},
-		{STRUCT, "struct", 12, 3},
-		{IDENT, "Point", 12, 10},
-		{LBRACE, "{", 12, 16},
-		{IDENT, "x", 13, 4},
-		{COLON, ":", 13, 5},
-		{INT, "int", 13, 7},
-		{SEMICOLON, ";", 13, 10},
-		{IDENT, "y", 14, 4},
-		{COLON, ":", 14, 5},
-		{INT, "int", 14, 7},
-		{SEMICOLON, ";", 14, 10},
-		{RBRACE, "}", 15, 3},
-		{COMMENT, "/* This is a /* nested */ block comment */", 16, 3},
-		{UNSAFE, "unsafe", 17, 3},
-		{LBRACE, "{", 17, 10},
-		{IDENT, "var", 18, 4},
-		{IDENT, "p", 18, 8},
-		{COLON, ":", 18, 9},
-		{ASTERISK, "*", 18, 11},
-		{IDENT, "Point", 18, 12},
-		{SEMICOLON, ";", 18, 17},
-		{RBRACE, "}", 19, 3},
-		{IF, "if", 20, 3},
-		{IDENT, "x", 20, 6},
-		{GT, ">", 20, 8},
-		{NUMBER, "0", 20, 10},
-		{LBRACE, "{", 20, 12},
+		{STRUCT, "struct", 10, 3},
+		{IDENT, "Point", 10, 10},
+		{LBRACE, "{", 10, 16},
+		{IDENT, "x", 11, 4},
+		{COLON, ":", 11, 5},
+		{INT, "int", 11, 7},
+		{SEMICOLON, ";", 11, 10},
+		{IDENT, "y", 12, 4},
+		{COLON, ":", 12, 5},
+		{INT, "int", 12, 7},
+		{SEMICOLON, ";", 12, 10},
+		{RBRACE, "}", 13, 3},
+		{COMMENT, "/* This is a /* nested */ block comment */", 14, 3},
+		{UNSAFE, "unsafe", 15, 3},
+		{LBRACE, "{", 15, 10},
+		{IDENT, "var", 16, 4},
+		{IDENT, "p", 16, 8},
+		{COLON, ":", 16, 9},
+		{ASTERISK, "*", 16, 11},
+		{IDENT, "Point", 16, 12},
+		{SEMICOLON, ";", 16, 17},
+		{RBRACE, "}", 17, 3},
+		{IF, "if", 18, 3},
+		{IDENT, "x", 18, 6},
+		{GT, ">", 18, 8},
+		{NUMBER, "0", 18, 10},
+		{LBRACE, "{", 18, 12},
+		{LOG, "log", 19, 4},
+		{LPAREN, "(", 19, 7},
+		{STRING, "positive", 19, 8},
+		{RPAREN, ")", 19, 18},
+		{SEMICOLON, ";", 19, 19},
+		{RBRACE, "}", 20, 3},
+		{ELSE, "else", 20, 5},
+		{LBRACE, "{", 20, 10},
 		{LOG, "log", 21, 4},
 		{LPAREN, "(", 21, 7},
-		{STRING, "positive", 21, 8},
+		{STRING, "negative", 21, 8},
 		{RPAREN, ")", 21, 18},
 		{SEMICOLON, ";", 21, 19},
 		{RBRACE, "}", 22, 3},
-		{ELSE, "else", 22, 5},
-		{LBRACE, "{", 22, 10},
-		{LOG, "log", 23, 4},
-		{LPAREN, "(", 23, 7},
-		{STRING, "negative", 23, 8},
-		{RPAREN, ")", 23, 18},
-		{SEMICOLON, ";", 23, 19},
-		{RBRACE, "}", 24, 3},
-		{FOR, "for", 25, 3},
-		{IDENT, "i", 25, 7},
-		{COLONEQ, ":=", 25, 10},
-		{NUMBER, "0", 25, 12},
-		{SEMICOLON, ";", 25, 13},
-		{IDENT, "i", 25, 15},
-		{LT, "<", 25, 17},
-		{NUMBER, "10", 25, 19},
-		{SEMICOLON, ";", 25, 21},
-		{IDENT, "i", 25, 23},
-		{EQ, "=", 25, 25},
-		{IDENT, "i", 25, 27},
-		{PLUS, "+", 25, 29},
-		{NUMBER, "1", 25, 31},
-		{LBRACE, "{", 25, 33},
-		{LOG, "log", 26, 4},
-		{LPAREN, "(", 26, 7},
-		{IDENT, "i", 26, 8},
-		{RPAREN, ")", 26, 9},
-		{SEMICOLON, ";", 26, 10},
-		{RBRACE, "}", 27, 3},
-		{EOF, "", 28, 2},
+		{FOR, "for", 23, 3},
+		{IDENT, "i", 23, 7},
+		{COLONEQ, ":=", 23, 9},
+		{NUMBER, "0", 23, 12},
+		{SEMICOLON, ";", 23, 13},
+		{IDENT, "i", 23, 15},
+		{LT, "<", 23, 17},
+		{NUMBER, "10", 23, 19},
+		{SEMICOLON, ";", 23, 21},
+		{IDENT, "i", 23, 23},
+		{EQ, "=", 23, 25},
+		{IDENT, "i", 23, 27},
+		{PLUS, "+", 23, 29},
+		{NUMBER, "1", 23, 31},
+		{LBRACE, "{", 23, 33},
+		{LOG, "log", 24, 4},
+		{LPAREN, "(", 24, 7},
+		{IDENT, "i", 24, 8},
+		{RPAREN, ")", 24, 9},
+		{SEMICOLON, ";", 24, 10},
+		{RBRACE, "}", 25, 3},
+		{EOF, "", 26, 2},
 	}
 
 	l := New(input)
@@ -156,3 +156,105 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestCommentAtEndOfInput(t *testing.T) {
+	tests := []struct {
+		input       string
+		literal     string
+		nextLine    int
+		nextLiteral string
+	}{
+		{"// last line", "// last line", 1, ""},
+		{"/* a\nb\nc */\nx", "/* a\nb\nc */", 4, "x"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != COMMENT || tok.Literal != tt.literal {
+			t.Errorf("expected comment %q, got %v %q", tt.literal, tok.Type, tok.Literal)
+		}
+		next := l.NextToken()
+		if next.Line != tt.nextLine || next.Literal != tt.nextLiteral {
+			t.Errorf("expected %q on line %d after comment, got %q on line %d",
+				tt.nextLiteral, tt.nextLine, next.Literal, next.Line)
+		}
+	}
+}
+
+func TestBitwiseOperatorsAndNumberLiterals(t *testing.T) {
+	input := `a & b | c ^ d << 2 >> 1 && e || f <= g >= h
+0xFF 0b1010 0o17 1_000_000 0x_dead_BEEF 3.141_5 1_`
+
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{IDENT, "a"}, {AMP, "&"}, {IDENT, "b"}, {PIPE, "|"}, {IDENT, "c"},
+		{CARET, "^"}, {IDENT, "d"}, {SHL, "<<"}, {NUMBER, "2"}, {SHR, ">>"},
+		{NUMBER, "1"}, {AND, "&&"}, {IDENT, "e"}, {OR, "||"}, {IDENT, "f"},
+		{LTEQ, "<="}, {IDENT, "g"}, {GTEQ, ">="}, {IDENT, "h"},
+		{NUMBER, "0xFF"}, {NUMBER, "0b1010"}, {NUMBER, "0o17"},
+		{NUMBER, "1_000_000"}, {NUMBER, "0x_dead_BEEF"}, {NUMBER, "3.141_5"},
+		// A separator must sit between two digits; a trailing one starts a name
+		{NUMBER, "1"}, {IDENT, "_"},
+		{EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %v %q, got %v %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestOptionalType(t *testing.T) {
+	input := `x: ?int = nil;`
+
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{IDENT, "x"}, {COLON, ":"}, {QUESTION, "?"}, {INT, "int"},
+		{EQ, "="}, {NIL, "nil"}, {SEMICOLON, ";"}, {EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %v %q, got %v %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestTokenEnd(t *testing.T) {
+	input := "x := \"hi\";\n// note\ny >= 10"
+
+	tests := []struct {
+		expectedLiteral string
+		line, column    int
+		endLine, endCol int
+	}{
+		{"x", 1, 1, 1, 2}, {":=", 1, 3, 1, 5}, {"hi", 1, 6, 1, 10}, {";", 1, 10, 1, 11},
+		{"y", 3, 1, 3, 2}, {">=", 3, 3, 3, 5}, {"10", 3, 6, 3, 8},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type == COMMENT {
+			tok = l.NextToken()
+		}
+		if tok.Literal != tt.expectedLiteral || tok.Line != tt.line || tok.Column != tt.column ||
+			tok.EndLine != tt.endLine || tok.EndColumn != tt.endCol {
+			t.Fatalf("tests[%d] - expected %q at %d:%d-%d:%d, got %q at %d:%d-%d:%d", i,
+				tt.expectedLiteral, tt.line, tt.column, tt.endLine, tt.endCol,
+				tok.Literal, tok.Line, tok.Column, tok.EndLine, tok.EndColumn)
+		}
+	}
+}
@@ -31,6 +31,14 @@ const (
 	BREAK
 	CONTINUE
 	WHILE
+	IMPORT
+	PUB
+	SPAWN
+	CHAN
+	SELECT
+	CASE
+	DEFAULT
+	CONST
 
 	// Type keywords (needed for parser)
 	INT       // int
@@ -59,6 +67,11 @@ const (
 	GTEQ     // >=
 	AND      // &&
 	OR       // ||
+	AMP      // &
+	PIPE     // |
+	CARET    // ^
+	SHL      // <<
+	SHR      // >>
 
 	// Delimiters
 	LPAREN    // (
@@ -72,6 +85,7 @@ const (
 	COLON     // :
 	SEMICOLON // ;
 	ARROW     // ->
+	QUESTION  // ?, for optional types
 )
 
 // Token represents a lexical token
@@ -80,6 +94,10 @@ type Token struct {
 	Literal string
 	Line    int
 	Column  int
+	// EndLine and EndColumn locate the character just past the token, so
+	// a token on one line covers columns Column to EndColumn-1
+	EndLine   int
+	EndColumn int
 }
 
 // keywords maps string keywords to their corresponding token types
@@ -99,6 +117,14 @@ var keywords = map[string]TokenType{
 	"break":    BREAK,
 	"continue": CONTINUE,
 	"while":    WHILE,
+	"import":   IMPORT,
+	"pub":      PUB,
+	"spawn":    SPAWN,
+	"chan":     CHAN,
+	"select":   SELECT,
+	"case":     CASE,
+	"default":  DEFAULT,
+	"const":    CONST,
 
 	// Type keywords (these are essential for the parser)
 	"int":    INT,
@@ -111,6 +137,13 @@ var keywords = map[string]TokenType{
 	"type": TYPE,
 }
 
+// ValueKeywords returns the keywords that can stand where a name is used
+// in an expression: the literals true, false and nil, and the types that
+// convert values, as in int(x)
+func ValueKeywords() []string {
+	return []string{"bool", "false", "float", "int", "nil", "string", "true"}
+}
+
 // LookupIdent checks if the given identifier is a keyword
 func LookupIdent(ident string) TokenType {
 	if tok, ok := keywords[ident]; ok {
@@ -164,6 +197,22 @@ func (t TokenType) String() string {
 		return "CONTINUE"
 	case WHILE:
 		return "WHILE"
+	case IMPORT:
+		return "IMPORT"
+	case PUB:
+		return "PUB"
+	case SPAWN:
+		return "SPAWN"
+	case CHAN:
+		return "CHAN"
+	case SELECT:
+		return "SELECT"
+	case CASE:
+		return "CASE"
+	case DEFAULT:
+		return "DEFAULT"
+	case CONST:
+		return "CONST"
 	case INT:
 		return "INT"
 	case FLOAT:
@@ -208,6 +257,16 @@ func (t TokenType) String() string {
 		return "AND"
 	case OR:
 		return "OR"
+	case AMP:
+		return "AMP"
+	case PIPE:
+		return "PIPE"
+	case CARET:
+		return "CARET"
+	case SHL:
+		return "SHL"
+	case SHR:
+		return "SHR"
 	case LPAREN:
 		return "LPAREN"
 	case RPAREN:
@@ -230,6 +289,8 @@ func (t TokenType) String() string {
 		return "SEMICOLON"
 	case ARROW:
 		return "ARROW"
+	case QUESTION:
+		return "QUESTION"
 	default:
 		return "UNKNOWN"
 	}
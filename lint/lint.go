@@ -0,0 +1,245 @@
+// lint/lint.go
+package lint
+
+import (
+	"fmt"
+	"mars/ast"
+	"mars/lexer"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Severity is how a rule's findings are reported
+type Severity int
+
+const (
+	Off Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Off:
+		return "off"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseSeverity reads a severity as written in mars.toml
+func ParseSeverity(s string) (Severity, error) {
+	switch s {
+	case "off":
+		return Off, nil
+	case "warning":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	}
+	return Off, fmt.Errorf("invalid severity %q (want off, warning or error)", s)
+}
+
+// Rule is a check 'mars lint' runs over a program's AST
+type Rule struct {
+	ID          string
+	Description string
+	Severity    Severity // used unless the configuration overrides it
+	check       func(l *linter, program *ast.Program)
+}
+
+// Finding is a problem a rule found
+type Finding struct {
+	Rule     string
+	Severity Severity
+	Position ast.Position
+	Message  string
+	Help     string
+}
+
+// DefaultMaxFunctionLines is the length above which long-function reports a
+// function, unless configured with max-lines
+const DefaultMaxFunctionLines = 60
+
+// Rules returns every lint rule, in the order they are documented
+func Rules() []*Rule {
+	return rules
+}
+
+// rules is filled in by init, since the checks refer back to the rules
+var rules []*Rule
+
+func init() {
+	rules = []*Rule{
+		{ID: "shadow", Severity: Warning, check: checkShadow,
+			Description: "a local declaration hides a variable, parameter, constant or function of an enclosing scope"},
+		{ID: "bool-compare", Severity: Warning, check: checkBoolCompare,
+			Description: "a value is compared with true or false, as in x == true"},
+		{ID: "constant-condition", Severity: Warning, check: checkConstantCondition,
+			Description: "an if or while condition is always true or always false; while true is allowed"},
+		{ID: "self-assign", Severity: Warning, check: checkSelfAssign,
+			Description: "a variable, element or field is assigned to itself"},
+		{ID: "empty-block", Severity: Warning, check: checkEmptyBlock,
+			Description: "an if, else, loop or unsafe block has no statements and no comment"},
+		{ID: "long-function", Severity: Warning, check: checkLongFunction,
+			Description: "a function is longer than max-lines lines (default 60)"},
+	}
+}
+
+// findRule returns the rule with the given ID, or nil if there is none
+func findRule(id string) *Rule {
+	for _, rule := range rules {
+		if rule.ID == id {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Config selects the severity of each rule and their options
+type Config struct {
+	severities       map[string]Severity
+	MaxFunctionLines int
+}
+
+// DefaultConfig returns the configuration used without a [lint] table
+func DefaultConfig() *Config {
+	return &Config{
+		severities:       make(map[string]Severity),
+		MaxFunctionLines: DefaultMaxFunctionLines,
+	}
+}
+
+// Severity returns the severity the rule with the given ID is reported at
+func (c *Config) Severity(id string) Severity {
+	if severity, ok := c.severities[id]; ok {
+		return severity
+	}
+	if rule := findRule(id); rule != nil {
+		return rule.Severity
+	}
+	return Off
+}
+
+// Set configures a rule from the options of its mars.toml entry: severity,
+// and max-lines for long-function
+func (c *Config) Set(id string, options map[string]string) error {
+	if findRule(id) == nil {
+		return fmt.Errorf("unknown lint rule %q", id)
+	}
+	for key, value := range options {
+		switch {
+		case key == "severity":
+			severity, err := ParseSeverity(value)
+			if err != nil {
+				return fmt.Errorf("rule %q: %v", id, err)
+			}
+			c.severities[id] = severity
+		case key == "max-lines" && id == "long-function":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("rule %q: max-lines must be a positive number, got %q", id, value)
+			}
+			c.MaxFunctionLines = n
+		default:
+			return fmt.Errorf("rule %q has no option %q", id, key)
+		}
+	}
+	return nil
+}
+
+// linter collects the findings of one run over a program
+type linter struct {
+	config   *Config
+	comments ast.CommentMap
+	rule     *Rule // the rule being checked
+	findings []Finding
+}
+
+func (l *linter) report(pos ast.Position, message, help string) {
+	l.findings = append(l.findings, Finding{
+		Rule:     l.rule.ID,
+		Severity: l.config.Severity(l.rule.ID),
+		Position: pos,
+		Message:  message,
+		Help:     help,
+	})
+}
+
+// Lint runs the enabled rules over program, parsed from source, and returns
+// their findings in source order. Findings are suppressed by a
+// "// mars:ignore RULE" comment at the end of their line or alone on the
+// line above; several rules may be listed, separated by commas or spaces.
+func Lint(program *ast.Program, source string, config *Config) []Finding {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	l := &linter{config: config, comments: program.Comments}
+	for _, rule := range rules {
+		if config.Severity(rule.ID) == Off {
+			continue
+		}
+		l.rule = rule
+		rule.check(l, program)
+	}
+
+	ignored := ignoreComments(source)
+	var findings []Finding
+	for _, f := range l.findings {
+		if !ignored[f.Position.Line][f.Rule] {
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i].Position, findings[j].Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return findings
+}
+
+// ignoreComments returns the rules each line's findings are exempt from,
+// read from the mars:ignore comments in source
+func ignoreComments(source string) map[int]map[string]bool {
+	lines := strings.Split(source, "\n")
+	ignored := make(map[int]map[string]bool)
+	for _, tok := range lexer.New(source).Tokens() {
+		if tok.Type != lexer.COMMENT {
+			continue
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(tok.Literal, "//"))
+		text, ok := strings.CutPrefix(text, "mars:ignore")
+		if !ok {
+			continue
+		}
+
+		// A comment alone on its line applies to the next line
+		line := tok.Line
+		if line <= len(lines) && tok.Column > 0 && strings.TrimSpace(prefix(lines[line-1], tok.Column-1)) == "" {
+			line++
+		}
+		if ignored[line] == nil {
+			ignored[line] = make(map[string]bool)
+		}
+		for _, id := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			ignored[line][id] = true
+		}
+	}
+	return ignored
+}
+
+// prefix returns the first n runes of line, or all of it if it is shorter
+func prefix(line string, n int) string {
+	runes := []rune(line)
+	if n > len(runes) {
+		n = len(runes)
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,182 @@
+package lint
+
+import (
+	"fmt"
+	"mars/lexer"
+	"mars/parser"
+	"strings"
+	"testing"
+)
+
+// lintSource parses input and lints it with config, failing on parse errors
+func lintSource(t *testing.T, input string, config *Config) []Finding {
+	t.Helper()
+	p := parser.NewParserWithSource(lexer.New(input), strings.Split(input, "\n"))
+	program := p.ParseProgram()
+	if errs := p.GetErrors(); errs != nil && errs.HasErrors() {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	return Lint(program, input, config)
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string // "rule:line: message" of each finding
+	}{
+		{
+			name: "shadowed variable and parameter",
+			input: `x := 1;
+func f(n: int) -> int {
+    x := 2;
+    if n > 0 {
+        n := 3;
+        return n + x;
+    }
+    return x;
+}`,
+			want: []string{
+				"shadow:3: variable 'x' shadows the variable declared on line 1",
+				"shadow:5: variable 'n' shadows the parameter declared on line 2",
+			},
+		},
+		{
+			name: "shadowing in for and select",
+			input: `func f(ch: chan[int]) {
+    i := 0;
+    for i := 0; i < 3; i = i + 1 {
+        println(i);
+    }
+    select {
+    case ch := recv(ch) {
+        println(ch);
+    }
+    }
+    println(i);
+}`,
+			want: []string{
+				"shadow:3: variable 'i' shadows the variable declared on line 2",
+				"shadow:7: variable 'ch' shadows the parameter declared on line 1",
+			},
+		},
+		{
+			name:  "separate scopes don't shadow",
+			input: "func f() {\n    if true {\n        x := 1;\n        println(x);\n    }\n    x := 2;\n    println(x);\n}",
+			want:  []string{"constant-condition:2: if condition is always true"},
+		},
+		{
+			name:  "comparison with booleans",
+			input: "func f(ok: bool) {\n    if ok == true { println(1); }\n    if false != ok { println(2); }\n}",
+			want: []string{
+				"bool-compare:2: comparison with true is redundant",
+				"bool-compare:3: comparison with false is redundant",
+			},
+		},
+		{
+			name:  "constant conditions",
+			input: "func f() {\n    if 1 > 2 { println(1); }\n    while !true && false { println(2); }\n    while true { break; }\n    while 1 == 1 { break; }\n}",
+			want: []string{
+				"constant-condition:2: if condition is always false",
+				"constant-condition:3: while condition is always false",
+				"constant-condition:5: while condition is always true",
+			},
+		},
+		{
+			name:  "self-assignment",
+			input: "mut x := 1;\nx = x;\nmut xs := [1, 2];\nxs[0] = xs[0];\nxs[0] = xs[1];",
+			want: []string{
+				"self-assign:2: 'x' is assigned to itself",
+				"self-assign:4: 'xs[0]' is assigned to itself",
+			},
+		},
+		{
+			name: "empty blocks",
+			input: `func f(x: int) {
+    if x > 0 {
+    } else {
+        // nothing to do for negatives
+    }
+    while x > 0 {}
+}
+func g() {}`,
+			want: []string{
+				"empty-block:2: empty if block",
+				"empty-block:6: empty while body",
+			},
+		},
+		{
+			name:  "ignore comments",
+			input: "mut x := 1;\nx = x; // mars:ignore self-assign\n// mars:ignore self-assign, bool-compare\nx = x;\nx = x; // mars:ignore shadow\nx = x;",
+			want: []string{
+				"self-assign:5: 'x' is assigned to itself",
+				"self-assign:6: 'x' is assigned to itself",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := lintSource(t, tt.input, nil)
+			var got []string
+			for _, f := range findings {
+				got = append(got, fmt.Sprintf("%s:%d: %s", f.Rule, f.Position.Line, f.Message))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestLongFunction(t *testing.T) {
+	body := strings.Repeat("    println(1);\n", 8)
+	input := "func f() {\n" + body + "}\n"
+
+	config := DefaultConfig()
+	if findings := lintSource(t, input, config); len(findings) != 0 {
+		t.Fatalf("expected no findings with the default maximum, got %v", findings)
+	}
+
+	if err := config.Set("long-function", map[string]string{"max-lines": "5", "severity": "error"}); err != nil {
+		t.Fatal(err)
+	}
+	findings := lintSource(t, input, config)
+	if len(findings) != 1 {
+		t.Fatalf("expected 1 finding, got %v", findings)
+	}
+	f := findings[0]
+	if f.Rule != "long-function" || f.Severity != Error || f.Message != "function 'f' is 10 lines long (max 5)" {
+		t.Errorf("unexpected finding %+v", f)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	config := DefaultConfig()
+	if err := config.Set("self-assign", map[string]string{"severity": "off"}); err != nil {
+		t.Fatal(err)
+	}
+	if findings := lintSource(t, "mut x := 1;\nx = x;", config); len(findings) != 0 {
+		t.Errorf("expected a rule that is off to report nothing, got %v", findings)
+	}
+	if config.Severity("shadow") != Warning {
+		t.Errorf("expected shadow to keep its default severity, got %s", config.Severity("shadow"))
+	}
+
+	errs := []struct {
+		rule     string
+		options  map[string]string
+		contains string
+	}{
+		{"no-such-rule", map[string]string{"severity": "off"}, `unknown lint rule "no-such-rule"`},
+		{"shadow", map[string]string{"severity": "loud"}, `invalid severity "loud"`},
+		{"shadow", map[string]string{"max-lines": "10"}, `rule "shadow" has no option "max-lines"`},
+		{"long-function", map[string]string{"max-lines": "ten"}, "max-lines must be a positive number"},
+	}
+	for _, tt := range errs {
+		err := DefaultConfig().Set(tt.rule, tt.options)
+		if err == nil || !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("Set(%q, %v) = %v, want an error containing %q", tt.rule, tt.options, err, tt.contains)
+		}
+	}
+}
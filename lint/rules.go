@@ -0,0 +1,388 @@
+// lint/rules.go
+package lint
+
+import (
+	"fmt"
+	"mars/ast"
+)
+
+// declared is a name the shadow rule has seen declared
+type declared struct {
+	kind string // "variable", "parameter", "constant" or "function"
+	line int
+}
+
+// shadowWalker tracks the names declared in each enclosing scope
+type shadowWalker struct {
+	l      *linter
+	scopes []map[string]declared
+}
+
+func checkShadow(l *linter, program *ast.Program) {
+	w := &shadowWalker{l: l}
+	w.enter()
+	for _, decl := range program.Declarations {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			w.define(d.Name, "function")
+		case *ast.VarDecl:
+			w.define(d.Name, "variable")
+		case *ast.ConstDecl:
+			w.define(d.Name, "constant")
+		}
+	}
+
+	for _, decl := range program.Declarations {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			w.enter()
+			if d.Signature != nil {
+				for _, param := range d.Signature.Parameters {
+					w.define(param.Name, "parameter")
+				}
+			}
+			w.block(d.Body)
+			w.exit()
+		case *ast.UnsafeBlock:
+			w.block(d.Body)
+		case *ast.VarDecl, *ast.ConstDecl:
+			// Declared above
+		case ast.Statement:
+			w.stmt(d)
+		}
+	}
+}
+
+func (w *shadowWalker) enter() {
+	w.scopes = append(w.scopes, make(map[string]declared))
+}
+
+func (w *shadowWalker) exit() {
+	w.scopes = w.scopes[:len(w.scopes)-1]
+}
+
+func (w *shadowWalker) define(name *ast.Identifier, kind string) {
+	if name != nil {
+		w.scopes[len(w.scopes)-1][name.Name] = declared{kind: kind, line: name.Position.Line}
+	}
+}
+
+// declare defines a local name, reporting it if an enclosing scope already
+// has it. Redeclarations in the same scope are the analyzer's to report.
+func (w *shadowWalker) declare(name *ast.Identifier, kind string) {
+	if name == nil {
+		return
+	}
+	for i := len(w.scopes) - 2; i >= 0; i-- {
+		if outer, ok := w.scopes[i][name.Name]; ok {
+			w.l.report(name.Position,
+				fmt.Sprintf("%s '%s' shadows the %s declared on line %d", kind, name.Name, outer.kind, outer.line),
+				"rename one of them")
+			break
+		}
+	}
+	w.define(name, kind)
+}
+
+func (w *shadowWalker) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	w.enter()
+	for _, stmt := range block.Statements {
+		w.stmt(stmt)
+	}
+	w.exit()
+}
+
+func (w *shadowWalker) stmt(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.VarDecl:
+		w.declare(s.Name, "variable")
+	case *ast.ConstDecl:
+		w.declare(s.Name, "constant")
+	case *ast.BlockStatement:
+		w.block(s)
+	case *ast.IfStatement:
+		w.block(s.Consequence)
+		w.block(s.Alternative)
+	case *ast.ForStatement:
+		w.enter()
+		if s.Init != nil {
+			w.stmt(s.Init)
+		}
+		w.block(s.Body)
+		w.exit()
+	case *ast.WhileStatement:
+		w.block(s.Body)
+	case *ast.SelectStatement:
+		for _, c := range s.Cases {
+			w.enter()
+			w.declare(c.Name, "variable")
+			w.block(c.Body)
+			w.exit()
+		}
+		w.block(s.Default)
+	}
+}
+
+func checkBoolCompare(l *linter, program *ast.Program) {
+	ast.Inspect(program, func(n ast.Node) bool {
+		expr, ok := n.(*ast.BinaryExpression)
+		if !ok || (expr.Operator != "==" && expr.Operator != "!=") {
+			return true
+		}
+		value, other := boolLiteral(expr.Right), expr.Left
+		if value == nil {
+			value, other = boolLiteral(expr.Left), expr.Right
+		}
+		if value == nil || boolLiteral(other) != nil {
+			// Comparing two literals is a constant condition
+			return true
+		}
+
+		// x == true and x != false are x; the other two are !x
+		use := other.String()
+		if *value != (expr.Operator == "==") {
+			use = "!" + use
+		}
+		l.report(expr.Position,
+			fmt.Sprintf("comparison with %t is redundant", *value),
+			fmt.Sprintf("use '%s' instead", use))
+		return true
+	})
+}
+
+// boolLiteral returns the value of a true or false literal, or nil if expr
+// is something else
+func boolLiteral(expr ast.Expression) *bool {
+	if lit, ok := expr.(*ast.Literal); ok {
+		if b, ok := lit.Value.(bool); ok {
+			return &b
+		}
+	}
+	return nil
+}
+
+func checkConstantCondition(l *linter, program *ast.Program) {
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.IfStatement:
+			if value, ok := constantBool(s.Condition); ok {
+				help := "remove the if and keep the block"
+				if !value {
+					help = "remove the if and its block"
+				}
+				l.report(s.Position, fmt.Sprintf("if condition is always %t", value), help)
+			}
+		case *ast.WhileStatement:
+			// while true is how Mars writes an endless loop
+			if value, ok := constantBool(s.Condition); ok && (!value || boolLiteral(s.Condition) == nil) {
+				help := "write the endless loop as while true"
+				if !value {
+					help = "the loop never runs; remove it"
+				}
+				l.report(s.Position, fmt.Sprintf("while condition is always %t", value), help)
+			}
+		}
+		return true
+	})
+}
+
+// constantBool evaluates a condition built only from literals, reporting
+// whether it could
+func constantBool(expr ast.Expression) (bool, bool) {
+	switch e := expr.(type) {
+	case *ast.Literal:
+		b, ok := e.Value.(bool)
+		return b, ok
+	case *ast.UnaryExpression:
+		if e.Operator == "!" {
+			b, ok := constantBool(e.Right)
+			return !b, ok
+		}
+	case *ast.BinaryExpression:
+		switch e.Operator {
+		case "&&", "||":
+			left, ok := constantBool(e.Left)
+			if !ok {
+				return false, false
+			}
+			right, ok := constantBool(e.Right)
+			if !ok {
+				return false, false
+			}
+			if e.Operator == "&&" {
+				return left && right, true
+			}
+			return left || right, true
+		case "==", "!=", "<", "<=", ">", ">=":
+			left, ok := e.Left.(*ast.Literal)
+			if !ok {
+				return false, false
+			}
+			right, ok := e.Right.(*ast.Literal)
+			if !ok {
+				return false, false
+			}
+			return compareLiterals(left.Value, e.Operator, right.Value)
+		}
+	}
+	return false, false
+}
+
+// compareLiterals compares two literal values of the same kind
+func compareLiterals(a interface{}, op string, b interface{}) (bool, bool) {
+	var cmp int
+	switch x := a.(type) {
+	case int:
+		y, ok := b.(int)
+		if !ok {
+			return false, false
+		}
+		cmp = compare(x, y)
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return false, false
+		}
+		cmp = compare(x, y)
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return false, false
+		}
+		cmp = compare(x, y)
+	case bool:
+		y, ok := b.(bool)
+		if !ok || (op != "==" && op != "!=") {
+			return false, false
+		}
+		if x != y {
+			cmp = 1
+		}
+	default:
+		return false, false
+	}
+
+	switch op {
+	case "==":
+		return cmp == 0, true
+	case "!=":
+		return cmp != 0, true
+	case "<":
+		return cmp < 0, true
+	case "<=":
+		return cmp <= 0, true
+	case ">":
+		return cmp > 0, true
+	default:
+		return cmp >= 0, true
+	}
+}
+
+func compare[T int | float64 | string](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func checkSelfAssign(l *linter, program *ast.Program) {
+	ast.Inspect(program, func(n ast.Node) bool {
+		var target ast.Expression
+		var value ast.Expression
+		var pos ast.Position
+		switch s := n.(type) {
+		case *ast.AssignmentStatement:
+			target, value, pos = s.Name, s.Value, s.Position
+		case *ast.IndexAssignmentStatement:
+			target = &ast.IndexExpression{Object: s.Object, Index: s.Index}
+			value, pos = s.Value, s.Position
+		case *ast.FieldAssignmentStatement:
+			target = &ast.MemberExpression{Object: s.Object, Property: s.Field}
+			value, pos = s.Value, s.Position
+		default:
+			return true
+		}
+		// A call may return something different each time it is made
+		if value == nil || hasCall(value) || target.String() != value.String() {
+			return true
+		}
+		l.report(pos, fmt.Sprintf("'%s' is assigned to itself", target.String()), "remove the assignment")
+		return true
+	})
+}
+
+// hasCall reports whether expr contains a function call
+func hasCall(expr ast.Expression) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FunctionCall); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func checkEmptyBlock(l *linter, program *ast.Program) {
+	empty := func(block *ast.BlockStatement, what string) {
+		if block == nil || len(block.Statements) > 0 {
+			return
+		}
+		// A comment saying why the block is empty is enough
+		if nc := l.comments.Get(block); nc != nil && len(nc.Dangling) > 0 {
+			return
+		}
+		l.report(block.Position, "empty "+what, "add statements, or a comment explaining why it is empty")
+	}
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.IfStatement:
+			empty(s.Consequence, "if block")
+			empty(s.Alternative, "else block")
+		case *ast.ForStatement:
+			empty(s.Body, "for body")
+		case *ast.WhileStatement:
+			empty(s.Body, "while body")
+		case *ast.UnsafeBlock:
+			empty(s.Body, "unsafe block")
+		case *ast.BlockStatement:
+			for _, stmt := range s.Statements {
+				if inner, ok := stmt.(*ast.BlockStatement); ok {
+					empty(inner, "block")
+				}
+			}
+		}
+		return true
+	})
+}
+
+func checkLongFunction(l *linter, program *ast.Program) {
+	for _, decl := range program.Declarations {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		// Nodes don't record where they end, so a function runs to the
+		// last line any node in its body starts on, plus its closing brace
+		last := fn.Position.Line
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if line := n.Pos().Line; line > last {
+				last = line
+			}
+			return true
+		})
+		lines := last - fn.Position.Line + 2
+		if lines > l.config.MaxFunctionLines {
+			l.report(fn.Position,
+				fmt.Sprintf("function '%s' is %d lines long (max %d)", fn.Name.Name, lines, l.config.MaxFunctionLines),
+				"split it into smaller functions")
+		}
+	}
+}
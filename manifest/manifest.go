@@ -0,0 +1,296 @@
+// manifest/manifest.go
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileName is the name of a package manifest
+const FileName = "mars.toml"
+
+// VendorDir holds vendored copies of dependencies, relative to the manifest
+const VendorDir = "vendor"
+
+// Manifest describes a package: its name, version, entry file and the
+// packages it depends on
+type Manifest struct {
+	File         string // path of the mars.toml
+	Dir          string // directory containing the manifest; the package root
+	Name         string
+	Version      string
+	Entry        string // file 'mars run' runs, relative to Dir
+	Dependencies []Dependency
+	Lint         []LintSetting // the [lint] table, in order
+}
+
+// Dependency is a package required by a manifest, found either at a local
+// path or in the vendor directory
+type Dependency struct {
+	Name    string // the name its modules are imported under
+	Path    string // directory of the package, relative to the manifest; empty if vendored
+	Version string // version the package must have; empty for any
+	Line    int    // line of the manifest that declares it
+}
+
+// Vendored reports whether the dependency is read from the vendor directory
+func (d Dependency) Vendored() bool {
+	return d.Path == ""
+}
+
+// Dir returns the directory holding the dependency of manifest m
+func (d Dependency) Dir(m *Manifest) string {
+	if d.Vendored() {
+		return filepath.Join(m.Dir, VendorDir, d.Name)
+	}
+	if filepath.IsAbs(d.Path) {
+		return d.Path
+	}
+	return filepath.Join(m.Dir, filepath.FromSlash(d.Path))
+}
+
+// LintSetting configures one rule of 'mars lint', either as
+// rule = "warning" or as an inline table of options such as
+// long-function = { severity = "error", max-lines = "80" }. The manifest
+// doesn't know the rules; the lint package validates them.
+type LintSetting struct {
+	Rule    string
+	Options map[string]string // "severity" plus rule-specific options
+	Line    int
+}
+
+// Error is a manifest that could not be read, parsed or resolved
+type Error struct {
+	File    string
+	Line    int // zero when the error isn't about one line
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Message)
+}
+
+var (
+	namePattern    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	versionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+$`)
+)
+
+// ValidName reports whether name can name a package. Package names are the
+// first segment of import paths, so they must be identifiers.
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Find looks for a manifest in dir and each of its parents, returning nil
+// if there is none
+func Find(dir string) (*Manifest, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		file := filepath.Join(dir, FileName)
+		if _, err := os.Stat(file); err == nil {
+			return Load(file)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads and validates the manifest in file
+func Load(file string) (*Manifest, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, &Error{File: file, Message: err.Error()}
+	}
+	m, err := Parse(file, string(content))
+	if err != nil {
+		return nil, err
+	}
+	if m.Dir, err = filepath.Abs(filepath.Dir(file)); err != nil {
+		return nil, &Error{File: file, Message: err.Error()}
+	}
+	return m, nil
+}
+
+// Parse reads a manifest from content. file is only used in errors.
+func Parse(file, content string) (*Manifest, error) {
+	doc, err := parseDocument(content)
+	if err != nil {
+		err.File = file
+		return nil, err
+	}
+
+	m := &Manifest{File: file, Entry: "main.mars"}
+	seen := make(map[string]bool)
+	for _, e := range doc {
+		fail := func(format string, args ...interface{}) error {
+			return &Error{File: file, Line: e.line, Message: fmt.Sprintf(format, args...)}
+		}
+
+		switch e.table {
+		case "package":
+			if e.value.table != nil {
+				return nil, fail("%q must be a string", e.key)
+			}
+			switch e.key {
+			case "name":
+				if !ValidName(e.value.str) {
+					return nil, fail("invalid package name %q: names must be identifiers", e.value.str)
+				}
+				m.Name = e.value.str
+			case "version":
+				if !versionPattern.MatchString(e.value.str) {
+					return nil, fail("invalid version %q: want MAJOR.MINOR.PATCH", e.value.str)
+				}
+				m.Version = e.value.str
+			case "entry":
+				m.Entry = e.value.str
+			default:
+				return nil, fail("unknown package key %q", e.key)
+			}
+		case "dependencies":
+			if !ValidName(e.key) {
+				return nil, fail("invalid dependency name %q: names must be identifiers", e.key)
+			}
+			if seen[e.key] {
+				return nil, fail("dependency %q is declared twice", e.key)
+			}
+			seen[e.key] = true
+
+			dep := Dependency{Name: e.key, Line: e.line}
+			if e.value.table == nil {
+				// name = "1.2.3" is a vendored copy of that version
+				dep.Version = e.value.str
+			} else {
+				for _, key := range e.value.keys {
+					switch key {
+					case "path":
+						dep.Path = e.value.table[key]
+					case "version":
+						dep.Version = e.value.table[key]
+					default:
+						return nil, fail("unknown key %q in dependency %q (want path or version)", key, e.key)
+					}
+				}
+				if _, ok := e.value.table["path"]; ok && dep.Path == "" {
+					return nil, fail("dependency %q has an empty path", e.key)
+				}
+			}
+			if dep.Version != "" && !versionPattern.MatchString(dep.Version) {
+				return nil, fail("invalid version %q for dependency %q: want MAJOR.MINOR.PATCH", dep.Version, e.key)
+			}
+			m.Dependencies = append(m.Dependencies, dep)
+		case "lint":
+			setting := LintSetting{Rule: e.key, Options: e.value.table, Line: e.line}
+			if e.value.table == nil {
+				// rule = "off" is shorthand for rule = { severity = "off" }
+				setting.Options = map[string]string{"severity": e.value.str}
+			}
+			m.Lint = append(m.Lint, setting)
+		default:
+			return nil, fail("unknown table [%s] (want [package], [dependencies] or [lint])", e.table)
+		}
+	}
+
+	if m.Name == "" {
+		return nil, &Error{File: file, Message: "missing package name"}
+	}
+	if m.Version == "" {
+		return nil, &Error{File: file, Message: "missing package version"}
+	}
+	return m, nil
+}
+
+// Packages returns the directory of every package the manifest depends on,
+// directly or not, by name. Dependencies with manifests of their own must
+// match the name and version they are required as. A name may only refer
+// to one directory.
+func (m *Manifest) Packages() (map[string]string, error) {
+	packages := make(map[string]string)
+	if err := m.addPackages(packages, nil); err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
+
+// addPackages adds m's dependencies and theirs to packages. requiredBy is
+// the chain of packages that led to m, for error messages.
+func (m *Manifest) addPackages(packages map[string]string, requiredBy []string) error {
+	chain := append(append([]string(nil), requiredBy...), m.Name)
+	for _, dep := range m.Dependencies {
+		fail := func(format string, args ...interface{}) error {
+			return &Error{File: m.File, Line: dep.Line, Message: fmt.Sprintf(format, args...)}
+		}
+
+		dir, err := filepath.Abs(dep.Dir(m))
+		if err != nil {
+			return fail("%v", err)
+		}
+		for _, name := range chain {
+			if name == dep.Name {
+				return fail("dependency cycle: %s -> %s", strings.Join(chain, " -> "), dep.Name)
+			}
+		}
+		if prev, ok := packages[dep.Name]; ok {
+			if prev != dir {
+				return fail("dependency %q is %s here but %s elsewhere in the dependency graph", dep.Name, dir, prev)
+			}
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			if dep.Vendored() {
+				return fail("vendored dependency %q not found in %s", dep.Name, dir)
+			}
+			return fail("dependency %q not found at %s", dep.Name, dir)
+		}
+		packages[dep.Name] = dir
+
+		depFile := filepath.Join(dir, FileName)
+		if _, err := os.Stat(depFile); err != nil {
+			// A package without a manifest has no dependencies or version
+			if dep.Version != "" {
+				return fail("dependency %q requires version %s, but %s has no %s to declare it; add one, or require any version with %s = { }",
+					dep.Name, dep.Version, dir, FileName, dep.Name)
+			}
+			continue
+		}
+		depManifest, err := Load(depFile)
+		if err != nil {
+			return err
+		}
+		if depManifest.Name != dep.Name {
+			return fail("dependency %q is the package %q", dep.Name, depManifest.Name)
+		}
+		if dep.Version != "" && depManifest.Version != dep.Version {
+			return fail("dependency %q requires version %s, found %s", dep.Name, dep.Version, depManifest.Version)
+		}
+		if err := depManifest.addPackages(packages, chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Template returns the manifest 'mars init' writes for a new package
+func Template(name string) string {
+	return fmt.Sprintf(`[package]
+name = %q
+version = "0.1.0"
+entry = "main.mars"
+
+[dependencies]
+# local = { path = "../local" }   # a package on disk
+# vendored = "1.0.0"              # a copy in vendor/vendored
+`, name)
+}
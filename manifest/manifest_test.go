@@ -0,0 +1,275 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates files under a temporary directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestParse(t *testing.T) {
+	m, err := Parse("mars.toml", `# a package
+[package]
+name = "shapes"      # comment after a value
+version = "1.2.3"
+entry = "src/main.mars"
+
+[dependencies]
+geometry = { path = "../geometry", version = "0.1.0" }
+util = { path = "libs/#util" }
+fmtx = "2.0.0"
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.Name != "shapes" || m.Version != "1.2.3" || m.Entry != "src/main.mars" {
+		t.Errorf("unexpected package %q %q %q", m.Name, m.Version, m.Entry)
+	}
+
+	want := []Dependency{
+		{Name: "geometry", Path: "../geometry", Version: "0.1.0", Line: 8},
+		{Name: "util", Path: "libs/#util", Line: 9},
+		{Name: "fmtx", Version: "2.0.0", Line: 10},
+	}
+	if len(m.Dependencies) != len(want) {
+		t.Fatalf("expected %d dependencies, got %d", len(want), len(m.Dependencies))
+	}
+	for i, dep := range m.Dependencies {
+		if dep != want[i] {
+			t.Errorf("dependency %d = %+v, want %+v", i, dep, want[i])
+		}
+	}
+	if !m.Dependencies[2].Vendored() || m.Dependencies[0].Vendored() {
+		t.Errorf("expected only fmtx to be vendored")
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	m, err := Parse("mars.toml", Template("hello"))
+	if err != nil {
+		t.Fatalf("template does not parse: %v", err)
+	}
+	if m.Name != "hello" || m.Entry != "main.mars" || len(m.Dependencies) != 0 {
+		t.Errorf("unexpected manifest from template: %+v", m)
+	}
+}
+
+func TestParseLint(t *testing.T) {
+	m, err := Parse("mars.toml", `[package]
+name = "shapes"
+version = "1.0.0"
+
+[lint]
+shadow = "off"
+long-function = { severity = "error", max-lines = "80" }
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []LintSetting{
+		{Rule: "shadow", Options: map[string]string{"severity": "off"}, Line: 6},
+		{Rule: "long-function", Options: map[string]string{"severity": "error", "max-lines": "80"}, Line: 7},
+	}
+	if len(m.Lint) != len(want) {
+		t.Fatalf("expected %d lint settings, got %d", len(want), len(m.Lint))
+	}
+	for i, setting := range m.Lint {
+		if setting.Rule != want[i].Rule || setting.Line != want[i].Line || len(setting.Options) != len(want[i].Options) {
+			t.Errorf("lint setting %d = %+v, want %+v", i, setting, want[i])
+			continue
+		}
+		for key, value := range want[i].Options {
+			if setting.Options[key] != value {
+				t.Errorf("lint setting %d: %s = %q, want %q", i, key, setting.Options[key], value)
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{`name = "x"`, "mars.toml:1: key outside of a table"},
+		{"[package]\nname = \"x\"", "missing package version"},
+		{"[package]\nversion = \"1.0.0\"", "missing package name"},
+		{"[package]\nname = \"my-pkg\"", `invalid package name "my-pkg"`},
+		{"[package]\nname = \"x\"\nversion = \"1.0\"", `mars.toml:3: invalid version "1.0"`},
+		{"[package]\nname = x", "expected a quoted string"},
+		{"[package]\nname = \"x", "unterminated string"},
+		{"[package\n", "unterminated table header"},
+		{"[workspace]\nname = \"x\"", "unknown table [workspace]"},
+		{"[package]\nauthor = \"me\"", `unknown package key "author"`},
+		{"[dependencies]\nutil = { path = \"a\" }\nutil = { path = \"b\" }", `dependency "util" is declared twice`},
+		{"[dependencies]\nutil = { git = \"url\" }", `unknown key "git" in dependency "util"`},
+		{"[dependencies]\nutil = { path = \"a\" path = \"b\" }", "expected ',' between inline table entries"},
+		{"[dependencies]\nutil = { path = \"\" }", `dependency "util" has an empty path`},
+	}
+	for _, tt := range tests {
+		_, err := Parse("mars.toml", tt.input)
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.contains) {
+			t.Errorf("%q: expected error containing %q, got %q", tt.input, tt.contains, err.Error())
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"mars.toml":       "[package]\nname = \"app\"\nversion = \"0.1.0\"\n",
+		"src/deep/a.mars": "",
+	})
+
+	m, err := Find(filepath.Join(root, "src", "deep"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m == nil || m.Name != "app" {
+		t.Fatalf("expected to find the app manifest, got %+v", m)
+	}
+	if want, _ := filepath.Abs(root); m.Dir != want {
+		t.Errorf("manifest dir = %s, want %s", m.Dir, want)
+	}
+}
+
+func TestPackages(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"app/mars.toml": `[package]
+name = "app"
+version = "0.1.0"
+
+[dependencies]
+geometry = { path = "../geometry", version = "1.0.0" }
+util = { path = "../util" }
+fmtx = { }
+`,
+		"app/vendor/fmtx/lib.mars": "",
+		"geometry/mars.toml":       "[package]\nname = \"geometry\"\nversion = \"1.0.0\"\n[dependencies]\nutil = { path = \"../util\" }\n",
+		"util/mars.toml":           "[package]\nname = \"util\"\nversion = \"0.2.0\"\n",
+	})
+
+	m, err := Load(filepath.Join(root, "app", FileName))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	packages, err := m.Packages()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"geometry": filepath.Join(root, "geometry"),
+		"util":     filepath.Join(root, "util"),
+		"fmtx":     filepath.Join(root, "app", "vendor", "fmtx"),
+	}
+	if len(packages) != len(want) {
+		t.Errorf("expected %d packages, got %v", len(want), packages)
+	}
+	for name, dir := range want {
+		if packages[name] != dir {
+			t.Errorf("package %s = %s, want %s", name, packages[name], dir)
+		}
+	}
+}
+
+func TestPackagesErrors(t *testing.T) {
+	pkg := func(name, deps string) string {
+		return "[package]\nname = \"" + name + "\"\nversion = \"1.0.0\"\n[dependencies]\n" + deps
+	}
+	tests := []struct {
+		name     string
+		files    map[string]string
+		contains string
+	}{
+		{
+			name:     "missing path",
+			files:    map[string]string{"app/mars.toml": pkg("app", `util = { path = "../util" }`)},
+			contains: `dependency "util" not found at`,
+		},
+		{
+			name:     "missing vendored copy",
+			files:    map[string]string{"app/mars.toml": pkg("app", `util = "1.0.0"`)},
+			contains: `vendored dependency "util" not found`,
+		},
+		{
+			name: "pinned version without a manifest",
+			files: map[string]string{
+				"app/mars.toml":            pkg("app", `fmtx = "2.0.0"`),
+				"app/vendor/fmtx/lib.mars": "",
+			},
+			contains: `dependency "fmtx" requires version 2.0.0, but`,
+		},
+		{
+			name: "version mismatch",
+			files: map[string]string{
+				"app/mars.toml":  pkg("app", `util = { path = "../util", version = "2.0.0" }`),
+				"util/mars.toml": pkg("util", ""),
+			},
+			contains: `dependency "util" requires version 2.0.0, found 1.0.0`,
+		},
+		{
+			name: "name mismatch",
+			files: map[string]string{
+				"app/mars.toml":  pkg("app", `util = { path = "../util" }`),
+				"util/mars.toml": pkg("helpers", ""),
+			},
+			contains: `dependency "util" is the package "helpers"`,
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"app/mars.toml":  pkg("app", `util = { path = "../util" }`),
+				"util/mars.toml": pkg("util", `app = { path = "../app" }`),
+			},
+			contains: "dependency cycle: app -> util -> app",
+		},
+		{
+			name: "one name, two directories",
+			files: map[string]string{
+				"app/mars.toml":   pkg("app", "a = { path = \"../a\" }\nb = { path = \"../b\" }"),
+				"a/mars.toml":     pkg("a", `util = { path = "../util" }`),
+				"b/mars.toml":     pkg("b", `util = { path = "../b/util" }`),
+				"util/mars.toml":  pkg("util", ""),
+				"b/util/lib.mars": "",
+			},
+			contains: `dependency "util" is`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeFiles(t, tt.files)
+			m, err := Load(filepath.Join(root, "app", FileName))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_, err = m.Packages()
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("expected error containing %q, got %q", tt.contains, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// manifest/parse.go
+package manifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The manifest is written in a subset of TOML: [table] headers, comments,
+// and key = value lines whose values are strings or inline tables of
+// strings, such as { path = "../util" }.
+
+// entry is one key = value line of a manifest
+type entry struct {
+	table string
+	key   string
+	value value
+	line  int
+}
+
+// value is a string, or an inline table when table is non-nil
+type value struct {
+	str   string
+	table map[string]string
+	keys  []string // keys of the inline table, in order
+}
+
+func parseDocument(content string) ([]entry, *Error) {
+	var entries []entry
+	table := ""
+	for i, raw := range strings.Split(content, "\n") {
+		line := i + 1
+		text := strings.TrimSpace(stripComment(raw))
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, &Error{Line: line, Message: "unterminated table header"}
+			}
+			table = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		}
+		if table == "" {
+			return nil, &Error{Line: line, Message: "key outside of a table"}
+		}
+
+		key, rest, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, &Error{Line: line, Message: fmt.Sprintf("expected key = value, got %q", text)}
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, &Error{Line: line, Message: "missing key before '='"}
+		}
+
+		v, err := parseValue(strings.TrimSpace(rest))
+		if err != "" {
+			return nil, &Error{Line: line, Message: err}
+		}
+		entries = append(entries, entry{table: table, key: key, value: v, line: line})
+	}
+	return entries, nil
+}
+
+// parseValue parses a string or an inline table of strings, returning why
+// it is invalid if it isn't one
+func parseValue(text string) (value, string) {
+	if !strings.HasPrefix(text, "{") {
+		s, rest, err := parseString(text)
+		if err != "" {
+			return value{}, err
+		}
+		if rest != "" {
+			return value{}, fmt.Sprintf("unexpected %q after value", rest)
+		}
+		return value{str: s}, ""
+	}
+
+	if !strings.HasSuffix(text, "}") {
+		return value{}, "unterminated inline table"
+	}
+	table := make(map[string]string)
+	var keys []string
+	rest := strings.TrimSpace(text[1 : len(text)-1])
+	for rest != "" {
+		key, after, ok := strings.Cut(rest, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return value{}, fmt.Sprintf("expected key = value in inline table, got %q", rest)
+		}
+		s, after, err := parseString(strings.TrimSpace(after))
+		if err != "" {
+			return value{}, err
+		}
+		if _, dup := table[key]; dup {
+			return value{}, fmt.Sprintf("key %q appears twice in inline table", key)
+		}
+		table[key] = s
+		keys = append(keys, key)
+
+		after = strings.TrimSpace(after)
+		if after != "" && !strings.HasPrefix(after, ",") {
+			return value{}, fmt.Sprintf("expected ',' between inline table entries, got %q", after)
+		}
+		rest = strings.TrimSpace(strings.TrimPrefix(after, ","))
+	}
+	return value{table: table, keys: keys}, ""
+}
+
+// parseString reads a double-quoted string from the start of text and
+// returns it along with the text after it
+func parseString(text string) (string, string, string) {
+	if !strings.HasPrefix(text, `"`) {
+		return "", "", fmt.Sprintf("expected a quoted string, got %q", text)
+	}
+	var sb strings.Builder
+	for i := 1; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '"':
+			return sb.String(), strings.TrimSpace(text[i+1:]), ""
+		case '\\':
+			i++
+			if i == len(text) {
+				break
+			}
+			switch text[i] {
+			case '"', '\\':
+				sb.WriteByte(text[i])
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				return "", "", fmt.Sprintf("unknown escape \\%c in string", text[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", "", "unterminated string"
+}
+
+// stripComment removes a # comment that isn't inside a string
+func stripComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case '#':
+			if !inString {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
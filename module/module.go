@@ -0,0 +1,261 @@
+// module/module.go
+package module
+
+import (
+	"fmt"
+	"mars/ast"
+	"mars/errors"
+	"mars/lexer"
+	"mars/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LibFile is the module a package's bare import path loads
+const LibFile = "lib.mars"
+
+// Module is one parsed source file of a multi-file program
+type Module struct {
+	Path    string // import path relative to the project root, without .mars
+	File    string // file the module was read from
+	Source  string
+	Program *ast.Program
+	Imports []*Module // modules named by the file's import declarations, in order
+}
+
+// Graph is an entry file and every module it imports, directly or not
+type Graph struct {
+	Root    string
+	Main    *Module
+	Modules []*Module // dependencies before the modules that import them; Main is last
+}
+
+// Programs returns the parsed program of every module, by import path
+func (g *Graph) Programs() map[string]*ast.Program {
+	programs := make(map[string]*ast.Program, len(g.Modules))
+	for _, mod := range g.Modules {
+		programs[mod.Path] = mod.Program
+	}
+	return programs
+}
+
+// Error is a module that could not be found, read or parsed, or an import cycle
+type Error struct {
+	File     string       // file containing the failing import, or the file that failed to parse
+	Position ast.Position // the failing import; zero for files that failed to parse
+	End      ast.Position // the end of the failing import
+	Code     string
+	Message  string
+	Help     string
+	Parse    []*errors.Error // parse errors, when the file failed to parse
+	Source   string          // the source of File, when it was read
+}
+
+func (e *Error) Error() string {
+	if len(e.Parse) > 0 {
+		return fmt.Sprintf("Parse errors in '%s':\n%s", e.File, strings.TrimRight(e.reporter().String(), "\n"))
+	}
+	if e.Position.Line > 0 {
+		return strings.TrimRight(e.reporter().String(), "\n")
+	}
+
+	// Files that couldn't be read have no source to show
+	msg := fmt.Sprintf("error[%s]: %s", e.Code, e.Message)
+	if e.File != "" {
+		msg = fmt.Sprintf("%s: %s", e.File, msg)
+	}
+	if e.Help != "" {
+		msg += "\n  help: " + e.Help
+	}
+	return msg
+}
+
+// Diagnostics converts the error to diagnostics: one per parse error, or
+// one for the failing import
+func (e *Error) Diagnostics() []errors.Diagnostic {
+	return e.reporter().Diagnostics()
+}
+
+// reporter reports the error's parse errors, or the failing import, in File
+func (e *Error) reporter() *errors.MarsReporter {
+	reporter := errors.NewMarsReporter(e.Source, e.File)
+	if len(e.Parse) > 0 {
+		reporter.AddErrors(e.Parse)
+	} else {
+		reporter.AddErrorWithSpan(e.Position, e.End, e.Code, e.Message, e.Help)
+	}
+	return reporter
+}
+
+// Resolver loads modules from files under a project root. Import "a/b"
+// names the file a/b.mars relative to the root, unless a is the name of a
+// package added with AddPackage.
+type Resolver struct {
+	root     string
+	packages map[string]string // package name to directory
+	modules  map[string]*Module
+	loading  []string // import paths being loaded, outermost first
+}
+
+func NewResolver(root string) *Resolver {
+	return &Resolver{root: root, packages: make(map[string]string), modules: make(map[string]*Module)}
+}
+
+// AddPackage makes the package in dir importable as name: import "name"
+// loads dir/lib.mars and import "name/a/b" loads dir/a/b.mars. Modules of a
+// package import each other by the same paths.
+func (r *Resolver) AddPackage(name, dir string) {
+	r.packages[name] = dir
+}
+
+// fileOf returns the file that import path names
+func (r *Resolver) fileOf(path string) string {
+	first, rest, _ := strings.Cut(path, "/")
+	if dir, ok := r.packages[first]; ok {
+		if rest == "" {
+			return filepath.Join(dir, LibFile)
+		}
+		return filepath.Join(dir, filepath.FromSlash(rest)+".mars")
+	}
+	return filepath.Join(r.root, filepath.FromSlash(path)+".mars")
+}
+
+// Load parses the entry file and every module it imports. Modules are
+// loaded once each, however many files import them.
+func Load(root, filename string) (*Graph, error) {
+	return NewResolver(root).Load(filename)
+}
+
+// Load parses filename as the entry module and resolves its imports
+func (r *Resolver) Load(filename string) (*Graph, error) {
+	path, err := r.pathOf(filename)
+	if err != nil {
+		return nil, &Error{File: filename, Code: errors.ErrCodeImportError, Message: err.Error()}
+	}
+
+	graph := &Graph{Root: r.root}
+	main, loadErr := r.load(path, filename, graph)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	graph.Main = main
+	return graph, nil
+}
+
+// pathOf returns the import path that names filename under the root
+func (r *Resolver) pathOf(filename string) (string, error) {
+	root, err := filepath.Abs(r.root)
+	if err != nil {
+		return "", err
+	}
+	file, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file is outside the project root %s", r.root)
+	}
+	return strings.TrimSuffix(filepath.ToSlash(rel), ".mars"), nil
+}
+
+// load parses one module and, depth first, the modules it imports,
+// appending each to graph.Modules once its imports are loaded
+func (r *Resolver) load(path, filename string, graph *Graph) (*Module, *Error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, &Error{File: filename, Code: errors.ErrCodeImportError, Message: err.Error()}
+	}
+
+	source := string(content)
+	p := parser.NewParserWithSource(lexer.New(source), strings.Split(source, "\n"))
+	program := p.ParseProgram()
+	if parseErrors := p.GetErrors(); parseErrors != nil && parseErrors.HasErrors() {
+		return nil, &Error{File: filename, Parse: parseErrors.Errors(), Source: source}
+	}
+
+	mod := &Module{Path: path, File: filename, Source: source, Program: program}
+	r.modules[path] = mod
+	r.loading = append(r.loading, path)
+	defer func() { r.loading = r.loading[:len(r.loading)-1] }()
+
+	for _, decl := range program.Declarations {
+		imp, ok := decl.(*ast.ImportDecl)
+		if !ok {
+			continue
+		}
+
+		if err := validatePath(imp.Path); err != "" {
+			return nil, &Error{
+				File:     filename,
+				Position: imp.Position,
+				End:      imp.EndPosition,
+				Source:   source,
+				Code:     errors.ErrCodeImportError,
+				Message:  fmt.Sprintf("invalid import path %q: %s", imp.Path, err),
+				Help:     "import paths are relative to the project root, e.g. import \"geometry/vec\";",
+			}
+		}
+
+		for i, loading := range r.loading {
+			if loading == imp.Path {
+				cycle := append(append([]string(nil), r.loading[i:]...), imp.Path)
+				return nil, &Error{
+					File:     filename,
+					Position: imp.Position,
+					End:      imp.EndPosition,
+					Source:   source,
+					Code:     errors.ErrCodeImportError,
+					Message:  "import cycle: " + strings.Join(cycle, " -> "),
+					Help:     "move the declarations both modules need into a third module",
+				}
+			}
+		}
+
+		dep, loaded := r.modules[imp.Path]
+		if !loaded {
+			depFile := r.fileOf(imp.Path)
+			if _, err := os.Stat(depFile); err != nil {
+				return nil, &Error{
+					File:     filename,
+					Position: imp.Position,
+					End:      imp.EndPosition,
+					Source:   source,
+					Code:     errors.ErrCodeImportError,
+					Message:  fmt.Sprintf("cannot find module %q", imp.Path),
+					Help:     fmt.Sprintf("looked for %s", depFile),
+				}
+			}
+
+			var loadErr *Error
+			dep, loadErr = r.load(imp.Path, depFile, graph)
+			if loadErr != nil {
+				return nil, loadErr
+			}
+		}
+		mod.Imports = append(mod.Imports, dep)
+	}
+
+	graph.Modules = append(graph.Modules, mod)
+	return mod, nil
+}
+
+// validatePath returns why an import path is invalid, or "" if it is valid
+func validatePath(path string) string {
+	if path == "" {
+		return "path is empty"
+	}
+	if strings.HasPrefix(path, "/") || filepath.IsAbs(path) {
+		return "path must be relative to the project root"
+	}
+	for _, segment := range strings.Split(path, "/") {
+		switch segment {
+		case "":
+			return "path has an empty segment"
+		case ".", "..":
+			return "path must not contain '.' or '..' segments"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,174 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeProject creates files under a temporary project root
+func writeProject(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestLoadOrdersDependenciesFirst(t *testing.T) {
+	root := writeProject(t, map[string]string{
+		"main.mars":         `import "geometry/vec"; import "util";`,
+		"geometry/vec.mars": `import "util"; func length() -> int { return 1; }`,
+		"util.mars":         `func double(n: int) -> int { return n * 2; }`,
+	})
+
+	graph, err := Load(root, filepath.Join(root, "main.mars"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var paths []string
+	for _, mod := range graph.Modules {
+		paths = append(paths, mod.Path)
+	}
+	if got := strings.Join(paths, " "); got != "util geometry/vec main" {
+		t.Errorf("modules in load order = %q, want %q", got, "util geometry/vec main")
+	}
+	if graph.Main.Path != "main" || len(graph.Main.Imports) != 2 {
+		t.Errorf("unexpected main module %q with %d imports", graph.Main.Path, len(graph.Main.Imports))
+	}
+	// util is shared, not loaded twice
+	if graph.Main.Imports[1] != graph.Main.Imports[0].Imports[0] {
+		t.Errorf("expected both importers of util to share one module")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		file     string // file of the error
+		line     int
+		contains string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"main.mars": `import "a";`,
+				"a.mars":    `import "b";`,
+				"b.mars":    "func f() {}\nimport \"a\";",
+			},
+			file:     "b.mars",
+			line:     2,
+			contains: "import cycle: a -> b -> a",
+		},
+		{
+			name:     "entry imported by its own import",
+			files:    map[string]string{"main.mars": `import "a";`, "a.mars": `import "main";`},
+			file:     "a.mars",
+			line:     1,
+			contains: "import cycle: main -> a -> main",
+		},
+		{
+			name:     "missing module",
+			files:    map[string]string{"main.mars": `import "nope/thing";`},
+			file:     "main.mars",
+			line:     1,
+			contains: `cannot find module "nope/thing"`,
+		},
+		{
+			name:     "path escapes root",
+			files:    map[string]string{"main.mars": `import "../outside";`},
+			file:     "main.mars",
+			line:     1,
+			contains: "must not contain '.' or '..' segments",
+		},
+		{
+			name:     "parse error in import",
+			files:    map[string]string{"main.mars": `import "broken";`, "broken.mars": "func {"},
+			file:     "broken.mars",
+			contains: "Parse errors in",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeProject(t, tt.files)
+			_, err := Load(root, filepath.Join(root, "main.mars"))
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			modErr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("expected *Error, got %T", err)
+			}
+			if filepath.Base(modErr.File) != tt.file || modErr.Position.Line != tt.line {
+				t.Errorf("error at %s:%d, want %s:%d", filepath.Base(modErr.File), modErr.Position.Line, tt.file, tt.line)
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("expected error containing %q, got %q", tt.contains, err.Error())
+			}
+			// Import errors are rendered like the analyzer's, quoting the import
+			if where := fmt.Sprintf("-->\033[0m %s:%d:1\n", modErr.File, tt.line); tt.line > 0 && !strings.Contains(err.Error(), where) {
+				t.Errorf("expected the error to point at %q, got %q", where, err.Error())
+			}
+
+			// Every diagnostic is in the failing file, at the import for
+			// import errors
+			diagnostics := modErr.Diagnostics()
+			if len(diagnostics) == 0 {
+				t.Fatal("expected diagnostics")
+			}
+			for _, d := range diagnostics {
+				if d.File != modErr.File || (tt.line > 0 && d.Start.Line != tt.line) || d.Code == "" {
+					t.Errorf("unexpected diagnostic %+v", d)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadPackages(t *testing.T) {
+	root := writeProject(t, map[string]string{
+		"app/main.mars":               `import "geometry"; import "geometry/shapes/square"; import "util";`,
+		"app/util.mars":               ``,
+		"geometry/lib.mars":           `import "geometry/shapes/square";`,
+		"geometry/shapes/square.mars": ``,
+	})
+
+	r := NewResolver(filepath.Join(root, "app"))
+	r.AddPackage("geometry", filepath.Join(root, "geometry"))
+	graph, err := r.Load(filepath.Join(root, "app", "main.mars"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, mod := range graph.Modules {
+		rel, _ := filepath.Rel(root, mod.File)
+		files[mod.Path] = filepath.ToSlash(rel)
+	}
+	want := map[string]string{
+		"geometry":               "geometry/lib.mars",
+		"geometry/shapes/square": "geometry/shapes/square.mars",
+		"util":                   "app/util.mars",
+		"main":                   "app/main.mars",
+	}
+	for path, file := range want {
+		if files[path] != file {
+			t.Errorf("module %q loaded from %q, want %q", path, files[path], file)
+		}
+	}
+	if len(graph.Modules) != len(want) {
+		t.Errorf("expected %d modules, got %d", len(want), len(graph.Modules))
+	}
+}
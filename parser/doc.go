@@ -0,0 +1,13 @@
+// Package parser turns Mars tokens into an ast.Program.
+//
+// The parser reports through report and reportAt, which enter panic mode:
+// later errors are dropped until a statement loop (ParseProgram,
+// parseBlockStatement, struct fields) calls recoverStatement, which runs
+// synchronize once and guarantees progress. synchronize skips past a ;, or
+// up to a statement keyword or the } closing the enclosing block, counting
+// the braces it passes. An error on the same line as the last one kept is
+// also dropped. Errors end where their token does (tokenEnd), and
+// recordSyntaxErrorSpan spans whole expressions, from ast.Start to the
+// node's EndPos; every node sets EndPosition from endPosition, the end of
+// the last token consumed.
+package parser
@@ -1,4 +1,4 @@
-// Package parser parser/parser.go
+// parser/parser.go
 package parser
 
 import (
@@ -6,6 +6,7 @@ import (
 	"mars/ast"
 	"mars/errors"
 	"mars/lexer"
+	"math/big"
 	"strconv"
 	"strings"
 )
@@ -23,6 +24,18 @@ type parser struct {
 	// disambiguate constructs like IDENT '{' between struct literals
 	// (expression context) and block statements (statement context).
 	inExpression bool
+	// Comments read from the lexer that have not been attached to a node
+	// yet, and the attachments made so far
+	comments      []*ast.Comment
+	commentMap    ast.CommentMap
+	lastLexedLine int // line on which the last token read from the lexer ends
+	// Error recovery: panicking is set by an error and cleared when the
+	// statement it is in has been skipped, and errors reported meanwhile
+	// are dropped as cascades of the first. synced records that the
+	// parser has already skipped ahead since that error.
+	panicking     bool
+	synced        bool
+	lastErrorLine int
 }
 
 func NewParser(lexer *lexer.Lexer) *parser {
@@ -31,13 +44,14 @@ func NewParser(lexer *lexer.Lexer) *parser {
 
 func NewParserWithSource(lexer *lexer.Lexer, sourceLines []string) *parser {
 	p := &parser{
-		lexer:  lexer,
-		errors: errors.NewErrorList(),
-		source: sourceLines,
+		lexer:      lexer,
+		errors:     errors.NewErrorList(),
+		source:     sourceLines,
+		commentMap: ast.CommentMap{},
 	}
 	// Initialize 2-token window
-	p.curToken = p.lexer.NextToken()
-	p.peekToken = p.lexer.NextToken()
+	p.curToken = p.readToken()
+	p.peekToken = p.readToken()
 	return p
 }
 
@@ -49,29 +63,72 @@ func tokenToPosition(token lexer.Token) ast.Position {
 	}
 }
 
+// tokenEnd returns the position just past a token
+func tokenEnd(token lexer.Token) ast.Position {
+	return ast.Position{
+		Line:   token.EndLine,
+		Column: token.EndColumn,
+	}
+}
+
 // Helper function to get current token position
 func (p *parser) currentPosition() ast.Position {
 	return tokenToPosition(p.curToken)
 }
 
+// endPosition returns the position just past the last token consumed,
+// which is where the node that token completes ends
+func (p *parser) endPosition() ast.Position {
+	return tokenEnd(p.prevToken)
+}
+
 // Helper function to get previous token position
 func (p *parser) previousPosition() ast.Position {
 	return tokenToPosition(p.prevToken)
 }
 
-func (p *parser) recordError(message string) {
-	p.errors.AddError(message, p.curToken.Line, p.curToken.Column)
+// report records an error about the current token, unless it cascades
+// from an earlier one: only the first error of a statement is kept, and
+// an error on the same line as the last one kept is dropped
+func (p *parser) report(err *errors.Error) {
+	p.reportAt(err, p.curToken)
 }
 
-func (p *parser) recordSyntaxError(message string) {
-	sourceLine := p.getSourceLine(p.curToken.Line)
-	err := errors.NewSyntaxError(message, p.curToken.Line, p.curToken.Column)
-	if sourceLine != "" {
+// reportAt is report for an error about tok, which it underlines
+func (p *parser) reportAt(err *errors.Error, tok lexer.Token) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.synced = false
+	if err.Line == p.lastErrorLine {
+		return
+	}
+	p.lastErrorLine = err.Line
+	if err.EndLine == 0 && err.Line == tok.Line && err.Column == tok.Column {
+		err = err.WithEnd(tok.EndLine, tok.EndColumn)
+	}
+	if sourceLine := p.getSourceLine(err.Line); sourceLine != "" {
 		err = err.WithSourceLine(sourceLine)
 	}
 	p.errors.Add(err)
 }
 
+func (p *parser) recordError(message string) {
+	p.report(errors.NewError(message, p.curToken.Line, p.curToken.Column))
+}
+
+func (p *parser) recordSyntaxError(message string) {
+	p.report(errors.NewSyntaxError(message, p.curToken.Line, p.curToken.Column))
+}
+
+// recordSyntaxErrorSpan records a syntax error about the code from start
+// to end, such as an expression used where a call is required
+func (p *parser) recordSyntaxErrorSpan(start, end ast.Position, message string) {
+	err := errors.NewSyntaxError(message, start.Line, start.Column).WithEnd(end.Line, end.Column)
+	p.report(err)
+}
+
 func (p *parser) recordParserStateError(message string) {
 	// Add context about current parser state with user-friendly symbols
 	curSymbol := p.tokenToSymbol(p.curToken.Type.String())
@@ -82,42 +139,36 @@ func (p *parser) recordParserStateError(message string) {
 	convertedMessage := p.convertTokenNamesInMessage(message)
 	fullMessage := fmt.Sprintf("%s (context: %s)", convertedMessage, context)
 
-	sourceLine := p.getSourceLine(p.curToken.Line)
-	err := errors.NewParserStateError(fullMessage, p.curToken.Line, p.curToken.Column)
-	if sourceLine != "" {
-		err = err.WithSourceLine(sourceLine)
-	}
-	p.errors.Add(err)
+	p.report(errors.NewParserStateError(fullMessage, p.curToken.Line, p.curToken.Column))
 }
 
 // convertTokenNamesInMessage replaces token names with symbols in error messages
 func (p *parser) convertTokenNamesInMessage(message string) string {
-	// Replace common token name patterns
-	replacements := map[string]string{
-		"RBRACE":    "'}'",
-		"LBRACE":    "'{'",
-		"RBRACKET":  "']'",
-		"LBRACKET":  "'['",
-		"SEMICOLON": "';'",
-		"RPAREN":    "')'",
-		"LPAREN":    "'('",
-		"COLON":     "':'",
-		"COLONEQ":   "':='",
-		"EQ":        "'='",
-		"FUNC":      "function keyword",
-		"RETURN":    "return keyword",
-		"IF":        "if keyword",
-		"FOR":       "for keyword",
-		"WHILE":     "while keyword",
-		"EOF":       "end of file",
-	}
-
-	result := message
-	for token, symbol := range replacements {
-		result = strings.ReplaceAll(result, token, symbol)
-	}
-	return result
-}
+	return tokenNames.Replace(message)
+}
+
+// tokenNames replaces token names with symbols. Names that contain
+// others, such as SEMICOLON and COLON, come first so that the longer
+// name is replaced whole.
+var tokenNames = strings.NewReplacer(
+	"SEMICOLON", "';'",
+	"COLONEQ", "':='",
+	"RBRACKET", "']'",
+	"LBRACKET", "'['",
+	"RBRACE", "'}'",
+	"LBRACE", "'{'",
+	"RPAREN", "')'",
+	"LPAREN", "'('",
+	"COLON", "':'",
+	"COMMA", "','",
+	"EQ", "'='",
+	"FUNC", "function keyword",
+	"RETURN", "return keyword",
+	"IF", "if keyword",
+	"FOR", "for keyword",
+	"WHILE", "while keyword",
+	"EOF", "end of file",
+)
 
 // tokenToSymbol converts token names to user-friendly symbols
 func (p *parser) tokenToSymbol(token string) string {
@@ -170,6 +221,16 @@ func (p *parser) tokenToSymbol(token string) string {
 		return "'&&'"
 	case "OR":
 		return "'||'"
+	case "AMP":
+		return "'&'"
+	case "PIPE":
+		return "'|'"
+	case "CARET":
+		return "'^'"
+	case "SHL":
+		return "'<<'"
+	case "SHR":
+		return "'>>'"
 	case "COMMA":
 		return "','"
 	case "DOT":
@@ -188,6 +249,24 @@ func (p *parser) tokenToSymbol(token string) string {
 		return "for keyword"
 	case "WHILE":
 		return "while keyword"
+	case "IMPORT":
+		return "import keyword"
+	case "PUB":
+		return "pub keyword"
+	case "SPAWN":
+		return "spawn keyword"
+	case "CHAN":
+		return "chan keyword"
+	case "SELECT":
+		return "select keyword"
+	case "CASE":
+		return "case keyword"
+	case "DEFAULT":
+		return "default keyword"
+	case "CONST":
+		return "const keyword"
+	case "TYPE":
+		return "type keyword"
 	case "MUT":
 		return "mut keyword"
 	case "STRUCT":
@@ -218,15 +297,15 @@ func (p *parser) tokenToSymbol(token string) string {
 }
 
 func (p *parser) recordArrayIndexError(message string) {
-	p.errors.Add(errors.NewArrayIndexError(message, p.curToken.Line, p.curToken.Column))
+	p.report(errors.NewArrayIndexError(message, p.curToken.Line, p.curToken.Column))
 }
 
 func (p *parser) recordFunctionCallError(message string) {
-	p.errors.Add(errors.NewFunctionCallError(message, p.curToken.Line, p.curToken.Column))
+	p.report(errors.NewFunctionCallError(message, p.curToken.Line, p.curToken.Column))
 }
 
 func (p *parser) recordControlFlowError(message string) {
-	p.errors.Add(errors.NewControlFlowError(message, p.curToken.Line, p.curToken.Column))
+	p.report(errors.NewControlFlowError(message, p.curToken.Line, p.curToken.Column))
 }
 
 // getSourceLine returns the source line at the given line number (1-indexed)
@@ -240,7 +319,106 @@ func (p *parser) getSourceLine(lineNum int) string {
 func (p *parser) nextToken() {
 	p.prevToken = p.curToken
 	p.curToken = p.peekToken
-	p.peekToken = p.lexer.NextToken()
+	p.peekToken = p.readToken()
+}
+
+// readToken returns the next non-comment token from the lexer. Comments are
+// queued so they can be attached to the surrounding nodes instead of being
+// handed to the grammar, which lets them appear anywhere in the source.
+func (p *parser) readToken() lexer.Token {
+	for {
+		tok := p.lexer.NextToken()
+		if tok.Type != lexer.COMMENT {
+			p.lastLexedLine = tokenEndLine(tok)
+			return tok
+		}
+		p.comments = append(p.comments, &ast.Comment{
+			Text:        tok.Literal,
+			Position:    tokenToPosition(tok),
+			BlankBefore: p.lastLexedLine > 0 && tok.Line-p.lastLexedLine > 1,
+		})
+		p.lastLexedLine = tokenEndLine(tok)
+	}
+}
+
+// tokenEndLine returns the line on which a token ends, accounting for
+// block comments and strings that span several lines
+func tokenEndLine(tok lexer.Token) int {
+	return tok.Line + strings.Count(tok.Literal, "\n")
+}
+
+// takeCommentsBefore removes and returns the queued comments that start
+// before the given token
+func (p *parser) takeCommentsBefore(tok lexer.Token) []*ast.Comment {
+	n := 0
+	for n < len(p.comments) && commentBefore(p.comments[n], tok) {
+		n++
+	}
+	taken := p.comments[:n:n]
+	p.comments = p.comments[n:]
+	return taken
+}
+
+// commentBefore reports whether a comment starts before the given token
+func commentBefore(c *ast.Comment, tok lexer.Token) bool {
+	return c.Position.Line < tok.Line ||
+		(c.Position.Line == tok.Line && c.Position.Column < tok.Column)
+}
+
+// leadingComments takes the comments directly above the current token and
+// reports whether a blank line separates the upcoming node from them (or
+// from the previous token when there are none)
+func (p *parser) leadingComments() ([]*ast.Comment, bool) {
+	leading := p.takeCommentsBefore(p.curToken)
+	prevEnd := 0
+	if p.prevToken.Line > 0 {
+		prevEnd = tokenEndLine(p.prevToken)
+	}
+	if len(leading) > 0 {
+		last := leading[len(leading)-1]
+		prevEnd = last.Position.Line + strings.Count(last.Text, "\n")
+	}
+	return leading, prevEnd > 0 && p.curToken.Line-prevEnd > 1
+}
+
+// attachComments records the comments for a node that has just been parsed.
+// A comment on the same line as the node's last token becomes its trailing
+// comment.
+func (p *parser) attachComments(node ast.Node, leading []*ast.Comment, blankBefore bool) {
+	var trailing *ast.Comment
+	if len(p.comments) > 0 {
+		next := p.comments[0]
+		if next.Position.Line == tokenEndLine(p.prevToken) && commentBefore(next, p.curToken) {
+			trailing = next
+			p.comments = p.comments[1:]
+		}
+	}
+	if len(leading) == 0 && trailing == nil && !blankBefore {
+		return
+	}
+	// The node may already hold dangling comments from its own body
+	nc := p.commentMap[node]
+	if nc == nil {
+		nc = &ast.NodeComments{}
+		p.commentMap[node] = nc
+	}
+	nc.Leading = leading
+	nc.Trailing = trailing
+	nc.BlankBefore = blankBefore
+}
+
+// attachDangling records comments that appear before the closing token of a
+// block, struct or program and so belong to no following node
+func (p *parser) attachDangling(node ast.Node, dangling []*ast.Comment) {
+	if len(dangling) == 0 {
+		return
+	}
+	nc := p.commentMap[node]
+	if nc == nil {
+		nc = &ast.NodeComments{}
+		p.commentMap[node] = nc
+	}
+	nc.Dangling = append(nc.Dangling, dangling...)
 }
 
 func (p *parser) previousToken() lexer.Token {
@@ -258,12 +436,22 @@ func (p *parser) ParseProgram() *ast.Program {
 	program.Position = p.currentPosition()
 
 	for p.curToken.Type != lexer.EOF {
+		start := p.curToken
+		leading, blank := p.leadingComments()
 		decl := p.parseDeclaration()
 		if decl != nil {
 			program.Declarations = append(program.Declarations, decl)
+			p.attachComments(decl, leading, blank)
 		}
+		p.recoverStatement(start, decl == nil)
 	}
 
+	program.EndPosition = p.currentPosition()
+	p.attachDangling(program, p.takeCommentsBefore(p.curToken))
+	p.attachDangling(program, p.comments)
+	p.comments = nil
+	program.Comments = p.commentMap
+
 	return program
 }
 
@@ -278,8 +466,16 @@ func (p *parser) parseType() *ast.Type {
 		return p.parseArrayOrSliceType()
 	case lexer.ASTERISK:
 		return p.parsePointerType()
+	case lexer.QUESTION:
+		return p.parseOptionalType()
 	case lexer.IDENT:
+		// Sized integer types such as u8 and bigint are predeclared names, not keywords
+		if ast.IsIntTypeName(p.curToken.Literal) || p.curToken.Literal == "bigint" {
+			return p.parseBaseType()
+		}
 		return p.parseStructTypeReference()
+	case lexer.CHAN:
+		return p.parseChanType()
 	default:
 		p.recordSyntaxError(fmt.Sprintf("expected type, got %s", p.curToken.Type))
 		return nil
@@ -288,8 +484,9 @@ func (p *parser) parseType() *ast.Type {
 
 func (p *parser) parseBaseType() *ast.Type {
 	baseType := &ast.Type{
-		BaseType: p.curToken.Literal,
-		Position: p.currentPosition(),
+		BaseType:    p.curToken.Literal,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
 	}
 	p.nextToken() // consume the type token
 	return baseType
@@ -313,6 +510,14 @@ func (p *parser) parseArrayOrSliceType() *ast.Type {
 			return nil
 		}
 		p.nextToken() // consume size
+	} else if p.curTokenIs(lexer.IDENT) {
+		// A named constant, resolved by the analyzer
+		arrayType.ArrayLen = &ast.Identifier{
+			Name:        p.curToken.Literal,
+			Position:    p.currentPosition(),
+			EndPosition: tokenEnd(p.curToken),
+		}
+		p.nextToken() // consume constant name
 	}
 	// else: dynamic slice (ArraySize remains nil)
 
@@ -322,6 +527,7 @@ func (p *parser) parseArrayOrSliceType() *ast.Type {
 
 	// Parse element type
 	arrayType.ArrayType = p.parseType()
+	arrayType.EndPosition = p.endPosition()
 	return arrayType
 }
 
@@ -335,7 +541,19 @@ func (p *parser) parsePointerType() *ast.Type {
 	return &ast.Type{
 		PointerType: pointeeType,
 		Position:    startPos,
+		EndPosition: p.endPosition(),
+	}
+}
+
+// parseOptionalType handles: "?" Type
+func (p *parser) parseOptionalType() *ast.Type {
+	startPos := p.currentPosition()
+	p.nextToken() // consume '?'
+	valueType := p.parseType()
+	if valueType == nil {
+		return nil
 	}
+	return &ast.Type{OptionalType: valueType, Position: startPos, EndPosition: p.endPosition()}
 }
 
 func (p *parser) parseStructTypeReference() *ast.Type {
@@ -344,21 +562,48 @@ func (p *parser) parseStructTypeReference() *ast.Type {
 		Position:   p.currentPosition(),
 	}
 	p.nextToken() // consume struct name
+
+	// mod.Type names a struct declared in an imported module
+	if p.curTokenIs(lexer.DOT) && p.peekTokenIs(lexer.IDENT) {
+		p.nextToken() // consume "."
+		structType.StructName += "." + p.curToken.Literal
+		p.nextToken() // consume type name
+	}
+	structType.EndPosition = p.endPosition()
 	return structType
 }
 
+// parseChanType handles: "chan" "[" Type "]"
+func (p *parser) parseChanType() *ast.Type {
+	startPos := p.currentPosition()
+	p.nextToken() // consume 'chan'
+	if !p.expectCurrent(lexer.LBRACKET) {
+		return nil
+	}
+	elemType := p.parseType()
+	if elemType == nil {
+		return nil
+	}
+	if !p.expectCurrent(lexer.RBRACKET) {
+		return nil
+	}
+	return &ast.Type{ChanType: elemType, Position: startPos, EndPosition: p.endPosition()}
+}
+
 // ===== DECLARATION PARSING =====
 
 func (p *parser) parseDeclaration() ast.Declaration {
 	switch p.curToken.Type {
-	case lexer.COMMENT:
-		// Skip comments by consuming the token and returning nil
-		p.nextToken()
-		return nil
+	case lexer.IMPORT:
+		return p.parseImportDeclaration()
+	case lexer.PUB:
+		return p.parsePublicDeclaration()
 	case lexer.FUNC:
 		return p.parseFunctionDeclaration()
 	case lexer.MUT:
 		return p.parseVariableDeclaration()
+	case lexer.CONST:
+		return p.parseConstDeclaration()
 	case lexer.STRUCT:
 		return p.parseStructDeclaration()
 	case lexer.ENUM:
@@ -367,10 +612,13 @@ func (p *parser) parseDeclaration() ast.Declaration {
 		return p.parseTypeDeclaration()
 	case lexer.UNSAFE:
 		return p.parseUnsafeDeclaration()
-	case lexer.IF, lexer.FOR, lexer.RETURN, lexer.LOG, lexer.BREAK, lexer.CONTINUE:
+	case lexer.IF, lexer.FOR, lexer.RETURN, lexer.LOG, lexer.BREAK, lexer.CONTINUE, lexer.SPAWN, lexer.SELECT:
 		return p.parseStatement()
 	case lexer.LBRACE:
-		return p.parseBlockStatement()
+		if block := p.parseBlockStatement(); block != nil {
+			return block
+		}
+		return nil
 	case lexer.IDENT:
 		// Check for different identifier contexts
 		if p.peekTokenIs(lexer.COLON) {
@@ -383,11 +631,80 @@ func (p *parser) parseDeclaration() ast.Declaration {
 		return p.parseExpressionStatement()
 	default:
 		p.recordSyntaxError(fmt.Sprintf("unexpected token %s at top level", p.curToken.Type))
+		p.nextToken()
 		p.synchronize()
 		return nil
 	}
 }
 
+// parseImportDeclaration handles: "import" STRING [ ";" ]
+func (p *parser) parseImportDeclaration() ast.Declaration {
+	importDecl := &ast.ImportDecl{
+		Position: p.currentPosition(),
+	}
+	p.nextToken() // consume "import"
+
+	if !p.curTokenIs(lexer.STRING) {
+		p.recordSyntaxError("expected module path string after 'import'")
+		p.synchronize()
+		return nil
+	}
+	importDecl.Path = p.curToken.Literal
+	importDecl.Name = ast.ModuleName(importDecl.Path)
+	if importDecl.Name == "" {
+		p.recordSyntaxError(fmt.Sprintf("invalid module path %q: the last segment must be an identifier", importDecl.Path))
+		p.nextToken()
+		return nil
+	}
+	p.nextToken() // consume path
+
+	// Optional semicolon
+	if p.curTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+
+	importDecl.EndPosition = p.endPosition()
+	return importDecl
+}
+
+// parsePublicDeclaration handles: "pub" ( FuncDecl | StructDecl | ConstDecl | VarDecl )
+func (p *parser) parsePublicDeclaration() ast.Declaration {
+	p.nextToken() // consume "pub"
+
+	var decl ast.Declaration
+	switch {
+	case p.curTokenIs(lexer.FUNC):
+		decl = p.parseFunctionDeclaration()
+	case p.curTokenIs(lexer.STRUCT):
+		decl = p.parseStructDeclaration()
+	case p.curTokenIs(lexer.CONST):
+		decl = p.parseConstDeclaration()
+	case p.curTokenIs(lexer.TYPE):
+		decl = p.parseTypeDeclaration()
+	case p.curTokenIs(lexer.MUT),
+		p.curTokenIs(lexer.IDENT) && (p.peekTokenIs(lexer.COLON) || p.peekTokenIs(lexer.COLONEQ)):
+		decl = p.parseVariableDeclaration()
+	default:
+		p.recordSyntaxError(fmt.Sprintf("expected function, struct, type, constant or variable declaration after 'pub', got %s", p.curToken.Type))
+		p.synchronize()
+		return nil
+	}
+
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		d.Public = true
+	case *ast.StructDecl:
+		d.Public = true
+	case *ast.VarDecl:
+		d.Public = true
+	case *ast.ConstDecl:
+		d.Public = true
+	case *ast.TypeDecl:
+		d.Public = true
+	}
+	return decl
+}
+
 // parseFunctionDeclaration handles: "func" IDENT "(" [ Params ] ")" [ "->" Type ] Block
 func (p *parser) parseFunctionDeclaration() ast.Declaration {
 	startPos := p.currentPosition()
@@ -401,8 +718,9 @@ func (p *parser) parseFunctionDeclaration() ast.Declaration {
 		return nil
 	}
 	funcDecl.Name = &ast.Identifier{
-		Name:     p.curToken.Literal,
-		Position: p.currentPosition(),
+		Name:        p.curToken.Literal,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
 	}
 	p.nextToken() // consume function name
 
@@ -429,6 +747,7 @@ func (p *parser) parseFunctionDeclaration() ast.Declaration {
 		p.nextToken() // consume "->"
 		signature.ReturnType = p.parseType()
 	}
+	signature.EndPosition = p.endPosition()
 
 	// Attach the completed signature to the function declaration
 	funcDecl.Signature = signature
@@ -441,6 +760,7 @@ func (p *parser) parseFunctionDeclaration() ast.Declaration {
 		p.nextToken()
 	}
 
+	funcDecl.EndPosition = p.endPosition()
 	return funcDecl
 }
 
@@ -466,17 +786,24 @@ func (p *parser) parseParameters() []*ast.Parameter {
 }
 
 func (p *parser) parseParameter() *ast.Parameter {
+	startPos := p.currentPosition()
+	mutable := p.curTokenIs(lexer.MUT)
+	if mutable {
+		p.nextToken() // consume 'mut'
+	}
 	if !p.curTokenIs(lexer.IDENT) {
 		p.recordSyntaxError("expected parameter name")
 		return nil
 	}
 
 	param := &ast.Parameter{
+		Mutable: mutable,
 		Name: &ast.Identifier{
-			Name:     p.curToken.Literal,
-			Position: p.currentPosition(),
+			Name:        p.curToken.Literal,
+			Position:    p.currentPosition(),
+			EndPosition: tokenEnd(p.curToken),
 		},
-		Position: p.currentPosition(),
+		Position: startPos,
 	}
 	p.nextToken() // consume parameter name
 
@@ -485,6 +812,7 @@ func (p *parser) parseParameter() *ast.Parameter {
 	}
 
 	param.Type = p.parseType()
+	param.EndPosition = p.endPosition()
 	return param
 }
 
@@ -506,8 +834,9 @@ func (p *parser) parseVariableDeclaration() ast.Declaration {
 		return nil
 	}
 	varDecl.Name = &ast.Identifier{
-		Name:     p.curToken.Literal,
-		Position: p.currentPosition(),
+		Name:        p.curToken.Literal,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
 	}
 	p.nextToken() // consume variable name
 
@@ -526,6 +855,7 @@ func (p *parser) parseVariableDeclaration() ast.Declaration {
 		varDecl.Value = p.parseExpression()
 
 		// Infer type from value
+		varDecl.Inferred = true
 		if varDecl.Value != nil {
 			varDecl.Type = p.inferTypeFromExpression(varDecl.Value)
 		}
@@ -539,9 +869,52 @@ func (p *parser) parseVariableDeclaration() ast.Declaration {
 		p.nextToken()
 	}
 
+	varDecl.EndPosition = p.endPosition()
 	return varDecl
 }
 
+// parseConstDeclaration handles: "const" IDENT [ ":" Type ] "=" Expression ";"
+func (p *parser) parseConstDeclaration() ast.Declaration {
+	constDecl := &ast.ConstDecl{
+		Position: p.currentPosition(),
+	}
+	p.nextToken() // consume "const"
+
+	if !p.curTokenIs(lexer.IDENT) {
+		p.recordSyntaxError("expected constant name")
+		return nil
+	}
+	constDecl.Name = &ast.Identifier{
+		Name:        p.curToken.Literal,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
+	}
+	p.nextToken() // consume constant name
+
+	if p.curTokenIs(lexer.COLON) {
+		p.nextToken() // consume ":"
+		constDecl.Type = p.parseType()
+	}
+	if p.curTokenIs(lexer.COLONEQ) {
+		p.recordSyntaxError(fmt.Sprintf("constants are declared with '=': const %s = value;", constDecl.Name.Name))
+		return nil
+	}
+	if !p.curTokenIs(lexer.EQ) {
+		p.recordSyntaxError(fmt.Sprintf("constant '%s' needs a value: const %s = value;", constDecl.Name.Name, constDecl.Name.Name))
+		return nil
+	}
+	p.nextToken() // consume "="
+	constDecl.Value = p.parseExpression()
+
+	// Optional semicolon
+	if p.curTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+
+	constDecl.EndPosition = p.endPosition()
+	return constDecl
+}
+
 // parseStructDeclaration handles: "struct" IDENT "{" { FieldDecl } "}"
 func (p *parser) parseStructDeclaration() ast.Declaration {
 	startPos := p.currentPosition()
@@ -555,8 +928,9 @@ func (p *parser) parseStructDeclaration() ast.Declaration {
 		return nil
 	}
 	structDecl.Name = &ast.Identifier{
-		Name:     p.curToken.Literal,
-		Position: p.currentPosition(),
+		Name:        p.curToken.Literal,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
 	}
 	p.nextToken() // consume struct name
 
@@ -566,39 +940,43 @@ func (p *parser) parseStructDeclaration() ast.Declaration {
 
 	// Parse fields
 	for !p.curTokenIs(lexer.RBRACE) && !p.isAtEnd() {
+		start := p.curToken
+		leading, blank := p.leadingComments()
 		field := p.parseFieldDeclaration()
 		if field != nil {
 			structDecl.Fields = append(structDecl.Fields, field)
-		} else {
-			// If field parsing failed, try to recover by skipping to next field or end
-			if !p.curTokenIs(lexer.RBRACE) && !p.isAtEnd() {
-				p.synchronize()
-				// If we're still not at the end or closing brace, skip this field and continue
-				if !p.curTokenIs(lexer.RBRACE) && !p.isAtEnd() {
-					continue
-				}
-			}
-			break
+			p.attachComments(field, leading, blank)
 		}
+		p.recoverStatement(start, field == nil)
 	}
 
+	p.attachDangling(structDecl, p.takeCommentsBefore(p.curToken))
 	if !p.expectCurrent(lexer.RBRACE) {
 		return nil
 	}
+	structDecl.EndPosition = p.endPosition()
 
 	return structDecl
 }
 
 func (p *parser) parseFieldDeclaration() *ast.FieldDecl {
+	public := false
+	if p.curTokenIs(lexer.PUB) {
+		public = true
+		p.nextToken() // consume "pub"
+	}
+
 	if !p.curTokenIs(lexer.IDENT) {
 		p.recordSyntaxError("expected field name")
 		return nil
 	}
 
 	field := &ast.FieldDecl{
+		Public: public,
 		Name: &ast.Identifier{
-			Name:     p.curToken.Literal,
-			Position: p.currentPosition(),
+			Name:        p.curToken.Literal,
+			Position:    p.currentPosition(),
+			EndPosition: tokenEnd(p.curToken),
 		},
 		Position: p.currentPosition(),
 	}
@@ -615,6 +993,7 @@ func (p *parser) parseFieldDeclaration() *ast.FieldDecl {
 		p.nextToken()
 	}
 
+	field.EndPosition = p.endPosition()
 	return field
 }
 
@@ -624,8 +1003,9 @@ func (p *parser) parseUnsafeDeclaration() ast.Declaration {
 	p.nextToken() // consume "unsafe"
 	block := p.parseBlockStatement()
 	return &ast.UnsafeBlock{
-		Body:     block,
-		Position: startPos,
+		Body:        block,
+		Position:    startPos,
+		EndPosition: p.endPosition(),
 	}
 }
 
@@ -663,10 +1043,11 @@ func (p *parser) parseAssignment() ast.Declaration {
 		}
 
 		return &ast.IndexAssignmentStatement{
-			Object:   object,
-			Index:    index,
-			Value:    value,
-			Position: startPos,
+			Object:      object,
+			Index:       index,
+			Value:       value,
+			Position:    startPos,
+			EndPosition: p.endPosition(),
 		}
 	}
 
@@ -685,9 +1066,10 @@ func (p *parser) parseAssignment() ast.Declaration {
 	// Convert object back to identifier for regular assignment
 	if ident, ok := object.(*ast.Identifier); ok {
 		return &ast.AssignmentStatement{
-			Name:     ident,
-			Value:    value,
-			Position: startPos,
+			Name:        ident,
+			Value:       value,
+			Position:    startPos,
+			EndPosition: p.endPosition(),
 		}
 	}
 
@@ -703,10 +1085,48 @@ func (p *parser) parseEnumDeclaration() ast.Declaration {
 	return nil
 }
 
+// parseTypeDeclaration handles: "type" IDENT [ "=" ] Type [ ";" ]
 func (p *parser) parseTypeDeclaration() ast.Declaration {
-	p.recordSyntaxError("type declarations not yet implemented")
-	p.synchronize()
-	return nil
+	typeDecl := &ast.TypeDecl{
+		Position: p.currentPosition(),
+	}
+	p.nextToken() // consume "type"
+
+	if !p.curTokenIs(lexer.IDENT) {
+		p.recordSyntaxError("expected type name")
+		p.synchronize()
+		return nil
+	}
+	typeDecl.Name = &ast.Identifier{
+		Name:        p.curToken.Literal,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
+	}
+	p.nextToken() // consume type name
+
+	if p.curTokenIs(lexer.EQ) {
+		typeDecl.Alias = true
+		p.nextToken() // consume "="
+	}
+	if p.curTokenIs(lexer.SEMICOLON) || p.curTokenIs(lexer.EOF) {
+		p.recordSyntaxError(fmt.Sprintf("type '%s' needs a type: type %s int; or type %s = int;",
+			typeDecl.Name.Name, typeDecl.Name.Name, typeDecl.Name.Name))
+		p.synchronize()
+		return nil
+	}
+	typeDecl.Type = p.parseType()
+	if typeDecl.Type == nil {
+		p.synchronize()
+		return nil
+	}
+
+	// Optional semicolon
+	if p.curTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+
+	typeDecl.EndPosition = p.endPosition()
+	return typeDecl
 }
 
 // ===== ENHANCED EXPRESSION PARSING =====
@@ -731,10 +1151,11 @@ func (p *parser) parseLogicalOr() ast.Expression {
 		p.nextToken()
 		right := p.parseLogicalAnd()
 		expr = &ast.BinaryExpression{
-			Left:     expr,
-			Operator: op,
-			Right:    right,
-			Position: pos,
+			Left:        expr,
+			Operator:    op,
+			Right:       right,
+			Position:    pos,
+			EndPosition: p.endPosition(),
 		}
 	}
 	return expr
@@ -748,10 +1169,11 @@ func (p *parser) parseLogicalAnd() ast.Expression {
 		p.nextToken()
 		right := p.parseEquality()
 		expr = &ast.BinaryExpression{
-			Left:     expr,
-			Operator: op,
-			Right:    right,
-			Position: pos,
+			Left:        expr,
+			Operator:    op,
+			Right:       right,
+			Position:    pos,
+			EndPosition: p.endPosition(),
 		}
 	}
 	return expr
@@ -766,10 +1188,11 @@ func (p *parser) parseEquality() ast.Expression {
 		p.nextToken()
 		right := p.parseComparison()
 		expr = &ast.BinaryExpression{
-			Left:     expr,
-			Operator: op,
-			Right:    right,
-			Position: pos,
+			Left:        expr,
+			Operator:    op,
+			Right:       right,
+			Position:    pos,
+			EndPosition: p.endPosition(),
 		}
 	}
 	return expr
@@ -784,61 +1207,71 @@ func (p *parser) parseComparison() ast.Expression {
 		p.nextToken()
 		right := p.parseTerm()
 		expr = &ast.BinaryExpression{
-			Left:     expr,
-			Operator: op,
-			Right:    right,
-			Position: pos,
+			Left:        expr,
+			Operator:    op,
+			Right:       right,
+			Position:    pos,
+			EndPosition: p.endPosition(),
 		}
 	}
 	return expr
 }
 
+// parseTerm parses additive operators, with | and ^ at the same level as
+// in Go
 func (p *parser) parseTerm() ast.Expression {
 	expr := p.parseFactor()
 
-	for p.curTokenIs(lexer.PLUS) || p.curTokenIs(lexer.MINUS) {
+	for p.curTokenIs(lexer.PLUS) || p.curTokenIs(lexer.MINUS) || p.curTokenIs(lexer.PIPE) || p.curTokenIs(lexer.CARET) {
 		op := p.curToken.Literal
 		pos := p.currentPosition()
 		p.nextToken()
 		right := p.parseFactor()
 		expr = &ast.BinaryExpression{
-			Left:     expr,
-			Operator: op,
-			Right:    right,
-			Position: pos,
+			Left:        expr,
+			Operator:    op,
+			Right:       right,
+			Position:    pos,
+			EndPosition: p.endPosition(),
 		}
 	}
 	return expr
 }
 
+// parseFactor parses multiplicative operators, shifts and &, so that
+// x & 1 == 0 compares the masked value
 func (p *parser) parseFactor() ast.Expression {
 	expr := p.parseUnary()
 
-	for p.curTokenIs(lexer.ASTERISK) || p.curTokenIs(lexer.SLASH) || p.curTokenIs(lexer.PERCENT) {
+	for p.curTokenIs(lexer.ASTERISK) || p.curTokenIs(lexer.SLASH) || p.curTokenIs(lexer.PERCENT) ||
+		p.curTokenIs(lexer.SHL) || p.curTokenIs(lexer.SHR) || p.curTokenIs(lexer.AMP) {
 		op := p.curToken.Literal
 		pos := p.currentPosition()
 		p.nextToken()
 		right := p.parseUnary()
 		expr = &ast.BinaryExpression{
-			Left:     expr,
-			Operator: op,
-			Right:    right,
-			Position: pos,
+			Left:        expr,
+			Operator:    op,
+			Right:       right,
+			Position:    pos,
+			EndPosition: p.endPosition(),
 		}
 	}
 	return expr
 }
 
 func (p *parser) parseUnary() ast.Expression {
-	if p.curTokenIs(lexer.BANG) || p.curTokenIs(lexer.MINUS) {
+	// Unary ^ is bitwise complement
+	if p.curTokenIs(lexer.BANG) || p.curTokenIs(lexer.MINUS) || p.curTokenIs(lexer.CARET) {
 		op := p.curToken.Literal
 		pos := p.currentPosition()
 		p.nextToken()
 		right := p.parseUnary()
 		return &ast.UnaryExpression{
-			Operator: op,
-			Right:    right,
-			Position: pos,
+			Operator:    op,
+			Right:       right,
+			Position:    pos,
+			EndPosition: p.endPosition(),
 		}
 	}
 	return p.parsePrimary()
@@ -868,9 +1301,19 @@ func (p *parser) parsePrimary() ast.Expression {
 		}
 	case lexer.LBRACKET:
 		expr = p.parseArrayLiteral()
+	case lexer.CHAN:
+		expr = p.parseChanLiteral()
+	case lexer.INT, lexer.FLOAT, lexer.STRING_KW, lexer.BOOL:
+		// A conversion such as int(d) calls the type by name
+		if !p.peekTokenIs(lexer.LPAREN) {
+			p.recordSyntaxError(fmt.Sprintf("unexpected type %s in expression; convert with %s(value)", p.curToken.Literal, p.curToken.Literal))
+			p.synchronize()
+			return nil
+		}
+		expr = p.parseIdentifier()
 	default:
-		p.synchronize()
 		p.recordParserStateError(fmt.Sprintf("unexpected token %s in expression", p.curToken.Type))
+		p.synchronize()
 		return nil
 	}
 
@@ -893,6 +1336,19 @@ func (p *parser) parsePrimary() ast.Expression {
 						continue
 					}
 				}
+				// mod.Type{...} for a struct declared in an imported module
+				if member, ok := expr.(*ast.MemberExpression); ok {
+					if module, ok := member.Object.(*ast.Identifier); ok && p.looksLikeStructLiteral() {
+						if lit, ok := p.parseStructLiteral(member.Property.Name).(*ast.StructLiteral); ok {
+							lit.Module = module
+							lit.Type.Position = member.Property.Position
+							lit.Position = module.Position
+							expr = lit
+							continue
+						}
+						return nil
+					}
+				}
 			}
 			// Not a struct literal; leave for statement/block parser.
 			return expr
@@ -904,6 +1360,30 @@ func (p *parser) parsePrimary() ast.Expression {
 	}
 }
 
+// parseChanLiteral handles: "chan" "[" Type "]" "(" [ Expression ] ")"
+func (p *parser) parseChanLiteral() ast.Expression {
+	startPos := p.currentPosition()
+	elemType := p.parseChanType()
+	if elemType == nil {
+		return nil
+	}
+	if !p.curTokenIs(lexer.LPAREN) {
+		p.recordSyntaxError("expected '(' after channel type; create channels with chan[T]() or chan[T](capacity)")
+		return nil
+	}
+	p.nextToken() // consume '('
+
+	lit := &ast.ChanLiteral{ElemType: elemType.ChanType, Position: startPos}
+	if !p.curTokenIs(lexer.RPAREN) {
+		lit.Capacity = p.parseExpression()
+	}
+	if !p.expectCurrent(lexer.RPAREN) {
+		return nil
+	}
+	lit.EndPosition = p.endPosition()
+	return lit
+}
+
 // looksLikeStructLiteral peeks inside a '{' to detect 'IDENT :'
 func (p *parser) looksLikeStructLiteral() bool {
 	// We are currently on '{'. The first token after '{' is parser.peekToken.
@@ -913,10 +1393,23 @@ func (p *parser) looksLikeStructLiteral() bool {
 		// Empty literal: Type{}
 		return true
 	}
-	second := p.lexer.PeekTokenN(1)
+	second := p.peekLexerToken(1)
 	return first.Type == lexer.IDENT && second.Type == lexer.COLON
 }
 
+// peekLexerToken returns the n-th upcoming non-comment token after peekToken
+// without consuming any input
+func (p *parser) peekLexerToken(n int) lexer.Token {
+	var tok lexer.Token
+	for i := 1; n > 0; i++ {
+		tok = p.lexer.PeekTokenN(i)
+		if tok.Type != lexer.COMMENT {
+			n--
+		}
+	}
+	return tok
+}
+
 // parseIdentifier handles identifiers
 func (p *parser) parseIdentifier() ast.Expression {
 	name := p.curToken.Literal
@@ -924,8 +1417,9 @@ func (p *parser) parseIdentifier() ast.Expression {
 	p.nextToken() // consume identifier
 
 	return &ast.Identifier{
-		Name:     name,
-		Position: pos,
+		Name:        name,
+		Position:    pos,
+		EndPosition: p.endPosition(),
 	}
 }
 
@@ -937,15 +1431,17 @@ func (p *parser) parseStructLiteral(typeName string) ast.Expression {
 	if !p.curTokenIs(lexer.LBRACE) {
 		// This should never happen, but if it does, return an identifier instead
 		return &ast.Identifier{
-			Name:     typeName,
-			Position: startPos,
+			Name:        typeName,
+			Position:    startPos,
+			EndPosition: p.endPosition(),
 		}
 	}
 
 	structLit := &ast.StructLiteral{
 		Type: &ast.Identifier{
-			Name:     typeName,
-			Position: startPos,
+			Name:        typeName,
+			Position:    startPos,
+			EndPosition: p.endPosition(),
 		},
 		Position: startPos,
 	}
@@ -953,6 +1449,7 @@ func (p *parser) parseStructLiteral(typeName string) ast.Expression {
 
 	if p.curTokenIs(lexer.RBRACE) {
 		p.nextToken() // consume "}"
+		structLit.EndPosition = p.endPosition()
 		return structLit
 	}
 
@@ -973,6 +1470,7 @@ func (p *parser) parseStructLiteral(typeName string) ast.Expression {
 	if !p.expectCurrent(lexer.RBRACE) {
 		return nil
 	}
+	structLit.EndPosition = p.endPosition()
 
 	return structLit
 }
@@ -987,8 +1485,9 @@ func (p *parser) parseFieldInit() *ast.FieldInit {
 
 	field := &ast.FieldInit{
 		Name: &ast.Identifier{
-			Name:     p.curToken.Literal,
-			Position: p.currentPosition(),
+			Name:        p.curToken.Literal,
+			Position:    p.currentPosition(),
+			EndPosition: tokenEnd(p.curToken),
 		},
 		Position: p.currentPosition(),
 	}
@@ -1005,6 +1504,7 @@ func (p *parser) parseFieldInit() *ast.FieldInit {
 	}
 
 	field.Value = p.parseExpression()
+	field.EndPosition = p.endPosition()
 	return field
 }
 
@@ -1028,10 +1528,11 @@ func (p *parser) parseIndexOrSliceExpression(object ast.Expression) ast.Expressi
 
 		// Create SliceExpression with nil start
 		return &ast.SliceExpression{
-			Object:   object,
-			Start:    nil,
-			End:      endExpr,
-			Position: startPos,
+			Object:      object,
+			Start:       nil,
+			End:         endExpr,
+			Position:    startPos,
+			EndPosition: p.endPosition(),
 		}
 	}
 
@@ -1053,10 +1554,11 @@ func (p *parser) parseIndexOrSliceExpression(object ast.Expression) ast.Expressi
 
 		// Create SliceExpression
 		return &ast.SliceExpression{
-			Object:   object,
-			Start:    startExpr,
-			End:      endExpr,
-			Position: startPos,
+			Object:      object,
+			Start:       startExpr,
+			End:         endExpr,
+			Position:    startPos,
+			EndPosition: p.endPosition(),
 		}
 	}
 
@@ -1068,45 +1570,100 @@ func (p *parser) parseIndexOrSliceExpression(object ast.Expression) ast.Expressi
 	p.nextToken() // consume ']'
 
 	return &ast.IndexExpression{
-		Object:   object,
-		Index:    startExpr,
-		Position: startPos,
+		Object:      object,
+		Index:       startExpr,
+		Position:    startPos,
+		EndPosition: p.endPosition(),
 	}
 }
 
 func (p *parser) parseNumberLiteral() ast.Expression {
+	literal := strings.ReplaceAll(p.curToken.Literal, "_", "")
+
+	// 0x, 0b and 0o prefixes only introduce ints
+	if len(literal) > 1 && literal[0] == '0' && strings.ContainsRune("xXbBoO", rune(literal[1])) {
+		intVal, err := strconv.ParseInt(literal, 0, 64)
+		if isRangeError(err) {
+			return p.parseBigLiteral(literal)
+		}
+		if err != nil {
+			p.recordSyntaxError(fmt.Sprintf("invalid number literal %s", p.curToken.Literal))
+			p.synchronize()
+			return nil
+		}
+		lit := &ast.Literal{
+			Token:       p.curToken.Literal,
+			Value:       int(intVal),
+			Position:    p.currentPosition(),
+			EndPosition: tokenEnd(p.curToken),
+		}
+		p.nextToken()
+		return lit
+	}
+
 	// First try to parse as an integer
-	if intVal, err := strconv.ParseInt(p.curToken.Literal, 10, 64); err == nil {
+	intVal, err := strconv.ParseInt(literal, 10, 64)
+	if err == nil {
 		lit := &ast.Literal{
-			Token:    p.curToken.Literal,
-			Value:    int(intVal), // Convert to int to match the type checker's expectations
-			Position: p.currentPosition(),
+			Token:       p.curToken.Literal,
+			Value:       int(intVal), // Convert to int to match the type checker's expectations
+			Position:    p.currentPosition(),
+			EndPosition: tokenEnd(p.curToken),
 		}
 		p.nextToken()
 		return lit
 	}
+	if isRangeError(err) {
+		return p.parseBigLiteral(literal)
+	}
 
 	// If integer parsing fails, try as float
-	val, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	val, err := strconv.ParseFloat(literal, 64)
 	if err != nil {
 		p.recordSyntaxError("failed to parse number: " + err.Error())
 		p.synchronize()
 		return nil
 	}
 	lit := &ast.Literal{
-		Token:    p.curToken.Literal,
-		Value:    val,
-		Position: p.currentPosition(),
+		Token:       p.curToken.Literal,
+		Value:       val,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
+	}
+	p.nextToken()
+	return lit
+}
+
+// parseBigLiteral parses an integer literal too large for int as a bigint
+func (p *parser) parseBigLiteral(literal string) ast.Expression {
+	value, ok := new(big.Int).SetString(literal, 0)
+	if !ok {
+		p.recordSyntaxError(fmt.Sprintf("invalid number literal %s", p.curToken.Literal))
+		p.synchronize()
+		return nil
+	}
+	lit := &ast.Literal{
+		Token:       p.curToken.Literal,
+		Value:       value,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
 	}
 	p.nextToken()
 	return lit
 }
 
+// isRangeError reports whether err is strconv's error for a value out of range
+func isRangeError(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
+
 func (p *parser) parseStringLiteral() ast.Expression {
 	lit := &ast.Literal{
-		Token:    p.curToken.Literal,
-		Value:    p.curToken.Literal,
-		Position: p.currentPosition(),
+		Token:       p.curToken.Literal,
+		Value:       p.curToken.Literal,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
 	}
 	p.nextToken()
 	return lit
@@ -1114,9 +1671,10 @@ func (p *parser) parseStringLiteral() ast.Expression {
 
 func (p *parser) parseBooleanLiteral() ast.Expression {
 	lit := &ast.Literal{
-		Token:    p.curToken.Literal,
-		Value:    p.curToken.Type == lexer.TRUE,
-		Position: p.currentPosition(),
+		Token:       p.curToken.Literal,
+		Value:       p.curToken.Type == lexer.TRUE,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
 	}
 	p.nextToken()
 	return lit
@@ -1124,9 +1682,10 @@ func (p *parser) parseBooleanLiteral() ast.Expression {
 
 func (p *parser) parseNilLiteral() ast.Expression {
 	lit := &ast.Literal{
-		Token:    p.curToken.Literal,
-		Value:    nil,
-		Position: p.currentPosition(),
+		Token:       p.curToken.Literal,
+		Value:       nil,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
 	}
 	p.nextToken()
 	return lit
@@ -1141,6 +1700,7 @@ func (p *parser) parseArrayLiteral() ast.Expression {
 
 	if p.curTokenIs(lexer.RBRACKET) {
 		p.nextToken() // consume ]
+		array.EndPosition = p.endPosition()
 		return array
 	}
 
@@ -1153,6 +1713,7 @@ func (p *parser) parseArrayLiteral() ast.Expression {
 	if !p.expectCurrent(lexer.RBRACKET) {
 		return nil
 	}
+	array.EndPosition = p.endPosition()
 
 	return array
 }
@@ -1167,6 +1728,7 @@ func (p *parser) parseCallExpression(function ast.Expression) ast.Expression {
 
 	if p.curTokenIs(lexer.RPAREN) {
 		p.nextToken() // consume )
+		call.EndPosition = p.endPosition()
 		return call
 	}
 
@@ -1180,6 +1742,7 @@ func (p *parser) parseCallExpression(function ast.Expression) ast.Expression {
 	if !p.expectCurrent(lexer.RPAREN) {
 		return nil
 	}
+	call.EndPosition = p.endPosition()
 
 	return call
 }
@@ -1197,6 +1760,7 @@ func (p *parser) parseIndexExpression(array ast.Expression) ast.Expression {
 	if !p.expectCurrent(lexer.RBRACKET) {
 		return nil
 	}
+	index.EndPosition = p.endPosition()
 
 	return index
 }
@@ -1212,15 +1776,17 @@ func (p *parser) parseMemberExpression(object ast.Expression) ast.Expression {
 
 	// Safe parsing without dangerous type assertion
 	property := &ast.Identifier{
-		Name:     p.curToken.Literal,
-		Position: p.currentPosition(),
+		Name:        p.curToken.Literal,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
 	}
 	p.nextToken() // consume identifier
 
 	return &ast.MemberExpression{
-		Object:   object,
-		Property: property,
-		Position: startPos,
+		Object:      object,
+		Property:    property,
+		Position:    startPos,
+		EndPosition: p.endPosition(),
 	}
 }
 
@@ -1233,12 +1799,6 @@ func (p *parser) parseStatement() ast.Statement {
 		return nil
 	}
 
-	// Skip comments
-	if p.curTokenIs(lexer.COMMENT) {
-		p.nextToken()             // consume comment
-		return p.parseStatement() // recursively parse the next statement
-	}
-
 	switch p.curToken.Type {
 	case lexer.IF:
 		return p.parseIfStatement()
@@ -1254,6 +1814,26 @@ func (p *parser) parseStatement() ast.Statement {
 		return p.parseBreakStatement()
 	case lexer.CONTINUE:
 		return p.parseContinueStatement()
+	case lexer.SPAWN:
+		return p.parseSpawnStatement()
+	case lexer.SELECT:
+		return p.parseSelectStatement()
+	case lexer.CONST:
+		if decl := p.parseConstDeclaration(); decl != nil {
+			return decl.(ast.Statement)
+		}
+		return nil
+	case lexer.TYPE:
+		p.recordSyntaxError("type declarations are only allowed at top level")
+		p.nextToken()
+		p.synchronize()
+		return nil
+	case lexer.PUB:
+		// Local declarations are never visible outside their module;
+		// report 'pub' and parse the rest of the statement
+		p.recordSyntaxError("'pub' is only allowed on top-level declarations")
+		p.nextToken()
+		return p.parseStatement()
 	case lexer.MUT, lexer.IDENT:
 		// Check if this is a variable declaration
 		if p.curTokenIs(lexer.MUT) || (p.curTokenIs(lexer.IDENT) && (p.peekTokenIs(lexer.COLON) || p.peekTokenIs(lexer.COLONEQ))) {
@@ -1286,18 +1866,21 @@ func (p *parser) parseBlockStatement() *ast.BlockStatement {
 		if p.curTokenIs(lexer.RBRACE) || p.curTokenIs(lexer.EOF) {
 			break
 		}
+		start := p.curToken
+		leading, blank := p.leadingComments()
 		stmt := p.parseStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
-		} else {
-			// If parsing fails, advance token to prevent infinite loop
-			p.nextToken()
+			p.attachComments(stmt, leading, blank)
 		}
+		p.recoverStatement(start, stmt == nil)
 	}
 
+	p.attachDangling(block, p.takeCommentsBefore(p.curToken))
 	if !p.expectCurrent(lexer.RBRACE) {
 		return nil
 	}
+	block.EndPosition = p.endPosition()
 
 	return block
 }
@@ -1323,16 +1906,19 @@ func (p *parser) parseIfStatement() ast.Statement {
 		p.nextToken() // consume 'else'
 		if p.curTokenIs(lexer.IF) {
 			// else if - parse as another if statement
+			elseIfPos := p.currentPosition()
 			elseIf := p.parseIfStatement()
 			stmt.Alternative = &ast.BlockStatement{
-				Statements: []ast.Statement{elseIf},
-				Position:   p.currentPosition(),
+				Statements:  []ast.Statement{elseIf},
+				Position:    elseIfPos,
+				EndPosition: p.endPosition(),
 			}
 		} else {
 			// else block
 			stmt.Alternative = p.parseBlockStatement()
 		}
 	}
+	stmt.EndPosition = p.endPosition()
 
 	return stmt
 }
@@ -1390,6 +1976,7 @@ func (p *parser) parseForStatement() ast.Statement {
 		return nil
 	}
 	stmt.Body = p.parseBlockStatement()
+	stmt.EndPosition = p.endPosition()
 	return stmt
 }
 
@@ -1408,9 +1995,120 @@ func (p *parser) parseWhileStatement() ast.Statement {
 		return nil
 	}
 	stmt.Body = p.parseBlockStatement()
+	stmt.EndPosition = p.endPosition()
+	return stmt
+}
+
+// parseSpawnStatement handles: "spawn" Call [ ";" ]
+func (p *parser) parseSpawnStatement() ast.Statement {
+	startPos := p.currentPosition()
+	p.nextToken() // consume 'spawn'
+
+	expr := p.parseExpression()
+	if expr == nil {
+		return nil
+	}
+	call, ok := expr.(*ast.FunctionCall)
+	if !ok {
+		p.recordSyntaxErrorSpan(ast.Start(expr), expr.EndPos(), fmt.Sprintf("spawn requires a function call, got %s", expr.String()))
+		return nil
+	}
+
+	if p.curTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+	return &ast.SpawnStatement{Call: call, Position: startPos, EndPosition: p.endPosition()}
+}
+
+// parseSelectStatement handles:
+//
+//	"select" "{" { "case" [ IDENT ":=" ] ( "recv" "(" Expr ")" | "send" "(" Expr "," Expr ")" ) Block } [ "default" Block ] "}"
+func (p *parser) parseSelectStatement() ast.Statement {
+	stmt := &ast.SelectStatement{Position: p.currentPosition()}
+	p.nextToken() // consume 'select'
+	if !p.expectCurrent(lexer.LBRACE) {
+		return nil
+	}
+
+	for !p.curTokenIs(lexer.RBRACE) && !p.isAtEnd() {
+		switch p.curToken.Type {
+		case lexer.CASE:
+			c := p.parseSelectCase()
+			if c == nil {
+				return nil
+			}
+			stmt.Cases = append(stmt.Cases, c)
+		case lexer.DEFAULT:
+			if stmt.Default != nil {
+				p.recordControlFlowError("select has more than one default case")
+				return nil
+			}
+			p.nextToken() // consume 'default'
+			if stmt.Default = p.parseBlockStatement(); stmt.Default == nil {
+				return nil
+			}
+		default:
+			p.recordControlFlowError(fmt.Sprintf("expected 'case' or 'default' in select, got %s", p.curToken.Type))
+			p.synchronize()
+			return nil
+		}
+	}
+	if !p.expectCurrent(lexer.RBRACE) {
+		return nil
+	}
+	if len(stmt.Cases) == 0 && stmt.Default == nil {
+		p.recordControlFlowError("select needs at least one case")
+	}
+	stmt.EndPosition = p.endPosition()
 	return stmt
 }
 
+func (p *parser) parseSelectCase() *ast.SelectCase {
+	c := &ast.SelectCase{Position: p.currentPosition()}
+	p.nextToken() // consume 'case'
+
+	if p.curTokenIs(lexer.IDENT) && p.peekTokenIs(lexer.COLONEQ) {
+		c.Name = &ast.Identifier{Name: p.curToken.Literal, Position: p.currentPosition(), EndPosition: tokenEnd(p.curToken)}
+		p.nextToken() // consume name
+		p.nextToken() // consume ':='
+	}
+
+	expr := p.parseExpression()
+	call, ok := expr.(*ast.FunctionCall)
+	var op string
+	if ok {
+		if ident, isIdent := call.Function.(*ast.Identifier); isIdent {
+			op = ident.Name
+		}
+	}
+	switch {
+	case op == "recv" && len(call.Arguments) == 1:
+		c.Channel = call.Arguments[0]
+	case op == "send" && len(call.Arguments) == 2 && c.Name == nil:
+		c.Send = true
+		c.Channel, c.Value = call.Arguments[0], call.Arguments[1]
+	default:
+		message := "select cases must be recv(ch), name := recv(ch), or send(ch, value)"
+		if expr == nil {
+			p.recordControlFlowError(message)
+			return nil
+		}
+		start, end := ast.Start(expr), expr.EndPos()
+		p.report(errors.NewControlFlowError(message, start.Line, start.Column).WithEnd(end.Line, end.Column))
+		return nil
+	}
+
+	if !p.curTokenIs(lexer.LBRACE) {
+		p.recordControlFlowError("expected '{' after select case")
+		return nil
+	}
+	if c.Body = p.parseBlockStatement(); c.Body == nil {
+		return nil
+	}
+	c.EndPosition = p.endPosition()
+	return c
+}
+
 // parseForInit handles the init part of a for loop
 // It can be a variable declaration or an expression
 func (p *parser) parseForInit() ast.Statement {
@@ -1448,8 +2146,9 @@ func (p *parser) parseVariableDeclarationForLoop() ast.Declaration {
 		return nil
 	}
 	varDecl.Name = &ast.Identifier{
-		Name:     p.curToken.Literal,
-		Position: p.currentPosition(),
+		Name:        p.curToken.Literal,
+		Position:    p.currentPosition(),
+		EndPosition: tokenEnd(p.curToken),
 	}
 	p.nextToken() // consume variable name
 
@@ -1468,6 +2167,7 @@ func (p *parser) parseVariableDeclarationForLoop() ast.Declaration {
 		varDecl.Value = p.parseExpression()
 
 		// Infer type from value
+		varDecl.Inferred = true
 		if varDecl.Value != nil {
 			varDecl.Type = p.inferTypeFromExpression(varDecl.Value)
 		}
@@ -1477,6 +2177,7 @@ func (p *parser) parseVariableDeclarationForLoop() ast.Declaration {
 	}
 
 	// Don't consume semicolon - it's part of the for loop syntax
+	varDecl.EndPosition = p.endPosition()
 	return varDecl
 }
 
@@ -1503,6 +2204,7 @@ func (p *parser) parseReturnStatement() ast.Statement {
 		p.nextToken()
 	}
 
+	stmt.EndPosition = p.endPosition()
 	return stmt
 }
 
@@ -1527,6 +2229,7 @@ func (p *parser) parsePrintStatement() ast.Statement {
 		p.nextToken()
 	}
 
+	stmt.EndPosition = p.endPosition()
 	return stmt
 }
 
@@ -1537,7 +2240,8 @@ func (p *parser) parseBreakStatement() ast.Statement {
 		p.nextToken()
 	}
 	return &ast.BreakStatement{
-		Position: startPos,
+		Position:    startPos,
+		EndPosition: p.endPosition(),
 	}
 }
 
@@ -1548,7 +2252,8 @@ func (p *parser) parseContinueStatement() ast.Statement {
 		p.nextToken()
 	}
 	return &ast.ContinueStatement{
-		Position: startPos,
+		Position:    startPos,
+		EndPosition: p.endPosition(),
 	}
 }
 
@@ -1576,19 +2281,32 @@ func (p *parser) parseExpressionStatement() ast.Statement {
 		// Check if leftExpr is an IndexExpression (array assignment)
 		if indexExpr, ok := leftExpr.(*ast.IndexExpression); ok {
 			return &ast.IndexAssignmentStatement{
-				Object:   indexExpr.Object,
-				Index:    indexExpr.Index,
-				Value:    rightExpr,
-				Position: startPos,
+				Object:      indexExpr.Object,
+				Index:       indexExpr.Index,
+				Value:       rightExpr,
+				Position:    startPos,
+				EndPosition: p.endPosition(),
+			}
+		}
+
+		// Check if leftExpr is a MemberExpression (field assignment)
+		if member, ok := leftExpr.(*ast.MemberExpression); ok {
+			return &ast.FieldAssignmentStatement{
+				Object:      member.Object,
+				Field:       member.Property,
+				Value:       rightExpr,
+				Position:    startPos,
+				EndPosition: p.endPosition(),
 			}
 		}
 
 		// Check if leftExpr is an Identifier (regular assignment)
 		if ident, ok := leftExpr.(*ast.Identifier); ok {
 			return &ast.AssignmentStatement{
-				Name:     ident,
-				Value:    rightExpr,
-				Position: startPos,
+				Name:        ident,
+				Value:       rightExpr,
+				Position:    startPos,
+				EndPosition: p.endPosition(),
 			}
 		}
 
@@ -1606,6 +2324,7 @@ func (p *parser) parseExpressionStatement() ast.Statement {
 		p.nextToken()
 	}
 
+	stmt.EndPosition = p.endPosition()
 	return stmt
 }
 
@@ -1618,6 +2337,8 @@ func (p *parser) inferTypeFromExpression(expr ast.Expression) *ast.Type {
 			return ast.NewBaseType("int")
 		case float64:
 			return ast.NewBaseType("float")
+		case *big.Int:
+			return ast.NewBaseType("bigint")
 		case string:
 			return ast.NewBaseType("string")
 		case bool:
@@ -1632,6 +2353,8 @@ func (p *parser) inferTypeFromExpression(expr ast.Expression) *ast.Type {
 	case *ast.FunctionCall:
 		// For function calls, we can't infer the return type at parse time
 		return ast.NewBaseType("unknown")
+	case *ast.ChanLiteral:
+		return &ast.Type{ChanType: e.ElemType, Position: e.Position}
 	case *ast.BinaryExpression:
 		// For binary expressions, infer based on operands
 		leftType := p.inferTypeFromExpression(e.Left)
@@ -1684,13 +2407,8 @@ func (p *parser) expectPeek(t lexer.TokenType) bool {
 		return true
 	}
 
-	// Add source line context to the error
-	sourceLine := p.getSourceLine(p.peekToken.Line)
-	err := errors.NewUnexpectedTokenError(t.String(), p.peekToken.Type.String(), p.peekToken.Line, p.peekToken.Column)
-	if sourceLine != "" {
-		err = err.WithSourceLine(sourceLine)
-	}
-	p.errors.Add(err)
+	p.unexpected(t, p.peekToken, p.curToken)
+	p.nextToken()
 	p.synchronize()
 	return false
 }
@@ -1701,33 +2419,79 @@ func (p *parser) expectCurrent(t lexer.TokenType) bool {
 		return true
 	}
 
-	// Add source line context to the error
-	sourceLine := p.getSourceLine(p.curToken.Line)
-	err := errors.NewUnexpectedTokenError(t.String(), p.curToken.Type.String(), p.curToken.Line, p.curToken.Column)
-	if sourceLine != "" {
-		err = err.WithSourceLine(sourceLine)
-	}
-	p.errors.Add(err)
+	p.unexpected(t, p.curToken, p.prevToken)
 	p.synchronize()
 	return false
 }
 
+// unexpected reports that the parser wanted a token of type t after
+// before and found got. A token missing at the end of a line is reported
+// just past before rather than at the start of the next line.
+func (p *parser) unexpected(t lexer.TokenType, got, before lexer.Token) {
+	if before.EndLine > 0 && got.Line > before.EndLine {
+		end := tokenEnd(before)
+		p.report(errors.NewUnexpectedTokenError(t.String(), got.Type.String(), end.Line, end.Column))
+		return
+	}
+	p.reportAt(errors.NewUnexpectedTokenError(t.String(), got.Type.String(), got.Line, got.Column), got)
+}
+
+// synchronize skips the rest of the statement an error is in, so that
+// parsing resumes at the next one: past a ';' or a '}' that closes a
+// block the skipped code opened, or before a '}' that closes an enclosing
+// block or a keyword that starts a statement. It does nothing if the
+// parser has already skipped ahead since the error.
 func (p *parser) synchronize() {
-	p.nextToken()
+	if p.synced {
+		return
+	}
+	p.synced = true
 
+	depth := 0
 	for !p.isAtEnd() {
-		if p.curTokenIs(lexer.SEMICOLON) {
-			p.nextToken()
-			return
-		}
-
 		switch p.curToken.Type {
+		case lexer.SEMICOLON:
+			if depth == 0 {
+				p.nextToken()
+				return
+			}
+		case lexer.LBRACE:
+			depth++
+		case lexer.RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+			if depth == 0 {
+				p.nextToken()
+				return
+			}
 		case lexer.FUNC, lexer.MUT, lexer.STRUCT, lexer.ENUM, lexer.TYPE,
-			lexer.RBRACE, lexer.RBRACKET, lexer.FOR, lexer.IF,
-			lexer.RETURN, lexer.UNSAFE:
-			return
+			lexer.FOR, lexer.WHILE, lexer.IF, lexer.RETURN, lexer.LOG,
+			lexer.BREAK, lexer.CONTINUE, lexer.UNSAFE, lexer.IMPORT, lexer.PUB,
+			lexer.SPAWN, lexer.SELECT, lexer.CONST:
+			if depth == 0 {
+				return
+			}
 		}
 
 		p.nextToken()
 	}
 }
+
+// recoverStatement ends recovery from an error in the statement or
+// declaration that began at start: if it failed to parse, the rest of it
+// is skipped, and errors are reported again from the next one. The parser
+// always moves past start, so that a statement that cannot begin there
+// is not parsed again forever.
+func (p *parser) recoverStatement(start lexer.Token, failed bool) {
+	if p.panicking {
+		if failed {
+			p.synchronize()
+		}
+		p.panicking = false
+	}
+	if p.curToken == start && !p.isAtEnd() {
+		p.nextToken()
+	}
+}
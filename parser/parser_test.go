@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"mars/ast"
 	"mars/lexer"
+	"math/big"
+	"strings"
 	"testing"
 )
 
@@ -399,6 +401,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"x := 3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))", // Arithmetic before equality
 		},
+		{
+			"x := a | b & c ^ d",
+			"((a | (b & c)) ^ d)", // & binds like *, | and ^ like +
+		},
+		{
+			"x := a + b << 2",
+			"(a + (b << 2))", // Shifts bind like *
+		},
+		{
+			"x := a & 1 == 0",
+			"((a & 1) == 0)", // Bitwise operators bind tighter than comparisons
+		},
+		{
+			"x := ^a & b",
+			"((^a) & b)", // Unary complement binds tighter than binary
+		},
 		{
 			"x := true",
 			"true", // Simple literal
@@ -1168,13 +1186,13 @@ func TestParserErrorsCorrected(t *testing.T) {
 		{
 			input:       `func add(a : int, b : int) int { return a + b; }`,
 			shouldError: true,
-			errorCount:  2, // Missing -> and unexpected RBRACE
+			errorCount:  1, // Missing '{': the return type needs ->
 			description: "function missing -> in return type",
 		},
 		{
 			input:       `func test(x : int { return x; }`,
 			shouldError: true,
-			errorCount:  2, // Missing ) and unexpected RBRACE
+			errorCount:  1, // Missing ); the body is skipped, not reported again
 			description: "function missing closing parenthesis",
 		},
 		{
@@ -1192,7 +1210,7 @@ func TestParserErrorsCorrected(t *testing.T) {
 		{
 			input:       `p := Point{x: 1, y:};`,
 			shouldError: true,
-			errorCount:  3, // EOF in expression + missing RBRACE
+			errorCount:  1, // RBRACE in expression; the missing value is not reported again
 			description: "parser state error: unexpected token '}' in expression (context: current token: '}', peek token: ';')",
 		},
 	}
@@ -1736,3 +1754,658 @@ func TestVarKeywordDebug(t *testing.T) {
 		}
 	}
 }
+
+func TestCommentAttachment(t *testing.T) {
+	input := `// header
+x := 1; // trailing
+
+/* doc */
+func f() {
+	// leading
+	log(x);
+	// dangling
+}
+mut y := foo(1, /* inline */ 2);
+// end of file`
+
+	p := NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Declarations) != 3 {
+		t.Fatalf("expected 3 declarations, got %d", len(program.Declarations))
+	}
+
+	x := program.Comments.Get(program.Declarations[0])
+	if x == nil || len(x.Leading) != 1 || x.Leading[0].Text != "// header" {
+		t.Fatalf("expected '// header' leading comment on x, got %+v", x)
+	}
+	if x.Trailing == nil || x.Trailing.Text != "// trailing" {
+		t.Errorf("expected '// trailing' trailing comment on x, got %+v", x.Trailing)
+	}
+
+	fn := program.Declarations[1].(*ast.FuncDecl)
+	fc := program.Comments.Get(fn)
+	if fc == nil || len(fc.Leading) != 1 || fc.Leading[0].Text != "/* doc */" {
+		t.Fatalf("expected '/* doc */' before f, got %+v", fc)
+	}
+	if fc.BlankBefore {
+		t.Errorf("expected f to directly follow its doc comment")
+	}
+	if !fc.Leading[0].BlankBefore {
+		t.Errorf("expected '/* doc */' to be preceded by a blank line")
+	}
+
+	logc := program.Comments.Get(fn.Body.Statements[0])
+	if logc == nil || len(logc.Leading) != 1 || logc.Leading[0].Text != "// leading" {
+		t.Errorf("expected '// leading' on log statement, got %+v", logc)
+	}
+	body := program.Comments.Get(fn.Body)
+	if body == nil || len(body.Dangling) != 1 || body.Dangling[0].Text != "// dangling" {
+		t.Errorf("expected '// dangling' in function body, got %+v", body)
+	}
+
+	// Comments inside expressions no longer break parsing; they move to
+	// the enclosing statement
+	y := program.Comments.Get(program.Declarations[2])
+	if y == nil || y.Trailing == nil || y.Trailing.Text != "/* inline */" {
+		t.Errorf("expected '/* inline */' to trail y, got %+v", y)
+	}
+
+	end := program.Comments.Get(program)
+	if end == nil || len(end.Dangling) != 1 || end.Dangling[0].Text != "// end of file" {
+		t.Errorf("expected '// end of file' dangling on program, got %+v", end)
+	}
+}
+
+func TestInferredVarDecl(t *testing.T) {
+	p := NewParser(lexer.New("a := 1; b : int = 2;"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	a := program.Declarations[0].(*ast.VarDecl)
+	b := program.Declarations[1].(*ast.VarDecl)
+	if !a.Inferred {
+		t.Errorf("expected 'a := 1' to be marked as inferred")
+	}
+	if b.Inferred {
+		t.Errorf("expected 'b : int = 2' not to be marked as inferred")
+	}
+}
+
+func TestImportDeclaration(t *testing.T) {
+	p := NewParser(lexer.New(`import "geometry/vec"; import "util"`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Declarations) != 2 {
+		t.Fatalf("expected 2 declarations, got %d", len(program.Declarations))
+	}
+	tests := []struct {
+		path string
+		name string
+	}{
+		{"geometry/vec", "vec"},
+		{"util", "util"},
+	}
+	for i, tt := range tests {
+		imp, ok := program.Declarations[i].(*ast.ImportDecl)
+		if !ok {
+			t.Fatalf("declaration %d is not *ast.ImportDecl. got=%T", i, program.Declarations[i])
+		}
+		if imp.Path != tt.path || imp.Name != tt.name {
+			t.Errorf("import %d: got path=%q name=%q, want path=%q name=%q", i, imp.Path, imp.Name, tt.path, tt.name)
+		}
+	}
+}
+
+func TestImportDeclarationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{`import vec;`, "expected module path string after 'import'"},
+		{`import "geometry/";`, `invalid module path "geometry/"`},
+		{`import "vec.mars";`, `invalid module path "vec.mars"`},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.GetErrors()
+		if errs == nil || !errs.HasErrors() {
+			t.Errorf("%s: expected a parse error", tt.input)
+			continue
+		}
+		if !strings.Contains(errs.Error(), tt.contains) {
+			t.Errorf("%s: expected error containing %q, got %q", tt.input, tt.contains, errs.Error())
+		}
+	}
+}
+
+func TestPublicDeclarations(t *testing.T) {
+	input := `pub struct Vec { pub x: int; y: int; }
+pub func length(v: Vec) -> int { return v.x; }
+pub mut count := 0;
+func helper() {}`
+	p := NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Declarations) != 4 {
+		t.Fatalf("expected 4 declarations, got %d", len(program.Declarations))
+	}
+	structDecl, ok := program.Declarations[0].(*ast.StructDecl)
+	if !ok || !structDecl.Public {
+		t.Fatalf("expected a public struct, got %s", program.Declarations[0])
+	}
+	if !structDecl.Fields[0].Public || structDecl.Fields[1].Public {
+		t.Errorf("expected only field x to be public, got %s", structDecl)
+	}
+	if fn, ok := program.Declarations[1].(*ast.FuncDecl); !ok || !fn.Public {
+		t.Errorf("expected a public function, got %s", program.Declarations[1])
+	}
+	if v, ok := program.Declarations[2].(*ast.VarDecl); !ok || !v.Public || !v.Mutable {
+		t.Errorf("expected a public mutable variable, got %s", program.Declarations[2])
+	}
+	if fn, ok := program.Declarations[3].(*ast.FuncDecl); !ok || fn.Public {
+		t.Errorf("expected a private function, got %s", program.Declarations[3])
+	}
+}
+
+func TestPublicDeclarationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{`pub import "vec";`, "expected function, struct, type, constant or variable declaration after 'pub'"},
+		{`func f() { pub x := 1; }`, "'pub' is only allowed on top-level declarations"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.GetErrors()
+		if errs == nil || !errs.HasErrors() {
+			t.Errorf("%s: expected a parse error", tt.input)
+			continue
+		}
+		if !strings.Contains(errs.Error(), tt.contains) {
+			t.Errorf("%s: expected error containing %q, got %q", tt.input, tt.contains, errs.Error())
+		}
+	}
+}
+
+func TestQualifiedStructLiteral(t *testing.T) {
+	p := NewParser(lexer.New(`func f(v: vec.Vec) -> vec.Vec { return vec.Vec{x: 1}; }`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Declarations[0].(*ast.FuncDecl)
+	if name := fn.Signature.Parameters[0].Type.StructName; name != "vec.Vec" {
+		t.Errorf("parameter type = %q, want %q", name, "vec.Vec")
+	}
+	ret := fn.Body.Statements[0].(*ast.ReturnStatement)
+	lit, ok := ret.Value.(*ast.StructLiteral)
+	if !ok {
+		t.Fatalf("expected *ast.StructLiteral, got %T", ret.Value)
+	}
+	if lit.Module == nil || lit.Module.Name != "vec" || lit.Type.Name != "Vec" {
+		t.Errorf("expected literal of vec.Vec, got %s", lit)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	input := `func f(jobs: chan[int]) {
+    spawn worker(jobs, 2);
+    c := chan[string](4);
+    select {
+    case v := recv(jobs) { log(v); }
+    case send(c, "x") { }
+    default { }
+    }
+}`
+	p := NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Declarations[0].(*ast.FuncDecl)
+	if param := fn.Signature.Parameters[0].Type; param.ChanType == nil || param.ChanType.BaseType != "int" {
+		t.Errorf("expected parameter of type chan[int], got %s", param)
+	}
+	spawn, ok := fn.Body.Statements[0].(*ast.SpawnStatement)
+	if !ok {
+		t.Fatalf("expected *ast.SpawnStatement, got %T", fn.Body.Statements[0])
+	}
+	if spawn.Call.String() != "worker(jobs, 2)" {
+		t.Errorf("unexpected spawned call %s", spawn.Call)
+	}
+	decl := fn.Body.Statements[1].(*ast.VarDecl)
+	lit, ok := decl.Value.(*ast.ChanLiteral)
+	if !ok {
+		t.Fatalf("expected *ast.ChanLiteral, got %T", decl.Value)
+	}
+	if lit.ElemType.BaseType != "string" || lit.Capacity.String() != "4" {
+		t.Errorf("unexpected channel literal %s", lit)
+	}
+
+	sel, ok := fn.Body.Statements[2].(*ast.SelectStatement)
+	if !ok {
+		t.Fatalf("expected *ast.SelectStatement, got %T", fn.Body.Statements[2])
+	}
+	if len(sel.Cases) != 2 || sel.Default == nil {
+		t.Fatalf("expected 2 cases and a default, got %s", sel)
+	}
+	recv, send := sel.Cases[0], sel.Cases[1]
+	if recv.Send || recv.Name == nil || recv.Name.Name != "v" || recv.Channel.String() != "jobs" {
+		t.Errorf("unexpected receive case %s", recv)
+	}
+	if !send.Send || send.Name != nil || send.Channel.String() != "c" || send.Value.String() != `"x"` {
+		t.Errorf("unexpected send case %s", send)
+	}
+}
+
+func TestConcurrencyErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{`spawn 42;`, "spawn requires a function call"},
+		{`c := chan[int];`, "expected '(' after channel type"},
+		{`select { }`, "select needs at least one case"},
+		{`select { case recv(c) { } default { } default { } }`, "select has more than one default case"},
+		{`select { case len(c) { } }`, "select cases must be recv(ch), name := recv(ch), or send(ch, value)"},
+		{`select { x := 1; }`, "expected 'case' or 'default' in select"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.GetErrors()
+		if errs == nil || !errs.HasErrors() {
+			t.Errorf("%s: expected a parse error", tt.input)
+			continue
+		}
+		if !strings.Contains(errs.Error(), tt.contains) {
+			t.Errorf("%s: expected error containing %q, got %q", tt.input, tt.contains, errs.Error())
+		}
+	}
+}
+
+func TestConstDeclaration(t *testing.T) {
+	input := `pub const N = 4 * 2;
+const SCALE: float = 1.5;
+func f(grid: [N]int) {
+    const LOCAL = "x";
+}`
+	p := NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	n, ok := program.Declarations[0].(*ast.ConstDecl)
+	if !ok || !n.Public || n.Name.Name != "N" || n.Type != nil {
+		t.Fatalf("expected public constant N, got %s", program.Declarations[0])
+	}
+	if n.Value.String() != "(4 * 2)" {
+		t.Errorf("N = %s, want (4 * 2)", n.Value)
+	}
+	scale := program.Declarations[1].(*ast.ConstDecl)
+	if scale.Public || scale.Type == nil || scale.Type.BaseType != "float" {
+		t.Errorf("expected private float constant SCALE, got %s", scale)
+	}
+
+	fn := program.Declarations[2].(*ast.FuncDecl)
+	param := fn.Signature.Parameters[0].Type
+	if !param.IsFixedArray() || param.ArrayLen == nil || param.ArrayLen.Name != "N" || param.ArraySize != nil {
+		t.Errorf("expected parameter of type [N]int, got %s", param)
+	}
+	if _, ok := fn.Body.Statements[0].(*ast.ConstDecl); !ok {
+		t.Errorf("expected a local constant, got %T", fn.Body.Statements[0])
+	}
+}
+
+func TestConstDeclarationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{`const = 1;`, "expected constant name"},
+		{`const N := 1;`, "constants are declared with '=': const N = value;"},
+		{`const N;`, "constant 'N' needs a value: const N = value;"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.GetErrors()
+		if errs == nil || !errs.HasErrors() {
+			t.Errorf("%s: expected a parse error", tt.input)
+			continue
+		}
+		if !strings.Contains(errs.Error(), tt.contains) {
+			t.Errorf("%s: expected error containing %q, got %q", tt.input, tt.contains, errs.Error())
+		}
+	}
+}
+
+func TestTypeDeclaration(t *testing.T) {
+	input := `pub type UserId = int;
+type Meters int;
+type Grid [3]Meters;
+func f(d: Meters) -> int { return int(d); }`
+	p := NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	id, ok := program.Declarations[0].(*ast.TypeDecl)
+	if !ok || !id.Public || !id.Alias || id.Name.Name != "UserId" || id.Type.BaseType != "int" {
+		t.Fatalf("expected public alias UserId = int, got %s", program.Declarations[0])
+	}
+	meters := program.Declarations[1].(*ast.TypeDecl)
+	if meters.Public || meters.Alias || meters.Type.BaseType != "int" {
+		t.Errorf("expected private distinct type Meters, got %s", meters)
+	}
+	grid := program.Declarations[2].(*ast.TypeDecl)
+	if !grid.Type.IsFixedArray() || grid.Type.ArrayType.StructName != "Meters" {
+		t.Errorf("expected Grid to be [3]Meters, got %s", grid.Type)
+	}
+
+	fn := program.Declarations[3].(*ast.FuncDecl)
+	if fn.Signature.Parameters[0].Type.StructName != "Meters" {
+		t.Errorf("expected parameter of type Meters, got %s", fn.Signature.Parameters[0].Type)
+	}
+	ret := fn.Body.Statements[0].(*ast.ReturnStatement)
+	call, ok := ret.Value.(*ast.FunctionCall)
+	if !ok || call.Function.String() != "int" {
+		t.Errorf("expected int(d) to parse as a call, got %s", ret.Value)
+	}
+}
+
+func TestTypeDeclarationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{`type = int;`, "expected type name"},
+		{`type Meters;`, "type 'Meters' needs a type: type Meters int; or type Meters = int;"},
+		{`func f() { type T int; }`, "type declarations are only allowed at top level"},
+		{`x := int;`, "unexpected type int in expression; convert with int(value)"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.GetErrors()
+		if errs == nil || !errs.HasErrors() {
+			t.Errorf("%s: expected a parse error", tt.input)
+			continue
+		}
+		if !strings.Contains(errs.Error(), tt.contains) {
+			t.Errorf("%s: expected error containing %q, got %q", tt.input, tt.contains, errs.Error())
+		}
+	}
+}
+
+func TestIntegerLiteralsAndSizedTypes(t *testing.T) {
+	input := `mask: u32 = 0xFF_00;
+flags: byte = 0b1010;
+perm := 0o755;
+big := 1_000_000;
+func f(xs: []i8) -> u64 { return 0; }`
+	p := NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := []struct {
+		typ   string
+		value int
+	}{
+		{"u32", 0xFF00},
+		{"byte", 10},
+		{"", 0o755},
+		{"", 1000000},
+	}
+	for i, tt := range expected {
+		decl := program.Declarations[i].(*ast.VarDecl)
+		if tt.typ != "" && (decl.Type == nil || decl.Type.BaseType != tt.typ) {
+			t.Errorf("%s: expected type %s, got %s", decl.Name.Name, tt.typ, decl.Type)
+		}
+		lit, ok := decl.Value.(*ast.Literal)
+		if !ok || lit.Value != tt.value {
+			t.Errorf("%s: expected value %d, got %s", decl.Name.Name, tt.value, decl.Value)
+		}
+	}
+
+	fn := program.Declarations[4].(*ast.FuncDecl)
+	if fn.Signature.Parameters[0].Type.ArrayType.BaseType != "i8" || fn.Signature.ReturnType.BaseType != "u64" {
+		t.Errorf("expected func(xs: []i8) -> u64, got %s", fn.Signature)
+	}
+
+	for _, tt := range []struct{ input, contains string }{
+		{`x := 0x;`, "invalid number literal 0x"},
+	} {
+		p := NewParser(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.GetErrors()
+		if errs == nil || !strings.Contains(errs.Error(), tt.contains) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.input, tt.contains, errs)
+		}
+	}
+}
+
+func TestBigIntegerLiterals(t *testing.T) {
+	input := `a := 9223372036854775808;
+b := 0x1_0000_0000_0000_0000;
+c: bigint = 1;`
+	p := NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	for i, expected := range []string{"9223372036854775808", "18446744073709551616"} {
+		decl := program.Declarations[i].(*ast.VarDecl)
+		lit, ok := decl.Value.(*ast.Literal)
+		if !ok {
+			t.Fatalf("%s: expected a literal, got %T", decl.Name.Name, decl.Value)
+		}
+		value, ok := lit.Value.(*big.Int)
+		if !ok || value.String() != expected {
+			t.Errorf("%s: expected bigint %s, got %v", decl.Name.Name, expected, lit.Value)
+		}
+	}
+
+	decl := program.Declarations[2].(*ast.VarDecl)
+	if decl.Type == nil || decl.Type.BaseType != "bigint" {
+		t.Errorf("c: expected type bigint, got %s", decl.Type)
+	}
+}
+
+func TestOptionalTypes(t *testing.T) {
+	input := `x: ?int = nil;
+func find(n: ?[]string) -> ?Point { return nil; }`
+	p := NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	decl := program.Declarations[0].(*ast.VarDecl)
+	if decl.Type == nil || decl.Type.String() != "?int" {
+		t.Errorf("x: expected type ?int, got %s", decl.Type)
+	}
+	fn := program.Declarations[1].(*ast.FuncDecl)
+	if got := fn.Signature.Parameters[0].Type.String(); got != "?[]string" {
+		t.Errorf("n: expected type ?[]string, got %s", got)
+	}
+	if got := fn.Signature.ReturnType.String(); got != "?struct Point" {
+		t.Errorf("find: expected return type ?struct Point, got %s", got)
+	}
+}
+
+func TestFieldAssignmentAndMutableParameters(t *testing.T) {
+	input := `func move(mut p: Point, d: int) { p.pos.x = d; }`
+	p := NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Declarations[0].(*ast.FuncDecl)
+	params := fn.Signature.Parameters
+	if !params[0].Mutable || params[1].Mutable {
+		t.Errorf("expected only p to be mut, got %s", fn.Signature)
+	}
+	stmt, ok := fn.Body.Statements[0].(*ast.FieldAssignmentStatement)
+	if !ok {
+		t.Fatalf("expected a field assignment, got %T", fn.Body.Statements[0])
+	}
+	if stmt.Object.String() != "p.pos" || stmt.Field.Name != "x" || stmt.Value.String() != "d" {
+		t.Errorf("expected p.pos.x = d, got %s", stmt)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	input := `func main() {
+    a := 1 +;
+    b := [1, 2;
+    if a > { log(1); }
+    log(b[0);
+    c := foo(1,, 2);
+    log("ok");
+}
+
+func other() {
+    x := 5 *;
+    return x;
+}`
+	p := NewParserWithSource(lexer.New(input), strings.Split(input, "\n"))
+	program := p.ParseProgram()
+
+	// One error per broken statement, none for the rest of them
+	var lines []int
+	for _, err := range p.GetErrors().Errors() {
+		lines = append(lines, err.Line)
+	}
+	if fmt.Sprint(lines) != "[2 3 4 5 6 11]" {
+		t.Errorf("expected errors on lines [2 3 4 5 6 11], got %v:\n%s", lines, p.GetErrors())
+	}
+
+	// Both functions are parsed, with the statements that parse
+	if len(program.Declarations) != 2 {
+		t.Fatalf("expected 2 declarations, got %d", len(program.Declarations))
+	}
+	for i, expected := range []string{`log("ok");`, "return x;"} {
+		body := program.Declarations[i].(*ast.FuncDecl).Body
+		if last := body.Statements[len(body.Statements)-1]; last.String() != expected {
+			t.Errorf("expected function %d to end with %s, got %s", i, expected, last)
+		}
+	}
+}
+
+func TestCascadingErrorsDropped(t *testing.T) {
+	tests := []struct {
+		input string
+		line  int
+	}{
+		// The skipped body of a function with a broken signature
+		{"func test(x : int { return x; }\nfunc ok() { log(1); }", 1},
+		// Errors after the first on a line
+		{"x := ; y := ;\nz := 1;", 1},
+		// A missing closing brace at the end of the file
+		{"func f() {\n    log(1);\n", 2},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.GetErrors().Errors()
+		if len(errs) != 1 || errs[0].Line != tt.line {
+			t.Errorf("%q: expected one error on line %d, got %d:\n%s", tt.input, tt.line, len(errs), p.GetErrors())
+		}
+	}
+}
+
+func TestErrorSpans(t *testing.T) {
+	tests := []struct {
+		input  string
+		line   int
+		column int
+		end    int // column just past the span; equal to column for a point
+	}{
+		// The unexpected token
+		{`log(1 22);`, 1, 7, 9},
+		{`x := 1 + ;`, 1, 10, 11},
+		// The expression that should be a call
+		{`spawn worker + 1;`, 1, 7, 17},
+		// A token missing at the end of a line, just past the one before
+		{"log(x\nlog(y);", 1, 6, 6},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.GetErrors().Errors()
+		if len(errs) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		err := errs[0]
+		end := err.EndColumn
+		if err.EndLine == 0 {
+			end = err.Column
+		}
+		if err.Line != tt.line || err.Column != tt.column || end != tt.end {
+			t.Errorf("%q: expected span %d:%d-%d, got %d:%d-%d:%d (%s)", tt.input, tt.line, tt.column, tt.end,
+				err.Line, err.Column, err.EndLine, err.EndColumn, err.Message)
+		}
+	}
+}
+
+func TestNodeSpans(t *testing.T) {
+	input := `func f(a: int) -> int {
+    x := a + b[0] * 2;
+    s.f = "héllo";
+    if x > 1 { log(x); } else if x < 0 { return 0; }
+    return -x
+}`
+	lines := strings.Split(input, "\n")
+	p := NewParser(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	// text returns the source from the start of a node to its end
+	text := func(n ast.Node) string {
+		start, end := ast.Start(n), n.EndPos()
+		if start.Line != end.Line {
+			return fmt.Sprintf("lines %d-%d", start.Line, end.Line)
+		}
+		return string([]rune(lines[start.Line-1])[start.Column-1 : end.Column-1])
+	}
+
+	fn := program.Declarations[0].(*ast.FuncDecl)
+	decl := fn.Body.Statements[0].(*ast.VarDecl)
+	sum := decl.Value.(*ast.BinaryExpression)
+	ifStmt := fn.Body.Statements[2].(*ast.IfStatement)
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "lines 1-6"},
+		{fn, "lines 1-6"},
+		{fn.Name, "f"},
+		{decl, "x := a + b[0] * 2;"},
+		{sum, "a + b[0] * 2"},
+		{sum.Right, "b[0] * 2"},
+		{sum.Right.(*ast.BinaryExpression).Left, "b[0]"},
+		{fn.Body.Statements[1], `s.f = "héllo";`},
+		{ifStmt, "if x > 1 { log(x); } else if x < 0 { return 0; }"},
+		{ifStmt.Consequence, "{ log(x); }"},
+		{ifStmt.Alternative, "if x < 0 { return 0; }"},
+		{fn.Body.Statements[3], "return -x"},
+	}
+	for _, tt := range tests {
+		if got := text(tt.node); got != tt.expected {
+			t.Errorf("%T: expected span %q, got %q", tt.node, tt.expected, got)
+		}
+	}
+
+	// Every node parsed has an end after its start
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		start, end := n.Pos(), n.EndPos()
+		if end.Line < start.Line || (end.Line == start.Line && end.Column <= start.Column) {
+			t.Errorf("%T %s: end %v is not after start %v", n, n.TokenLiteral(), end, start)
+		}
+		return true
+	})
+}